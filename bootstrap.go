@@ -0,0 +1,1199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	nethttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wethegamers/agis-core/api"
+	"github.com/wethegamers/agis-core/bot"
+	"github.com/wethegamers/agis-core/bot/commands"
+	"github.com/wethegamers/agis-core/hotconfig"
+	"github.com/wethegamers/agis-core/http"
+	"github.com/wethegamers/agis-core/payment"
+	"github.com/wethegamers/agis-core/services"
+	"github.com/wethegamers/agis-core/version"
+
+	"github.com/wethegamers/agis/deployments/migrations"
+	"github.com/wethegamers/agis/internal/app"
+	"github.com/wethegamers/agis/internal/audit"
+	internalConfig "github.com/wethegamers/agis/internal/config"
+	"github.com/wethegamers/agis/internal/experiments"
+	"github.com/wethegamers/agis/internal/flags"
+	"github.com/wethegamers/agis/internal/gdpr"
+	"github.com/wethegamers/agis/internal/health"
+	internalHotConfig "github.com/wethegamers/agis/internal/hotconfig"
+	"github.com/wethegamers/agis/internal/leader"
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/logging"
+	"github.com/wethegamers/agis/internal/metrics"
+	"github.com/wethegamers/agis/internal/middleware"
+	"github.com/wethegamers/agis/internal/migrate"
+	"github.com/wethegamers/agis/internal/provisioning"
+	"github.com/wethegamers/agis/internal/secrets"
+	"github.com/wethegamers/agis/internal/templates"
+	"github.com/wethegamers/agis/internal/tracing"
+	"github.com/wethegamers/agis/internal/treasury"
+
+	"github.com/bwmarrin/discordgo"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// bootstrap builds the bot's subsystems. Each step registers an
+// app.Service for what it created, declaring the services it depends on;
+// App starts them in dependency order and stops them in reverse, so
+// nothing is stopped before the services that use it.
+//
+// Connections that later steps need to build their services (the
+// database, the Discord session) are opened while building; Start only
+// runs migrations and launches servers and background loops.
+type bootstrap struct {
+	app    *app.App
+	health *health.Checker
+	config *internalConfig.Store
+	flags  *flags.Service
+
+	secrets    *secrets.Manager
+	secretRefs map[string]string // references resolved in the environment, by variable
+
+	kube          kubernetes.Interface
+	db            *services.DatabaseService
+	session       *discordgo.Session
+	hotCfg        *hotconfig.Manager
+	games         *internalHotConfig.Source // reloaded by flags-watch
+	ledger        *ledger.Ledger
+	audit         *audit.Log
+	logging       *services.LoggingService
+	adConversions *services.AdConversionService
+}
+
+// build runs every startup step. Services registered before a failing step
+// are left for the caller to stop.
+func (b *bootstrap) build() error {
+	if err := b.initConfig(); err != nil {
+		return err
+	}
+	b.initFlags()
+	b.initProbes()
+	b.initTracing()
+	b.initHotConfig()
+	b.initErrorMonitor()
+
+	if err := b.initDatabase(); err != nil {
+		return err
+	}
+	b.initFlagExposures()
+	if err := b.initDiscord(); err != nil {
+		return err
+	}
+	b.initServices()
+	b.initPayments()
+	b.initCommands()
+	b.initCleanup()
+	b.initGDPR()
+	b.initScheduler()
+	b.initGuildServers()
+	b.wireDashboards()
+	b.openDiscord()
+	b.watchSecrets()
+	b.initHTTPServer()
+	b.initAPIServer()
+	return nil
+}
+
+// initSecrets resolves secret references in the environment and .env, so
+// DISCORD_TOKEN, DB_PASSWORD or STRIPE_SECRET_KEY can name a secret
+// (file:///run/secrets/db, vault://secret/production/agis-bot#DB_PASSWORD,
+// k8s://agis/agis-bot-secrets#DB_PASSWORD) instead of holding it. It runs
+// before the agis-core config reads the environment. Vault is used when
+// VAULT_ADDR is set, logging in with VAULT_TOKEN or, with VAULT_ROLE, the
+// pod's service account. The secrets service renews Vault leases and
+// re-reads other secrets every SECRETS_REFRESH_INTERVAL (default 5m).
+func (b *bootstrap) initSecrets() error {
+	if err := loadDotEnv(".env"); err != nil {
+		return err
+	}
+	m := secrets.NewManager(nil)
+	m.Register("file", secrets.FileResolver{})
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		vault := secrets.NewVaultResolver(addr, os.Getenv("VAULT_TOKEN"))
+		if role := os.Getenv("VAULT_ROLE"); role != "" {
+			vault.SetKubernetesAuth(role, "/var/run/secrets/kubernetes.io/serviceaccount/token")
+		}
+		m.Register("vault", vault)
+	}
+	if b.kube != nil {
+		m.Register("k8s", secrets.NewKubernetesResolver(b.kube))
+	}
+	m.SetRefreshInterval(envDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	refs, err := m.ResolveEnv(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve secret references: %w", err)
+	}
+	b.secrets, b.secretRefs = m, refs
+	b.app.Register(app.NewBackgroundService("secrets", m.Run))
+	if len(refs) > 0 {
+		log.Printf("✅ Resolved %d secret references", len(refs))
+	}
+	return nil
+}
+
+// loadDotEnv sets variables from a .env file that are not already set,
+// as agis-core's config does, so references in it are resolved too.
+func loadDotEnv(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	env, err := internalConfig.ParseEnvFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for key, val := range env {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, val)
+		}
+	}
+	return nil
+}
+
+// exportDatabaseURL copies the parts of DATABASE_URL that agis-core's
+// config reads into DB_HOST, DB_USER, DB_PASSWORD and DB_NAME, leaving
+// any that are already set. agis-core connects with a fixed DSN, so the
+// port, TLS settings and timeouts in the URL only apply to the
+// internal/config consumers; a warning says so.
+func exportDatabaseURL() error {
+	raw := os.Getenv("DATABASE_URL")
+	if raw == "" {
+		return nil
+	}
+	var db internalConfig.DatabaseConfig
+	if err := db.ParseURL(raw); err != nil {
+		return fmt.Errorf("DATABASE_URL: %w", err)
+	}
+	for key, val := range map[string]string{
+		"DB_HOST":     db.Host,
+		"DB_USER":     db.User,
+		"DB_PASSWORD": db.Password,
+		"DB_NAME":     db.Name,
+	} {
+		if _, ok := os.LookupEnv(key); !ok && val != "" {
+			os.Setenv(key, val)
+		}
+	}
+	if (db.Port != 0 && db.Port != 5432) || (db.SSLMode != "" && db.SSLMode != "disable") ||
+		db.StatementTimeout > 0 || db.LockTimeout > 0 {
+		log.Printf("⚠️ DATABASE_URL sets a port, sslmode or options that the core database pool ignores")
+	}
+	return nil
+}
+
+// watchSecrets applies rotated credentials. A new Discord token
+// reconnects the session. agis-core opens its database pool with a fixed
+// DSN and the payment service keeps the Stripe key it was built with, so
+// any other rotated secret restarts the replica instead, after a random
+// delay of up to SECRETS_RESTART_JITTER (default 1m) so replicas do not
+// all restart at once.
+func (b *bootstrap) watchSecrets() {
+	rotated := make(chan string, 1)
+	for key, ref := range b.secretRefs {
+		if key == "DISCORD_TOKEN" {
+			b.secrets.Subscribe(ref, b.rotateDiscordToken)
+			continue
+		}
+		b.secrets.Subscribe(ref, func(string) {
+			select {
+			case rotated <- key:
+			default:
+			}
+		})
+	}
+	if len(b.secretRefs) == 0 {
+		return
+	}
+
+	jitter := envDuration("SECRETS_RESTART_JITTER", time.Minute)
+	restart := app.NewBackgroundService("secret-restart", func(ctx context.Context) error {
+		var key string
+		select {
+		case <-ctx.Done():
+			return nil
+		case key = <-rotated:
+		}
+		delay := time.Duration(0)
+		if jitter > 0 {
+			delay = rand.N(jitter)
+		}
+		log.Printf("🔑 %s rotated - restarting in %s to use the new credentials", key, delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		return fmt.Errorf("%s rotated: restarting to apply it", key)
+	})
+	b.app.Register(restart.WithSupervision(app.Supervision{Policy: app.RestartNever}), app.DependsOn("secrets"))
+}
+
+// rotateDiscordToken reconnects the gateway with a rotated bot token.
+func (b *bootstrap) rotateDiscordToken(token string) {
+	log.Println("🔑 Discord token rotated - reconnecting")
+	if err := b.session.Close(); err != nil {
+		log.Printf("⚠️ Failed to close Discord session: %v", err)
+	}
+	b.session.Lock()
+	b.session.Token = "Bot " + token
+	b.session.Unlock()
+	if err := b.session.Open(); err != nil {
+		log.Printf("⚠️ Failed to reconnect Discord with the rotated token: %v", err)
+	}
+}
+
+// initConfig loads the live-reloadable settings (log level, rate limits,
+// CORS origins, feature flags) from defaults, the CONFIG_FILE (or
+// --config) file, the environment and command-line flags, and makes
+// internal/logging the default logger so level changes apply at once.
+// Settings are reloaded on SIGHUP, when the file changes and through the
+// admin endpoint on the probes port; an invalid change is rejected and
+// the previous settings kept. Invalid settings at startup, such as a
+// wildcard CORS origin in production, stop the bot.
+func (b *bootstrap) initConfig() error {
+	store, err := internalConfig.NewStore(func() (*internalConfig.Config, error) {
+		return internalConfig.LoadFrom(internalConfig.Sources{Args: os.Args[1:], Secrets: b.secrets})
+	})
+	if errors.Is(err, internalConfig.ErrInvalid) {
+		return fmt.Errorf("load live config: %w", err)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to load live config: %v - reload disabled", err)
+		return nil
+	}
+	b.config = store
+
+	logCfg := store.Current().Log
+	logger := logging.New(logging.Config{Level: logCfg.Level, Format: logCfg.Format, AddSource: logCfg.AddSource})
+	logging.SetDefault(logger)
+	store.SetLogger(logger.Logger)
+	store.BindLogLevel(logger)
+
+	b.app.Register(app.NewBackgroundService("config-sighup", store.WatchSignals))
+	path := store.Current().File()
+	if path != "" {
+		b.app.Register(app.NewBackgroundService("config-watch", func(ctx context.Context) error {
+			return store.WatchFile(ctx, path, 5*time.Second)
+		}))
+	}
+	log.Printf("✅ Live config loaded (file: %q)", path)
+	return nil
+}
+
+// initFlags builds the feature flags from the features settings and the
+// features and flags sections of hot-config.yaml. Flags follow settings
+// reloads and the file is re-read every 5 seconds.
+func (b *bootstrap) initFlags() {
+	var hot *internalHotConfig.Source
+	if src, err := internalHotConfig.NewSource(hotConfigPath()); err != nil {
+		log.Printf("⚠️ Feature flags without hot-config: %v", err)
+	} else {
+		hot = src
+	}
+	b.games = hot
+	b.flags = flags.NewService(func() *internalConfig.Config {
+		if b.config == nil {
+			return nil
+		}
+		return b.config.Current()
+	}, hot)
+	if b.config != nil {
+		b.config.Subscribe(internalConfig.SectionFeatures, func(_, _ *internalConfig.Config) { b.flags.Refresh() })
+		b.config.Subscribe(internalConfig.SectionApp, func(_, _ *internalConfig.Config) { b.flags.Refresh() })
+	}
+	if hot != nil {
+		b.app.Register(app.NewBackgroundService("flags-watch", func(ctx context.Context) error {
+			return b.flags.Watch(ctx, 5*time.Second)
+		}))
+	}
+	log.Printf("✅ Feature flags loaded (%d flags)", len(b.flags.Current().Keys()))
+}
+
+// initFlagExposures records exposures to experiment-backed flags in the
+// A/B tables.
+func (b *bootstrap) initFlagExposures() {
+	if b.db.DB() == nil {
+		return
+	}
+	exposures := flags.NewExposureLog(b.db.DB())
+	b.flags.SetExposures(exposures)
+	b.app.Register(app.NewBackgroundService("flag-exposures", exposures.Run), app.DependsOn("migrations"))
+}
+
+// initProbes serves the liveness and readiness probes on HEALTH_PORT
+// (default 8081). Readiness follows the App, so it turns unready as soon
+// as shutdown begins; registered early, the server is stopped after the
+// services built later. With CONFIG_RELOAD_TOKEN set, the port also
+// serves POST /admin/config/reload and GET /admin/flags, which shows how
+// each flag evaluates for ?user_id=&guild_id=&tier=&environment= and why.
+func (b *bootstrap) initProbes() {
+	port := os.Getenv("HEALTH_PORT")
+	if port == "" {
+		port = "8081"
+	}
+	mux := nethttp.NewServeMux()
+	health.NewHandler(b.health, version.Version).RegisterRoutes(mux)
+	if token := os.Getenv("CONFIG_RELOAD_TOKEN"); token != "" && b.config != nil {
+		mux.Handle("POST /admin/config/reload", b.config.Handler(token))
+		mux.Handle("GET /admin/flags", b.flags.Handler(token))
+	}
+	srv := &nethttp.Server{Addr: ":" + port, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	b.app.Register(app.NewServiceFunc("probes", func(context.Context) error {
+		if err := srv.ListenAndServe(); !errors.Is(err, nethttp.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, srv.Shutdown).WithReady(app.DialReady("localhost:" + port)))
+}
+
+// initTracing initializes OpenTelemetry tracing (v1.9.0+).
+// Enable by setting OTEL_EXPORTER_OTLP_ENDPOINT.
+func (b *bootstrap) initTracing() {
+	tracingCfg := tracing.DefaultConfig()
+	tracingCfg.ServiceName = "agis"
+	tracingCfg.Environment = os.Getenv("SENTRY_ENVIRONMENT")
+	if tracingCfg.Environment == "" {
+		tracingCfg.Environment = "development"
+	}
+	tracingCfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	tracingCfg.Enabled = tracingCfg.Endpoint != ""
+
+	tracingProvider, err := tracing.Init(context.Background(), tracingCfg)
+	if err != nil {
+		log.Printf("⚠️ Failed to initialize tracing: %v", err)
+		return
+	}
+	if tracingProvider == nil {
+		return
+	}
+	if tracingCfg.Enabled {
+		log.Printf("✅ OpenTelemetry tracing initialized (endpoint: %s)", tracingCfg.Endpoint)
+	}
+	// Registered first so spans from every other service are flushed.
+	b.app.Register(app.NewServiceFunc("tracing",
+		func(context.Context) error { return nil },
+		tracingProvider.Shutdown,
+	))
+}
+
+// initHotConfig loads hot-reloadable configuration (v1.8.0+) and logs
+// any lint problems in it. The watcher follows ConfigMap-mounted YAML
+// files for changes.
+func (b *bootstrap) initHotConfig() {
+	hotConfigPath := hotConfigPath()
+	if _, err := os.Stat(hotConfigPath); err != nil {
+		log.Printf("⚠️ Hot config file not found at %s - using defaults", hotConfigPath)
+		return
+	}
+	if data, err := os.ReadFile(hotConfigPath); err == nil {
+		// The core manager has no admission hook, so problems are
+		// reported here; `agisctl config lint` gives the same list.
+		for _, p := range internalHotConfig.Lint(data) {
+			log.Printf("⚠️ %s:%s", hotConfigPath, p)
+		}
+	}
+	hotCfg, err := hotconfig.NewManager(hotConfigPath)
+	if err != nil {
+		log.Printf("⚠️ Failed to initialize hot config: %v", err)
+		return
+	}
+	b.hotCfg = hotCfg
+
+	log.Printf("✅ Hot-reloadable config loaded from %s", hotConfigPath)
+	games := hotCfg.GetEnabledGames()
+	log.Printf("   📋 %d games configured: ", len(games))
+	for name := range games {
+		game := games[name]
+		log.Printf("      - %s (%s): %d GC/hour", name, game.Tier, game.BaseCostPerHour)
+	}
+
+	b.app.Register(app.NewServiceFunc("hot-config",
+		func(context.Context) error {
+			// The loaded config stays usable without the watcher.
+			if err := hotCfg.Start(); err != nil {
+				log.Printf("⚠️ Failed to start hot config watcher: %v", err)
+			}
+			return nil
+		},
+		func(context.Context) error {
+			hotCfg.Stop()
+			return nil
+		},
+	))
+}
+
+// hotConfigPath returns HOT_CONFIG_PATH, defaulting to the repository
+// copy when running locally.
+func hotConfigPath() string {
+	if p := os.Getenv("HOT_CONFIG_PATH"); p != "" {
+		return p
+	}
+	return "configs/hot-config.yaml"
+}
+
+// initErrorMonitor initializes error monitoring (Sentry).
+func (b *bootstrap) initErrorMonitor() {
+	sentryEnv := os.Getenv("SENTRY_ENVIRONMENT")
+	if sentryEnv == "" {
+		sentryEnv = "development"
+	}
+	errorMonitor, err := services.NewErrorMonitor(os.Getenv("SENTRY_DSN"), sentryEnv, version.Version)
+	if err != nil {
+		log.Printf("⚠️ Failed to initialize error monitoring: %v", err)
+	}
+	if errorMonitor == nil {
+		return
+	}
+	b.app.Register(app.NewServiceFunc("error-monitor",
+		func(context.Context) error { return nil },
+		func(context.Context) error {
+			errorMonitor.Close()
+			return nil
+		},
+	))
+}
+
+// connectKubernetes checks cluster access; the bot continues without it.
+// The client is kept for leader election and k8s:// secret references.
+func (b *bootstrap) connectKubernetes() {
+	var (
+		config *rest.Config
+		err    error
+	)
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		// Running inside cluster
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			log.Printf("⚠️ Failed to get in-cluster config: %v", err)
+			return
+		}
+	} else {
+		// Try to use local kubeconfig
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		configOverrides := &clientcmd.ConfigOverrides{}
+		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+		config, err = kubeConfig.ClientConfig()
+		if err != nil {
+			log.Printf("⚠️ Failed to load Kubernetes config: %v (continuing without K8s)", err)
+			return
+		}
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Printf("⚠️ Failed to create Kubernetes client: %v", err)
+		return
+	}
+	b.kube = client
+	log.Println("✅ Connected to Kubernetes cluster")
+}
+
+// initDatabase connects to PostgreSQL and registers the migrations
+// service, which with MIGRATE_ON_STARTUP=true applies pending schema
+// migrations before any service that uses the schema starts.
+func (b *bootstrap) initDatabase() error {
+	dbService, err := services.NewDatabaseService(cfg)
+	if err != nil {
+		return fmt.Errorf("initialize database service: %w", err)
+	}
+	b.db = dbService
+	if dbService.DB() != nil {
+		b.health.Register("database", health.DatabaseCheck(dbService.DB().PingContext))
+	}
+	b.audit = audit.New(dbService.DB())
+	b.app.Register(app.NewServiceFunc("database",
+		func(context.Context) error { return nil },
+		func(context.Context) error { return dbService.Close() },
+	))
+	log.Println("✅ Database service initialized")
+
+	// Replicas serialise on an advisory lock; otherwise run
+	// `agisctl migrate up` as a deploy step.
+	migrateSchema := func(context.Context) error { return nil }
+	if os.Getenv("MIGRATE_ON_STARTUP") == "true" && dbService.DB() != nil {
+		migrator, err := migrate.New(dbService.DB(), migrations.FS, nil)
+		if err != nil {
+			return fmt.Errorf("load migrations: %w", err)
+		}
+		migrator.SetAuditLog(b.audit)
+		migrateSchema = migrator.OnStart()
+	}
+	b.app.Register(app.NewServiceFunc("migrations", migrateSchema,
+		func(context.Context) error { return nil },
+	), app.DependsOn("database"), app.StartTimeout(5*time.Minute))
+
+	// Initialize double-entry credit ledger (all balance movements go through it)
+	b.ledger = ledger.New(dbService.DB())
+	return nil
+}
+
+// initDiscord creates the Discord session. It is opened by openDiscord once
+// every handler is registered.
+func (b *bootstrap) initDiscord() error {
+	token := cfg.Discord.Token
+	if token == "" {
+		return errors.New("DISCORD_TOKEN is required")
+	}
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return fmt.Errorf("create Discord session: %w", err)
+	}
+
+	// Enable state tracking for member updates (required for BeforeUpdate)
+	session.StateEnabled = true
+	session.State.TrackMembers = true
+	session.State.TrackRoles = true
+
+	b.session = session
+	b.app.Register(app.NewServiceFunc("discord",
+		func(context.Context) error { return nil },
+		func(context.Context) error { return session.Close() },
+	))
+	return nil
+}
+
+// initServices wires logging, consent and ad conversions.
+func (b *bootstrap) initServices() {
+	ctx := context.Background()
+
+	// Initialize logging service
+	b.logging = services.NewLoggingService(b.db, b.session, "") // Guild ID will be set later
+	log.Println("✅ Logging service initialized")
+
+	// Initialize GDPR consent service (BLOCKER 7)
+	consentService := services.NewConsentService(b.db.DB())
+	if err := consentService.InitSchema(ctx); err != nil {
+		log.Printf("⚠️ Failed to initialize consent schema: %v", err)
+	}
+	// Wire consent checker for HTTP endpoints
+	http.SetConsentChecker(consentService)
+	log.Println("✅ Consent service initialized")
+
+	// Initialize Ad Conversion service (ayeT-Studios S2S)
+	b.adConversions = services.NewAdConversionService(b.db, consentService, cfg.Ads.AyetAPIKey, cfg.Ads.AyetCallbackToken)
+	if err := b.adConversions.InitSchema(ctx); err != nil {
+		log.Printf("⚠️ Failed to initialize ad conversions schema: %v", err)
+	}
+	// Wire ayeT-Studios S2S callback handler
+	ayetHandler := http.NewAyetHandler(b.adConversions)
+	http.SetAyetHandler(ayetHandler)
+
+	// Initialize ad metrics collector
+	adMetrics := services.NewAdMetrics(
+		metrics.AdConversionsTotal,
+		metrics.AdRewardsTotal,
+		metrics.AdFraudAttemptsTotal,
+		metrics.AdCallbackLatency,
+		metrics.AdConversionsByTier,
+	)
+	b.adConversions.SetMetrics(adMetrics)
+	ayetHandler.SetMetrics(adMetrics)
+	log.Println("✅ Ad conversion service initialized (ayeT-Studios S2S with Prometheus metrics)")
+
+	// Wire ad callback token and handler (credits reward from ayet - legacy fallback)
+	http.SetAdsCallbackToken(cfg.Ads.AyetCallbackToken)
+	http.SetAdsAPIKey(cfg.Ads.AyetAPIKey)
+	http.SetAdsLinks(cfg.Ads.OfferwallURL, cfg.Ads.SurveywallURL, cfg.Ads.VideoPlacementID)
+	http.OnRewardWithConversion = func(uid string, amount int, conversionID, source string) error {
+		if b.db.DB() == nil {
+			err := b.db.ProcessAdConversion(uid, amount, conversionID, source)
+			if errors.Is(err, services.ErrDuplicate) {
+				return nil
+			}
+			return err
+		}
+		// Credit GC from ADS through the ledger (idempotent on conversion
+		// ID); a negative amount reverses an earlier reward. Conversions
+		// recorded before the ledger are still treated as duplicates.
+		desc := fmt.Sprintf("Ad reward from %s - Conversion %s", source, conversionID)
+		entry := ledger.TransferEntry(ledger.Ads, ledger.UserAccount(uid), ledger.CurrencyGC, int64(amount), "ad_reward", desc)
+		if amount < 0 {
+			entry = ledger.TransferEntry(ledger.UserAccount(uid), ledger.Ads, ledger.CurrencyGC, int64(-amount), "ad_reversal", desc)
+		}
+		entry.CreatedBy = source
+		entry.IdempotencyKey = conversionID
+		_, err := b.ledger.PostWith(context.Background(), entry, func(ctx context.Context, tx *sql.Tx, _ int64) error {
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO ad_conversions (conversion_id, uid, amount, source)
+				SELECT $1, $2, $3, $4
+				WHERE NOT EXISTS (SELECT 1 FROM ad_conversions WHERE conversion_id = $1)
+			`, conversionID, uid, amount, source)
+			if err != nil {
+				return fmt.Errorf("record ad conversion: %w", err)
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return services.ErrDuplicate
+			}
+			return nil
+		})
+		if errors.Is(err, ledger.ErrDuplicate) || errors.Is(err, services.ErrDuplicate) {
+			return nil
+		}
+		return err
+	}
+
+	// Wire verification API config, Discord session, and logging
+	http.SetVerifyAPI(cfg.Roles.VerifyAPISecret, cfg.Discord.GuildID, cfg.Roles.VerifiedRoleID)
+	http.SetDiscordSessionForAPI(b.session)
+	http.SetLoggingServiceForAPI(b.logging)
+
+	// Load log channels from environment variables
+	b.logging.LoadChannelConfigFromEnv()
+
+	// Start log rotation (rotate every 24 hours, keep logs for 30 days).
+	// The rotation goroutine cannot be stopped, so it runs on the leader
+	// until the process exits.
+	b.singleton("log-rotation", false, func(ctx context.Context) error {
+		b.logging.StartLogRotation(24*time.Hour, 30*24*time.Hour)
+		<-ctx.Done()
+		return nil
+	})
+}
+
+// initPayments wires the Stripe payment service (BLOCKER 2: Zero-touch payments).
+func (b *bootstrap) initPayments() {
+	if os.Getenv("STRIPE_SECRET_KEY") == "" {
+		log.Println("⚠️ Stripe not configured - payments disabled (set STRIPE_SECRET_KEY to enable)")
+		return
+	}
+	stripeTestMode := os.Getenv("STRIPE_TEST_MODE") == "true"
+	stripeService := payment.NewStripeService(
+		os.Getenv("STRIPE_SECRET_KEY"),
+		os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		os.Getenv("STRIPE_SUCCESS_URL"),
+		os.Getenv("STRIPE_CANCEL_URL"),
+		stripeTestMode,
+	)
+	var exps *experiments.Service
+	if b.db.DB() != nil {
+		exps = experiments.NewService(b.db.DB())
+	}
+
+	// Wire webhook callback for automatic WTG fulfillment
+	http.SetStripeService(stripeService, func(discordID string, wtgCoins int, sessionID string, amountPaid int64) error {
+		log.Printf("💰 Processing payment: User %s purchased %d WTG for $%.2f (session: %s)",
+			discordID, wtgCoins, float64(amountPaid)/100, sessionID)
+
+		// Credit WTG through the ledger (serializable, idempotent on session
+		// ID) and audit the credit in the same transaction
+		entry := ledger.TransferEntry(ledger.Stripe, ledger.UserAccount(discordID), ledger.CurrencyWTG, int64(wtgCoins),
+			"purchase", fmt.Sprintf("Stripe payment $%.2f - Session %s", float64(amountPaid)/100, sessionID))
+		entry.CreatedBy = "stripe"
+		entry.IdempotencyKey = sessionID
+		_, err := b.ledger.PostWith(context.Background(), entry, func(ctx context.Context, tx *sql.Tx, entryID int64) error {
+			_, err := b.audit.RecordTx(ctx, tx, audit.Event{
+				Actor:  "stripe",
+				Action: "payment.credit",
+				Target: audit.Target{Type: "user", ID: discordID},
+				After: map[string]any{
+					"currency":        ledger.CurrencyWTG,
+					"amount":          wtgCoins,
+					"amount_paid":     amountPaid,
+					"session_id":      sessionID,
+					"ledger_entry_id": entryID,
+				},
+			})
+			return err
+		})
+		if errors.Is(err, ledger.ErrDuplicate) {
+			log.Printf("ℹ️ Stripe session %s already fulfilled", sessionID)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to credit WTG coins: %w", err)
+		}
+
+		log.Printf("✅ Successfully credited %d WTG to user %s", wtgCoins, discordID)
+
+		// Purchases are the experiments' conversions and revenue; clients
+		// cannot report these themselves. Replayed sessions returned above.
+		if exps != nil {
+			meta := map[string]any{"session_id": sessionID}
+			for eventType, value := range map[string]float64{
+				experiments.EventConversion: 1,
+				experiments.EventRevenue:    float64(amountPaid) / 100,
+			} {
+				if _, err := exps.RecordAll(context.Background(), discordID, eventType, value, meta); err != nil {
+					log.Printf("⚠️ Failed to record experiment %s for %s: %v", eventType, sessionID, err)
+				}
+			}
+		}
+
+		// Send Discord DM notification (best effort, don't fail payment on DM error)
+		channel, err := b.session.UserChannelCreate(discordID)
+		if err == nil {
+			_, _ = b.session.ChannelMessageSend(channel.ID, fmt.Sprintf(
+				"💎 **Payment Successful!**\\n\\n"+
+					"You've received **%d WTG Coins**!\\n"+
+					"Amount paid: $%.2f\\n\\n"+
+					"Use `credits` to see your balance or `convert` to turn WTG into GameCredits!",
+				wtgCoins, float64(amountPaid)/100,
+			))
+		}
+
+		return nil
+	})
+
+	log.Printf("✅ Stripe payment service initialized (Test Mode: %v)", stripeTestMode)
+}
+
+// initCommands builds the modular command handler.
+func (b *bootstrap) initCommands() {
+	commandHandler = commands.NewCommandHandler(cfg, b.db, b.logging)
+	log.Println("✅ Modular command system initialized")
+
+	// Wire hot-reloadable config to command handler (v1.8.0+)
+	if b.hotCfg != nil {
+		commandHandler.SetHotConfig(b.hotCfg)
+	}
+
+	// Register ad analytics command (requires AdConversionService)
+	commandHandler.Register(commands.NewAdAnalyticsCommand(b.adConversions))
+	log.Println("✅ Ad analytics command registered")
+}
+
+// initCleanup registers the stopped-server cleanup loop, restarted by
+// the supervisor if it dies.
+func (b *bootstrap) initCleanup() {
+	cleanupService := services.NewCleanupService(b.db, b.logging)
+	b.singleton("cleanup", true, supervisedLoop(cleanupService.Start, cleanupService.Stop))
+}
+
+// initGDPR registers the erasure loop, which carries out erasure requests
+// once their cooling-off period has passed. GDPR_SIGNING_KEY must stay
+// stable: it derives the pseudonyms kept in financial records and signs
+// erasure receipts.
+func (b *bootstrap) initGDPR() {
+	if b.db.DB() == nil {
+		return
+	}
+	gdprService, err := gdpr.NewService(b.db.DB(), []byte(os.Getenv("GDPR_SIGNING_KEY")), nil)
+	if err != nil {
+		log.Printf("⚠️ GDPR erasure disabled: %v (set GDPR_SIGNING_KEY to enable)", err)
+		return
+	}
+	gdprService.SetAuditLog(b.audit)
+	b.singleton("gdpr-erasure", true, gdprService.Run)
+	log.Println("✅ GDPR erasure scheduler registered")
+}
+
+// initGuildServers registers the guild server provisioning scheduler. It
+// starts approved requests, renews or expires active ones and recovers
+// requests left provisioning or terminating, paying from the guild
+// treasury. PLATFORM_ADMIN_IDS lists the Discord IDs allowed to grant
+// treasury funds.
+func (b *bootstrap) initGuildServers() {
+	if b.db.DB() == nil || commandHandler.Agones() == nil {
+		log.Println("⚠️ Agones service not available - guild server provisioning disabled")
+		return
+	}
+	var admins []string
+	for _, id := range strings.Split(os.Getenv("PLATFORM_ADMIN_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins = append(admins, id)
+		}
+	}
+	authz := treasury.NewDiscordAuthorizer(b.session, admins)
+	treasuryService := treasury.NewService(b.db.DB(), b.ledger, authz)
+	treasuryService.SetAuditLog(b.audit)
+
+	namespace := os.Getenv("AGONES_NAMESPACE")
+	if namespace == "" {
+		namespace = "default"
+	}
+	servers := coreProvisioner{
+		agones:    commandHandler.Agones(),
+		templates: templates.NewService(b.db.DB(), b.games),
+		namespace: namespace,
+	}
+	provisioningService := provisioning.NewService(b.db.DB(), treasuryService, authz, servers, nil)
+	provisioningService.SetAuditLog(b.audit)
+	b.singleton("guild-provisioning", true, provisioningService.Run, "discord")
+	log.Println("✅ Guild server provisioning scheduler registered")
+}
+
+// coreProvisioner runs guild servers as Agones game servers sized by the
+// request's template. The guild treasury has already paid, so the servers
+// are not billed per user.
+type coreProvisioner struct {
+	agones    *services.AgonesService
+	templates provisioning.TemplateLookup
+	namespace string
+}
+
+// Provision implements provisioning.Provisioner. The server ID is the
+// Agones game server UID.
+func (p coreProvisioner) Provision(ctx context.Context, req *provisioning.Request) (string, error) {
+	tmpl, err := p.templates.Get(ctx, req.TemplateID)
+	if err != nil {
+		return "", fmt.Errorf("load template %s: %w", req.TemplateID, err)
+	}
+	return p.agones.CreateGameServer(ctx, &services.GameServerRequest{
+		Name:      req.ServerName,
+		Namespace: p.namespace,
+		GameType:  tmpl.GameType,
+		Labels: map[string]string{
+			"guild-id":     req.GuildID,
+			"requested-by": req.RequestedBy,
+			"template-id":  tmpl.ID,
+		},
+		Resources: services.ResourceRequirements{
+			CPURequest:    tmpl.CPURequest,
+			MemoryRequest: tmpl.MemoryRequest,
+		},
+	})
+}
+
+// Deprovision implements provisioning.Provisioner by deleting the game
+// server with the stored UID. Requests that never got a server are a
+// no-op.
+func (p coreProvisioner) Deprovision(ctx context.Context, req *provisioning.Request) error {
+	if req.ServerID == "" {
+		return nil
+	}
+	return p.agones.DeleteGameServerByUID(ctx, req.ServerID)
+}
+
+// singleton registers job to run on one replica at a time, elected with
+// the backend chosen by LEADER_ELECTION. Jobs that cannot be started
+// again in the same process are not restartable: failing or losing
+// leadership shuts the replica down instead, and its restart rejoins
+// the election.
+func (b *bootstrap) singleton(name string, restartable bool, job func(context.Context) error, deps ...string) {
+	var svc *app.BackgroundService
+	if locker := b.newLocker(name); locker != nil {
+		elector := leader.NewElector(name, locker, nil)
+		elector.SetStopOnLoss(!restartable)
+		svc = leader.NewService(elector, job)
+	} else {
+		svc = app.NewBackgroundService(name, job)
+	}
+	if !restartable {
+		svc.WithSupervision(app.Supervision{Policy: app.RestartNever})
+	}
+	b.app.Register(svc, app.DependsOn(append([]string{"migrations"}, deps...)...))
+}
+
+// newLocker returns the leader election backend for name:
+// LEADER_ELECTION=kubernetes uses a Lease, postgres an advisory lock and
+// none disables election. By default a Lease is used inside a cluster
+// and PostgreSQL elsewhere.
+func (b *bootstrap) newLocker(name string) leader.Locker {
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	mode := os.Getenv("LEADER_ELECTION")
+	if mode == "" {
+		mode = "postgres"
+		if b.kube != nil && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			mode = "kubernetes"
+		}
+	}
+	switch mode {
+	case "kubernetes":
+		if b.kube != nil {
+			return leader.NewLeaseLocker(b.kube, podNamespace(), "agis-"+name, identity, 15*time.Second)
+		}
+	case "postgres":
+		if b.db.DB() != nil {
+			return leader.NewPGLocker(b.db.DB(), name, identity)
+		}
+	case "none":
+		return nil
+	}
+	log.Printf("⚠️ Leader election backend %q unavailable - %s runs on every replica", mode, name)
+	return nil
+}
+
+// podNamespace returns the namespace leases are created in.
+func podNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if ns, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		return strings.TrimSpace(string(ns))
+	}
+	return "default"
+}
+
+// supervisedLoop adapts a service whose Start blocks until Stop to a
+// BackgroundService function. Start returning on its own means the loop
+// died, which is reported to the supervisor as a failure.
+func supervisedLoop(start, stop func()) func(context.Context) error {
+	return func(ctx context.Context) error {
+		exited := make(chan struct{})
+		defer close(exited)
+		go func() {
+			select {
+			case <-ctx.Done():
+				stop()
+			case <-exited:
+			}
+		}()
+		start()
+		if ctx.Err() == nil {
+			return errors.New("loop exited")
+		}
+		return nil
+	}
+}
+
+// initScheduler registers the server schedule runner.
+func (b *bootstrap) initScheduler() {
+	if commandHandler.EnhancedService() == nil {
+		log.Println("⚠️ Enhanced server service not available - scheduler disabled")
+		return
+	}
+	schedulerService := services.NewSchedulerService(b.db, commandHandler.EnhancedService(), metrics.SchedulerActiveSchedules, metrics.SchedulerExecutionsTotal)
+	commandHandler.SetScheduler(schedulerService)
+	// Stop cancels the scheduler for good, so it cannot be restarted.
+	b.singleton("scheduler", false, func(ctx context.Context) error {
+		if err := schedulerService.Start(); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		schedulerService.Stop()
+		return nil
+	})
+}
+
+// wireDashboards wires the WordPress user and admin dashboard providers.
+func (b *bootstrap) wireDashboards() {
+	http.SetUserServersProvider(func(ctx context.Context, discordID string) ([]http.DashboardServer, error) {
+		var (
+			servers []*services.GameServer
+			err     error
+		)
+		if commandHandler != nil && commandHandler.EnhancedService() != nil {
+			servers, err = commandHandler.EnhancedService().GetUserServersEnhanced(ctx, discordID)
+		} else {
+			servers, err = b.db.GetUserServers(discordID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out := make([]http.DashboardServer, 0, len(servers))
+		for _, s := range servers {
+			ds := http.DashboardServer{
+				ID:         s.ID,
+				Name:       s.Name,
+				Game:       s.GameType,
+				Address:    s.Address,
+				Port:       s.Port,
+				Status:     s.Status,
+				Region:     "",
+				Players:    http.PlayersInfo{Current: 0, Max: 0},
+				ConnectURL: "",
+				ManageURL:  "",
+			}
+			if !s.CreatedAt.IsZero() {
+				ds.CreatedAt = s.CreatedAt.Format(time.RFC3339)
+			}
+			out = append(out, ds)
+		}
+		return out, nil
+	})
+
+	http.SetAdminDashboardProvider(func(ctx context.Context) (*http.AdminDashboardData, error) {
+		dataRaw, err := b.db.GetAdminDashboardData()
+		if err != nil {
+			return nil, err
+		}
+		// Map to http struct to avoid import cycle
+		data := &http.AdminDashboardData{
+			TotalServers:         dataRaw.TotalServers,
+			ActiveServers:        dataRaw.ActiveServers,
+			ServerUtilization:    dataRaw.ServerUtilization,
+			Servers:              make([]http.AdminServer, 0, len(dataRaw.Servers)),
+			TotalUsers:           dataRaw.TotalUsers,
+			PremiumUsers:         dataRaw.PremiumUsers,
+			PremiumPercentage:    dataRaw.PremiumPercentage,
+			TotalGuilds:          dataRaw.TotalGuilds,
+			TotalTreasuryBalance: dataRaw.TotalTreasuryBalance,
+			TopGuilds:            make([]http.AdminGuild, 0, len(dataRaw.TopGuilds)),
+			CreditsEarnedToday:   dataRaw.CreditsEarnedToday,
+			CPUUsage:             dataRaw.CPUUsage,
+			MemoryUsage:          dataRaw.MemoryUsage,
+			NetworkIO:            dataRaw.NetworkIO,
+			NetworkUtilization:   dataRaw.NetworkUtilization,
+			Version:              version.Version,
+		}
+		for _, s := range dataRaw.Servers {
+			data.Servers = append(data.Servers, http.AdminServer{
+				Name:            s.Name,
+				GameType:        s.GameType,
+				OwnerUsername:   s.OwnerUsername,
+				Status:          s.Status,
+				UptimeFormatted: s.UptimeFormatted,
+				CostPerHour:     s.CostPerHour,
+			})
+		}
+		for _, g := range dataRaw.TopGuilds {
+			data.TopGuilds = append(data.TopGuilds, http.AdminGuild{
+				GuildName:   g.GuildName,
+				Balance:     g.Balance,
+				MemberCount: g.MemberCount,
+			})
+		}
+		return data, nil
+	})
+}
+
+// openDiscord registers the event handlers and connects. The bot keeps
+// running without Discord so metrics and the APIs stay available; role
+// sync needs the connection and is only registered once it is open.
+func (b *bootstrap) openDiscord() {
+	// Initialize event handlers for verified role protection
+	eventHandlers := bot.NewEventHandlers(b.logging, cfg.Roles.VerifiedRoleID, cfg.Discord.GuildID)
+
+	// Register event handlers (message-based)
+	b.session.AddHandler(b.trackMessage)
+	b.session.AddHandler(ready)
+	b.session.AddHandler(eventHandlers.HandleGuildMemberUpdate)
+
+	// Register interaction handler
+	b.session.AddHandler(b.trackInteraction)
+
+	// Set bot intents - include message content, guild state, and guild members for role monitoring
+	b.session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent | discordgo.IntentsGuilds | discordgo.IntentsGuildMembers
+
+	if err := b.session.Open(); err != nil {
+		log.Printf("⚠️ Failed to open Discord session: %v (continuing without Discord)", err)
+		return
+	}
+	// Set Discord session for notification service
+	commandHandler.SetDiscordSession(b.session)
+
+	// Sync verified roles every 10 minutes
+	if cfg.Roles.VerifiedRoleID != "" && cfg.Discord.GuildID != "" {
+		roleSyncService := services.NewRoleSyncService(b.db.DB(), b.session, cfg.Discord.GuildID, cfg.Roles.VerifiedRoleID, cfg.Roles.PremiumRoleID, 10*time.Minute)
+		// Stop closes the service for good, so it cannot be restarted.
+		b.singleton("role-sync", false, supervisedLoop(roleSyncService.Start, roleSyncService.Stop), "discord")
+	}
+}
+
+// trackMessage handles a message command as in-flight work, so shutdown
+// waits for it. Messages arriving while draining are ignored.
+func (b *bootstrap) trackMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	done, err := b.app.Tracker().Begin("discord", "message")
+	if err != nil {
+		return
+	}
+	defer done()
+	commandHandler.HandleMessage(s, m)
+}
+
+// trackInteraction handles an interaction as in-flight work. While
+// draining it is answered with a retry notice, since Discord reports an
+// unanswered interaction as failed.
+func (b *bootstrap) trackInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	done, err := b.app.Tracker().Begin("discord", interactionName(i))
+	if err != nil {
+		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "⏳ Agis is restarting - please try again in a moment.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	defer done()
+	commandHandler.HandleInteraction(s, i)
+}
+
+// interactionName names an interaction for drain logs.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return "/" + i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return "component " + i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return "modal " + i.ModalSubmitData().CustomID
+	}
+	return i.Type.String()
+}
+
+// initHTTPServer registers the metrics and webhook server on :9090. It
+// does not wait for migrations, so metrics are scraped while they run.
+// On shutdown it stops accepting connections and drains in-flight
+// payment callbacks before the database is closed.
+func (b *bootstrap) initHTTPServer() {
+	httpServer := http.NewServer()
+	b.app.Register(app.NewServiceFunc("http", func(context.Context) error {
+		if err := httpServer.Start(); !errors.Is(err, nethttp.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, httpServer.Stop).
+		WithReady(app.DialReady("localhost:9090")).
+		WithDrain(httpServer.Stop), app.DependsOn("database"))
+}
+
+// initAPIServer registers the REST API server (separate from the metrics
+// HTTP server).
+func (b *bootstrap) initAPIServer() {
+	if commandHandler.EnhancedService() == nil || commandHandler.Agones() == nil {
+		log.Println("⚠️ REST API disabled - missing required services")
+		return
+	}
+	apiPort := os.Getenv("API_PORT")
+	if apiPort == "" {
+		apiPort = "8080"
+	}
+	apiServer := api.NewAPIServer(":"+apiPort, b.db, commandHandler.Agones(), commandHandler.EnhancedService())
+
+	// CORS origins and the per-client rate limit follow settings reloads.
+	var handler nethttp.Handler = apiServer
+	if b.config != nil {
+		limiter := middleware.NewRateLimiter(0, 0)
+		b.config.BindRateLimit(limiter)
+		handler = middleware.Chain(
+			middleware.CORSFunc(b.config.AllowedOrigins),
+			limiter.Handler(middleware.IPKeyFunc),
+		)(apiServer)
+	}
+	server := &nethttp.Server{
+		Addr:         ":" + apiPort,
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	stop := func(ctx context.Context) error {
+		return errors.Join(server.Shutdown(ctx), apiServer.Stop(ctx))
+	}
+	b.app.Register(app.NewServiceFunc("rest-api", func(context.Context) error {
+		log.Printf("🚀 Starting REST API server on :%s", apiPort)
+		if err := server.ListenAndServe(); !errors.Is(err, nethttp.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, stop).
+		WithReady(app.DialReady("localhost:"+apiPort)).
+		WithDrain(stop), app.DependsOn("migrations"))
+	log.Println("✅ REST API v1 initialized")
+}
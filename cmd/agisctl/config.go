@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wethegamers/agis/internal/config"
+	"github.com/wethegamers/agis/internal/hotconfig"
+)
+
+func init() {
+	var path string
+	register(&command{
+		name:    "config validate",
+		summary: "Parse and validate hot-config.yaml",
+		noDB:    true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&path, "file", defaultHotConfigPath(), "hot-config file (default $HOT_CONFIG_PATH or configs/hot-config.yaml)")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return configValidate(e, path)
+		},
+	})
+
+	var lintPath string
+	var printSchema bool
+	register(&command{
+		name:    "config lint",
+		summary: "Check hot-config.yaml against its schema and rules, with line numbers",
+		noDB:    true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&lintPath, "file", defaultHotConfigPath(), "hot-config file (default $HOT_CONFIG_PATH or configs/hot-config.yaml)")
+			fs.BoolVar(&printSchema, "schema", false, "print the JSON Schema instead of linting")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			if printSchema {
+				_, err := e.stdout.Write(hotconfig.Schema())
+				return err
+			}
+			return configLint(e, lintPath)
+		},
+	})
+
+	var file string
+	register(&command{
+		name:    "config print",
+		summary: "Show the bot's effective settings and where each came from",
+		noDB:    true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&file, "config", os.Getenv("CONFIG_FILE"), "YAML, TOML or .env config file (default $CONFIG_FILE)")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return configPrint(e, file)
+		},
+	})
+
+	var checkFile, environment string
+	register(&command{
+		name:    "config check",
+		summary: "Validate the bot's settings, optionally as another environment",
+		noDB:    true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&checkFile, "config", os.Getenv("CONFIG_FILE"), "YAML, TOML or .env config file (default $CONFIG_FILE)")
+			fs.StringVar(&environment, "environment", "", "check as this app environment, e.g. production (default from the settings)")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return configCheck(e, checkFile, environment)
+		},
+	})
+}
+
+func defaultHotConfigPath() string {
+	if p := os.Getenv("HOT_CONFIG_PATH"); p != "" {
+		return p
+	}
+	return "configs/hot-config.yaml"
+}
+
+type validateResult struct {
+	File   string   `json:"file"`
+	Valid  bool     `json:"valid"`
+	Games  int      `json:"games"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+func configValidate(e *env, path string) error {
+	res := &validateResult{File: path}
+	f, err := hotconfig.Load(path)
+	if err == nil {
+		res.Games = len(f.Games)
+		err = f.Validate()
+	}
+	if err != nil {
+		res.Errors = validationMessages(err)
+	}
+	res.Valid = err == nil
+
+	if err := e.emit(res, func(w io.Writer) {
+		if res.Valid {
+			fmt.Fprintf(w, "%s: OK (%d games)\n", path, res.Games)
+			return
+		}
+		fmt.Fprintf(w, "%s: %d problem(s)\n", path, len(res.Errors))
+		for _, msg := range res.Errors {
+			fmt.Fprintf(w, "  %s\n", msg)
+		}
+	}); err != nil {
+		return err
+	}
+	if !res.Valid {
+		return fmt.Errorf("%s is invalid", path)
+	}
+	return nil
+}
+
+type lintResult struct {
+	File     string              `json:"file"`
+	Valid    bool                `json:"valid"`
+	Problems []hotconfig.Problem `json:"problems,omitempty"`
+}
+
+// configLint reports every schema and semantic problem in a hot-config
+// file as file:line:column, the form editors and CI annotations accept.
+func configLint(e *env, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	res := &lintResult{File: path, Problems: hotconfig.Lint(data)}
+	res.Valid = len(res.Problems) == 0
+
+	if err := e.emit(res, func(w io.Writer) {
+		if res.Valid {
+			fmt.Fprintf(w, "%s: OK\n", path)
+			return
+		}
+		for _, p := range res.Problems {
+			fmt.Fprintf(w, "%s:%s\n", path, p)
+		}
+	}); err != nil {
+		return err
+	}
+	if !res.Valid {
+		return fmt.Errorf("%s is invalid: %d problem(s)", path, len(res.Problems))
+	}
+	return nil
+}
+
+// configPrint loads the bot configuration from defaults, the file and
+// the environment, as the bot would, and prints it with secrets redacted.
+func configPrint(e *env, file string) error {
+	cfg, err := config.LoadFrom(config.Sources{File: file})
+	if err != nil {
+		return err
+	}
+	settings := cfg.Settings()
+	return e.emit(settings, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tORIGIN")
+		for _, s := range settings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, s.Value, s.Origin)
+		}
+		tw.Flush()
+	})
+}
+
+// configCheck loads the bot configuration as configPrint does and
+// reports every problem Config.Validate finds. The environment override
+// applies production rules to a file before it is deployed.
+func configCheck(e *env, file, environment string) error {
+	var args []string
+	if environment != "" {
+		args = append(args, "--app-environment="+environment)
+	}
+	res := &validateResult{File: file}
+	_, err := config.LoadFrom(config.Sources{File: file, Args: args})
+	if err != nil {
+		res.Errors = validationMessages(err)
+	}
+	res.Valid = err == nil
+
+	name := file
+	if name == "" {
+		name = "environment"
+	}
+	if err := e.emit(res, func(w io.Writer) {
+		if res.Valid {
+			fmt.Fprintf(w, "%s: OK\n", name)
+			return
+		}
+		fmt.Fprintf(w, "%s: %d problem(s)\n", name, len(res.Errors))
+		for _, msg := range res.Errors {
+			fmt.Fprintf(w, "  %s\n", msg)
+		}
+	}); err != nil {
+		return err
+	}
+	if !res.Valid {
+		return fmt.Errorf("%s is invalid", name)
+	}
+	return nil
+}
+
+// validationMessages splits a joined validation error into one message
+// per problem.
+func validationMessages(err error) []string {
+	for _, sentinel := range []error{hotconfig.ErrInvalid, config.ErrInvalid} {
+		if errors.Is(err, sentinel) {
+			msg := strings.TrimPrefix(err.Error(), sentinel.Error()+": ")
+			return strings.Split(msg, "\n")
+		}
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,296 @@
+// Command agisctl is the AGIS operator CLI.
+//
+// It adjusts balances through the credit ledger, looks up users, manages
+// servers and tiers, inspects guild treasuries, validates and lints
+// hot-config.yaml, prints and checks the bot's effective settings and
+// applies database migrations. Every command accepts --dry-run and
+// --output json, and every change is written to the audit log.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+// usageError reports a bad invocation; run prints it followed by the
+// command's usage and exits 2.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// command is a leaf subcommand such as "credits adjust".
+type command struct {
+	name    string
+	args    string
+	summary string
+	// flags registers command-specific flags.
+	flags func(fs *flag.FlagSet)
+	// nargs is the number of positional arguments required.
+	nargs int
+	// noDB commands run without a database connection.
+	noDB bool
+	run  func(ctx context.Context, e *env, args []string) error
+}
+
+var commands []*command
+
+func register(c *command) {
+	commands = append(commands, c)
+}
+
+// env carries the global options and connections shared by commands.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	dryRun bool
+	json   bool
+	actor  string
+
+	db    *sql.DB
+	audit *audit.Log
+	now   func() time.Time
+}
+
+// opener opens the database; tests replace it.
+type opener func(dsn string) (*sql.DB, error)
+
+func openPostgres(dsn string) (*sql.DB, error) {
+	return sql.Open("postgres", dsn)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr, openPostgres)
+	stop()
+	os.Exit(code)
+}
+
+// run executes one invocation and returns the process exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, open opener) int {
+	cmd, rest := lookup(args)
+	if cmd == nil {
+		printUsage(stderr)
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			return 0
+		}
+		return 2
+	}
+
+	e := &env{stdout: stdout, stderr: stderr, now: time.Now}
+	fs := flag.NewFlagSet("agisctl "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&e.dryRun, "dry-run", false, "show what would change without writing anything")
+	output := fs.String("output", "text", "output format: text or json")
+	dsn := fs.String("database-url", os.Getenv("DATABASE_URL"), "PostgreSQL connection string (default $DATABASE_URL)")
+	fs.StringVar(&e.actor, "actor", defaultActor(), "operator recorded in the audit log (default $AGISCTL_ACTOR or cli:$USER)")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: agisctl %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, rest)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if len(positional) != cmd.nargs {
+		fs.Usage()
+		return 2
+	}
+	switch *output {
+	case "text":
+	case "json":
+		e.json = true
+	default:
+		fmt.Fprintf(stderr, "agisctl: --output must be text or json, got %q\n", *output)
+		return 2
+	}
+
+	if !cmd.noDB {
+		if *dsn == "" {
+			fmt.Fprintln(stderr, "agisctl: --database-url or DATABASE_URL is required")
+			return 2
+		}
+		db, err := open(*dsn)
+		if err != nil {
+			fmt.Fprintf(stderr, "agisctl: open database: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+		e.db = db
+		e.audit = audit.New(db)
+	}
+
+	if err := cmd.run(ctx, e, positional); err != nil {
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintf(stderr, "agisctl %s: %v\n", cmd.name, err)
+			fs.Usage()
+			return 2
+		}
+		fmt.Fprintf(stderr, "agisctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// lookup finds the longest registered command name that prefixes args.
+func lookup(args []string) (*command, []string) {
+	var best *command
+	var bestLen int
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(words) > len(args) || len(words) <= bestLen {
+			continue
+		}
+		match := true
+		for i, w := range words {
+			if args[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			best, bestLen = c, len(words)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, args[bestLen:]
+}
+
+// parseInterspersed allows flags after positional arguments, so that
+// "credits adjust 123 500 --reason x" works. A bare negative number such
+// as -100 is positional unless it is the value of the preceding flag.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for len(args) > 0 {
+		if isNumber(args[0]) {
+			positional = append(positional, args[0])
+			args = args[1:]
+			continue
+		}
+		end := len(args)
+		for i := 1; i < len(args); i++ {
+			if isNumber(args[i]) && !takesValue(fs, args[i-1]) {
+				end = i
+				break
+			}
+		}
+		if err := fs.Parse(args[:end]); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		switch {
+		case len(rest) == 0:
+		case rest[0] == "--":
+			return append(append(positional, rest[1:]...), args[end:]...), nil
+		default:
+			positional = append(positional, rest[0])
+			rest = rest[1:]
+		}
+		args = append(rest, args[end:]...)
+	}
+	return positional, nil
+}
+
+func isNumber(arg string) bool {
+	_, err := strconv.ParseInt(arg, 10, 64)
+	return err == nil
+}
+
+// takesValue reports whether arg is a flag that consumes the next argument.
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if name == arg || strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "agisctl - AGIS operator CLI")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: agisctl <command> [arguments] [--dry-run] [--output text|json]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	sorted := append([]*command(nil), commands...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	for _, c := range sorted {
+		fmt.Fprintf(w, "  %-36s %s\n", c.name+" "+c.args, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'agisctl <command> -h' for command flags.")
+}
+
+func defaultActor() string {
+	if a := os.Getenv("AGISCTL_ACTOR"); a != "" {
+		return a
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// emit writes v as indented JSON with --output json, otherwise calls text.
+func (e *env) emit(v any, text func(w io.Writer)) error {
+	if e.json {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(e.stdout)
+	return nil
+}
+
+// inTx runs fn in a transaction that is rolled back on error.
+func (e *env) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// dryRunNote marks text output of a command that changed nothing.
+func (e *env) dryRunNote(w io.Writer) {
+	if e.dryRun {
+		fmt.Fprintln(w, "(dry run: nothing was changed)")
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/wethegamers/agis/internal/migrate"
+)
+
+// runMock runs agisctl against a sqlmock database.
+func runMock(t *testing.T, setup func(mock sqlmock.Sqlmock), args ...string) (int, string, string) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if setup != nil {
+		setup(mock)
+	}
+
+	var stdout, stderr bytes.Buffer
+	open := func(string) (*sql.DB, error) { return db, nil }
+	args = append(args, "--database-url", "postgres://test", "--actor", "ops@example.com")
+	code := run(context.Background(), args, &stdout, &stderr, open)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCreditsAdjust_DryRunWritesNothing(t *testing.T) {
+	code, out, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT balance FROM ledger_balances`)).
+			WithArgs("user:42", "GC").
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(300))
+	}, "credits", "adjust", "42", "-100", "--reason", "refund abuse", "--dry-run", "--output", "json")
+
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var res adjustResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if !res.DryRun || res.BalanceBefore != 300 || res.BalanceAfter != 200 || res.LedgerEntryID != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestCreditsAdjust_DryRunRejectsOverdraft(t *testing.T) {
+	code, _, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT balance FROM ledger_balances`)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(50))
+	}, "credits", "adjust", "42", "-100", "--reason", "chargeback", "--dry-run")
+
+	if code != 1 || !strings.Contains(stderr, "insufficient funds") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestCreditsAdjust_PostsLedgerEntryAndAudit(t *testing.T) {
+	code, out, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key = $1`)).
+			WithArgs("ticket-991").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+			WithArgs("admin_adjustment", "support ticket 991", "ticket-991", "ops@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(77, time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+			WithArgs(77, "SYSTEM", "WTG", -5).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(-5))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+			WithArgs(77, "user:42", "WTG", 5).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(12))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (discord_id, wtg_coins)`)).
+			WithArgs("42", 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO credit_transactions`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT balance FROM ledger_balances WHERE account = $1 AND currency = $2`)).
+			WithArgs("user:42", "WTG").
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(12))
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_log`)).
+			WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+			WithArgs(sqlmock.AnyArg(), "ops@example.com", "credits.adjust", "user", "42",
+				`{"balance":7,"currency":"WTG"}`, sqlmock.AnyArg(), sqlmock.AnyArg(),
+				nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+	}, "credits", "adjust", "42", "5", "--currency", "wtg", "--reason", "support ticket 991", "--idempotency-key", "ticket-991")
+
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if want := "42: +5 WTG, balance 7 -> 12 (ledger entry 77)\n"; out != want {
+		t.Errorf("output %q, want %q", out, want)
+	}
+}
+
+func TestCreditsAdjust_RequiresReason(t *testing.T) {
+	code, _, stderr := runMock(t, nil, "credits", "adjust", "42", "100")
+	if code != 2 || !strings.Contains(stderr, "Usage: agisctl credits adjust") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestServerStop_AlreadyStopped(t *testing.T) {
+	code, _, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name, discord_id, status FROM game_servers WHERE id = $1 FOR UPDATE`)).
+			WithArgs(int64(9)).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "discord_id", "status"}).AddRow("mc", "42", "stopped"))
+		mock.ExpectRollback()
+	}, "server", "stop", "9", "--reason", "abuse report")
+
+	if code != 1 || !strings.Contains(stderr, "already stopped") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestTierGrant_DryRun(t *testing.T) {
+	code, out, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(tier, 'free') FROM users WHERE discord_id = $1`)).
+			WithArgs("42").
+			WillReturnRows(sqlmock.NewRows([]string{"tier"}).AddRow("free"))
+	}, "tier", "grant", "42", "premium", "--days", "7", "--reason", "contest prize", "--dry-run")
+
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !strings.Contains(out, "42: tier free -> premium until") || !strings.Contains(out, "dry run") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestMigrateUp_DryRunListsPending(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"v2.10.0-later.sql", "v2.0-base.sql", "v2.2.0-next.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, out, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists", "checksum"}).AddRow(true, false))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at, NULL FROM schema_migrations`)).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at", "checksum"}).AddRow("v2.0-base", time.Now(), nil))
+	}, "migrate", "up", "--dir", dir, "--dry-run", "--output", "json")
+
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var res migrate.Result
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if strings.Join(res.Versions, ",") != "v2.2.0-next,v2.10.0-later" || !res.DryRun {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestMigrateStatus_Embedded(t *testing.T) {
+	code, out, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists", "checksum"}).AddRow(false, false))
+	}, "migrate", "status")
+
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !regexp.MustCompile(`v2\.8\.0-performance-indexes +pending`).MatchString(out) {
+		t.Errorf("status should list the embedded migrations, got %q", out)
+	}
+}
+
+func TestMigrateDown_Irreversible(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "v2.0-base.sql"), []byte("SELECT 1;"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := runMock(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists", "checksum"}).AddRow(true, false))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at, NULL FROM schema_migrations`)).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at", "checksum"}).AddRow("v2.0-base", time.Now(), nil))
+	}, "migrate", "down", "--dir", dir, "--dry-run")
+
+	if code != 1 || !strings.Contains(stderr, "no down file: v2.0-base") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"config", "validate", "--file", "../../configs/hot-config.yaml"},
+		&stdout, &stderr, nil)
+	if code != 0 || !strings.Contains(stdout.String(), "OK") {
+		t.Errorf("exit %d, stdout %q, stderr %q", code, stdout.String(), stderr.String())
+	}
+
+	bad := filepath.Join(t.TempDir(), "hot-config.yaml")
+	if err := os.WriteFile(bad, []byte("games:\n  rust:\n    name: Rust\n    max_slots: -1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	code = run(context.Background(), []string{"config", "validate", "--file", bad, "--output", "json"},
+		&stdout, &stderr, nil)
+	var res validateResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if code != 1 || res.Valid || len(res.Errors) != 1 {
+		t.Errorf("exit %d, result %+v", code, res)
+	}
+}
+
+func TestConfigLint(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"config", "lint", "--file", "../../configs/hot-config.yaml"},
+		&stdout, &stderr, nil)
+	if code != 0 || !strings.Contains(stdout.String(), "OK") {
+		t.Errorf("exit %d, stdout %q, stderr %q", code, stdout.String(), stderr.String())
+	}
+
+	bad := filepath.Join(t.TempDir(), "hot-config.yaml")
+	data := "games:\n  rust:\n    name: Rust\n    enabled: false\n    tier: mega\n    base_cost_per_hour: 5\n"
+	if err := os.WriteFile(bad, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	code = run(context.Background(), []string{"config", "lint", "--file", bad}, &stdout, &stderr, nil)
+	want := bad + ":5:11: games.rust.tier: must be one of solo, moderate, premium, titan, got \"mega\"\n"
+	if code != 1 || stdout.String() != want {
+		t.Errorf("exit %d, stdout %q", code, stdout.String())
+	}
+
+	stdout.Reset()
+	code = run(context.Background(), []string{"config", "lint", "--file", bad, "--output", "json"}, &stdout, &stderr, nil)
+	var res lintResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if code != 1 || res.Valid || len(res.Problems) != 1 || res.Problems[0].Line != 5 {
+		t.Errorf("exit %d, result %+v", code, res)
+	}
+
+	stdout.Reset()
+	code = run(context.Background(), []string{"config", "lint", "--schema"}, &stdout, &stderr, nil)
+	if code != 0 || !json.Valid(stdout.Bytes()) {
+		t.Errorf("exit %d, schema %q", code, stdout.String())
+	}
+}
+
+func TestConfigPrint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "agis.yaml")
+	if err := os.WriteFile(file, []byte("log:\n  level: debug\ndatabase:\n  password: hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DISCORD_TOKEN", "bot-token")
+	t.Setenv("HTTP_PORT", "9000")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"config", "print", "--config", file}, &stdout, &stderr, nil)
+	out := stdout.String()
+	if code != 0 {
+		t.Fatalf("exit %d, stderr %q", code, stderr.String())
+	}
+	for _, want := range []string{"log.level", "file " + file + ":2", "env HTTP_PORT", "<redacted>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "bot-token") {
+		t.Errorf("secret printed:\n%s", out)
+	}
+
+	t.Setenv("HTTP_PORT", "abc")
+	stderr.Reset()
+	code = run(context.Background(), []string{"config", "print", "--config", file}, &stdout, &stderr, nil)
+	if code != 1 || !strings.Contains(stderr.String(), `http.port: invalid value "abc" from env HTTP_PORT`) {
+		t.Errorf("exit %d, stderr %q", code, stderr.String())
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "agis.yaml")
+	if err := os.WriteFile(file, []byte("database:\n  password: p\n  ssl_mode: disable\n  max_idle_conns: 40\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DISCORD_TOKEN", "bot-token")
+	t.Setenv("HTTP_ALLOWED_ORIGINS", "https://wethegamers.org")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"config", "check", "--config", file}, &stdout, &stderr, nil)
+	if code != 1 || !strings.Contains(stdout.String(), "database.max_idle_conns: 40 exceeds database.max_open_conns 25 (from file "+file+":4)") {
+		t.Errorf("exit %d, stdout %q", code, stdout.String())
+	}
+
+	// Production adds the TLS rule to the same file.
+	stdout.Reset()
+	code = run(context.Background(), []string{"config", "check", "--config", file, "--environment", "production", "--output", "json"},
+		&stdout, &stderr, nil)
+	var res validateResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if code != 1 || res.Valid || len(res.Errors) != 2 || !strings.HasPrefix(res.Errors[0], "database.ssl_mode: must be require") {
+		t.Errorf("exit %d, result %+v", code, res)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"credits", "steal"}, &stdout, &stderr, nil); code != 2 {
+		t.Errorf("exit %d, want 2", code)
+	}
+	if !strings.Contains(stderr.String(), "credits adjust") {
+		t.Errorf("usage should list commands, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wethegamers/agis/deployments/migrations"
+	"github.com/wethegamers/agis/internal/migrate"
+)
+
+func init() {
+	var dir, target string
+	var steps int
+	dirFlag := func(fs *flag.FlagSet) {
+		fs.StringVar(&dir, "dir", os.Getenv("MIGRATIONS_DIR"), "read migrations from this directory instead of the embedded set (default $MIGRATIONS_DIR)")
+	}
+	register(&command{
+		name:    "migrate status",
+		summary: "List migrations and whether each has been applied",
+		flags:   dirFlag,
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return migrateStatus(ctx, e, dir)
+		},
+	})
+	register(&command{
+		name:    "migrate up",
+		summary: "Apply pending migrations in version order",
+		flags: func(fs *flag.FlagSet) {
+			dirFlag(fs)
+			fs.StringVar(&target, "to", "", "stop after this version")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return migrateRun(ctx, e, dir, "up", migrate.Options{Target: target})
+		},
+	})
+	register(&command{
+		name:    "migrate down",
+		summary: "Revert the newest applied migrations",
+		flags: func(fs *flag.FlagSet) {
+			dirFlag(fs)
+			fs.StringVar(&target, "to", "", "revert every migration after this version")
+			fs.IntVar(&steps, "steps", 1, "number of migrations to revert when --to is not set")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return migrateRun(ctx, e, dir, "down", migrate.Options{Target: target, Steps: steps})
+		},
+	})
+}
+
+func newRunner(e *env, dir string) (*migrate.Runner, error) {
+	var fsys fs.FS = migrations.FS
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	}
+	r, err := migrate.New(e.db, fsys, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.SetAuditLog(e.audit)
+	return r, nil
+}
+
+func migrateStatus(ctx context.Context, e *env, dir string) error {
+	r, err := newRunner(e, dir)
+	if err != nil {
+		return err
+	}
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return e.emit(statuses, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED\tDOWN")
+		for _, s := range statuses {
+			at := "-"
+			if s.AppliedAt != nil {
+				at = s.AppliedAt.Format(time.RFC3339)
+			}
+			down := "no"
+			if s.Reversible {
+				down = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Version, s.State, at, down)
+		}
+		tw.Flush()
+	})
+}
+
+func migrateRun(ctx context.Context, e *env, dir, direction string, opts migrate.Options) error {
+	r, err := newRunner(e, dir)
+	if err != nil {
+		return err
+	}
+	opts.DryRun = e.dryRun
+	opts.Actor = e.actor
+	run, verb := r.Up, "Applied"
+	if direction == "down" {
+		run, verb = r.Down, "Reverted"
+	}
+	res, err := run(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	return e.emit(res, func(w io.Writer) {
+		if len(res.Versions) == 0 {
+			fmt.Fprintln(w, "Nothing to do")
+			return
+		}
+		if e.dryRun {
+			verb = "Would revert"
+			if direction == "up" {
+				verb = "Would apply"
+			}
+		}
+		for _, v := range res.Versions {
+			fmt.Fprintf(w, "%s %s\n", verb, v)
+		}
+		e.dryRunNote(w)
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+func init() {
+	var owner, status string
+	var limit int
+	register(&command{
+		name:    "server list",
+		summary: "List game servers, newest first",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&owner, "user", "", "only servers owned by this Discord ID")
+			fs.StringVar(&status, "status", "", "only servers in this status")
+			fs.IntVar(&limit, "limit", 50, "maximum number of servers")
+		},
+		run: func(ctx context.Context, e *env, _ []string) error {
+			return serverList(ctx, e, owner, status, limit)
+		},
+	})
+
+	var reason string
+	register(&command{
+		name:    "server stop",
+		args:    "<server-id>",
+		summary: "Mark a server stopping; the bot shuts down its GameServer",
+		nargs:   1,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&reason, "reason", "", "reason recorded in the audit log (required)")
+		},
+		run: func(ctx context.Context, e *env, args []string) error {
+			return serverStop(ctx, e, args[0], reason)
+		},
+	})
+}
+
+type server struct {
+	ID          int64     `json:"id"`
+	DiscordID   string    `json:"discord_id"`
+	Name        string    `json:"name"`
+	GameType    string    `json:"game_type"`
+	Status      string    `json:"status"`
+	Address     string    `json:"address,omitempty"`
+	Port        int       `json:"port,omitempty"`
+	CostPerHour int64     `json:"cost_per_hour"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func serverList(ctx context.Context, e *env, owner, status string, limit int) error {
+	if limit <= 0 {
+		limit = 50
+	}
+	var where []string
+	var args []any
+	if owner != "" {
+		args = append(args, owner)
+		where = append(where, "discord_id = $"+strconv.Itoa(len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		where = append(where, "status = $"+strconv.Itoa(len(args)))
+	}
+	query := `SELECT id, discord_id, name, game_type, status, COALESCE(address, ''), COALESCE(port, 0),
+		COALESCE(cost_per_hour, 0), created_at FROM game_servers`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("list servers: %w", err)
+	}
+	defer rows.Close()
+
+	servers := []server{}
+	for rows.Next() {
+		var s server
+		if err := rows.Scan(&s.ID, &s.DiscordID, &s.Name, &s.GameType, &s.Status, &s.Address, &s.Port,
+			&s.CostPerHour, &s.CreatedAt); err != nil {
+			return fmt.Errorf("scan server: %w", err)
+		}
+		servers = append(servers, s)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list servers: %w", err)
+	}
+
+	return e.emit(servers, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tOWNER\tNAME\tGAME\tSTATUS\tADDRESS\tGC/H\tCREATED")
+		for _, s := range servers {
+			addr := s.Address
+			if addr != "" && s.Port != 0 {
+				addr += ":" + strconv.Itoa(s.Port)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", s.ID, s.DiscordID, s.Name, s.GameType, s.Status,
+				addr, s.CostPerHour, s.CreatedAt.Format(time.RFC3339))
+		}
+		tw.Flush()
+	})
+}
+
+type stopResult struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Owner  string `json:"discord_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// Statuses a server cannot be stopped from.
+var stoppedStatuses = map[string]bool{"stopping": true, "stopped": true, "deleted": true}
+
+func serverStop(ctx context.Context, e *env, arg, reason string) error {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return fmt.Errorf("server id must be an integer, got %q", arg)
+	}
+	if reason == "" {
+		return usageError("--reason is required")
+	}
+	res := &stopResult{ID: id, To: "stopping", DryRun: e.dryRun}
+
+	lookupServer := func(q queryer, lock string) error {
+		err := q.QueryRowContext(ctx,
+			`SELECT name, discord_id, status FROM game_servers WHERE id = $1`+lock, id,
+		).Scan(&res.Name, &res.Owner, &res.From)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("server %d not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("look up server: %w", err)
+		}
+		if stoppedStatuses[res.From] {
+			return fmt.Errorf("server %d is already %s", id, res.From)
+		}
+		return nil
+	}
+
+	if e.dryRun {
+		if err := lookupServer(e.db, ""); err != nil {
+			return err
+		}
+	} else {
+		err := e.inTx(ctx, func(tx *sql.Tx) error {
+			if err := lookupServer(tx, " FOR UPDATE"); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE game_servers SET status = 'stopping', is_public = false WHERE id = $1`, id,
+			); err != nil {
+				return fmt.Errorf("update server: %w", err)
+			}
+			_, err := e.audit.RecordTx(ctx, tx, audit.Event{
+				Actor:  e.actor,
+				Action: "server.stop",
+				Target: audit.Target{Type: "server", ID: strconv.FormatInt(id, 10)},
+				Before: map[string]any{"status": res.From},
+				After:  map[string]any{"status": res.To, "owner": res.Owner, "reason": reason},
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.emit(res, func(w io.Writer) {
+		fmt.Fprintf(w, "Server %d (%s, owner %s): %s -> %s\n", res.ID, res.Name, res.Owner, res.From, res.To)
+		e.dryRunNote(w)
+	})
+}
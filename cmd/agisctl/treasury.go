@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+func init() {
+	var history int
+	register(&command{
+		name:    "treasury show",
+		args:    "<guild-id>",
+		summary: "Show a guild treasury's balance, runway and recent transactions",
+		nargs:   1,
+		flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&history, "history", 10, "number of recent transactions to show")
+		},
+		run: func(ctx context.Context, e *env, args []string) error {
+			return treasuryShow(ctx, e, args[0], history)
+		},
+	})
+}
+
+// operatorAuthorizer grants the CLI operator full access. Anyone holding
+// the database URL already has it.
+type operatorAuthorizer struct{}
+
+func (operatorAuthorizer) GuildRole(context.Context, string, string) (treasury.Role, error) {
+	return treasury.RoleOwner, nil
+}
+
+func (operatorAuthorizer) IsPlatformAdmin(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+type treasuryInfo struct {
+	*treasury.Summary
+	LedgerBalance int64                  `json:"ledger_balance"`
+	History       []treasury.Transaction `json:"history"`
+}
+
+func treasuryShow(ctx context.Context, e *env, guildID string, history int) error {
+	l := ledger.New(e.db)
+	svc := treasury.NewService(e.db, l, operatorAuthorizer{})
+
+	sum, err := svc.Summary(ctx, guildID, e.actor)
+	if err != nil {
+		return err
+	}
+	info := &treasuryInfo{Summary: sum}
+	if info.LedgerBalance, err = l.Balance(ctx, ledger.GuildAccount(guildID), ledger.CurrencyGC); err != nil {
+		return err
+	}
+	if history > 0 {
+		if info.History, err = svc.History(ctx, guildID, e.actor, history, 0); err != nil {
+			return err
+		}
+	}
+
+	return e.emit(info, func(w io.Writer) {
+		fmt.Fprintf(w, "Guild:    %s\n", sum.GuildID)
+		fmt.Fprintf(w, "Balance:  %d GC (ledger %d)\n", sum.Balance, info.LedgerBalance)
+		if sum.Balance != info.LedgerBalance {
+			fmt.Fprintln(w, "Warning:  guild_treasury differs from the ledger")
+		}
+		fmt.Fprintf(w, "Earned:   %d GC, spent %d GC\n", sum.TotalEarned, sum.TotalSpent)
+		fmt.Fprintf(w, "Servers:  %d active, %d GC/h, %d GC/day\n", sum.ActiveServers, sum.HourlyCost, sum.DailyBurn)
+		if sum.RunwayHours != nil {
+			fmt.Fprintf(w, "Runway:   %.1f h (until %s)\n", *sum.RunwayHours, sum.DepletesAt.Format(time.RFC3339))
+		}
+		if len(info.History) == 0 {
+			return
+		}
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tWHEN\tTYPE\tAMOUNT\tSOURCE\tBY\tDESCRIPTION")
+		for _, t := range info.History {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", t.ID, t.CreatedAt.Format(time.RFC3339), t.Type,
+				t.Amount, t.Source, t.CreatedBy, t.Description)
+		}
+		tw.Flush()
+	})
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/ledger"
+)
+
+// Tiers accepted by "tier grant". Paid tiers match the subscriptions
+// table check constraint.
+var tiers = map[string]bool{"free": true, "premium": true, "premium_plus": true}
+
+func init() {
+	register(&command{
+		name:    "user show",
+		args:    "<discord-id>",
+		summary: "Show a user's balances, tier and subscription",
+		nargs:   1,
+		run:     userShow,
+	})
+
+	var currency, reason, key string
+	register(&command{
+		name:    "credits adjust",
+		args:    "<discord-id> <amount>",
+		summary: "Credit (positive) or debit (negative) a user through the ledger",
+		nargs:   2,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&currency, "currency", string(ledger.CurrencyGC), "GC or WTG")
+			fs.StringVar(&reason, "reason", "", "reason recorded on the ledger entry (required)")
+			fs.StringVar(&key, "idempotency-key", "", "ledger idempotency key; re-running with the same key is a no-op")
+		},
+		run: func(ctx context.Context, e *env, args []string) error {
+			return creditsAdjust(ctx, e, args, ledger.Currency(strings.ToUpper(currency)), reason, key)
+		},
+	})
+
+	var days int
+	var grantReason string
+	register(&command{
+		name:    "tier grant",
+		args:    "<discord-id> <free|premium|premium_plus>",
+		summary: "Set a user's tier; paid tiers get a subscription period",
+		nargs:   2,
+		flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&days, "days", 30, "length of the granted subscription period")
+			fs.StringVar(&grantReason, "reason", "", "reason recorded in the audit log (required)")
+		},
+		run: func(ctx context.Context, e *env, args []string) error {
+			return tierGrant(ctx, e, args[0], args[1], days, grantReason)
+		},
+	})
+}
+
+type userInfo struct {
+	DiscordID    string        `json:"discord_id"`
+	Tier         string        `json:"tier"`
+	Credits      int64         `json:"credits"`
+	WTGCoins     int64         `json:"wtg_coins"`
+	LedgerGC     int64         `json:"ledger_gc"`
+	LedgerWTG    int64         `json:"ledger_wtg"`
+	Subscription *subscription `json:"subscription,omitempty"`
+}
+
+type subscription struct {
+	Tier      string    `json:"tier"`
+	Status    string    `json:"status"`
+	PeriodEnd time.Time `json:"period_end"`
+	Stripe    bool      `json:"stripe"`
+}
+
+func userShow(ctx context.Context, e *env, args []string) error {
+	u := &userInfo{DiscordID: args[0]}
+	err := e.db.QueryRowContext(ctx, `
+		SELECT COALESCE(tier, 'free'), COALESCE(credits, 0), COALESCE(wtg_coins, 0)
+		FROM users WHERE discord_id = $1
+	`, u.DiscordID).Scan(&u.Tier, &u.Credits, &u.WTGCoins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %s not found", u.DiscordID)
+	}
+	if err != nil {
+		return fmt.Errorf("look up user: %w", err)
+	}
+
+	l := ledger.New(e.db)
+	acct := ledger.UserAccount(u.DiscordID)
+	if u.LedgerGC, err = l.Balance(ctx, acct, ledger.CurrencyGC); err != nil {
+		return err
+	}
+	if u.LedgerWTG, err = l.Balance(ctx, acct, ledger.CurrencyWTG); err != nil {
+		return err
+	}
+
+	sub := &subscription{}
+	err = e.db.QueryRowContext(ctx, `
+		SELECT tier, status, current_period_end, stripe_subscription_id IS NOT NULL
+		FROM subscriptions
+		WHERE discord_id = $1
+		ORDER BY current_period_end DESC
+		LIMIT 1
+	`, u.DiscordID).Scan(&sub.Tier, &sub.Status, &sub.PeriodEnd, &sub.Stripe)
+	switch {
+	case err == nil:
+		u.Subscription = sub
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("look up subscription: %w", err)
+	}
+
+	return e.emit(u, func(w io.Writer) {
+		fmt.Fprintf(w, "User:     %s\n", u.DiscordID)
+		fmt.Fprintf(w, "Tier:     %s\n", u.Tier)
+		fmt.Fprintf(w, "Credits:  %d GC (ledger %d)\n", u.Credits, u.LedgerGC)
+		fmt.Fprintf(w, "WTG:      %d (ledger %d)\n", u.WTGCoins, u.LedgerWTG)
+		if u.Credits != u.LedgerGC || u.WTGCoins != u.LedgerWTG {
+			fmt.Fprintln(w, "Warning:  users balance cache differs from the ledger")
+		}
+		if s := u.Subscription; s != nil {
+			source := "granted"
+			if s.Stripe {
+				source = "stripe"
+			}
+			fmt.Fprintf(w, "Sub:      %s, %s until %s (%s)\n", s.Tier, s.Status, s.PeriodEnd.Format(time.RFC3339), source)
+		}
+	})
+}
+
+type adjustResult struct {
+	DiscordID     string `json:"discord_id"`
+	Currency      string `json:"currency"`
+	Amount        int64  `json:"amount"`
+	BalanceBefore int64  `json:"balance_before"`
+	BalanceAfter  int64  `json:"balance_after"`
+	LedgerEntryID int64  `json:"ledger_entry_id,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"`
+	DryRun        bool   `json:"dry_run"`
+}
+
+func creditsAdjust(ctx context.Context, e *env, args []string, cur ledger.Currency, reason, key string) error {
+	discordID := args[0]
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount == 0 {
+		return fmt.Errorf("amount must be a non-zero integer, got %q", args[1])
+	}
+	if cur != ledger.CurrencyGC && cur != ledger.CurrencyWTG {
+		return fmt.Errorf("currency must be GC or WTG, got %q", cur)
+	}
+	if reason == "" {
+		return usageError("--reason is required")
+	}
+
+	user := ledger.UserAccount(discordID)
+	res := &adjustResult{DiscordID: discordID, Currency: string(cur), Amount: amount, DryRun: e.dryRun}
+
+	if e.dryRun {
+		l := ledger.New(e.db)
+		if res.BalanceBefore, err = l.Balance(ctx, user, cur); err != nil {
+			return err
+		}
+		res.BalanceAfter = res.BalanceBefore + amount
+		if res.BalanceAfter < 0 {
+			return fmt.Errorf("%w: %s would have %d %s", ledger.ErrInsufficientFunds, user, res.BalanceAfter, cur)
+		}
+		return e.emitAdjust(res)
+	}
+
+	entry := ledger.TransferEntry(ledger.System, user, cur, amount, "admin_adjustment", reason)
+	if amount < 0 {
+		entry = ledger.TransferEntry(user, ledger.System, cur, -amount, "admin_adjustment", reason)
+	}
+	entry.CreatedBy = e.actor
+	entry.IdempotencyKey = key
+
+	id, err := ledger.New(e.db).PostWith(ctx, entry, func(ctx context.Context, tx *sql.Tx, entryID int64) error {
+		if err := tx.QueryRowContext(ctx,
+			`SELECT balance FROM ledger_balances WHERE account = $1 AND currency = $2`,
+			user.String(), string(cur),
+		).Scan(&res.BalanceAfter); err != nil {
+			return fmt.Errorf("read balance: %w", err)
+		}
+		res.BalanceBefore = res.BalanceAfter - amount
+		_, err := e.audit.RecordTx(ctx, tx, audit.Event{
+			Actor:  e.actor,
+			Action: "credits.adjust",
+			Target: audit.Target{Type: "user", ID: discordID},
+			Before: map[string]any{"currency": cur, "balance": res.BalanceBefore},
+			After: map[string]any{
+				"currency":        cur,
+				"balance":         res.BalanceAfter,
+				"amount":          amount,
+				"reason":          reason,
+				"ledger_entry_id": entryID,
+			},
+		})
+		return err
+	})
+	if errors.Is(err, ledger.ErrDuplicate) {
+		res.LedgerEntryID, res.Duplicate = id, true
+		return e.emitAdjust(res)
+	}
+	if err != nil {
+		return err
+	}
+	res.LedgerEntryID = id
+	return e.emitAdjust(res)
+}
+
+func (e *env) emitAdjust(res *adjustResult) error {
+	return e.emit(res, func(w io.Writer) {
+		if res.Duplicate {
+			fmt.Fprintf(w, "Already applied as ledger entry %d; nothing changed\n", res.LedgerEntryID)
+			return
+		}
+		fmt.Fprintf(w, "%s: %+d %s, balance %d -> %d", res.DiscordID, res.Amount, res.Currency, res.BalanceBefore, res.BalanceAfter)
+		if res.LedgerEntryID != 0 {
+			fmt.Fprintf(w, " (ledger entry %d)", res.LedgerEntryID)
+		}
+		fmt.Fprintln(w)
+		e.dryRunNote(w)
+	})
+}
+
+type tierResult struct {
+	DiscordID string     `json:"discord_id"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DryRun    bool       `json:"dry_run"`
+}
+
+func tierGrant(ctx context.Context, e *env, discordID, tier string, days int, reason string) error {
+	if !tiers[tier] {
+		return fmt.Errorf("tier must be free, premium or premium_plus, got %q", tier)
+	}
+	if tier != "free" && days <= 0 {
+		return fmt.Errorf("--days must be positive, got %d", days)
+	}
+	if reason == "" {
+		return usageError("--reason is required")
+	}
+
+	now := e.now().UTC()
+	res := &tierResult{DiscordID: discordID, To: tier, DryRun: e.dryRun}
+	if tier != "free" {
+		expires := now.AddDate(0, 0, days)
+		res.ExpiresAt = &expires
+	}
+
+	if e.dryRun {
+		if err := lookupTier(ctx, e.db, discordID, false, &res.From); err != nil {
+			return err
+		}
+		return e.emitTier(res)
+	}
+
+	err := e.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lookupTier(ctx, tx, discordID, true, &res.From); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE users SET tier = $2 WHERE discord_id = $1`, discordID, tier,
+		); err != nil {
+			return fmt.Errorf("update tier: %w", err)
+		}
+		// A grant replaces whatever is active. Stripe-managed subscriptions
+		// are cancelled here only; cancel them in Stripe too if the grant
+		// should stick past their next renewal.
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE subscriptions SET status = 'canceled', updated_at = $2
+			WHERE discord_id = $1 AND status = 'active'
+		`, discordID, now); err != nil {
+			return fmt.Errorf("cancel subscriptions: %w", err)
+		}
+		if res.ExpiresAt != nil {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO subscriptions (discord_id, tier, status, current_period_start, current_period_end)
+				VALUES ($1, $2, 'active', $3, $4)
+			`, discordID, tier, now, *res.ExpiresAt); err != nil {
+				return fmt.Errorf("insert subscription: %w", err)
+			}
+		}
+
+		_, err := e.audit.RecordTx(ctx, tx, audit.Event{
+			Actor:  e.actor,
+			Action: "tier.grant",
+			Target: audit.Target{Type: "user", ID: discordID},
+			Before: map[string]any{"tier": res.From},
+			After:  map[string]any{"tier": tier, "expires_at": res.ExpiresAt, "reason": reason},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return e.emitTier(res)
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func lookupTier(ctx context.Context, q queryer, discordID string, lock bool, tier *string) error {
+	query := `SELECT COALESCE(tier, 'free') FROM users WHERE discord_id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	err := q.QueryRowContext(ctx, query, discordID).Scan(tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %s not found", discordID)
+	}
+	if err != nil {
+		return fmt.Errorf("look up user: %w", err)
+	}
+	return nil
+}
+
+func (e *env) emitTier(res *tierResult) error {
+	return e.emit(res, func(w io.Writer) {
+		fmt.Fprintf(w, "%s: tier %s -> %s", res.DiscordID, res.From, res.To)
+		if res.ExpiresAt != nil {
+			fmt.Fprintf(w, " until %s", res.ExpiresAt.Format(time.RFC3339))
+		}
+		fmt.Fprintln(w)
+		e.dryRunNote(w)
+	})
+}
@@ -0,0 +1,15 @@
+// Package migrations embeds the AGIS database migrations so the bot and
+// agisctl can apply them without the SQL files on disk.
+//
+// Each vX.Y.Z-name.sql file is one migration; an optional
+// vX.Y.Z-name.down.sql next to it reverts it. Migrations that hold
+// financial or compliance records (the credit ledger, GDPR erasures,
+// consent texts and the audit log) deliberately have none.
+package migrations
+
+import "embed"
+
+// FS holds every migration file in this directory.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,127 @@
+-- Migration v2.1.0: Double-entry credit ledger
+-- Every balance movement is recorded as a balanced set of postings.
+-- users.credits / users.wtg_coins become caches of the ledger balances.
+
+-- ============================================================================
+-- Ledger Tables
+-- ============================================================================
+
+-- Journal entries (one per business event: purchase, gift, conversion, ...)
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    entry_type VARCHAR(50) NOT NULL, -- 'purchase', 'ad_reward', 'gift', 'conversion', 'server_cost', ...
+    description TEXT,
+    idempotency_key VARCHAR(200) UNIQUE, -- e.g. Stripe session ID, ayeT conversion ID
+    created_by VARCHAR(32), -- Discord user ID or 'system'
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Postings (positive = credit to account, negative = debit from account)
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES ledger_entries(id) ON DELETE RESTRICT,
+    account VARCHAR(100) NOT NULL, -- 'user:<discord_id>', 'guild:<guild_id>', 'STRIPE', 'ADS', 'SYSTEM', 'BURN'
+    currency VARCHAR(10) NOT NULL CHECK (currency IN ('GC', 'WTG')),
+    amount BIGINT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry_id ON ledger_postings(entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings(account, currency);
+
+-- Materialised balances, maintained in the same transaction as the postings
+CREATE TABLE IF NOT EXISTS ledger_balances (
+    account VARCHAR(100) NOT NULL,
+    currency VARCHAR(10) NOT NULL CHECK (currency IN ('GC', 'WTG')),
+    balance BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account, currency),
+    -- Only system accounts (STRIPE, ADS, SYSTEM, BURN) may go negative
+    CHECK (balance >= 0 OR account NOT LIKE '%:%')
+);
+
+-- ============================================================================
+-- Balance Invariant
+-- ============================================================================
+
+-- Function: Reject entries whose postings do not sum to zero per currency
+CREATE OR REPLACE FUNCTION ledger_check_entry_balanced()
+RETURNS TRIGGER AS $$
+DECLARE
+    unbalanced RECORD;
+BEGIN
+    SELECT currency, SUM(amount) AS total INTO unbalanced
+    FROM ledger_postings
+    WHERE entry_id = NEW.entry_id
+    GROUP BY currency
+    HAVING SUM(amount) <> 0
+    LIMIT 1;
+
+    IF FOUND THEN
+        RAISE EXCEPTION 'ledger entry % is unbalanced in % by %', NEW.entry_id, unbalanced.currency, unbalanced.total;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Trigger: Checked at commit so multi-posting entries can be inserted row by row
+DROP TRIGGER IF EXISTS ledger_entry_balanced_trigger ON ledger_postings;
+CREATE CONSTRAINT TRIGGER ledger_entry_balanced_trigger
+AFTER INSERT ON ledger_postings
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW
+EXECUTE FUNCTION ledger_check_entry_balanced();
+
+-- View: Balances derived purely from postings (used by the invariant checker)
+CREATE OR REPLACE VIEW ledger_derived_balances AS
+SELECT
+    account,
+    currency,
+    SUM(amount) AS balance
+FROM ledger_postings
+GROUP BY account, currency;
+
+-- ============================================================================
+-- Opening Balances
+-- ============================================================================
+
+-- Import balances that existed before the ledger as postings from SYSTEM,
+-- so the ledger, the users table and guild_treasury agree from day one.
+DO $$
+DECLARE
+    opening_id BIGINT;
+BEGIN
+    IF EXISTS (SELECT 1 FROM ledger_entries WHERE idempotency_key = 'opening-balance-v2.1.0') THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO ledger_entries (entry_type, description, idempotency_key, created_by)
+    VALUES ('opening_balance', 'Opening balances imported from users and guild_treasury', 'opening-balance-v2.1.0', 'system')
+    RETURNING id INTO opening_id;
+
+    INSERT INTO ledger_postings (entry_id, account, currency, amount)
+    SELECT opening_id, 'user:' || discord_id, 'GC', credits FROM users WHERE credits > 0
+    UNION ALL
+    SELECT opening_id, 'user:' || discord_id, 'WTG', wtg_coins FROM users WHERE wtg_coins > 0
+    UNION ALL
+    SELECT opening_id, 'guild:' || guild_id, 'GC', balance FROM guild_treasury WHERE balance > 0;
+
+    INSERT INTO ledger_postings (entry_id, account, currency, amount)
+    SELECT opening_id, 'SYSTEM', currency, -SUM(amount)
+    FROM ledger_postings
+    WHERE entry_id = opening_id
+    GROUP BY currency;
+
+    INSERT INTO ledger_balances (account, currency, balance)
+    SELECT account, currency, SUM(amount)
+    FROM ledger_postings
+    WHERE entry_id = opening_id
+    GROUP BY account, currency
+    ON CONFLICT (account, currency) DO UPDATE SET balance = ledger_balances.balance + EXCLUDED.balance;
+END $$;
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.1.0-credit-ledger')
+ON CONFLICT (version) DO NOTHING;
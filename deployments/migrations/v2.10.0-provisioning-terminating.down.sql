@@ -0,0 +1,8 @@
+-- Revert v2.10.0: Provisioning terminating status
+-- Fails while any request is terminating; let the scheduler finish them.
+
+ALTER TABLE server_provision_requests
+    DROP CONSTRAINT IF EXISTS server_provision_requests_status_check;
+ALTER TABLE server_provision_requests
+    ADD CONSTRAINT server_provision_requests_status_check
+    CHECK (status IN ('pending', 'approved', 'provisioning', 'active', 'terminated', 'failed'));
@@ -0,0 +1,20 @@
+-- Migration v2.10.0: Provisioning terminating status
+-- Requests are marked terminating before their server is removed, so a
+-- removal that fails or is interrupted is retried by the scheduler.
+
+-- ============================================================================
+-- Request Status
+-- ============================================================================
+
+ALTER TABLE server_provision_requests
+    DROP CONSTRAINT IF EXISTS server_provision_requests_status_check;
+ALTER TABLE server_provision_requests
+    ADD CONSTRAINT server_provision_requests_status_check
+    CHECK (status IN ('pending', 'approved', 'provisioning', 'active', 'terminating', 'terminated', 'failed'));
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.10.0-provisioning-terminating')
+ON CONFLICT (version) DO NOTHING;
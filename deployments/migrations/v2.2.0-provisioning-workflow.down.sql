@@ -0,0 +1,4 @@
+-- Revert v2.2.0: Guild server provisioning workflow
+
+DROP INDEX IF EXISTS idx_provision_requests_due;
+DROP TABLE IF EXISTS server_provision_events;
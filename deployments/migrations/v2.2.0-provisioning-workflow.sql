@@ -0,0 +1,32 @@
+-- Migration v2.2.0: Guild server provisioning workflow
+-- Records every server_provision_requests state transition and indexes the
+-- columns the workflow scheduler polls.
+
+-- ============================================================================
+-- Provisioning Audit Trail
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS server_provision_events (
+    id BIGSERIAL PRIMARY KEY,
+    request_id INTEGER NOT NULL REFERENCES server_provision_requests(id) ON DELETE CASCADE,
+    from_status VARCHAR(20), -- NULL when the request is submitted
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(32) NOT NULL, -- Discord user ID or 'system'
+    reason TEXT,
+    amount INTEGER NOT NULL DEFAULT 0, -- GameCredits reserved, renewed or refunded
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_provision_events_request_id ON server_provision_events(request_id, created_at);
+
+-- Scheduler lookups: approved requests awaiting provisioning and active
+-- servers due for renewal or termination.
+CREATE INDEX IF NOT EXISTS idx_provision_requests_due
+    ON server_provision_requests(status, termination_scheduled_at);
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.2.0-provisioning-workflow')
+ON CONFLICT (version) DO NOTHING;
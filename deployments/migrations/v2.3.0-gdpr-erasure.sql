@@ -0,0 +1,34 @@
+-- Migration v2.3.0: GDPR erasure requests
+-- Tracks right-to-erasure requests through their cooling-off period and
+-- stores the signed receipt issued when the erasure is carried out.
+
+-- ============================================================================
+-- Erasure Requests
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS gdpr_erasure_requests (
+    id BIGSERIAL PRIMARY KEY,
+    subject_hash CHAR(64) NOT NULL, -- SHA-256 of the Discord ID; survives erasure
+    discord_id VARCHAR(32), -- cleared once the erasure completes
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'cancelled', 'completed')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    scheduled_for TIMESTAMP NOT NULL, -- end of the cooling-off period
+    cancelled_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    pseudonym VARCHAR(32), -- ID that replaced the Discord ID in retained financial records
+    receipt JSONB,
+    receipt_signature CHAR(64) -- HMAC-SHA256 of the receipt
+);
+
+-- At most one open request per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gdpr_erasure_pending
+    ON gdpr_erasure_requests(subject_hash) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_gdpr_erasure_due
+    ON gdpr_erasure_requests(scheduled_for) WHERE status = 'pending';
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.3.0-gdpr-erasure')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,41 @@
+-- Migration v2.4.0: Versioned consent texts
+-- Adds a registry of consent texts per type, version and locale, and records
+-- which version each consent decision was made against.
+
+-- ============================================================================
+-- Consent Texts
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS consent_texts (
+    consent_type VARCHAR(50) NOT NULL, -- 'ads', 'analytics', 'personalization'
+    version INTEGER NOT NULL CHECK (version > 0),
+    locale VARCHAR(10) NOT NULL, -- BCP 47 language tag, e.g. 'en', 'de'
+    body TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (consent_type, version, locale)
+);
+
+-- Seed version 1 in English so every type has a current text
+INSERT INTO consent_texts (consent_type, version, locale, body) VALUES
+    ('ads', 1, 'en', 'I agree to view rewarded advertisements and allow ad partners to process my data to deliver and verify them.'),
+    ('analytics', 1, 'en', 'I agree to the collection of usage analytics to help improve AGIS.'),
+    ('personalization', 1, 'en', 'I agree to personalised recommendations and offers based on my activity.')
+ON CONFLICT DO NOTHING;
+
+-- ============================================================================
+-- Consent Records
+-- ============================================================================
+
+ALTER TABLE consent_records
+    ADD COLUMN IF NOT EXISTS text_version INTEGER,
+    ADD COLUMN IF NOT EXISTS locale VARCHAR(10);
+
+CREATE INDEX IF NOT EXISTS idx_consent_user_type_created
+    ON consent_records(user_id, consent_type, created_at DESC);
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.4.0-consent-versions')
+ON CONFLICT (version) DO NOTHING;
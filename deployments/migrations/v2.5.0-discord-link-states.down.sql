@@ -0,0 +1,4 @@
+-- Revert v2.5.0: Discord account linking
+-- Pending link attempts are lost; users restart the flow.
+
+DROP TABLE IF EXISTS oauth_link_states;
@@ -0,0 +1,23 @@
+-- Migration v2.5.0: Discord account linking
+-- Server-side state for the Discord OAuth2 PKCE linking flow.
+
+-- ============================================================================
+-- OAuth Link States
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS oauth_link_states (
+    state_hash CHAR(64) PRIMARY KEY, -- SHA-256 of the state parameter
+    user_id INTEGER NOT NULL, -- Wasp user starting the link
+    code_verifier VARCHAR(128) NOT NULL, -- PKCE verifier
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_link_states_expires_at ON oauth_link_states(expires_at);
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.5.0-discord-link-states')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,6 @@
+-- Revert v2.6.0: Outbound webhooks
+-- Drops every subscription and the delivery queue.
+
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
@@ -0,0 +1,62 @@
+-- Migration v2.7.0: Audit log
+-- Append-only, hash-chained record of admin and money-moving actions.
+
+-- ============================================================================
+-- Audit Log
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL,
+    actor VARCHAR(64) NOT NULL, -- Discord ID or 'SYSTEM'
+    action VARCHAR(64) NOT NULL, -- e.g. treasury.admin_grant, provision.terminated
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(128) NOT NULL,
+    -- JSON rather than JSONB: the stored text must stay byte-identical to
+    -- what was hashed.
+    before_state JSON,
+    after_state JSON,
+    diff JSON,
+    request_id VARCHAR(64),
+    ip_address VARCHAR(64),
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE -- SHA-256 over prev_hash and the row
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_occurred_at ON audit_log(occurred_at DESC);
+
+-- ============================================================================
+-- Functions
+-- ============================================================================
+
+-- Function: Reject changes to audit rows
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+-- Trigger: Block UPDATE and DELETE
+DROP TRIGGER IF EXISTS audit_log_no_modify ON audit_log;
+CREATE TRIGGER audit_log_no_modify
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+
+-- Trigger: Block TRUNCATE
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.7.0-audit-log')
+ON CONFLICT (version) DO NOTHING;
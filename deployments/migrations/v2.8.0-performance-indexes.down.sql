@@ -0,0 +1,34 @@
+-- Revert v2.8.0: Performance indexes
+
+DROP INDEX IF EXISTS idx_users_join_date;
+DROP INDEX IF EXISTS idx_game_servers_discord_id;
+DROP INDEX IF EXISTS idx_game_servers_status;
+DROP INDEX IF EXISTS idx_game_servers_user_status;
+DROP INDEX IF EXISTS idx_game_servers_game_type;
+DROP INDEX IF EXISTS idx_game_servers_created_at;
+DROP INDEX IF EXISTS idx_ad_conversions_conversion_id;
+DROP INDEX IF EXISTS idx_ad_conversions_user_created;
+DROP INDEX IF EXISTS idx_ad_conversions_status_created;
+DROP INDEX IF EXISTS idx_consent_records_user_id;
+DROP INDEX IF EXISTS idx_consent_records_consented;
+DROP INDEX IF EXISTS idx_consent_records_ip_country;
+DROP INDEX IF EXISTS idx_consent_records_consent_timestamp;
+DROP INDEX IF EXISTS idx_consent_records_withdrawn_timestamp;
+DROP INDEX IF EXISTS idx_subscriptions_user_status;
+DROP INDEX IF EXISTS idx_command_usage_discord_id;
+DROP INDEX IF EXISTS idx_command_usage_command;
+DROP INDEX IF EXISTS idx_command_usage_used_at;
+DROP INDEX IF EXISTS idx_credit_transactions_from_user;
+DROP INDEX IF EXISTS idx_credit_transactions_to_user;
+DROP INDEX IF EXISTS idx_credit_transactions_type;
+DROP INDEX IF EXISTS idx_credit_transactions_timestamp;
+DROP INDEX IF EXISTS idx_public_servers_game_type;
+DROP INDEX IF EXISTS idx_public_servers_owner_id;
+DROP INDEX IF EXISTS idx_public_servers_added_at;
+DROP INDEX IF EXISTS idx_bot_roles_role_type;
+DROP INDEX IF EXISTS idx_bot_roles_guild_id;
+DROP INDEX IF EXISTS idx_guild_treasury_transactions_guild;
+DROP INDEX IF EXISTS idx_guild_treasury_transactions_timestamp;
+DROP INDEX IF EXISTS idx_server_reviews_server_id;
+DROP INDEX IF EXISTS idx_server_reviews_reviewer_id;
+DROP INDEX IF EXISTS idx_server_reviews_rating;
@@ -0,0 +1,83 @@
+-- Migration v2.8.0: Performance indexes
+-- Replaces services.EnsureIndexes, which created these at every startup.
+-- Several tables are created by agis-core or on first use, so each index is
+-- skipped with a NOTICE when its table or column does not exist yet.
+
+-- ============================================================================
+-- Indexes
+-- ============================================================================
+
+DO $$
+DECLARE
+    stmt TEXT;
+BEGIN
+    FOREACH stmt IN ARRAY ARRAY[
+        -- users (discord_id is the primary key; tier is indexed by v1.7.0)
+        'CREATE INDEX IF NOT EXISTS idx_users_join_date ON users(join_date)',
+
+        -- game_servers
+        'CREATE INDEX IF NOT EXISTS idx_game_servers_discord_id ON game_servers(discord_id)',
+        'CREATE INDEX IF NOT EXISTS idx_game_servers_status ON game_servers(status)',
+        'CREATE INDEX IF NOT EXISTS idx_game_servers_user_status ON game_servers(discord_id, status)',
+        'CREATE INDEX IF NOT EXISTS idx_game_servers_game_type ON game_servers(game_type)',
+        'CREATE INDEX IF NOT EXISTS idx_game_servers_created_at ON game_servers(created_at)',
+
+        -- ad_conversions (discord_id, created_at and status are indexed by v2.0)
+        'CREATE INDEX IF NOT EXISTS idx_ad_conversions_conversion_id ON ad_conversions(conversion_id)',
+        'CREATE INDEX IF NOT EXISTS idx_ad_conversions_user_created ON ad_conversions(discord_id, created_at DESC)',
+        'CREATE INDEX IF NOT EXISTS idx_ad_conversions_status_created ON ad_conversions(status, created_at DESC)',
+
+        -- consent_records
+        'CREATE INDEX IF NOT EXISTS idx_consent_records_user_id ON consent_records(user_id)',
+        'CREATE INDEX IF NOT EXISTS idx_consent_records_consented ON consent_records(consented)',
+        'CREATE INDEX IF NOT EXISTS idx_consent_records_ip_country ON consent_records(ip_country)',
+        'CREATE INDEX IF NOT EXISTS idx_consent_records_consent_timestamp ON consent_records(consent_timestamp)',
+        'CREATE INDEX IF NOT EXISTS idx_consent_records_withdrawn_timestamp ON consent_records(withdrawn_timestamp) WHERE withdrawn_timestamp IS NOT NULL',
+
+        -- subscriptions (single-column indexes are created by v2.0)
+        'CREATE INDEX IF NOT EXISTS idx_subscriptions_user_status ON subscriptions(discord_id, status)',
+
+        -- command_usage
+        'CREATE INDEX IF NOT EXISTS idx_command_usage_discord_id ON command_usage(discord_id)',
+        'CREATE INDEX IF NOT EXISTS idx_command_usage_command ON command_usage(command)',
+        'CREATE INDEX IF NOT EXISTS idx_command_usage_used_at ON command_usage(used_at DESC)',
+
+        -- credit_transactions
+        'CREATE INDEX IF NOT EXISTS idx_credit_transactions_from_user ON credit_transactions(from_user)',
+        'CREATE INDEX IF NOT EXISTS idx_credit_transactions_to_user ON credit_transactions(to_user)',
+        'CREATE INDEX IF NOT EXISTS idx_credit_transactions_type ON credit_transactions(transaction_type)',
+        'CREATE INDEX IF NOT EXISTS idx_credit_transactions_timestamp ON credit_transactions(timestamp DESC)',
+
+        -- public_servers
+        'CREATE INDEX IF NOT EXISTS idx_public_servers_game_type ON public_servers(game_type)',
+        'CREATE INDEX IF NOT EXISTS idx_public_servers_owner_id ON public_servers(owner_id)',
+        'CREATE INDEX IF NOT EXISTS idx_public_servers_added_at ON public_servers(added_at DESC)',
+
+        -- bot_roles
+        'CREATE INDEX IF NOT EXISTS idx_bot_roles_role_type ON bot_roles(role_type)',
+        'CREATE INDEX IF NOT EXISTS idx_bot_roles_guild_id ON bot_roles(guild_id)',
+
+        -- guild_treasury_transactions
+        'CREATE INDEX IF NOT EXISTS idx_guild_treasury_transactions_guild ON guild_treasury_transactions(guild_id)',
+        'CREATE INDEX IF NOT EXISTS idx_guild_treasury_transactions_timestamp ON guild_treasury_transactions(timestamp DESC)',
+
+        -- server_reviews
+        'CREATE INDEX IF NOT EXISTS idx_server_reviews_server_id ON server_reviews(server_id)',
+        'CREATE INDEX IF NOT EXISTS idx_server_reviews_reviewer_id ON server_reviews(reviewer_id)',
+        'CREATE INDEX IF NOT EXISTS idx_server_reviews_rating ON server_reviews(rating)'
+    ]
+    LOOP
+        BEGIN
+            EXECUTE stmt;
+        EXCEPTION WHEN undefined_table OR undefined_column THEN
+            RAISE NOTICE 'skipped: % (%)', stmt, SQLERRM;
+        END;
+    END LOOP;
+END $$;
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.8.0-performance-indexes')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,4 @@
+-- Revert v2.9.0: Leader elections
+-- Terms restart from 1; only safe while no replica holds leadership.
+
+DROP TABLE IF EXISTS leader_elections;
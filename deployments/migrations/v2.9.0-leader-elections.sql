@@ -0,0 +1,22 @@
+-- Migration v2.9.0: Leader elections
+-- Fencing terms for singleton background jobs elected with PostgreSQL
+-- advisory locks. The lock decides who leads; the term increases on every
+-- acquisition so writes from a deposed leader can be rejected.
+
+-- ============================================================================
+-- Leader Elections
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS leader_elections (
+    name VARCHAR(128) PRIMARY KEY, -- election name, e.g. "cleanup"
+    term BIGINT NOT NULL, -- fencing token of the current leader
+    holder VARCHAR(255) NOT NULL, -- pod name or hostname of the current leader
+    acquired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ============================================================================
+-- Migration Complete
+-- ============================================================================
+
+INSERT INTO schema_migrations (version) VALUES ('v2.9.0-leader-elections')
+ON CONFLICT (version) DO NOTHING;
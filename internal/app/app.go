@@ -1,45 +1,117 @@
 // Package app provides application lifecycle management for AGIS.
+//
+// Services are started in dependency order: a service starts once every
+// service it depends on is ready, and services with no dependency between
+// them start concurrently. They are stopped in reverse order.
+//
+// Shutdown first marks the application not ready and waits out the
+// pre-stop delay so load balancers stop routing to it, then drains: every
+// Drainable service and the Tracker stop accepting new work and finish
+// what is in flight, up to the drain timeout. Only then are services
+// stopped.
+//
+// Background services are supervised: a failed or panicking function is
+// restarted with backoff according to its Supervision, and once its
+// restart budget is exhausted Run shuts the application down.
 package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/wethegamers/agis/internal/health"
 )
 
 // App represents the main application with lifecycle management.
 type App struct {
 	name     string
 	version  string
-	services []Service
+	services []*entry
 	mu       sync.Mutex
 	started  bool
 
 	shutdownTimeout time.Duration
+	startTimeout    time.Duration
+	preStopDelay    time.Duration
+	drainTimeout    time.Duration
+	health          *health.Checker
+	tracker         *Tracker
+	running         bool
 	onStart         []func(context.Context) error
 	onStop          []func(context.Context) error
 }
 
 // Service represents a component that can be started and stopped.
+//
+// Start either returns once the service is running, or blocks for the
+// service's lifetime; a service whose Start blocks must implement Readier
+// so that its dependents can start.
 type Service interface {
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
 	Name() string
 }
 
+// Readier is implemented by services that are not ready as soon as Start
+// returns, or whose Start blocks. Run calls Ready alongside Start and
+// starts dependents once it returns nil; Ready should block until the
+// service is ready or ctx is done.
+type Readier interface {
+	Ready(ctx context.Context) error
+}
+
+// State is a service's position in the lifecycle.
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateStarting State = "starting"
+	StateReady    State = "ready"
+	StateFailed   State = "failed"
+	StateStopped  State = "stopped"
+)
+
+// ServiceStatus reports one registered service.
+type ServiceStatus struct {
+	Name      string   `json:"name"`
+	State     State    `json:"state"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// entry is a registered service with its options and state.
+type entry struct {
+	svc          Service
+	deps         []string
+	startTimeout time.Duration
+
+	state State
+	err   error
+}
+
 // Option configures the App.
 type Option func(*App)
 
+// ServiceOption configures a registered service.
+type ServiceOption func(*entry)
+
 // New creates a new App with the given options.
 func New(name, version string, opts ...Option) *App {
 	app := &App{
 		name:            name,
 		version:         version,
 		shutdownTimeout: 30 * time.Second,
+		startTimeout:    30 * time.Second,
+		drainTimeout:    20 * time.Second,
+		tracker:         NewTracker(nil),
 	}
 	for _, opt := range opts {
 		opt(app)
@@ -54,6 +126,39 @@ func WithShutdownTimeout(d time.Duration) Option {
 	}
 }
 
+// WithPreStopDelay sets how long Shutdown keeps serving after marking the
+// application not ready, so that endpoints are updated before it stops
+// accepting work. It applies only once startup has completed.
+func WithPreStopDelay(d time.Duration) Option {
+	return func(a *App) {
+		a.preStopDelay = d
+	}
+}
+
+// WithDrainTimeout sets how long Shutdown waits for in-flight work before
+// stopping services. The default is 20 seconds.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(a *App) {
+		a.drainTimeout = d
+	}
+}
+
+// WithStartTimeout sets how long each service may take to become ready,
+// unless overridden with StartTimeout. The default is 30 seconds.
+func WithStartTimeout(d time.Duration) Option {
+	return func(a *App) {
+		a.startTimeout = d
+	}
+}
+
+// WithHealth marks c ready once every service is ready, and not ready as
+// soon as shutdown begins, so /readyz follows the application.
+func WithHealth(c *health.Checker) Option {
+	return func(a *App) {
+		a.health = c
+	}
+}
+
 // WithOnStart adds a startup hook.
 func WithOnStart(fn func(context.Context) error) Option {
 	return func(a *App) {
@@ -68,14 +173,150 @@ func WithOnStop(fn func(context.Context) error) Option {
 	}
 }
 
+// DependsOn starts the service only after the named services are ready,
+// and stops it before them.
+func DependsOn(names ...string) ServiceOption {
+	return func(e *entry) {
+		e.deps = append(e.deps, names...)
+	}
+}
+
+// StartTimeout overrides the App's start timeout for one service.
+func StartTimeout(d time.Duration) ServiceOption {
+	return func(e *entry) {
+		e.startTimeout = d
+	}
+}
+
 // Register adds a service to the application.
-func (a *App) Register(svc Service) {
+func (a *App) Register(svc Service, opts ...ServiceOption) {
+	e := &entry{svc: svc, state: StatePending}
+	for _, opt := range opts {
+		opt(e)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.services = append(a.services, e)
+	if r, ok := svc.(HealthReporter); ok && a.health != nil {
+		a.health.Register("service:"+svc.Name(), r.Health)
+	}
+}
+
+// Status reports every registered service in start order.
+func (a *App) Status() []ServiceStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	order, err := a.order()
+	if err != nil {
+		order = a.services
+	}
+	out := make([]ServiceStatus, 0, len(order))
+	for _, e := range order {
+		s := ServiceStatus{Name: e.svc.Name(), State: e.state, DependsOn: e.deps}
+		if e.err != nil {
+			s.Error = e.err.Error()
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Ready reports whether every registered service is ready.
+func (a *App) Ready() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range a.services {
+		if e.state != StateReady {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *App) setState(e *entry, state State, err error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.services = append(a.services, svc)
+	e.state, e.err = state, err
 }
 
-// Run starts all services and blocks until shutdown signal.
+// order returns the services sorted so that each comes after its
+// dependencies, keeping registration order otherwise. Callers hold a.mu.
+func (a *App) order() ([]*entry, error) {
+	byName := make(map[string]*entry, len(a.services))
+	for _, e := range a.services {
+		name := e.svc.Name()
+		if _, dup := byName[name]; dup {
+			return nil, fmt.Errorf("app: service %s registered twice", name)
+		}
+		byName[name] = e
+	}
+	for _, e := range a.services {
+		for _, d := range e.deps {
+			if _, ok := byName[d]; !ok {
+				return nil, fmt.Errorf("app: service %s depends on unknown service %s", e.svc.Name(), d)
+			}
+		}
+	}
+
+	placed := make(map[string]bool, len(a.services))
+	order := make([]*entry, 0, len(a.services))
+	for len(order) < len(a.services) {
+		progress := false
+		for _, e := range a.services {
+			if placed[e.svc.Name()] || !allPlaced(e.deps, placed) {
+				continue
+			}
+			placed[e.svc.Name()] = true
+			order = append(order, e)
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("app: dependency cycle: %s", findCycle(a.services, placed, byName))
+		}
+	}
+	return order, nil
+}
+
+func allPlaced(deps []string, placed map[string]bool) bool {
+	for _, d := range deps {
+		if !placed[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle follows unplaced dependencies until a service repeats.
+func findCycle(services []*entry, placed map[string]bool, byName map[string]*entry) string {
+	var e *entry
+	for _, s := range services {
+		if !placed[s.svc.Name()] {
+			e = s
+			break
+		}
+	}
+	seen := make(map[string]int)
+	var path []string
+	for {
+		name := e.svc.Name()
+		if i, ok := seen[name]; ok {
+			return strings.Join(append(path[i:], name), " -> ")
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+		for _, d := range e.deps {
+			if !placed[d] {
+				e = byName[d]
+				break
+			}
+		}
+	}
+}
+
+// Run starts all services in dependency order and blocks until a shutdown
+// signal, a service failure or ctx is done. If a service fails to start
+// or become ready, everything is stopped and the error returned.
 func (a *App) Run(ctx context.Context) error {
 	a.mu.Lock()
 	if a.started {
@@ -83,7 +324,11 @@ func (a *App) Run(ctx context.Context) error {
 		return fmt.Errorf("app already started")
 	}
 	a.started = true
+	order, err := a.order()
 	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
 	// Run startup hooks
 	for _, hook := range a.onStart {
@@ -92,29 +337,46 @@ func (a *App) Run(ctx context.Context) error {
 		}
 	}
 
-	// Start all services
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(a.services))
-
-	for _, svc := range a.services {
-		wg.Add(1)
-		go func(s Service) {
-			defer wg.Done()
-			if err := s.Start(ctx); err != nil {
-				errCh <- fmt.Errorf("service %s failed: %w", s.Name(), err)
-			}
-		}(svc)
-	}
-
-	// Wait for shutdown signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	// errCh receives failures of services that are already running.
+	errCh := make(chan error, len(order))
+	startCtx, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+	startDone := make(chan error, 1)
+	go func() { startDone <- a.startAll(ctx, startCtx, order, errCh) }()
+
+	select {
+	case err := <-startDone:
+		if err != nil {
+			fmt.Printf("Startup failed: %v, initiating shutdown...\n", err)
+			return errors.Join(err, a.Shutdown())
+		}
+		a.mu.Lock()
+		a.running = true
+		a.mu.Unlock()
+		if a.health != nil {
+			a.health.SetReady(true)
+		}
+	case sig := <-sigCh:
+		cancelStart()
+		<-startDone
+		fmt.Printf("\nReceived signal %v during startup, initiating graceful shutdown...\n", sig)
+		return a.Shutdown()
+	case <-ctx.Done():
+		<-startDone
+		fmt.Printf("Context cancelled during startup, initiating shutdown...\n")
+		return a.Shutdown()
+	}
 
 	select {
 	case sig := <-sigCh:
 		fmt.Printf("\nReceived signal %v, initiating graceful shutdown...\n", sig)
 	case err := <-errCh:
 		fmt.Printf("Service error: %v, initiating shutdown...\n", err)
+		return errors.Join(err, a.Shutdown())
 	case <-ctx.Done():
 		fmt.Printf("Context cancelled, initiating shutdown...\n")
 	}
@@ -122,19 +384,162 @@ func (a *App) Run(ctx context.Context) error {
 	return a.Shutdown()
 }
 
-// Shutdown gracefully stops all services.
+// startAll starts each service once its dependencies are ready. Services
+// run under runCtx; startCtx bounds only the startup itself.
+func (a *App) startAll(runCtx, startCtx context.Context, order []*entry, errCh chan<- error) error {
+	startCtx, cancel := context.WithCancel(startCtx)
+	defer cancel()
+
+	ready := make(map[string]chan struct{}, len(order))
+	for _, e := range order {
+		ready[e.svc.Name()] = make(chan struct{})
+	}
+	failed := make(chan error, len(order))
+	var wg sync.WaitGroup
+	for _, e := range order {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			for _, d := range e.deps {
+				select {
+				case <-ready[d]:
+				case <-startCtx.Done():
+					return
+				}
+			}
+			if err := a.startOne(runCtx, startCtx, e, errCh); err != nil {
+				failed <- err
+				cancel()
+				return
+			}
+			close(ready[e.svc.Name()])
+		}(e)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return startCtx.Err()
+	}
+}
+
+// startOne starts a service and waits until it is ready or its start
+// timeout expires.
+func (a *App) startOne(runCtx, startCtx context.Context, e *entry, errCh chan<- error) error {
+	name := e.svc.Name()
+	timeout := e.startTimeout
+	if timeout <= 0 {
+		timeout = a.startTimeout
+	}
+	ctx, cancel := context.WithTimeout(startCtx, timeout)
+	defer cancel()
+
+	a.setState(e, StateStarting, nil)
+	started := make(chan error, 1)
+	go func() { started <- e.svc.Start(runCtx) }()
+	var ready chan error
+	if r, ok := e.svc.(Readier); ok {
+		ready = make(chan error, 1)
+		go func() { ready <- r.Ready(ctx) }()
+	}
+
+	fail := func(err error) error {
+		a.setState(e, StateFailed, err)
+		return fmt.Errorf("service %s failed: %w", name, err)
+	}
+	for {
+		select {
+		case err := <-started:
+			if err != nil {
+				return fail(err)
+			}
+			if ready == nil {
+				a.setState(e, StateReady, nil)
+				a.watch(e, errCh)
+				return nil
+			}
+			started = nil
+		case err := <-ready:
+			if err != nil {
+				if startCtx.Err() != nil {
+					return startCtx.Err()
+				}
+				return fail(fmt.Errorf("not ready: %w", err))
+			}
+			if started != nil {
+				// Start blocks for the service's lifetime; report
+				// it if it returns an error later.
+				go func(started <-chan error) {
+					if err := <-started; err != nil {
+						a.setState(e, StateFailed, err)
+						errCh <- fmt.Errorf("service %s failed: %w", name, err)
+					}
+				}(started)
+			}
+			a.setState(e, StateReady, nil)
+			a.watch(e, errCh)
+			return nil
+		case <-ctx.Done():
+			if startCtx.Err() != nil {
+				return startCtx.Err()
+			}
+			return fail(fmt.Errorf("not ready within %s", timeout))
+		}
+	}
+}
+
+// watch reports a Failer's failure after it has started.
+func (a *App) watch(e *entry, errCh chan<- error) {
+	f, ok := e.svc.(Failer)
+	if !ok {
+		return
+	}
+	go func() {
+		if err, ok := <-f.Failed(); ok {
+			a.setState(e, StateFailed, err)
+			errCh <- fmt.Errorf("service %s failed: %w", e.svc.Name(), err)
+		}
+	}()
+}
+
+// Shutdown gracefully stops all services in reverse dependency order.
 func (a *App) Shutdown() error {
+	if a.health != nil {
+		a.health.SetReady(false)
+	}
+
+	a.mu.Lock()
+	order, err := a.order()
+	if err != nil {
+		order = a.services
+	}
+	wasRunning := a.running
+	a.running = false
+	a.mu.Unlock()
+
+	if wasRunning && a.preStopDelay > 0 {
+		fmt.Printf("Not ready, waiting %s before draining...\n", a.preStopDelay)
+		time.Sleep(a.preStopDelay)
+	}
+	a.drain(order)
+
 	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
 	defer cancel()
-
 	var errs []error
 
 	// Stop services in reverse order
-	for i := len(a.services) - 1; i >= 0; i-- {
-		svc := a.services[i]
-		if err := svc.Stop(ctx); err != nil {
-			errs = append(errs, fmt.Errorf("stopping %s: %w", svc.Name(), err))
+	for i := len(order) - 1; i >= 0; i-- {
+		e := order[i]
+		if err := e.svc.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", e.svc.Name(), err))
+		}
+		a.mu.Lock()
+		if e.state != StateFailed {
+			e.state = StateStopped
 		}
+		a.mu.Unlock()
 	}
 
 	// Run shutdown hooks
@@ -150,6 +555,45 @@ func (a *App) Shutdown() error {
 	return nil
 }
 
+// drain drains the tracker and every started Drainable service at once,
+// logging whatever is still running at the drain timeout.
+func (a *App) drain(order []*entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.drainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	report := func(name string, err error) {
+		if err != nil {
+			fmt.Printf("Drain of %s incomplete: %v\n", name, err)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		report("in-flight operations", a.tracker.Drain(ctx))
+	}()
+	for _, e := range order {
+		d, ok := e.svc.(Drainable)
+		a.mu.Lock()
+		started := e.state == StateReady
+		a.mu.Unlock()
+		if !ok || !started {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report(e.svc.Name(), d.Drain(ctx))
+		}()
+	}
+	wg.Wait()
+}
+
+// Tracker returns the tracker for in-flight work, drained on shutdown.
+func (a *App) Tracker() *Tracker {
+	return a.tracker
+}
+
 // Name returns the application name.
 func (a *App) Name() string {
 	return a.name
@@ -165,6 +609,11 @@ type ServiceFunc struct {
 	name    string
 	startFn func(context.Context) error
 	stopFn  func(context.Context) error
+	readyFn func(context.Context) error
+	drainFn func(context.Context) error
+
+	once    sync.Once
+	started chan struct{}
 }
 
 // NewServiceFunc creates a Service from functions.
@@ -173,49 +622,73 @@ func NewServiceFunc(name string, start, stop func(context.Context) error) *Servi
 		name:    name,
 		startFn: start,
 		stopFn:  stop,
+		started: make(chan struct{}),
 	}
 }
 
-func (s *ServiceFunc) Name() string                    { return s.name }
-func (s *ServiceFunc) Start(ctx context.Context) error { return s.startFn(ctx) }
-func (s *ServiceFunc) Stop(ctx context.Context) error  { return s.stopFn(ctx) }
+// WithReady sets the readiness check, for start functions that block
+// such as ListenAndServe.
+func (s *ServiceFunc) WithReady(ready func(context.Context) error) *ServiceFunc {
+	s.readyFn = ready
+	return s
+}
 
-// BackgroundService runs a function in the background until stopped.
-type BackgroundService struct {
-	name   string
-	fn     func(context.Context) error
-	cancel context.CancelFunc
-	done   chan struct{}
+// WithDrain sets the function that stops accepting new work and waits
+// for in-flight work, such as http.Server.Shutdown.
+func (s *ServiceFunc) WithDrain(drain func(context.Context) error) *ServiceFunc {
+	s.drainFn = drain
+	return s
 }
 
-// NewBackgroundService creates a service that runs in the background.
-func NewBackgroundService(name string, fn func(context.Context) error) *BackgroundService {
-	return &BackgroundService{
-		name: name,
-		fn:   fn,
-		done: make(chan struct{}),
+func (s *ServiceFunc) Name() string { return s.name }
+
+func (s *ServiceFunc) Start(ctx context.Context) error {
+	if err := s.startFn(ctx); err != nil {
+		return err
 	}
+	s.once.Do(func() { close(s.started) })
+	return nil
 }
 
-func (s *BackgroundService) Name() string { return s.name }
+func (s *ServiceFunc) Stop(ctx context.Context) error { return s.stopFn(ctx) }
 
-func (s *BackgroundService) Start(ctx context.Context) error {
-	ctx, s.cancel = context.WithCancel(ctx)
-	go func() {
-		defer close(s.done)
-		_ = s.fn(ctx)
-	}()
-	return nil
+// Drain calls the drain function, if any.
+func (s *ServiceFunc) Drain(ctx context.Context) error {
+	if s.drainFn == nil {
+		return nil
+	}
+	return s.drainFn(ctx)
 }
 
-func (s *BackgroundService) Stop(ctx context.Context) error {
-	if s.cancel != nil {
-		s.cancel()
+// Ready calls the readiness check, or without one waits for the start
+// function to return.
+func (s *ServiceFunc) Ready(ctx context.Context) error {
+	if s.readyFn != nil {
+		return s.readyFn(ctx)
 	}
 	select {
-	case <-s.done:
+	case <-s.started:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
+
+// DialReady returns a readiness check that succeeds once addr accepts TCP
+// connections, for servers that do not report when they are listening.
+func DialReady(addr string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		for {
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				return conn.Close()
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s not accepting connections: %w", addr, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+}
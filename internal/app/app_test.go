@@ -3,8 +3,13 @@ package app
 import (
 	"context"
 	"errors"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/wethegamers/agis/internal/health"
 )
 
 type mockService struct {
@@ -104,3 +109,211 @@ func TestServiceFunc(t *testing.T) {
 		t.Error("stop function not called")
 	}
 }
+
+type failingService struct {
+	mockService
+}
+
+func (f *failingService) Start(ctx context.Context) error { return errors.New("port in use") }
+
+func TestRunServiceFailureStopsAll(t *testing.T) {
+	app := New("test", "1.0", WithShutdownTimeout(time.Second))
+	db := &mockService{name: "database"}
+	api := &failingService{mockService{name: "api"}}
+	app.Register(db)
+	app.Register(api)
+
+	err := app.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "port in use") {
+		t.Errorf("expected the service error, got %v", err)
+	}
+	if !db.stopped || !api.stopped {
+		t.Error("services not stopped after a start failure")
+	}
+}
+
+func TestBackgroundServiceStopBeforeStart(t *testing.T) {
+	svc := NewBackgroundService("cleanup", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := svc.Stop(ctx); err != nil {
+		t.Errorf("stop before start: %v", err)
+	}
+}
+
+// recorder logs lifecycle events from several services in order.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+// slowService becomes ready some time after Start returns.
+type slowService struct {
+	name  string
+	delay time.Duration
+	rec   *recorder
+}
+
+func (s *slowService) Name() string { return s.name }
+func (s *slowService) Start(ctx context.Context) error {
+	s.rec.add("start:" + s.name)
+	return nil
+}
+func (s *slowService) Stop(ctx context.Context) error {
+	s.rec.add("stop:" + s.name)
+	return nil
+}
+func (s *slowService) Ready(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		s.rec.add("ready:" + s.name)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestRunStartsInDependencyOrder(t *testing.T) {
+	rec := &recorder{}
+	checker := health.NewChecker()
+	app := New("test", "1.0", WithHealth(checker))
+	// Registered out of order on purpose.
+	app.Register(&slowService{name: "scheduler", rec: rec}, DependsOn("database", "migrations"))
+	app.Register(&slowService{name: "migrations", delay: 20 * time.Millisecond, rec: rec}, DependsOn("database"))
+	app.Register(&slowService{name: "database", delay: 20 * time.Millisecond, rec: rec})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !checker.IsReady() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !checker.IsReady() || !app.Ready() {
+		t.Error("not ready after startup")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if checker.IsReady() {
+		t.Error("health checker still ready after shutdown")
+	}
+
+	// Ready runs alongside Start, so only dependencies are ordered.
+	events := rec.String()
+	for _, pair := range [][2]string{
+		{"ready:database", "start:migrations"},
+		{"ready:migrations", "start:scheduler"},
+	} {
+		if strings.Index(events, pair[0]) > strings.Index(events, pair[1]) {
+			t.Errorf("%s before %s: %s", pair[1], pair[0], events)
+		}
+	}
+	if !strings.HasSuffix(events, "stop:scheduler,stop:migrations,stop:database") {
+		t.Errorf("not stopped in reverse dependency order: %s", events)
+	}
+	for _, s := range app.Status() {
+		if s.State != StateStopped {
+			t.Errorf("%s is %s after shutdown", s.Name, s.State)
+		}
+	}
+}
+
+func TestRunRejectsBadDependencies(t *testing.T) {
+	app := New("test", "1.0")
+	app.Register(&mockService{name: "a"}, DependsOn("c"))
+	app.Register(&mockService{name: "b"}, DependsOn("a"))
+	app.Register(&mockService{name: "c"}, DependsOn("b"))
+	app.Register(&mockService{name: "d"})
+	err := app.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: a -> c -> b -> a") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	app = New("test", "1.0")
+	app.Register(&mockService{name: "api"}, DependsOn("database"))
+	if err := app.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown service database") {
+		t.Errorf("expected an unknown dependency error, got %v", err)
+	}
+}
+
+func TestRunStartTimeout(t *testing.T) {
+	rec := &recorder{}
+	checker := health.NewChecker()
+	app := New("test", "1.0", WithHealth(checker), WithShutdownTimeout(time.Second))
+	app.Register(&slowService{name: "database", delay: time.Hour, rec: rec}, StartTimeout(20*time.Millisecond))
+	app.Register(&slowService{name: "api", rec: rec}, DependsOn("database"))
+
+	err := app.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "service database failed: not ready within 20ms") {
+		t.Errorf("expected a start timeout, got %v", err)
+	}
+	if strings.Contains(rec.String(), "start:api") {
+		t.Errorf("dependent started although its dependency never became ready: %s", rec)
+	}
+	if checker.IsReady() {
+		t.Error("health checker marked ready after failed startup")
+	}
+	if s := app.Status()[0]; s.Name != "database" || s.State != StateFailed || s.Error == "" {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
+
+func TestServiceFuncWithDialReady(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	stop := make(chan struct{})
+	svc := NewServiceFunc("http",
+		func(context.Context) error {
+			// Blocks like ListenAndServe.
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			<-stop
+			return ln.Close()
+		},
+		func(context.Context) error { close(stop); return nil },
+	).WithReady(DialReady(addr))
+
+	app := New("test", "1.0")
+	app.Register(svc)
+	app.Register(&mockService{name: "webhooks"}, DependsOn("http"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for !app.Ready() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !app.Ready() {
+		t.Fatalf("not ready: %+v", app.Status())
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDraining is returned by Tracker.Begin once shutdown has begun.
+var ErrDraining = errors.New("app: draining")
+
+// Drainable is implemented by services that accept work. During shutdown
+// Drain is called on every service at once, before any is stopped: it
+// stops accepting new work and waits for in-flight work until ctx is
+// done.
+type Drainable interface {
+	Drain(ctx context.Context) error
+}
+
+// Operation is a unit of in-flight work, such as a Discord interaction.
+type Operation struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+}
+
+// Tracker counts in-flight operations so that shutdown can wait for them.
+// The App's tracker is drained with every Drainable service.
+type Tracker struct {
+	mu       sync.Mutex
+	draining bool
+	nextID   uint64
+	active   map[uint64]Operation
+	idle     chan struct{}
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker(logger *slog.Logger) *Tracker {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Tracker{
+		active: make(map[uint64]Operation),
+		idle:   make(chan struct{}),
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Begin records the start of an operation and returns the function that
+// ends it. Once draining has begun it returns ErrDraining instead, and
+// the caller should turn the work away.
+func (t *Tracker) Begin(kind, name string) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, ErrDraining
+	}
+	id := t.nextID
+	t.nextID++
+	t.active[id] = Operation{Kind: kind, Name: name, Started: t.now()}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			delete(t.active, id)
+			if t.draining && len(t.active) == 0 {
+				close(t.idle)
+			}
+		})
+	}, nil
+}
+
+// InFlight lists the operations currently running.
+func (t *Tracker) InFlight() []Operation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Operation, 0, len(t.active))
+	for _, op := range t.active {
+		out = append(out, op)
+	}
+	return out
+}
+
+// Drain stops new operations from beginning and waits for running ones.
+// If ctx is done first, each operation still running is logged.
+func (t *Tracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.draining {
+		t.draining = true
+		if len(t.active) == 0 {
+			close(t.idle)
+		}
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.idle:
+		return nil
+	case <-ctx.Done():
+	}
+	ops := t.InFlight()
+	for _, op := range ops {
+		t.logger.Warn("operation still running at drain deadline",
+			"kind", op.Kind, "name", op.Name, "running_for", t.now().Sub(op.Started).Round(time.Millisecond))
+	}
+	return fmt.Errorf("%d operations still running: %w", len(ops), ctx.Err())
+}
+
+// Middleware tracks each request as an "http" operation. Once draining,
+// requests get 503 with Connection: close so clients retry elsewhere.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done, err := t.Begin("http", r.Method+" "+r.URL.Path)
+		if err != nil {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer done()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/health"
+)
+
+func TestTrackerDrainWaitsForInFlight(t *testing.T) {
+	tr := NewTracker(nil)
+	done, err := tr.Begin("discord", "/server create")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- tr.Drain(context.Background()) }()
+	deadline := time.Now().Add(time.Second)
+	for {
+		end, err := tr.Begin("discord", "/credits")
+		if errors.Is(err, ErrDraining) {
+			break
+		}
+		end()
+		if time.Now().After(deadline) {
+			t.Fatal("Begin still accepted work while draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v with work in flight", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	done()
+	done() // ending twice is harmless
+	if err := <-drained; err != nil {
+		t.Errorf("Drain = %v", err)
+	}
+}
+
+func TestTrackerDrainDeadline(t *testing.T) {
+	tr := NewTracker(nil)
+	if _, err := tr.Begin("http", "POST /webhooks/stripe"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := tr.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 operations") {
+		t.Errorf("Drain = %v, want one operation left at the deadline", err)
+	}
+	if ops := tr.InFlight(); len(ops) != 1 || ops[0].Name != "POST /webhooks/stripe" {
+		t.Errorf("InFlight = %+v", ops)
+	}
+}
+
+func TestTrackerMiddleware(t *testing.T) {
+	tr := NewTracker(nil)
+	h := tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(tr.InFlight()) != 1 {
+			t.Error("request not tracked")
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ayet/callback", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d before draining", rec.Code)
+	}
+
+	if err := tr.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ayet/callback", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Connection") != "close" {
+		t.Errorf("status = %d, Connection = %q while draining", rec.Code, rec.Header().Get("Connection"))
+	}
+}
+
+func TestShutdownDrainsBeforeStopping(t *testing.T) {
+	rec := &recorder{}
+	checker := health.NewChecker()
+	app := New("test", "1.0", WithHealth(checker), WithPreStopDelay(30*time.Millisecond))
+
+	var shutdownAt, drainAt time.Time
+	api := NewServiceFunc("api",
+		func(context.Context) error { return nil },
+		func(context.Context) error { rec.add("stop:api"); return nil },
+	).WithDrain(func(context.Context) error {
+		drainAt = time.Now()
+		if checker.IsReady() {
+			t.Error("still ready while draining")
+		}
+		rec.add("drain:api")
+		return nil
+	})
+	db := NewServiceFunc("database",
+		func(context.Context) error { return nil },
+		func(context.Context) error { rec.add("stop:database"); return nil },
+	)
+	app.Register(db)
+	app.Register(api, DependsOn("database"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for !checker.IsReady() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// An interaction that is in flight when shutdown begins finishes
+	// before any service stops.
+	end, err := app.Tracker().Begin("discord", "/server stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(60 * time.Millisecond)
+		rec.add("end:interaction")
+		end()
+	}()
+
+	shutdownAt = time.Now()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if wait := drainAt.Sub(shutdownAt); wait < 30*time.Millisecond {
+		t.Errorf("drained %s after shutdown began, before the pre-stop delay", wait)
+	}
+	if got := rec.String(); got != "drain:api,end:interaction,stop:api,stop:database" {
+		t.Errorf("shutdown sequence = %s", got)
+	}
+}
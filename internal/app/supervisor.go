@@ -0,0 +1,301 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// ErrRestartBudget is reported when a background service fails more often
+// than its supervision allows; Run then shuts the application down.
+var ErrRestartBudget = errors.New("app: restart budget exhausted")
+
+// RestartPolicy decides whether a background service is restarted when
+// its function returns.
+type RestartPolicy string
+
+const (
+	// RestartNever leaves the service stopped; a failure shuts the
+	// application down.
+	RestartNever RestartPolicy = "never"
+	// RestartOnFailure restarts after an error or panic, and leaves the
+	// service stopped if the function returns nil.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartAlways restarts whenever the function returns.
+	RestartAlways RestartPolicy = "always"
+)
+
+// Supervision configures how a background service is restarted. Zero
+// fields take the defaults from DefaultSupervision.
+type Supervision struct {
+	Policy RestartPolicy
+	// MinBackoff is the delay before the first restart; each further
+	// restart within Window doubles it, up to MaxBackoff. Delays are
+	// jittered between half and the full value.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRestarts is how many restarts are allowed within Window before
+	// the failure is escalated. Negative means unlimited.
+	MaxRestarts int
+	Window      time.Duration
+}
+
+// DefaultSupervision restarts failed services up to five times in ten
+// minutes, backing off from one second to one minute.
+func DefaultSupervision() Supervision {
+	return Supervision{
+		Policy:      RestartOnFailure,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+		MaxRestarts: 5,
+		Window:      10 * time.Minute,
+	}
+}
+
+func (s Supervision) withDefaults() Supervision {
+	d := DefaultSupervision()
+	if s.Policy == "" {
+		s.Policy = d.Policy
+	}
+	if s.MinBackoff <= 0 {
+		s.MinBackoff = d.MinBackoff
+	}
+	if s.MaxBackoff < s.MinBackoff {
+		s.MaxBackoff = max(d.MaxBackoff, s.MinBackoff)
+	}
+	if s.MaxRestarts == 0 {
+		s.MaxRestarts = d.MaxRestarts
+	}
+	if s.Window <= 0 {
+		s.Window = d.Window
+	}
+	return s
+}
+
+// Failer is implemented by services that can fail after Start returns.
+// Run shuts the application down when Failed delivers an error; the
+// channel is closed once the service has stopped.
+type Failer interface {
+	Failed() <-chan error
+}
+
+// HealthReporter is implemented by services that report their own health.
+// With WithHealth, Register adds it to the health checker as
+// "service:<name>".
+type HealthReporter interface {
+	Health(ctx context.Context) error
+}
+
+// PanicError is a panic recovered from a background service.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// BackgroundService runs a function in the background until stopped,
+// restarting it according to its Supervision.
+type BackgroundService struct {
+	name   string
+	fn     func(context.Context) error
+	sup    Supervision
+	logger *slog.Logger
+	now    func() time.Time
+	jitter func(time.Duration) time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	failed chan error
+
+	mu       sync.Mutex
+	running  bool
+	restarts []time.Time
+	lastErr  error
+	gaveUp   bool
+}
+
+// NewBackgroundService creates a service that runs in the background
+// under DefaultSupervision.
+func NewBackgroundService(name string, fn func(context.Context) error) *BackgroundService {
+	return &BackgroundService{
+		name:   name,
+		fn:     fn,
+		sup:    DefaultSupervision(),
+		logger: slog.Default(),
+		now:    time.Now,
+		jitter: func(d time.Duration) time.Duration {
+			return d/2 + rand.N(d/2+1)
+		},
+		done:   make(chan struct{}),
+		failed: make(chan error, 1),
+	}
+}
+
+// WithSupervision sets the restart policy. It must be called before Start.
+func (s *BackgroundService) WithSupervision(sup Supervision) *BackgroundService {
+	s.sup = sup.withDefaults()
+	return s
+}
+
+func (s *BackgroundService) Name() string { return s.name }
+
+func (s *BackgroundService) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.supervise(ctx)
+	return nil
+}
+
+// Stop cancels the function and waits for it to return. It is a no-op
+// if the service was never started, e.g. when startup failed earlier.
+func (s *BackgroundService) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain stops the function, letting it finish its current work, so
+// background loops wind down alongside request handling.
+func (s *BackgroundService) Drain(ctx context.Context) error {
+	return s.Stop(ctx)
+}
+
+// Failed delivers the error that exhausted the restart budget.
+func (s *BackgroundService) Failed() <-chan error { return s.failed }
+
+// Health reports an error while the service is waiting to restart or
+// after it has given up.
+func (s *BackgroundService) Health(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.gaveUp:
+		return fmt.Errorf("stopped after failure: %w", s.lastErr)
+	case !s.running && s.lastErr != nil:
+		return fmt.Errorf("restarting after failure: %w", s.lastErr)
+	}
+	return nil
+}
+
+// supervise runs fn until ctx is cancelled, the policy leaves it stopped
+// or the restart budget is exhausted.
+func (s *BackgroundService) supervise(ctx context.Context) {
+	defer close(s.failed)
+	defer close(s.done)
+	up := metrics.ServiceUp.WithLabelValues(s.name)
+	defer up.Set(0)
+
+	for {
+		s.setRunning(true, nil)
+		up.Set(1)
+		err := s.runOnce(ctx)
+		up.Set(0)
+		if ctx.Err() != nil {
+			s.setRunning(false, nil)
+			return
+		}
+
+		if err == nil {
+			if s.sup.Policy != RestartAlways {
+				s.setRunning(false, nil)
+				s.logger.Info("background service exited", "service", s.name)
+				return
+			}
+			metrics.ServiceFailuresTotal.WithLabelValues(s.name, "exit").Inc()
+			err = errors.New("exited")
+		} else {
+			var pe *PanicError
+			if errors.As(err, &pe) {
+				metrics.ServiceFailuresTotal.WithLabelValues(s.name, "panic").Inc()
+				s.logger.Error("background service panicked", "service", s.name, "panic", pe.Value, "stack", string(pe.Stack))
+			} else {
+				metrics.ServiceFailuresTotal.WithLabelValues(s.name, "error").Inc()
+			}
+		}
+		s.setRunning(false, err)
+
+		n := s.recentRestarts()
+		if s.sup.Policy == RestartNever || (s.sup.MaxRestarts >= 0 && n >= s.sup.MaxRestarts) {
+			s.giveUp(fmt.Errorf("%w (%d restarts in %s): %w", ErrRestartBudget, n, s.sup.Window, err))
+			return
+		}
+
+		delay := s.backoff(n)
+		s.logger.Warn("background service failed, restarting", "service", s.name, "error", err, "restart_in", delay)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		s.restarts = append(s.restarts, s.now())
+		s.mu.Unlock()
+		metrics.ServiceRestartsTotal.WithLabelValues(s.name).Inc()
+	}
+}
+
+// runOnce calls fn, turning a panic into a *PanicError.
+func (s *BackgroundService) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return s.fn(ctx)
+}
+
+func (s *BackgroundService) setRunning(running bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+	if err != nil || running {
+		s.lastErr = err
+	}
+}
+
+// recentRestarts drops restarts older than the window and counts the rest.
+func (s *BackgroundService) recentRestarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-s.sup.Window)
+	i := 0
+	for i < len(s.restarts) && s.restarts[i].Before(cutoff) {
+		i++
+	}
+	s.restarts = s.restarts[i:]
+	return len(s.restarts)
+}
+
+// backoff doubles MinBackoff once per recent restart, capped at
+// MaxBackoff, then applies jitter.
+func (s *BackgroundService) backoff(restarts int) time.Duration {
+	d := s.sup.MinBackoff
+	for i := 0; i < restarts && d < s.sup.MaxBackoff; i++ {
+		d *= 2
+	}
+	return s.jitter(min(d, s.sup.MaxBackoff))
+}
+
+func (s *BackgroundService) giveUp(err error) {
+	s.mu.Lock()
+	s.gaveUp, s.lastErr = true, err
+	s.mu.Unlock()
+	s.logger.Error("background service gave up", "service", s.name, "error", err)
+	s.failed <- err
+}
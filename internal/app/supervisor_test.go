@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/wethegamers/agis/internal/health"
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// fastSupervision restarts without noticeable delay.
+func fastSupervision(policy RestartPolicy, maxRestarts int) Supervision {
+	return Supervision{
+		Policy:      policy,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: maxRestarts,
+		Window:      time.Minute,
+	}
+}
+
+func waitClosed(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("service did not finish")
+		return nil
+	}
+}
+
+func TestBackgroundServiceRestartsOnFailure(t *testing.T) {
+	restarts := metrics.ServiceRestartsTotal.WithLabelValues("sup-retry")
+	before := testutil.ToFloat64(restarts)
+	var calls atomic.Int32
+	running := make(chan struct{})
+	svc := NewBackgroundService("sup-retry", func(ctx context.Context) error {
+		if calls.Add(1) < 3 {
+			return errors.New("connection reset")
+		}
+		close(running)
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithSupervision(fastSupervision(RestartOnFailure, 5))
+
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-running:
+	case <-time.After(2 * time.Second):
+		t.Fatal("service was not restarted")
+	}
+	if err := svc.Health(context.Background()); err != nil {
+		t.Errorf("Health while running: %v", err)
+	}
+	if got := testutil.ToFloat64(restarts) - before; got != 2 {
+		t.Errorf("restarts = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.ServiceUp.WithLabelValues("sup-retry")); got != 1 {
+		t.Errorf("up = %v, want 1", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := svc.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitClosed(t, svc.Failed()); err != nil {
+		t.Errorf("Failed after Stop = %v, want closed", err)
+	}
+	if got := testutil.ToFloat64(metrics.ServiceUp.WithLabelValues("sup-retry")); got != 0 {
+		t.Errorf("up after stop = %v, want 0", got)
+	}
+}
+
+func TestBackgroundServiceRecoversPanic(t *testing.T) {
+	panics := metrics.ServiceFailuresTotal.WithLabelValues("sup-panic", "panic")
+	before := testutil.ToFloat64(panics)
+	svc := NewBackgroundService("sup-panic", func(context.Context) error {
+		panic("nil map")
+	}).WithSupervision(fastSupervision(RestartNever, 0))
+
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := waitClosed(t, svc.Failed())
+	if !errors.Is(err, ErrRestartBudget) {
+		t.Fatalf("Failed = %v, want ErrRestartBudget", err)
+	}
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "nil map" {
+		t.Fatalf("Failed = %v, want a PanicError", err)
+	}
+	if !strings.Contains(string(pe.Stack), "supervisor_test.go") {
+		t.Errorf("stack does not include the panicking function:\n%s", pe.Stack)
+	}
+	if err := svc.Health(context.Background()); err == nil {
+		t.Error("Health after giving up = nil, want error")
+	}
+	if got := testutil.ToFloat64(panics) - before; got != 1 {
+		t.Errorf("panic failures = %v, want 1", got)
+	}
+}
+
+func TestBackgroundServiceExitPolicies(t *testing.T) {
+	tests := []struct {
+		policy    RestartPolicy
+		wantCalls int32
+		wantErr   bool
+	}{
+		{RestartOnFailure, 1, false},
+		{RestartAlways, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			var calls atomic.Int32
+			svc := NewBackgroundService("sup-exit-"+string(tt.policy), func(context.Context) error {
+				calls.Add(1)
+				return nil
+			}).WithSupervision(fastSupervision(tt.policy, 2))
+
+			if err := svc.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			err := waitClosed(t, svc.Failed())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Failed = %v, want error %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBackgroundServiceBackoff(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewBackgroundService("sup-backoff", nil).WithSupervision(Supervision{
+		MinBackoff: time.Second,
+		MaxBackoff: 5 * time.Second,
+		Window:     time.Minute,
+	})
+	svc.now = func() time.Time { return now }
+	svc.jitter = func(d time.Duration) time.Duration { return d }
+
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if got := svc.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	svc.restarts = []time.Time{now.Add(-2 * time.Minute), now.Add(-30 * time.Second)}
+	if got := svc.recentRestarts(); got != 1 {
+		t.Errorf("recentRestarts = %d, want 1 inside the window", got)
+	}
+}
+
+func TestRunShutsDownWhenRestartBudgetExhausted(t *testing.T) {
+	checker := health.NewChecker()
+	app := New("test", "1.0", WithShutdownTimeout(time.Second), WithHealth(checker))
+	db := &mockService{name: "database"}
+	app.Register(db)
+	app.Register(NewBackgroundService("sup-budget", func(context.Context) error {
+		return errors.New("permission denied")
+	}).WithSupervision(fastSupervision(RestartOnFailure, 2)), DependsOn("database"))
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run(context.Background()) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if !errors.Is(err, ErrRestartBudget) || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Run = %v, want the exhausted restart budget", err)
+	}
+	if !db.stopped {
+		t.Error("database not stopped after escalation")
+	}
+
+	_, results := checker.RunAll(context.Background())
+	if len(results) != 1 || results[0].Name != "service:sup-budget" || results[0].Status != health.StatusUnhealthy {
+		t.Errorf("health results = %+v, want service:sup-budget unhealthy", results)
+	}
+}
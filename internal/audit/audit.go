@@ -0,0 +1,420 @@
+// Package audit provides the tamper-evident audit log for AGIS.
+//
+// Admin and money-moving actions append an entry naming the actor, the
+// action and its target, the state before and after with a field-level
+// diff, and the originating request. Entries form a hash chain: each
+// stores the SHA-256 of the previous entry's hash and its own contents, so
+// editing or removing a row breaks every hash after it. The table also
+// rejects UPDATE, DELETE and TRUNCATE.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SystemActor is recorded for actions taken by background workflows.
+const SystemActor = "SYSTEM"
+
+// GenesisHash is the previous hash of the first entry.
+var GenesisHash = strings.Repeat("0", 64)
+
+// chainLockKey serialises appends so each entry sees its predecessor.
+const chainLockKey = 0x61756469746c6f67 // "auditlog"
+
+// ErrInvalidEvent is returned when an event lacks an actor, action or
+// target.
+var ErrInvalidEvent = errors.New("audit: actor, action and target are required")
+
+// Target is what an action was applied to.
+type Target struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Event describes an action to record. Before and After are marshalled
+// to JSON; leave Before nil for creations and After nil for deletions.
+type Event struct {
+	Actor  string
+	Action string
+	Target Target
+	Before any
+	After  any
+}
+
+// Change is one field's old and new value.
+type Change struct {
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// Entry is a row of audit_log.
+type Entry struct {
+	ID         int64             `json:"id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Actor      string            `json:"actor"`
+	Action     string            `json:"action"`
+	Target     Target            `json:"target"`
+	Before     json.RawMessage   `json:"before,omitempty"`
+	After      json.RawMessage   `json:"after,omitempty"`
+	Diff       map[string]Change `json:"diff,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+
+	diffJSON json.RawMessage // stored diff text, as hashed
+}
+
+// Recorder appends entries inside the caller's transaction, so the audit
+// row commits or rolls back with the change it describes. *Log
+// implements it.
+type Recorder interface {
+	RecordTx(ctx context.Context, tx *sql.Tx, e Event) (*Entry, error)
+}
+
+// Log reads and appends audit entries.
+type Log struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// New creates an audit log.
+func New(db *sql.DB) *Log {
+	return &Log{db: db, now: time.Now}
+}
+
+// Record appends an entry in its own transaction.
+func (l *Log) Record(ctx context.Context, e Event) (*Entry, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("audit: begin: %w", err)
+	}
+	entry, err := l.RecordTx(ctx, tx, e)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("audit: commit: %w", err)
+	}
+	return entry, nil
+}
+
+// RecordTx appends an entry inside tx. The request ID and IP come from
+// ctx (see WithRequest). Appends are serialised with a transaction-scoped
+// advisory lock held until tx ends.
+func (l *Log) RecordTx(ctx context.Context, tx *sql.Tx, e Event) (*Entry, error) {
+	entry, err := l.build(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(chainLockKey)); err != nil {
+		return nil, fmt.Errorf("audit: lock chain: %w", err)
+	}
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		entry.PrevHash = GenesisHash
+	} else if err != nil {
+		return nil, fmt.Errorf("audit: read chain head: %w", err)
+	}
+	entry.Hash = entry.computeHash()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO audit_log (occurred_at, actor, action, target_type, target_id, before_state, after_state,
+			diff, request_id, ip_address, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id`,
+		entry.OccurredAt, entry.Actor, entry.Action, entry.Target.Type, entry.Target.ID,
+		nullJSON(entry.Before), nullJSON(entry.After), nullJSON(entry.diffJSON),
+		nullString(entry.RequestID), nullString(entry.IP), entry.PrevHash, entry.Hash,
+	).Scan(&entry.ID)
+	if err != nil {
+		return nil, fmt.Errorf("audit: insert entry: %w", err)
+	}
+	return entry, nil
+}
+
+// build fills in everything but the chain fields.
+func (l *Log) build(ctx context.Context, e Event) (*Entry, error) {
+	if e.Actor == "" || e.Action == "" || e.Target.Type == "" || e.Target.ID == "" {
+		return nil, ErrInvalidEvent
+	}
+	before, err := marshalState(e.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := marshalState(e.After)
+	if err != nil {
+		return nil, err
+	}
+	diff := Diff(before, after)
+	var diffJSON json.RawMessage
+	if len(diff) > 0 {
+		if diffJSON, err = json.Marshal(diff); err != nil {
+			return nil, fmt.Errorf("audit: encode diff: %w", err)
+		}
+	}
+
+	req := RequestFromContext(ctx)
+	return &Entry{
+		// Postgres keeps microseconds; truncate so the hash survives a
+		// round trip.
+		OccurredAt: l.now().UTC().Truncate(time.Microsecond),
+		Actor:      e.Actor,
+		Action:     e.Action,
+		Target:     e.Target,
+		Before:     before,
+		After:      after,
+		Diff:       diff,
+		RequestID:  req.ID,
+		IP:         req.IP,
+		diffJSON:   diffJSON,
+	}, nil
+}
+
+// computeHash is SHA-256 over the previous hash and every stored field,
+// each length-prefixed so field boundaries cannot be shifted.
+func (e *Entry) computeHash() string {
+	h := sha256.New()
+	for _, field := range [][]byte{
+		[]byte(e.PrevHash),
+		[]byte(e.OccurredAt.UTC().Format(time.RFC3339Nano)),
+		[]byte(e.Actor),
+		[]byte(e.Action),
+		[]byte(e.Target.Type),
+		[]byte(e.Target.ID),
+		e.Before,
+		e.After,
+		e.diffJSON,
+		[]byte(e.RequestID),
+		[]byte(e.IP),
+	} {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(field)))
+		h.Write(n[:])
+		h.Write(field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func marshalState(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("audit: encode state: %w", err)
+	}
+	if string(b) == "null" {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// Diff compares two JSON objects field by field. Fields present on only
+// one side are reported with the other side empty. Non-object states are
+// compared as a whole under the key "".
+func Diff(before, after json.RawMessage) map[string]Change {
+	var b, a map[string]json.RawMessage
+	bObj := len(before) == 0 || json.Unmarshal(before, &b) == nil
+	aObj := len(after) == 0 || json.Unmarshal(after, &a) == nil
+	if !bObj || !aObj {
+		if string(before) == string(after) {
+			return nil
+		}
+		return map[string]Change{"": {From: before, To: after}}
+	}
+
+	diff := make(map[string]Change)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !jsonEqual(bv, av) {
+			diff[k] = Change{From: bv, To: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = Change{To: av}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func jsonEqual(x, y json.RawMessage) bool {
+	var xv, yv any
+	if json.Unmarshal(x, &xv) != nil || json.Unmarshal(y, &yv) != nil {
+		return string(x) == string(y)
+	}
+	xb, _ := json.Marshal(xv)
+	yb, _ := json.Marshal(yv)
+	return string(xb) == string(yb)
+}
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// BeforeID pages backwards: only entries with smaller IDs are returned.
+	BeforeID int64
+	Limit    int
+}
+
+// Query returns matching entries, newest first.
+func (l *Log) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if f.Actor != "" {
+		add("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = ?", f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= ?", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < ?", f.Until.UTC())
+	}
+	if f.BeforeID > 0 {
+		add("id < ?", f.BeforeID)
+	}
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 100
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	return l.query(ctx, query, args...)
+}
+
+const entryColumns = `id, occurred_at, actor, action, target_type, target_id, before_state, after_state,
+	diff, request_id, ip_address, prev_hash, hash`
+
+func (l *Log) query(ctx context.Context, query string, args ...any) ([]Entry, error) {
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit: query: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var before, after, diff []byte
+		var requestID, ip sql.NullString
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.Actor, &e.Action, &e.Target.Type, &e.Target.ID,
+			&before, &after, &diff, &requestID, &ip, &e.PrevHash, &e.Hash); err != nil {
+			return nil, fmt.Errorf("audit: scan entry: %w", err)
+		}
+		e.OccurredAt = e.OccurredAt.UTC()
+		e.Before, e.After, e.diffJSON = nonEmpty(before), nonEmpty(after), nonEmpty(diff)
+		if e.diffJSON != nil {
+			if err := json.Unmarshal(e.diffJSON, &e.Diff); err != nil {
+				return nil, fmt.Errorf("audit: decode diff of entry %d: %w", e.ID, err)
+			}
+		}
+		e.RequestID, e.IP = requestID.String, ip.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Report is the result of a chain verification.
+type Report struct {
+	Checked  int    `json:"checked"`
+	HeadHash string `json:"head_hash"`
+	// BrokenAt is the first entry whose hash or link does not match, or
+	// zero if the chain is intact.
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// OK reports whether the chain is intact.
+func (r *Report) OK() bool {
+	return r.BrokenAt == 0
+}
+
+const verifyBatch = 1000
+
+// Verify walks the whole chain from the first entry and recomputes every
+// hash. A broken chain is reported in the Report, not as an error.
+func (l *Log) Verify(ctx context.Context) (*Report, error) {
+	report := &Report{HeadHash: GenesisHash}
+	var afterID int64
+	for {
+		entries, err := l.query(ctx, `SELECT `+entryColumns+` FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`,
+			afterID, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			e := &entries[i]
+			switch {
+			case e.PrevHash != report.HeadHash:
+				report.BrokenAt, report.Reason = e.ID, "previous hash does not match the preceding entry"
+			case e.computeHash() != e.Hash:
+				report.BrokenAt, report.Reason = e.ID, "entry contents do not match its hash"
+			}
+			if !report.OK() {
+				return report, nil
+			}
+			report.Checked++
+			report.HeadHash = e.Hash
+			afterID = e.ID
+		}
+		if len(entries) < verifyBatch {
+			return report, nil
+		}
+	}
+}
+
+func nonEmpty(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	return json.RawMessage(b)
+}
+
+// nullJSON passes JSON as text; lib/pq would send []byte as bytea.
+func nullJSON(b json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(b), Valid: len(b) > 0}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
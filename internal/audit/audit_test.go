@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var entryCols = []string{
+	"id", "occurred_at", "actor", "action", "target_type", "target_id", "before_state", "after_state",
+	"diff", "request_id", "ip_address", "prev_hash", "hash",
+}
+
+func newMockLog(t *testing.T) (*Log, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	l := New(db)
+	l.now = func() time.Time { return testNow }
+	return l, mock
+}
+
+func row(e *Entry) []driver.Value {
+	return []driver.Value{
+		e.ID, e.OccurredAt, e.Actor, e.Action, e.Target.Type, e.Target.ID,
+		[]byte(e.Before), []byte(e.After), []byte(e.diffJSON), e.RequestID, e.IP, e.PrevHash, e.Hash,
+	}
+}
+
+// chain builds n linked entries as they would be stored.
+func chain(t *testing.T, l *Log, n int) []*Entry {
+	t.Helper()
+	prev := GenesisHash
+	var entries []*Entry
+	for i := 1; i <= n; i++ {
+		e, err := l.build(context.Background(), Event{
+			Actor:  "admin",
+			Action: "template.update",
+			Target: Target{Type: "template", ID: "small"},
+			Before: map[string]int{"cpu": i},
+			After:  map[string]int{"cpu": i + 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.ID, e.PrevHash = int64(i), prev
+		e.Hash = e.computeHash()
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRecord_ChainsToHead(t *testing.T) {
+	l, mock := newMockLog(t)
+	head := chain(t, l, 1)[0].Hash
+	ctx := WithRequest(context.Background(), Request{ID: "req-1", IP: "203.0.113.7"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+		WithArgs(int64(chainLockKey)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(head))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(testNow, "admin", "treasury.deposit", "guild", "42",
+			nil, `{"amount":500}`, `{"amount":{"to":500}}`, "req-1", "203.0.113.7", head, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	e, err := l.Record(ctx, Event{
+		Actor:  "admin",
+		Action: "treasury.deposit",
+		Target: Target{Type: "guild", ID: "42"},
+		After:  map[string]int{"amount": 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 2 || e.PrevHash != head || e.Hash != e.computeHash() || e.Hash == head {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecord_FirstEntryUsesGenesis(t *testing.T) {
+	l, mock := newMockLog(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_log`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	e, err := l.Record(context.Background(), Event{
+		Actor: SystemActor, Action: "gdpr.erasure_completed", Target: Target{Type: "gdpr_subject", ID: "abc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PrevHash != GenesisHash {
+		t.Errorf("prev hash = %q, want genesis", e.PrevHash)
+	}
+}
+
+func TestRecord_RejectsIncompleteEvent(t *testing.T) {
+	l, mock := newMockLog(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err := l.Record(context.Background(), Event{Actor: "admin", Action: "template.create"})
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("err = %v, want ErrInvalidEvent", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(entries []*Entry)
+		brokenAt int64
+	}{
+		{name: "intact", tamper: func([]*Entry) {}},
+		{
+			name:     "edited contents",
+			tamper:   func(e []*Entry) { e[1].Actor = "mallory" },
+			brokenAt: 2,
+		},
+		{
+			name: "removed entry",
+			tamper: func(e []*Entry) {
+				e[1] = e[2]
+				e[2] = nil
+			},
+			brokenAt: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, mock := newMockLog(t)
+			entries := chain(t, l, 3)
+			tt.tamper(entries)
+
+			rows := sqlmock.NewRows(entryCols)
+			for _, e := range entries {
+				if e != nil {
+					rows.AddRow(row(e)...)
+				}
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`)).
+				WithArgs(int64(0), verifyBatch).
+				WillReturnRows(rows)
+
+			report, err := l.Verify(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.BrokenAt != tt.brokenAt {
+				t.Errorf("broken at %d (%s), want %d", report.BrokenAt, report.Reason, tt.brokenAt)
+			}
+			if tt.brokenAt == 0 && (report.Checked != 3 || report.HeadHash != entries[2].Hash) {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+func TestQuery_BuildsFilter(t *testing.T) {
+	l, mock := newMockLog(t)
+	since := testNow.Add(-24 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`FROM audit_log WHERE actor = $1 AND target_type = $2 AND occurred_at >= $3 AND id < $4 ORDER BY id DESC LIMIT $5`)).
+		WithArgs("admin", "guild", since, int64(90), 100).
+		WillReturnRows(sqlmock.NewRows(entryCols))
+
+	entries, err := l.Query(context.Background(), Filter{
+		Actor: "admin", TargetType: "guild", Since: since, BeforeID: 90, Limit: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries", len(entries))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff := Diff(
+		json.RawMessage(`{"cpu":1,"memory":"1Gi","name":"small"}`),
+		json.RawMessage(`{"cpu":2,"name":"small","disk":"10Gi"}`),
+	)
+	want := map[string]Change{
+		"cpu":    {From: json.RawMessage(`1`), To: json.RawMessage(`2`)},
+		"memory": {From: json.RawMessage(`"1Gi"`)},
+		"disk":   {To: json.RawMessage(`"10Gi"`)},
+	}
+	got, _ := json.Marshal(diff)
+	exp, _ := json.Marshal(want)
+	if string(got) != string(exp) {
+		t.Errorf("diff = %s, want %s", got, exp)
+	}
+
+	if d := Diff(json.RawMessage(`{"a":1}`), json.RawMessage(`{ "a": 1 }`)); d != nil {
+		t.Errorf("equal states diff = %v", d)
+	}
+}
+
+func TestRequestFromHTTP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.5:4321"
+	r.Header.Set("X-Request-ID", "req-9")
+	if got := RequestFromHTTP(r); got.IP != "10.0.0.5" || got.ID != "req-9" {
+		t.Errorf("got %+v", got)
+	}
+
+	r.Header.Set("X-Forwarded-For", "198.51.100.2, 10.0.0.1")
+	if got := RequestFromHTTP(r); got.IP != "198.51.100.2" {
+		t.Errorf("forwarded IP = %q", got.IP)
+	}
+}
@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Request identifies the HTTP request behind an action.
+type Request struct {
+	ID string
+	IP string
+}
+
+type requestKey struct{}
+
+// WithRequest attaches request details that RecordTx copies into entries.
+func WithRequest(ctx context.Context, req Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFromContext returns the attached request details, if any.
+func RequestFromContext(ctx context.Context) Request {
+	req, _ := ctx.Value(requestKey{}).(Request)
+	return req
+}
+
+// RequestFromHTTP reads the request ID set by middleware.RequestID and
+// the client IP: the first X-Forwarded-For hop, then X-Real-IP, then the
+// peer address.
+func RequestFromHTTP(r *http.Request) Request {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if real := r.Header.Get("X-Real-IP"); real != "" {
+		ip = real
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		ip = strings.TrimSpace(first)
+	}
+	return Request{ID: r.Header.Get("X-Request-ID"), IP: ip}
+}
+
+// Middleware attaches request details to every request's context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequest(r.Context(), RequestFromHTTP(r))))
+	})
+}
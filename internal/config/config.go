@@ -3,199 +3,150 @@ package config
 
 import (
 	"fmt"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
 // Config holds all application configuration.
+//
+// Every setting has a key such as http.port, used in config files and
+// shown by Origin, an environment variable and a command-line flag (see
+// LoadFrom). Its default comes from the default tag; settings tagged
+// secret are redacted when printed.
 type Config struct {
 	// Application
-	App AppConfig
+	App AppConfig `yaml:"app"`
 
 	// Discord
-	Discord DiscordConfig
+	Discord DiscordConfig `yaml:"discord"`
 
 	// HTTP Server
-	HTTP HTTPConfig
+	HTTP HTTPConfig `yaml:"http"`
 
 	// Database
-	Database DatabaseConfig
+	Database DatabaseConfig `yaml:"database"`
 
 	// Feature flags
-	Features FeatureConfig
+	Features FeatureConfig `yaml:"features"`
 
 	// Metrics
-	Metrics MetricsConfig
+	Metrics MetricsConfig `yaml:"metrics"`
 
 	// Logging
-	Log LogConfig
+	Log LogConfig `yaml:"log"`
+
+	// origins records where each setting's value came from, by key.
+	origins map[string]Origin
+	// refs records the reference each resolved secret was given as.
+	refs map[string]string
+	file string
 }
 
 // AppConfig holds application-level configuration.
 type AppConfig struct {
-	Name        string
-	Version     string
-	Environment string
-	Debug       bool
+	Name        string `yaml:"name" env:"APP_NAME" default:"agis-bot"`
+	Version     string `yaml:"version" env:"APP_VERSION" default:"dev"`
+	Environment string `yaml:"environment" env:"APP_ENV" default:"development"`
+	Debug       bool   `yaml:"debug" env:"APP_DEBUG"`
 }
 
 // DiscordConfig holds Discord bot configuration.
 type DiscordConfig struct {
-	Token               string
-	ApplicationID       string
-	PublicKey           string
-	AllowedGuilds       []string
-	CommandPrefix       string
-	ShardCount          int
-	DisableWebSocket    bool
-	WebSocketReconnect  bool
-	WebSocketMaxRetries int
+	Token               string   `yaml:"token" env:"DISCORD_TOKEN" secret:"true"`
+	ApplicationID       string   `yaml:"application_id" env:"DISCORD_APPLICATION_ID"`
+	PublicKey           string   `yaml:"public_key" env:"DISCORD_PUBLIC_KEY"`
+	AllowedGuilds       []string `yaml:"allowed_guilds" env:"DISCORD_ALLOWED_GUILDS"`
+	CommandPrefix       string   `yaml:"command_prefix" env:"DISCORD_COMMAND_PREFIX" default:"!"`
+	ShardCount          int      `yaml:"shard_count" env:"DISCORD_SHARD_COUNT" default:"1"`
+	DisableWebSocket    bool     `yaml:"disable_websocket" env:"DISCORD_DISABLE_WEBSOCKET"`
+	WebSocketReconnect  bool     `yaml:"websocket_reconnect" env:"DISCORD_WEBSOCKET_RECONNECT" default:"true"`
+	WebSocketMaxRetries int      `yaml:"websocket_max_retries" env:"DISCORD_WEBSOCKET_MAX_RETRIES" default:"5"`
+
+	// OAuth2 account linking; ApplicationID is the client ID.
+	ClientSecret     string `yaml:"client_secret" env:"DISCORD_CLIENT_SECRET" secret:"true"`
+	OAuthRedirectURL string `yaml:"oauth_redirect_url" env:"DISCORD_OAUTH_REDIRECT_URL"`
 }
 
 // HTTPConfig holds HTTP server configuration.
 type HTTPConfig struct {
-	Host            string
-	Port            int
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	IdleTimeout     time.Duration
-	ShutdownTimeout time.Duration
-	EnableCORS      bool
-	AllowedOrigins  []string
-	RateLimitRPS    float64
-	RateLimitBurst  int
+	Host            string        `yaml:"host" env:"HTTP_HOST" default:"0.0.0.0"`
+	Port            int           `yaml:"port" env:"HTTP_PORT" default:"8080"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" default:"15s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"15s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"60s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" default:"30s"`
+	EnableCORS      bool          `yaml:"enable_cors" env:"HTTP_ENABLE_CORS" default:"true"`
+	AllowedOrigins  []string      `yaml:"allowed_origins" env:"HTTP_ALLOWED_ORIGINS" default:"*"`
+	RateLimitRPS    float64       `yaml:"rate_limit_rps" env:"HTTP_RATE_LIMIT_RPS" default:"100"`
+	RateLimitBurst  int           `yaml:"rate_limit_burst" env:"HTTP_RATE_LIMIT_BURST" default:"200"`
 }
 
 // DatabaseConfig holds database configuration.
+//
+// URL, a postgres:// URL, is an alternative to the individual connection
+// settings; the parts it contains fill them in (see ParseURL).
 type DatabaseConfig struct {
-	Host         string
-	Port         int
-	User         string
-	Password     string
-	Name         string
-	SSLMode      string
-	MaxOpenConns int
-	MaxIdleConns int
-	MaxLifetime  time.Duration
+	URL          string        `yaml:"url" env:"DATABASE_URL" secret:"true"`
+	Host         string        `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Port         int           `yaml:"port" env:"DB_PORT" default:"5432"`
+	User         string        `yaml:"user" env:"DB_USER" default:"agis"`
+	Password     string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name         string        `yaml:"name" env:"DB_NAME" default:"agis"`
+	SSLMode      string        `yaml:"ssl_mode" env:"DB_SSL_MODE" default:"disable"`
+	MaxOpenConns int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"5"`
+	MaxLifetime  time.Duration `yaml:"max_lifetime" env:"DB_MAX_LIFETIME" default:"5m"`
+
+	// TLS client certificate and the CA that signs the server's, for
+	// verify-ca and verify-full.
+	SSLRootCert string `yaml:"ssl_root_cert" env:"DB_SSL_ROOT_CERT"`
+	SSLCert     string `yaml:"ssl_cert" env:"DB_SSL_CERT"`
+	SSLKey      string `yaml:"ssl_key" env:"DB_SSL_KEY"`
+
+	// Session settings; zero timeouts leave the server defaults.
+	ApplicationName  string        `yaml:"application_name" env:"DB_APPLICATION_NAME" default:"agis-bot"`
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT" default:"0s"`
+	LockTimeout      time.Duration `yaml:"lock_timeout" env:"DB_LOCK_TIMEOUT" default:"0s"`
+
+	// Read replicas for reporting queries, as postgres:// URLs; see
+	// Replicas.
+	ReplicaURLs []string `yaml:"replica_urls" env:"DATABASE_REPLICA_URLS" secret:"true"`
 }
 
 // FeatureConfig holds feature flags.
 type FeatureConfig struct {
-	EnablePremium      bool
-	EnableAnalytics    bool
-	EnableWebSocket    bool
-	EnableHealthChecks bool
-	EnableMetrics      bool
-	EnableOpenSaaS     bool
-	EnableRateLimiting bool
+	EnablePremium      bool `yaml:"premium" env:"FEATURE_PREMIUM"`
+	EnableAnalytics    bool `yaml:"analytics" env:"FEATURE_ANALYTICS" default:"true"`
+	EnableWebSocket    bool `yaml:"websocket" env:"FEATURE_WEBSOCKET" default:"true"`
+	EnableHealthChecks bool `yaml:"health_checks" env:"FEATURE_HEALTH_CHECKS" default:"true"`
+	EnableMetrics      bool `yaml:"metrics" env:"FEATURE_METRICS" default:"true"`
+	EnableOpenSaaS     bool `yaml:"opensaas" env:"FEATURE_OPENSAAS" default:"true"`
+	EnableRateLimiting bool `yaml:"rate_limiting" env:"FEATURE_RATE_LIMITING" default:"true"`
 }
 
 // MetricsConfig holds metrics configuration.
 type MetricsConfig struct {
-	Enabled   bool
-	Path      string
-	Namespace string
+	Enabled   bool   `yaml:"enabled" env:"METRICS_ENABLED" default:"true"`
+	Path      string `yaml:"path" env:"METRICS_PATH" default:"/metrics"`
+	Namespace string `yaml:"namespace" env:"METRICS_NAMESPACE" default:"agis"`
 }
 
 // LogConfig holds logging configuration.
 type LogConfig struct {
-	Level       string
-	Format      string // "json" or "text"
-	AddSource   bool
-	Development bool
+	Level       string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	Format      string `yaml:"format" env:"LOG_FORMAT" default:"json"` // "json" or "text"
+	AddSource   bool   `yaml:"add_source" env:"LOG_ADD_SOURCE"`
+	Development bool   `yaml:"development" env:"LOG_DEVELOPMENT"`
 }
 
-// Load loads configuration from environment variables.
+// Load loads configuration from defaults and environment variables.
 func Load() (*Config, error) {
-	cfg := &Config{}
-	var errs []string
-
-	// App config
-	cfg.App = AppConfig{
-		Name:        envString("APP_NAME", "agis-bot"),
-		Version:     envString("APP_VERSION", "dev"),
-		Environment: envString("APP_ENV", "development"),
-		Debug:       envBool("APP_DEBUG", false),
-	}
-
-	// Discord config
-	cfg.Discord = DiscordConfig{
-		Token:               envString("DISCORD_TOKEN", ""),
-		ApplicationID:       envString("DISCORD_APPLICATION_ID", ""),
-		PublicKey:           envString("DISCORD_PUBLIC_KEY", ""),
-		AllowedGuilds:       envStringSlice("DISCORD_ALLOWED_GUILDS", nil),
-		CommandPrefix:       envString("DISCORD_COMMAND_PREFIX", "!"),
-		ShardCount:          envInt("DISCORD_SHARD_COUNT", 1),
-		DisableWebSocket:    envBool("DISCORD_DISABLE_WEBSOCKET", false),
-		WebSocketReconnect:  envBool("DISCORD_WEBSOCKET_RECONNECT", true),
-		WebSocketMaxRetries: envInt("DISCORD_WEBSOCKET_MAX_RETRIES", 5),
-	}
-
-	// Validate required Discord config
-	if cfg.Discord.Token == "" {
-		errs = append(errs, "DISCORD_TOKEN is required")
-	}
-
-	// HTTP config
-	cfg.HTTP = HTTPConfig{
-		Host:            envString("HTTP_HOST", "0.0.0.0"),
-		Port:            envInt("HTTP_PORT", 8080),
-		ReadTimeout:     envDuration("HTTP_READ_TIMEOUT", 15*time.Second),
-		WriteTimeout:    envDuration("HTTP_WRITE_TIMEOUT", 15*time.Second),
-		IdleTimeout:     envDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
-		ShutdownTimeout: envDuration("HTTP_SHUTDOWN_TIMEOUT", 30*time.Second),
-		EnableCORS:      envBool("HTTP_ENABLE_CORS", true),
-		AllowedOrigins:  envStringSlice("HTTP_ALLOWED_ORIGINS", []string{"*"}),
-		RateLimitRPS:    envFloat("HTTP_RATE_LIMIT_RPS", 100),
-		RateLimitBurst:  envInt("HTTP_RATE_LIMIT_BURST", 200),
-	}
-
-	// Database config
-	cfg.Database = DatabaseConfig{
-		Host:         envString("DB_HOST", "localhost"),
-		Port:         envInt("DB_PORT", 5432),
-		User:         envString("DB_USER", "agis"),
-		Password:     envString("DB_PASSWORD", ""),
-		Name:         envString("DB_NAME", "agis"),
-		SSLMode:      envString("DB_SSL_MODE", "disable"),
-		MaxOpenConns: envInt("DB_MAX_OPEN_CONNS", 25),
-		MaxIdleConns: envInt("DB_MAX_IDLE_CONNS", 5),
-		MaxLifetime:  envDuration("DB_MAX_LIFETIME", 5*time.Minute),
-	}
-
-	// Feature flags
-	cfg.Features = FeatureConfig{
-		EnablePremium:      envBool("FEATURE_PREMIUM", false),
-		EnableAnalytics:    envBool("FEATURE_ANALYTICS", true),
-		EnableWebSocket:    envBool("FEATURE_WEBSOCKET", true),
-		EnableHealthChecks: envBool("FEATURE_HEALTH_CHECKS", true),
-		EnableMetrics:      envBool("FEATURE_METRICS", true),
-		EnableOpenSaaS:     envBool("FEATURE_OPENSAAS", true),
-		EnableRateLimiting: envBool("FEATURE_RATE_LIMITING", true),
-	}
-
-	// Metrics config
-	cfg.Metrics = MetricsConfig{
-		Enabled:   envBool("METRICS_ENABLED", true),
-		Path:      envString("METRICS_PATH", "/metrics"),
-		Namespace: envString("METRICS_NAMESPACE", "agis"),
-	}
-
-	// Log config
-	cfg.Log = LogConfig{
-		Level:       envString("LOG_LEVEL", "info"),
-		Format:      envString("LOG_FORMAT", "json"),
-		AddSource:   envBool("LOG_ADD_SOURCE", false),
-		Development: envBool("LOG_DEVELOPMENT", false),
-	}
-
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("config validation failed: %s", strings.Join(errs, "; "))
-	}
+	return LoadFrom(Sources{})
+}
 
-	return cfg, nil
+// LoadFile loads configuration from defaults, a config file and
+// environment variables. An empty path reads the environment only.
+func LoadFile(path string) (*Config, error) {
+	return LoadFrom(Sources{File: path})
 }
 
 // MustLoad loads configuration and panics on error.
@@ -207,14 +158,6 @@ func MustLoad() *Config {
 	return cfg
 }
 
-// DatabaseDSN returns the PostgreSQL connection string.
-func (c *DatabaseConfig) DatabaseDSN() string {
-	return fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode,
-	)
-}
-
 // HTTPAddress returns the full HTTP address.
 func (c *HTTPConfig) HTTPAddress() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
@@ -229,64 +172,3 @@ func (c *AppConfig) IsProduction() bool {
 func (c *AppConfig) IsDevelopment() bool {
 	return c.Environment == "development"
 }
-
-// Helper functions for environment variable parsing
-
-func envString(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
-	}
-	return defaultVal
-}
-
-func envInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.Atoi(val); err == nil {
-			return i
-		}
-	}
-	return defaultVal
-}
-
-func envFloat(key string, defaultVal float64) float64 {
-	if val := os.Getenv(key); val != "" {
-		if f, err := strconv.ParseFloat(val, 64); err == nil {
-			return f
-		}
-	}
-	return defaultVal
-}
-
-func envBool(key string, defaultVal bool) bool {
-	if val := os.Getenv(key); val != "" {
-		if b, err := strconv.ParseBool(val); err == nil {
-			return b
-		}
-	}
-	return defaultVal
-}
-
-func envDuration(key string, defaultVal time.Duration) time.Duration {
-	if val := os.Getenv(key); val != "" {
-		if d, err := time.ParseDuration(val); err == nil {
-			return d
-		}
-	}
-	return defaultVal
-}
-
-func envStringSlice(key string, defaultVal []string) []string {
-	if val := os.Getenv(key); val != "" {
-		parts := strings.Split(val, ",")
-		result := make([]string, 0, len(parts))
-		for _, p := range parts {
-			if trimmed := strings.TrimSpace(p); trimmed != "" {
-				result = append(result, trimmed)
-			}
-		}
-		if len(result) > 0 {
-			return result
-		}
-	}
-	return defaultVal
-}
@@ -2,9 +2,14 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/wethegamers/agis/internal/secrets"
 )
 
 func TestLoad(t *testing.T) {
@@ -183,53 +188,239 @@ func TestIsDevelopment(t *testing.T) {
 	}
 }
 
-func TestEnvHelpers(t *testing.T) {
-	os.Setenv("TEST_STRING", "value")
-	if envString("TEST_STRING", "default") != "value" {
-		t.Error("envString failed")
+func TestLoadStrictParsing(t *testing.T) {
+	env := map[string]string{
+		"DISCORD_TOKEN":        "test",
+		"HTTP_PORT":            "abc",
+		"HTTP_READ_TIMEOUT":    "15",
+		"HTTP_RATE_LIMIT_RPS":  "fast",
+		"FEATURE_PREMIUM":      "yes please",
+		"DB_PASSWORD":          "hunter2",
+		"DB_MAX_OPEN_CONNS":    "25",
+		"HTTP_ALLOWED_ORIGINS": "https://a.example, https://b.example",
+	}
+	_, err := LoadFrom(Sources{LookupEnv: mapEnv(env)})
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	for _, want := range []string{
+		`http.port: invalid value "abc" from env HTTP_PORT: not an integer`,
+		`http.read_timeout: invalid value "15" from env HTTP_READ_TIMEOUT`,
+		`http.rate_limit_rps: invalid value "fast"`,
+		`features.premium: invalid value "yes please"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Key != "http.port" {
+		t.Errorf("expected a *FieldError for http.port, got %v", fe)
+	}
+
+	env["HTTP_PORT"], env["HTTP_READ_TIMEOUT"], env["HTTP_RATE_LIMIT_RPS"], env["FEATURE_PREMIUM"] = "9000", "15s", "2.5", "true"
+	cfg, err := LoadFrom(Sources{LookupEnv: mapEnv(env)})
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if cfg.HTTP.Port != 9000 || cfg.HTTP.RateLimitRPS != 2.5 || !cfg.Features.EnablePremium || len(cfg.HTTP.AllowedOrigins) != 2 {
+		t.Errorf("unexpected config %+v", cfg.HTTP)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "agis.yaml")
+	if err := os.WriteFile(yamlFile, []byte(`# agis settings
+http:
+  port: 8000
+  host: 127.0.0.1
+  allowed_origins:
+    - https://a.example
+    - https://b.example
+log:
+  level: debug
+database:
+  password: from-file
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"DISCORD_TOKEN": "t", "HTTP_PORT": "9000", "LOG_LEVEL": "warn"}
+
+	cfg, err := LoadFrom(Sources{File: yamlFile, LookupEnv: mapEnv(env), Args: []string{"--log-level=error", "--app-debug"}})
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	for key, want := range map[string]struct {
+		got    any
+		value  any
+		origin string
+	}{
+		"app.name":              {cfg.App.Name, "agis-bot", "default"},
+		"http.host":             {cfg.HTTP.Host, "127.0.0.1", "file " + yamlFile + ":4"},
+		"http.allowed_origins":  {len(cfg.HTTP.AllowedOrigins), 2, "file " + yamlFile + ":5"},
+		"http.port":             {cfg.HTTP.Port, 9000, "env HTTP_PORT"},
+		"log.level":             {cfg.Log.Level, "error", "flag --log-level"},
+		"app.debug":             {cfg.App.Debug, true, "flag --app-debug"},
+		"database.password":     {cfg.Database.Password, "from-file", "file " + yamlFile + ":11"},
+		"http.rate_limit_burst": {cfg.HTTP.RateLimitBurst, 200, "default"},
+	} {
+		if want.got != want.value {
+			t.Errorf("%s = %v, want %v", key, want.got, want.value)
+		}
+		if got := cfg.Origin(key).String(); got != want.origin {
+			t.Errorf("%s origin = %q, want %q", key, got, want.origin)
+		}
+	}
+
+	for _, s := range cfg.Settings() {
+		switch s.Key {
+		case "database.password":
+			if s.Value != Redacted || !s.Secret {
+				t.Errorf("password printed as %q", s.Value)
+			}
+		case "discord.client_secret":
+			if s.Value != "" {
+				t.Errorf("unset secret printed as %q", s.Value)
+			}
+		case "http.allowed_origins":
+			if s.Value != "https://a.example,https://b.example" || s.Env != "HTTP_ALLOWED_ORIGINS" || s.Flag != "--http-allowed-origins" {
+				t.Errorf("unexpected setting %+v", s)
+			}
+		}
+	}
+
+	if _, err := LoadFrom(Sources{LookupEnv: mapEnv(env), Args: []string{"--http-prot=1"}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown flag: %v", err)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agis.toml")
+	if err := os.WriteFile(path, []byte(`# agis settings
+discord.token = "from-toml"
+
+[http]
+port = 8000 # inline comment
+allowed_origins = ["https://a.example", 'https://b#example']
+read_timeout = "20s"
+
+[features]
+premium = true
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(Sources{File: path, LookupEnv: mapEnv(nil)})
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if cfg.Discord.Token != "from-toml" || cfg.HTTP.Port != 8000 || cfg.HTTP.ReadTimeout != 20*time.Second || !cfg.Features.EnablePremium {
+		t.Errorf("unexpected config %+v %+v", cfg.HTTP, cfg.Features)
+	}
+	if got := strings.Join(cfg.HTTP.AllowedOrigins, " "); got != "https://a.example https://b#example" {
+		t.Errorf("allowed origins = %q", got)
+	}
+	if got := cfg.Origin("http.port").String(); got != "file "+path+":5" {
+		t.Errorf("origin = %q", got)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unknown.yaml": "http:\n  prot: 8080\n  port: 8080\nlog: debug\n",
+		"unknown.toml": "[http]\nprot = 8080\nport = [1\n",
+		"bad.yaml":     "http: [unclosed\n",
+		"agis.json":    "{}",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFrom(Sources{File: path, LookupEnv: mapEnv(map[string]string{"DISCORD_TOKEN": "t"})})
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		switch name {
+		case "unknown.yaml":
+			for _, want := range []string{`unknown.yaml:2: unknown setting "http.prot"`, "unknown.yaml:4: log: expected a mapping"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error does not report %q:\n%v", name, want, err)
+				}
+			}
+		case "unknown.toml":
+			for _, want := range []string{`unknown.toml:2: unknown setting "http.prot"`, "unknown.toml:3: http.port: arrays must be on one line"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error does not report %q:\n%v", name, want, err)
+				}
+			}
+		}
 	}
-	if envString("MISSING", "default") != "default" {
-		t.Error("envString default failed")
+}
+
+func TestLoadSecretRefs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db-password")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
 	}
-	os.Unsetenv("TEST_STRING")
+	m := secrets.NewManager(nil)
+	m.Register("file", secrets.FileResolver{})
+	ref := "file://" + path
+	env := map[string]string{"DISCORD_TOKEN": "t", "DB_PASSWORD": ref, "APP_NAME": "file:///not/a/secret"}
 
-	os.Setenv("TEST_INT", "42")
-	if envInt("TEST_INT", 0) != 42 {
-		t.Error("envInt failed")
+	cfg, err := LoadFrom(Sources{LookupEnv: mapEnv(env), Secrets: m})
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if cfg.Database.Password != "s3cret" {
+		t.Errorf("password = %q, want the file contents", cfg.Database.Password)
 	}
-	if envInt("MISSING", 10) != 10 {
-		t.Error("envInt default failed")
+	if cfg.App.Name != "file:///not/a/secret" {
+		t.Errorf("non-secret setting resolved to %q", cfg.App.Name)
+	}
+	for _, s := range cfg.Settings() {
+		if s.Key == "database.password" && s.Value != ref {
+			t.Errorf("password printed as %q, want the reference", s.Value)
+		}
 	}
-	os.Unsetenv("TEST_INT")
 
-	os.Setenv("TEST_INT_INVALID", "not-a-number")
-	if envInt("TEST_INT_INVALID", 99) != 99 {
-		t.Error("envInt invalid should return default")
+	env["DISCORD_TOKEN"] = "vault://secret/agis#token"
+	_, err = LoadFrom(Sources{LookupEnv: mapEnv(env), Secrets: m})
+	if !errors.Is(err, secrets.ErrNoResolver) || !strings.Contains(err.Error(), "discord.token") {
+		t.Errorf("unresolvable reference: %v", err)
 	}
-	os.Unsetenv("TEST_INT_INVALID")
+}
 
-	os.Setenv("TEST_FLOAT", "3.14")
-	if envFloat("TEST_FLOAT", 0) != 3.14 {
-		t.Error("envFloat failed")
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
 	}
-	os.Unsetenv("TEST_FLOAT")
+}
 
-	os.Setenv("TEST_BOOL", "true")
-	if !envBool("TEST_BOOL", false) {
-		t.Error("envBool failed")
+func TestLoadFile(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("HTTP_PORT", "9000")
+	path := filepath.Join(t.TempDir(), "agis.env")
+	data := "# live settings\nexport DISCORD_TOKEN=\"from-file\"\nLOG_LEVEL = debug\nHTTP_PORT=8000\n\nHTTP_ALLOWED_ORIGINS='https://a.example, https://b.example'\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
 	}
-	os.Unsetenv("TEST_BOOL")
 
-	os.Setenv("TEST_DUR", "5m")
-	if envDuration("TEST_DUR", time.Second) != 5*time.Minute {
-		t.Error("envDuration failed")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Discord.Token != "from-file" || cfg.Log.Level != "debug" || len(cfg.HTTP.AllowedOrigins) != 2 {
+		t.Errorf("file values not loaded: %+v", cfg)
+	}
+	if cfg.HTTP.Port != 9000 {
+		t.Errorf("expected environment to override the file, got port %d", cfg.HTTP.Port)
 	}
-	os.Unsetenv("TEST_DUR")
 
-	os.Setenv("TEST_SLICE", "a, b, c")
-	slice := envStringSlice("TEST_SLICE", nil)
-	if len(slice) != 3 || slice[0] != "a" || slice[1] != "b" || slice[2] != "c" {
-		t.Errorf("envStringSlice failed: %v", slice)
+	if _, err := ParseEnvFile([]byte("LOG_LEVEL\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("ParseEnvFile error = %v, want line 1", err)
 	}
-	os.Unsetenv("TEST_SLICE")
 }
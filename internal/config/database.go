@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatabaseDSN returns the PostgreSQL keyword connection string. Values
+// are quoted as libpq requires, so passwords with spaces, quotes or
+// backslashes survive; optional settings that are unset are left out.
+func (c *DatabaseConfig) DatabaseDSN() string {
+	var b strings.Builder
+	add := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(quoteDSN(value))
+	}
+	add("host", c.Host)
+	add("port", strconv.Itoa(c.Port))
+	add("user", c.User)
+	if c.Password != "" {
+		add("password", c.Password)
+	}
+	add("dbname", c.Name)
+	add("sslmode", c.SSLMode)
+	for _, p := range c.params() {
+		add(p[0], p[1])
+	}
+	return b.String()
+}
+
+// quoteDSN quotes a keyword DSN value if it is empty or contains
+// whitespace, a quote or a backslash.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\r'\\") {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// params returns the optional connection parameters that are set, in
+// the order they appear in DSNs and URLs.
+func (c *DatabaseConfig) params() [][2]string {
+	var out [][2]string
+	for _, p := range [][2]string{
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+		{"application_name", c.ApplicationName},
+		{"options", c.options()},
+	} {
+		if p[1] != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// options sets the statement and lock timeouts as server parameters, in
+// milliseconds, when the session starts.
+func (c *DatabaseConfig) options() string {
+	var opts []string
+	if c.StatementTimeout > 0 {
+		opts = append(opts, fmt.Sprintf("-c statement_timeout=%d", c.StatementTimeout.Milliseconds()))
+	}
+	if c.LockTimeout > 0 {
+		opts = append(opts, fmt.Sprintf("-c lock_timeout=%d", c.LockTimeout.Milliseconds()))
+	}
+	return strings.Join(opts, " ")
+}
+
+// ConnectionURL returns the postgres:// URL form of the connection
+// settings, the inverse of ParseURL.
+func (c *DatabaseConfig) ConnectionURL() string {
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:   "/" + c.Name,
+	}
+	switch {
+	case c.Password != "":
+		u.User = url.UserPassword(c.User, c.Password)
+	case c.User != "":
+		u.User = url.User(c.User)
+	}
+	q := url.Values{"sslmode": {c.SSLMode}}
+	for _, p := range c.params() {
+		q.Set(p[0], p[1])
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ParseURL sets the connection settings a postgres:// or postgresql://
+// URL contains. Settings the URL leaves out keep their values. Errors
+// never include the URL, which may hold a password.
+func (c *DatabaseConfig) ParseURL(raw string) error {
+	values, err := databaseURLValues(raw)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(c).Elem()
+	for key, v := range values {
+		s := findSetting(func(s setting) bool { return s.key == key })
+		if err := setField(rv.Field(s.index[1]), v); err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimPrefix(key, "database."), err)
+		}
+	}
+	return nil
+}
+
+// urlParams maps URL query parameters to settings.
+var urlParams = map[string]string{
+	"sslmode":          "database.ssl_mode",
+	"sslrootcert":      "database.ssl_root_cert",
+	"sslcert":          "database.ssl_cert",
+	"sslkey":           "database.ssl_key",
+	"application_name": "database.application_name",
+}
+
+// databaseURLValues reads a URL into raw values by setting key.
+func databaseURLValues(raw string) (map[string]string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.New("not a valid URL")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return nil, fmt.Errorf("scheme must be postgres or postgresql, got %q", u.Scheme)
+	}
+	if strings.Contains(u.Host, ",") {
+		return nil, errors.New("multiple hosts are not supported")
+	}
+
+	values := make(map[string]string)
+	if h := u.Hostname(); h != "" {
+		values["database.host"] = h
+	}
+	if p := u.Port(); p != "" {
+		values["database.port"] = p
+	}
+	if u.User != nil {
+		values["database.user"] = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			values["database.password"] = p
+		}
+	}
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		values["database.name"] = name
+	}
+	for param, vs := range u.Query() {
+		v := vs[len(vs)-1]
+		if key, ok := urlParams[param]; ok {
+			values[key] = v
+			continue
+		}
+		if param != "options" {
+			return nil, fmt.Errorf("unsupported parameter %q", param)
+		}
+		if err := parseOptions(v, values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// parseOptions reads the -c statement_timeout and -c lock_timeout server
+// parameters. Bare numbers are milliseconds, as in PostgreSQL.
+func parseOptions(opts string, values map[string]string) error {
+	fields := strings.Fields(opts)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "-c" && i+1 < len(fields):
+			i++
+			f = fields[i]
+		case strings.HasPrefix(f, "-c"):
+			f = f[2:]
+		default:
+			return fmt.Errorf("unsupported option %q", f)
+		}
+		name, v, _ := strings.Cut(f, "=")
+		if _, err := strconv.Atoi(v); err == nil {
+			v += "ms"
+		}
+		switch name {
+		case "statement_timeout":
+			values["database.statement_timeout"] = v
+		case "lock_timeout":
+			values["database.lock_timeout"] = v
+		default:
+			return fmt.Errorf("unsupported option %q", name)
+		}
+	}
+	return nil
+}
+
+// applyDatabaseURL fills the connection settings from Database.URL. A
+// setting given both in the URL and elsewhere with a different value is
+// an error rather than silently resolved.
+func (c *Config) applyDatabaseURL() []error {
+	if c.Database.URL == "" {
+		return nil
+	}
+	origin := c.Origin("database.url")
+	values, err := databaseURLValues(c.Database.URL)
+	if err != nil {
+		return []error{&FieldError{Key: "database.url", Origin: origin, Err: err}}
+	}
+
+	var errs []error
+	rv := reflect.ValueOf(c).Elem()
+	for _, s := range settings {
+		v, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		field := rv.FieldByIndex(s.index)
+		parsed := reflect.New(field.Type()).Elem()
+		if err := setField(parsed, v); err != nil {
+			fe := &FieldError{Key: s.key, Origin: origin, Value: v, Err: err}
+			if s.secret {
+				fe.Value = ""
+			}
+			errs = append(errs, fe)
+			continue
+		}
+		if o := c.Origin(s.key); o.Layer != LayerDefault && !reflect.DeepEqual(parsed.Interface(), field.Interface()) {
+			errs = append(errs, fmt.Errorf("%s: set by both %s and database.url (%s); use one", s.key, o, origin))
+			continue
+		}
+		field.Set(parsed)
+		c.origins[s.key] = origin
+	}
+	return errs
+}
+
+// Replicas returns a configuration for each read replica in ReplicaURLs.
+// Each starts from c, so the credentials, database, TLS settings and
+// timeouts a replica URL leaves out are the primary's.
+func (c *DatabaseConfig) Replicas() ([]DatabaseConfig, error) {
+	out := make([]DatabaseConfig, 0, len(c.ReplicaURLs))
+	for i, raw := range c.ReplicaURLs {
+		r := *c
+		r.URL, r.ReplicaURLs = raw, nil
+		if err := r.ParseURL(raw); err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ReplicaDSNs returns the keyword DSN of each read replica, for reporting
+// queries that tolerate replication lag.
+func (c *DatabaseConfig) ReplicaDSNs() ([]string, error) {
+	replicas, err := c.Replicas()
+	if err != nil {
+		return nil, err
+	}
+	dsns := make([]string, len(replicas))
+	for i := range replicas {
+		dsns[i] = replicas[i].DatabaseDSN()
+	}
+	return dsns, nil
+}
+
+// millis reports whether d is a whole number of milliseconds, the
+// resolution PostgreSQL timeouts are sent with.
+func millis(d time.Duration) bool {
+	return d%time.Millisecond == 0
+}
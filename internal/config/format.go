@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues collects raw values from a config file, reporting unknown
+// keys and malformed entries with their line.
+type fileValues struct {
+	path   string
+	values map[string]value
+	errs   []error
+}
+
+func (f *fileValues) set(key, raw string, line int) {
+	if findSetting(func(s setting) bool { return s.key == key }) == nil {
+		f.fail(line, "unknown setting %q", key)
+		return
+	}
+	f.values[key] = value{raw: raw, origin: Origin{Layer: LayerFile, Source: fmt.Sprintf("%s:%d", f.path, line)}}
+}
+
+func (f *fileValues) fail(line int, format string, args ...any) {
+	f.errs = append(f.errs, fmt.Errorf("%s:%d: "+format, append([]any{f.path, line}, args...)...))
+}
+
+func (f *fileValues) result() (map[string]value, error) {
+	return f.values, errors.Join(f.errs...)
+}
+
+// parseYAML reads sections of scalar or list settings:
+//
+//	http:
+//	  port: 8080
+//	  allowed_origins: [https://wethegamers.org]
+func parseYAML(path string, data []byte) (map[string]value, error) {
+	f := &fileValues{path: path, values: make(map[string]value)}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return f.result()
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		f.fail(root.Line, "expected a mapping of sections")
+		return f.result()
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, section := root.Content[i], root.Content[i+1]
+		if section.Kind != yaml.MappingNode {
+			f.fail(section.Line, "%s: expected a mapping of settings", name.Value)
+			continue
+		}
+		for j := 0; j+1 < len(section.Content); j += 2 {
+			k, v := section.Content[j], section.Content[j+1]
+			key := name.Value + "." + k.Value
+			switch v.Kind {
+			case yaml.ScalarNode:
+				raw := v.Value
+				if v.Tag == "!!null" {
+					raw = ""
+				}
+				f.set(key, raw, k.Line)
+			case yaml.SequenceNode:
+				items := make([]string, 0, len(v.Content))
+				for _, item := range v.Content {
+					if item.Kind != yaml.ScalarNode {
+						f.fail(item.Line, "%s: list items must be scalars", key)
+					}
+					items = append(items, item.Value)
+				}
+				f.set(key, strings.Join(items, ","), k.Line)
+			default:
+				f.fail(v.Line, "%s: expected a scalar or list", key)
+			}
+		}
+	}
+	return f.result()
+}
+
+// parseTOML reads the subset of TOML used for settings: [section] tables
+// or dotted keys, with string, number, boolean and single-line string
+// array values.
+func parseTOML(path string, data []byte) (map[string]value, error) {
+	f := &fileValues{path: path, values: make(map[string]value)}
+	section := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				f.fail(n, "unsupported table header %s", line)
+				continue
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			f.fail(n, "expected key = value")
+			continue
+		}
+		key := strings.TrimSpace(k)
+		if section != "" {
+			key = section + "." + key
+		}
+		raw, err := tomlValue(strings.TrimSpace(v))
+		if err != nil {
+			f.fail(n, "%s: %v", key, err)
+			continue
+		}
+		f.set(key, raw, n)
+	}
+	return f.result()
+}
+
+// tomlValue converts a TOML value to the raw string form used by env
+// vars; arrays are joined with commas.
+func tomlValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "["):
+		if !strings.HasSuffix(v, "]") {
+			return "", errors.New("arrays must be on one line")
+		}
+		var items []string
+		for _, item := range splitArray(v[1 : len(v)-1]) {
+			s, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(v, `"""`), strings.HasPrefix(v, "'''"), strings.HasPrefix(v, "{"):
+		return "", errors.New("multi-line strings and inline tables are not supported")
+	case strings.HasPrefix(v, `"`):
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("malformed string %s", v)
+		}
+		return s, nil
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("malformed string %s", v)
+		}
+		return v[1 : len(v)-1], nil
+	case v == "":
+		return "", errors.New("missing value")
+	}
+	return v, nil
+}
+
+// splitArray splits array items on commas outside quotes.
+func splitArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote && (quote == '\'' || s[i-1] != '\\') {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// stripComment removes a # comment outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
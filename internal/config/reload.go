@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// ErrRejected is returned by Store.Reload when the new configuration
+// cannot be loaded or fails validation. The previous snapshot is kept.
+var ErrRejected = errors.New("config: reload rejected")
+
+// Section names a top-level part of Config that can be subscribed to.
+type Section string
+
+const (
+	SectionApp      Section = "app"
+	SectionDiscord  Section = "discord"
+	SectionHTTP     Section = "http"
+	SectionDatabase Section = "database"
+	SectionFeatures Section = "features"
+	SectionMetrics  Section = "metrics"
+	SectionLog      Section = "log"
+)
+
+// sections lists every section in Config field order.
+var sections = []struct {
+	name  Section
+	value func(*Config) any
+}{
+	{SectionApp, func(c *Config) any { return c.App }},
+	{SectionDiscord, func(c *Config) any { return c.Discord }},
+	{SectionHTTP, func(c *Config) any { return c.HTTP }},
+	{SectionDatabase, func(c *Config) any { return c.Database }},
+	{SectionFeatures, func(c *Config) any { return c.Features }},
+	{SectionMetrics, func(c *Config) any { return c.Metrics }},
+	{SectionLog, func(c *Config) any { return c.Log }},
+}
+
+// Changed returns the sections that differ between two configurations.
+func Changed(old, new *Config) []Section {
+	var changed []Section
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.value(old), s.value(new)) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+type subscriber struct {
+	id int
+	fn func(old, new *Config)
+}
+
+// Store holds the active configuration and swaps it atomically on
+// reload. Snapshots returned by Current are shared and must not be
+// modified.
+//
+// Subscribers are called after a reload for each section that changed.
+// A changed section nobody subscribes to is logged as taking effect after
+// a restart, since nothing applies it live.
+type Store struct {
+	load     func() (*Config, error)
+	validate func(*Config) error
+	logger   *slog.Logger
+	now      func() time.Time
+
+	current  atomic.Pointer[Config]
+	reloadMu sync.Mutex // serialises Reload
+
+	mu     sync.Mutex
+	subs   map[Section][]subscriber
+	nextID int
+}
+
+// NewStore loads the initial configuration with load, which is called
+// again on every reload.
+func NewStore(load func() (*Config, error)) (*Store, error) {
+	cfg, err := load()
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		load:   load,
+		logger: slog.Default(),
+		now:    time.Now,
+		subs:   make(map[Section][]subscriber),
+	}
+	s.current.Store(cfg)
+	return s, nil
+}
+
+// SetLogger sets the logger used to report reloads.
+func (s *Store) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SetValidator sets a check that reloaded configurations must pass
+// before they are applied.
+func (s *Store) SetValidator(fn func(*Config) error) {
+	s.validate = fn
+}
+
+// Current returns the active snapshot.
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// Subscribe calls fn after every reload that changes section. The
+// returned function removes the subscription.
+func (s *Store) Subscribe(section Section, fn func(old, new *Config)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.subs[section] = append(s.subs[section], subscriber{id: id, fn: fn})
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subs := s.subs[section]
+		for i, sub := range subs {
+			if sub.id == id {
+				s.subs[section] = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Reload loads and validates a new configuration and, if anything
+// changed, swaps it in and notifies subscribers. trigger names what
+// caused the reload (signal, file, admin) in logs and metrics. It returns
+// the sections that changed.
+func (s *Store) Reload(trigger string) ([]Section, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := s.load()
+	if err == nil && s.validate != nil {
+		err = s.validate(cfg)
+	}
+	if err != nil {
+		metrics.ConfigReloadsTotal.WithLabelValues(trigger, "rejected").Inc()
+		s.logger.Warn("configuration reload rejected, keeping previous snapshot", "trigger", trigger, "error", err)
+		return nil, fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+
+	old := s.current.Load()
+	changed := Changed(old, cfg)
+	if len(changed) == 0 {
+		metrics.ConfigReloadsTotal.WithLabelValues(trigger, "unchanged").Inc()
+		return nil, nil
+	}
+	s.current.Store(cfg)
+	metrics.ConfigReloadsTotal.WithLabelValues(trigger, "applied").Inc()
+	metrics.ConfigLastReloadTimestamp.Set(float64(s.now().Unix()))
+	s.logger.Info("configuration reloaded", "trigger", trigger, "sections", changed)
+
+	for _, section := range changed {
+		s.mu.Lock()
+		subs := s.subs[section]
+		s.mu.Unlock()
+		if len(subs) == 0 {
+			s.logger.Warn("configuration change takes effect after restart", "section", section)
+		}
+		for _, sub := range subs {
+			sub.fn(old, cfg)
+		}
+	}
+	return changed, nil
+}
+
+// LevelSetter is implemented by *logging.Logger.
+type LevelSetter interface {
+	SetLevel(level string)
+}
+
+// BindLogLevel applies Log.Level to l now and after every reload that
+// changes it. The returned function unbinds it.
+func (s *Store) BindLogLevel(l LevelSetter) func() {
+	l.SetLevel(s.Current().Log.Level)
+	return s.Subscribe(SectionLog, func(old, new *Config) {
+		if old.Log.Level != new.Log.Level {
+			l.SetLevel(new.Log.Level)
+		}
+	})
+}
+
+// RateLimitSetter is implemented by *middleware.RateLimiter.
+type RateLimitSetter interface {
+	SetLimits(requestsPerSecond float64, burst int)
+}
+
+// BindRateLimit applies HTTP.RateLimitRPS and HTTP.RateLimitBurst to r
+// now and after every reload that changes them. The returned function
+// unbinds it.
+func (s *Store) BindRateLimit(r RateLimitSetter) func() {
+	h := s.Current().HTTP
+	r.SetLimits(h.RateLimitRPS, h.RateLimitBurst)
+	return s.Subscribe(SectionHTTP, func(old, new *Config) {
+		if old.HTTP.RateLimitRPS != new.HTTP.RateLimitRPS || old.HTTP.RateLimitBurst != new.HTTP.RateLimitBurst {
+			r.SetLimits(new.HTTP.RateLimitRPS, new.HTTP.RateLimitBurst)
+		}
+	})
+}
+
+// AllowedOrigins returns the current HTTP.AllowedOrigins, for use with
+// middleware.CORSFunc so origin changes apply to the next request.
+func (s *Store) AllowedOrigins() []string {
+	return s.Current().HTTP.AllowedOrigins
+}
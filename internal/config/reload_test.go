@@ -0,0 +1,242 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/logging"
+	"github.com/wethegamers/agis/internal/middleware"
+)
+
+// fileStore writes settings to an env file and returns a Store loading
+// it.
+func fileStore(t *testing.T, settings string) (*Store, func(string)) {
+	t.Helper()
+	for _, key := range []string{"DISCORD_TOKEN", "LOG_LEVEL", "HTTP_RATE_LIMIT_RPS", "HTTP_RATE_LIMIT_BURST", "HTTP_ALLOWED_ORIGINS", "FEATURE_PREMIUM"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "agis.env")
+	write := func(settings string) {
+		if err := os.WriteFile(path, []byte(settings), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(settings)
+	s, err := NewStore(func() (*Config, error) { return LoadFile(path) })
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	return s, write
+}
+
+func TestStoreReload(t *testing.T) {
+	s, write := fileStore(t, "DISCORD_TOKEN=t\nLOG_LEVEL=info\n")
+	first := s.Current()
+
+	var logChanges, featureChanges int
+	s.Subscribe(SectionLog, func(old, new *Config) {
+		logChanges++
+		if old.Log.Level != "info" || new.Log.Level != "debug" {
+			t.Errorf("log change %q -> %q", old.Log.Level, new.Log.Level)
+		}
+	})
+	unsubscribe := s.Subscribe(SectionFeatures, func(_, _ *Config) { featureChanges++ })
+	unsubscribe()
+
+	write("DISCORD_TOKEN=t\nLOG_LEVEL=debug\nFEATURE_PREMIUM=true\n")
+	changed, err := s.Reload("test")
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if !slices.Equal(changed, []Section{SectionFeatures, SectionLog}) {
+		t.Errorf("changed = %v", changed)
+	}
+	if logChanges != 1 || featureChanges != 0 {
+		t.Errorf("notified log %d times and features %d times", logChanges, featureChanges)
+	}
+	if s.Current().Log.Level != "debug" || first.Log.Level != "info" {
+		t.Error("expected a new snapshot, leaving the old one untouched")
+	}
+
+	if changed, err := s.Reload("test"); err != nil || changed != nil {
+		t.Errorf("unchanged Reload = %v, %v", changed, err)
+	}
+	if logChanges != 1 {
+		t.Error("subscriber called without a change")
+	}
+}
+
+func TestStoreReloadRejectsInvalid(t *testing.T) {
+	s, write := fileStore(t, "DISCORD_TOKEN=t\nLOG_LEVEL=warn\n")
+	s.SetValidator(func(c *Config) error {
+		if c.Log.Level == "verbose" {
+			return errors.New("unknown log level")
+		}
+		return nil
+	})
+
+	for _, settings := range []string{
+		"LOG_LEVEL=debug\n",                  // DISCORD_TOKEN missing
+		"DISCORD_TOKEN=t\nLOG_LEVEL=verbose", // fails the validator
+		"DISCORD_TOKEN=t\nnot a setting\n",   // malformed file
+	} {
+		write(settings)
+		if _, err := s.Reload("test"); !errors.Is(err, ErrRejected) {
+			t.Errorf("Reload(%q) = %v, want ErrRejected", settings, err)
+		}
+		if s.Current().Log.Level != "warn" {
+			t.Fatalf("previous snapshot replaced by %q", settings)
+		}
+	}
+}
+
+func TestStoreBindings(t *testing.T) {
+	s, write := fileStore(t, "DISCORD_TOKEN=t\nLOG_LEVEL=info\nHTTP_RATE_LIMIT_RPS=0.001\nHTTP_RATE_LIMIT_BURST=1\n")
+	logger := logging.New(logging.Config{Output: new(nopWriter)})
+	s.BindLogLevel(logger)
+	rl := middleware.NewRateLimiter(100, 100)
+	s.BindRateLimit(rl)
+
+	ctx := context.Background()
+	if logger.Enabled(ctx, logging.LevelDebug) || !rl.Allow("a") || rl.Allow("a") {
+		t.Fatal("initial settings not applied")
+	}
+
+	write("DISCORD_TOKEN=t\nLOG_LEVEL=debug\nHTTP_RATE_LIMIT_RPS=0.001\nHTTP_RATE_LIMIT_BURST=2\n")
+	if _, err := s.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if !logger.Enabled(ctx, logging.LevelDebug) {
+		t.Error("log level not applied")
+	}
+	if !rl.Allow("b") || !rl.Allow("b") || rl.Allow("b") {
+		t.Error("rate limit burst not applied")
+	}
+}
+
+func TestStoreHTTPMiddlewareFollowsReload(t *testing.T) {
+	s, write := fileStore(t, "DISCORD_TOKEN=t\nHTTP_RATE_LIMIT_RPS=0.001\nHTTP_RATE_LIMIT_BURST=1\nHTTP_ALLOWED_ORIGINS=https://a.example\n")
+	rl := middleware.NewRateLimiter(100, 100)
+	s.BindRateLimit(rl)
+	h := middleware.Chain(
+		middleware.CORSFunc(s.AllowedOrigins),
+		rl.Handler(middleware.IPKeyFunc),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(client, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/servers", nil)
+		req.Header.Set("X-Real-IP", client)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("a", "https://a.example"); rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://a.example" {
+		t.Fatalf("first request: %d, origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec := serve("a", "https://a.example"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request within burst 1: %d", rec.Code)
+	}
+
+	write("DISCORD_TOKEN=t\nHTTP_RATE_LIMIT_RPS=0.001\nHTTP_RATE_LIMIT_BURST=3\nHTTP_ALLOWED_ORIGINS=https://b.example\n")
+	if _, err := s.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if rec := serve("b", "https://b.example"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within burst 3: %d", i+1, rec.Code)
+		}
+	}
+	if rec := serve("b", "https://b.example"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request beyond burst 3: %d", rec.Code)
+	}
+	if rec := serve("c", "https://a.example"); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("removed origin still allowed")
+	}
+}
+
+func TestStoreWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agis.env")
+	write := func(origins string) {
+		if err := os.WriteFile(path, []byte("DISCORD_TOKEN=t\nHTTP_ALLOWED_ORIGINS="+origins+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HTTP_ALLOWED_ORIGINS", "")
+	write("https://a.example")
+	s, err := NewStore(func() (*Config, error) { return LoadFile(path) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.WatchFile(ctx, path, time.Millisecond) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	write("https://b.example")
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Equal(s.AllowedOrigins(), []string{"https://b.example"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("file change not applied, origins = %v", s.AllowedOrigins())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStoreHandler(t *testing.T) {
+	s, write := fileStore(t, "DISCORD_TOKEN=t\nLOG_LEVEL=info\n")
+	h := s.Handler("secret")
+	do := func(method, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/config/reload", http.NoBody)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "Bearer secret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler("").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", http.NoBody))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("empty token: status %d", rec.Code)
+	}
+
+	write("DISCORD_TOKEN=t\nLOG_LEVEL=error\n")
+	rec = do(http.MethodPost, "Bearer secret")
+	var body struct{ Changed []Section }
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("reload: status %d, %v", rec.Code, err)
+	}
+	if !slices.Equal(body.Changed, []Section{SectionLog}) {
+		t.Errorf("changed = %v", body.Changed)
+	}
+
+	write("LOG_LEVEL=debug\n")
+	if rec := do(http.MethodPost, "Bearer secret"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid config: status %d", rec.Code)
+	}
+}
+
+type nopWriter struct{}
+
+func (*nopWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,415 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned by LoadFrom when a setting cannot be parsed or a
+// required setting is missing. Every problem is reported, one per line.
+var ErrInvalid = errors.New("config: invalid configuration")
+
+// Layer is a configuration source. Later layers override earlier ones.
+type Layer string
+
+const (
+	LayerDefault Layer = "default"
+	LayerFile    Layer = "file"
+	LayerEnv     Layer = "env"
+	LayerFlag    Layer = "flag"
+)
+
+// Origin records where a setting's value came from: the layer and, for
+// files, environment variables and flags, the file and line, variable or
+// flag that set it.
+type Origin struct {
+	Layer  Layer  `json:"layer"`
+	Source string `json:"source,omitempty"`
+}
+
+func (o Origin) String() string {
+	if o.Source == "" {
+		return string(o.Layer)
+	}
+	return string(o.Layer) + " " + o.Source
+}
+
+// Sources selects the layers LoadFrom reads on top of the defaults.
+type Sources struct {
+	// File is a YAML (.yaml, .yml), TOML (.toml) or env (.env) file. If
+	// empty, CONFIG_FILE is used; --config overrides both.
+	File string
+	// LookupEnv reads environment variables; nil means os.LookupEnv.
+	// Empty values are treated as unset.
+	LookupEnv func(key string) (string, bool)
+	// Args are command-line flags such as --http-port=9000, one per
+	// setting, named after its key.
+	Args []string
+	// Secrets resolves secret settings given as references such as
+	// vault://secret/production/agis-bot#DB_PASSWORD; nil leaves them
+	// as written.
+	Secrets SecretResolver
+}
+
+// SecretResolver resolves secret references and returns other values
+// unchanged. *secrets.Manager implements it.
+type SecretResolver interface {
+	Resolve(ctx context.Context, value string) (string, error)
+}
+
+// setting describes one leaf field of Config.
+type setting struct {
+	key    string // file key, e.g. http.port
+	env    string
+	flag   string
+	def    string
+	secret bool
+	index  []int
+	typ    reflect.Type
+}
+
+var settings = buildSettings()
+
+func buildSettings() []setting {
+	var out []setting
+	ct := reflect.TypeOf(Config{})
+	for i := 0; i < ct.NumField(); i++ {
+		sf := ct.Field(i)
+		section := sf.Tag.Get("yaml")
+		if section == "" {
+			continue
+		}
+		for j := 0; j < sf.Type.NumField(); j++ {
+			f := sf.Type.Field(j)
+			key := section + "." + f.Tag.Get("yaml")
+			out = append(out, setting{
+				key:    key,
+				env:    f.Tag.Get("env"),
+				flag:   strings.NewReplacer(".", "-", "_", "-").Replace(key),
+				def:    f.Tag.Get("default"),
+				secret: f.Tag.Get("secret") == "true",
+				index:  []int{i, j},
+				typ:    f.Type,
+			})
+		}
+	}
+	return out
+}
+
+func findSetting(match func(setting) bool) *setting {
+	for i := range settings {
+		if match(settings[i]) {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// value is a raw setting value from one layer.
+type value struct {
+	raw    string
+	origin Origin
+}
+
+// FieldError reports a setting whose value could not be parsed.
+type FieldError struct {
+	Key    string
+	Origin Origin
+	Value  string // empty for secrets
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: invalid value from %s: %v", e.Key, e.Origin, e.Err)
+	}
+	return fmt.Sprintf("%s: invalid value %q from %s: %v", e.Key, e.Value, e.Origin, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// LoadFrom loads configuration from the defaults, then the config file,
+// then environment variables, then flags, and validates it. Values that
+// fail to parse are errors, not silently replaced by defaults; they and
+// any Validate problems are reported together, wrapped in ErrInvalid.
+func LoadFrom(src Sources) (*Config, error) {
+	lookup := src.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	var errs []error
+
+	flags, path, err := parseFlags(src.Args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if path == "" {
+		path = src.File
+	}
+	if path == "" {
+		path, _ = lookup("CONFIG_FILE")
+	}
+	file := map[string]value{}
+	if path != "" {
+		if file, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{origins: make(map[string]Origin, len(settings)), refs: make(map[string]string), file: path}
+	rv := reflect.ValueOf(cfg).Elem()
+	for _, s := range settings {
+		v := value{raw: s.def, origin: Origin{Layer: LayerDefault}}
+		if fv, ok := file[s.key]; ok {
+			v = fv
+		}
+		if raw, ok := lookup(s.env); ok && raw != "" {
+			v = value{raw: raw, origin: Origin{Layer: LayerEnv, Source: s.env}}
+		}
+		if fv, ok := flags[s.key]; ok {
+			v = fv
+		}
+		cfg.origins[s.key] = v.origin
+		if s.secret && src.Secrets != nil && v.raw != "" {
+			resolved, err := src.Secrets.Resolve(context.Background(), v.raw)
+			if err != nil {
+				errs = append(errs, &FieldError{Key: s.key, Origin: v.origin, Err: err})
+				continue
+			}
+			if resolved != v.raw {
+				cfg.refs[s.key] = v.raw
+			}
+			v.raw = resolved
+		}
+		if err := setField(rv.FieldByIndex(s.index), v.raw); err != nil {
+			fe := &FieldError{Key: s.key, Origin: v.origin, Value: v.raw, Err: err}
+			if s.secret {
+				fe.Value = ""
+			}
+			errs = append(errs, fe)
+		}
+	}
+
+	errs = append(errs, cfg.applyDatabaseURL()...)
+
+	failed := make(map[string]bool, len(errs))
+	for _, err := range errs {
+		if fe, ok := err.(*FieldError); ok {
+			failed[fe.Key] = true
+		}
+	}
+	errs = append(errs, cfg.validate(failed)...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// Origin reports where the setting with the given key, such as
+// http.port, got its value.
+func (c *Config) Origin(key string) Origin {
+	return c.origins[key]
+}
+
+// File returns the config file that was read, or "" if there was none.
+func (c *Config) File() string {
+	return c.file
+}
+
+// setField parses raw into a field of one of the supported kinds.
+func setField(f reflect.Value, raw string) error {
+	switch f.Interface().(type) {
+	case string:
+		f.SetString(raw)
+	case bool:
+		if raw == "" {
+			f.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		f.SetBool(b)
+	case int:
+		if raw == "" {
+			f.SetInt(0)
+			return nil
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		f.SetInt(int64(n))
+	case float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		f.SetFloat(n)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("not a duration such as 30s or 5m")
+		}
+		f.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				list = append(list, p)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+// parseFlags reads one flag per setting plus --config, the config file
+// path.
+func parseFlags(args []string) (map[string]value, string, error) {
+	values := make(map[string]value)
+	fs := flag.NewFlagSet("agis", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("config", "", "config file")
+	for _, s := range settings {
+		set := func(raw string) error {
+			values[s.key] = value{raw: raw, origin: Origin{Layer: LayerFlag, Source: "--" + s.flag}}
+			return nil
+		}
+		if s.typ.Kind() == reflect.Bool {
+			fs.BoolFunc(s.flag, s.key, set)
+		} else {
+			fs.Func(s.flag, s.key, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, *path, nil
+}
+
+// readFile decodes a config file by extension into raw values by key.
+// Unknown keys are errors, except in env files, which are often shared
+// with other programs.
+func readFile(path string) (map[string]value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	}
+	var values map[string]value
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		values, err = parseYAML(path, data)
+	case ".toml":
+		values, err = parseTOML(path, data)
+	case ".env":
+		values, err = parseEnv(path, data)
+	default:
+		return nil, fmt.Errorf("config: %s: unsupported file type %q (want .yaml, .toml or .env)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return values, nil
+}
+
+func parseEnv(path string, data []byte) (map[string]value, error) {
+	env, err := ParseEnvFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]value)
+	for name, raw := range env {
+		if s := findSetting(func(s setting) bool { return s.env == name }); s != nil {
+			values[s.key] = value{raw: raw, origin: Origin{Layer: LayerFile, Source: path}}
+		}
+	}
+	return values, nil
+}
+
+// ParseEnvFile parses KEY=value lines. Blank lines and lines starting
+// with # are skipped, an "export " prefix is allowed and values may be
+// wrapped in single or double quotes.
+func ParseEnvFile(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+		}
+		values[key] = unquote(strings.TrimSpace(val))
+	}
+	return values, nil
+}
+
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
+
+// Redacted replaces secret values in Settings.
+const Redacted = "<redacted>"
+
+// Setting is one effective setting and where it came from.
+type Setting struct {
+	Key    string `json:"key"`
+	Env    string `json:"env"`
+	Flag   string `json:"flag"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret,omitempty"`
+	Origin Origin `json:"origin"`
+}
+
+// Settings lists every setting in Config order with its effective value.
+// Secrets that are set show as Redacted, or as the reference they were
+// resolved from.
+func (c *Config) Settings() []Setting {
+	rv := reflect.ValueOf(c).Elem()
+	out := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		var v string
+		switch f := rv.FieldByIndex(s.index).Interface().(type) {
+		case []string:
+			v = strings.Join(f, ",")
+		default:
+			v = fmt.Sprint(f)
+		}
+		if s.secret && v != "" {
+			v = Redacted
+			if ref, ok := c.refs[s.key]; ok {
+				v = ref
+			}
+		}
+		out = append(out, Setting{
+			Key:    s.key,
+			Env:    s.env,
+			Flag:   "--" + s.flag,
+			Value:  v,
+			Secret: s.secret,
+			Origin: c.Origin(s.key),
+		})
+	}
+	return out
+}
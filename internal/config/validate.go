@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rule checks one setting and returns the problem, or "" if there is
+// none. Production rules apply only when App.IsProduction.
+type rule struct {
+	key        string
+	production bool
+	check      func(c *Config) string
+}
+
+// rules lists every check Validate makes, by section in Config order.
+var rules = []rule{
+	{key: "app.name", check: func(c *Config) string { return required(c.App.Name) }},
+	{key: "app.environment", check: func(c *Config) string {
+		return oneOf(c.App.Environment, "development", "test", "staging", "production")
+	}},
+	{key: "app.debug", production: true, check: func(c *Config) string {
+		return unless(c.App.Debug, "must be off in production")
+	}},
+
+	{key: "discord.token", check: func(c *Config) string { return required(c.Discord.Token) }},
+	{key: "discord.shard_count", check: func(c *Config) string { return atLeast(c.Discord.ShardCount, 1) }},
+	{key: "discord.websocket_max_retries", check: func(c *Config) string { return atLeast(c.Discord.WebSocketMaxRetries, 0) }},
+	{key: "discord.oauth_redirect_url", check: func(c *Config) string {
+		if c.Discord.ClientSecret != "" && c.Discord.OAuthRedirectURL == "" {
+			return "is required when discord.client_secret is set"
+		}
+		return absoluteURL(c.Discord.OAuthRedirectURL)
+	}},
+	{key: "discord.oauth_redirect_url", production: true, check: func(c *Config) string {
+		u := c.Discord.OAuthRedirectURL
+		return unless(u != "" && !strings.HasPrefix(u, "https://"), "must use https in production")
+	}},
+
+	{key: "http.port", check: func(c *Config) string { return port(c.HTTP.Port) }},
+	{key: "http.read_timeout", check: func(c *Config) string { return positive(c.HTTP.ReadTimeout) }},
+	{key: "http.write_timeout", check: func(c *Config) string { return positive(c.HTTP.WriteTimeout) }},
+	{key: "http.idle_timeout", check: func(c *Config) string { return positive(c.HTTP.IdleTimeout) }},
+	{key: "http.shutdown_timeout", check: func(c *Config) string { return positive(c.HTTP.ShutdownTimeout) }},
+	{key: "http.allowed_origins", check: func(c *Config) string {
+		for _, o := range c.HTTP.AllowedOrigins {
+			if o == "*" {
+				continue
+			}
+			if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				return fmt.Sprintf("%q is not an origin such as https://wethegamers.org", o)
+			}
+		}
+		return ""
+	}},
+	{key: "http.allowed_origins", production: true, check: func(c *Config) string {
+		wildcard := c.HTTP.EnableCORS && slices.Contains(c.HTTP.AllowedOrigins, "*")
+		return unless(wildcard, "must list origins, not *, in production")
+	}},
+	{key: "http.rate_limit_rps", check: func(c *Config) string {
+		return unless(c.Features.EnableRateLimiting && c.HTTP.RateLimitRPS <= 0,
+			fmt.Sprintf("must be positive when rate limiting is on, got %v", c.HTTP.RateLimitRPS))
+	}},
+	{key: "http.rate_limit_burst", check: func(c *Config) string {
+		if !c.Features.EnableRateLimiting {
+			return ""
+		}
+		return atLeast(c.HTTP.RateLimitBurst, 1)
+	}},
+
+	{key: "database.host", check: func(c *Config) string { return required(c.Database.Host) }},
+	{key: "database.port", check: func(c *Config) string { return port(c.Database.Port) }},
+	{key: "database.user", check: func(c *Config) string { return required(c.Database.User) }},
+	{key: "database.name", check: func(c *Config) string { return required(c.Database.Name) }},
+	{key: "database.ssl_mode", check: func(c *Config) string {
+		return oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	}},
+	{key: "database.ssl_mode", production: true, check: func(c *Config) string {
+		return unless(!slices.Contains([]string{"require", "verify-ca", "verify-full"}, c.Database.SSLMode),
+			fmt.Sprintf("must be require, verify-ca or verify-full in production, got %q", c.Database.SSLMode))
+	}},
+	{key: "database.password", production: true, check: func(c *Config) string {
+		return unless(c.Database.Password == "", "is required in production")
+	}},
+	{key: "database.max_open_conns", check: func(c *Config) string { return atLeast(c.Database.MaxOpenConns, 0) }},
+	{key: "database.max_idle_conns", check: func(c *Config) string {
+		d := c.Database
+		if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+			return fmt.Sprintf("%d exceeds database.max_open_conns %d", d.MaxIdleConns, d.MaxOpenConns)
+		}
+		return atLeast(d.MaxIdleConns, 0)
+	}},
+	{key: "database.max_lifetime", check: func(c *Config) string {
+		return unless(c.Database.MaxLifetime < 0, "must not be negative")
+	}},
+	{key: "database.ssl_cert", check: func(c *Config) string {
+		return unless((c.Database.SSLCert == "") != (c.Database.SSLKey == ""), "and database.ssl_key must be set together")
+	}},
+	{key: "database.statement_timeout", check: func(c *Config) string { return timeout(c.Database.StatementTimeout) }},
+	{key: "database.lock_timeout", check: func(c *Config) string { return timeout(c.Database.LockTimeout) }},
+	{key: "database.replica_urls", check: func(c *Config) string {
+		replicas, err := c.Database.Replicas()
+		if err != nil {
+			return err.Error()
+		}
+		for i, r := range replicas {
+			if msg := port(r.Port); msg != "" {
+				return fmt.Sprintf("replica %d: port %s", i+1, msg)
+			}
+		}
+		return ""
+	}},
+	{key: "database.replica_urls", production: true, check: func(c *Config) string {
+		replicas, _ := c.Database.Replicas()
+		for i, r := range replicas {
+			if !slices.Contains([]string{"require", "verify-ca", "verify-full"}, r.SSLMode) {
+				return fmt.Sprintf("replica %d must use TLS in production, got sslmode %q", i+1, r.SSLMode)
+			}
+		}
+		return ""
+	}},
+
+	{key: "metrics.path", check: func(c *Config) string {
+		return unless(c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/"),
+			fmt.Sprintf("must start with /, got %q", c.Metrics.Path))
+	}},
+	{key: "metrics.namespace", check: func(c *Config) string {
+		return unless(!metricName.MatchString(c.Metrics.Namespace),
+			fmt.Sprintf("%q is not a valid Prometheus name", c.Metrics.Namespace))
+	}},
+
+	{key: "log.level", check: func(c *Config) string { return oneOf(c.Log.Level, "debug", "info", "warn", "error") }},
+	{key: "log.format", check: func(c *Config) string { return oneOf(c.Log.Format, "json", "text") }},
+}
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Validate checks that the settings make sense together, including the
+// stricter rules for production (see AppConfig.IsProduction). Every
+// problem is reported, each prefixed with its key and, when known, where
+// the value came from; the result wraps ErrInvalid.
+func (c *Config) Validate() error {
+	if errs := c.validate(nil); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate returns every problem, skipping keys that failed to parse.
+func (c *Config) validate(skip map[string]bool) []error {
+	var errs []error
+	for _, r := range rules {
+		if skip[r.key] || (r.production && !c.App.IsProduction()) {
+			continue
+		}
+		msg := r.check(c)
+		if msg == "" {
+			continue
+		}
+		if o := c.Origin(r.key); o.Layer != "" {
+			msg += " (from " + o.String() + ")"
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", r.key, msg))
+	}
+	return errs
+}
+
+func unless(bad bool, msg string) string {
+	if bad {
+		return msg
+	}
+	return ""
+}
+
+func required(s string) string {
+	return unless(s == "", "is required")
+}
+
+func oneOf(v string, allowed ...string) string {
+	return unless(!slices.Contains(allowed, v),
+		fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), v))
+}
+
+func atLeast(n, min int) string {
+	return unless(n < min, fmt.Sprintf("must be at least %d, got %d", min, n))
+}
+
+func port(n int) string {
+	return unless(n < 1 || n > 65535, fmt.Sprintf("must be between 1 and 65535, got %d", n))
+}
+
+func positive(d time.Duration) string {
+	return unless(d <= 0, fmt.Sprintf("must be positive, got %s", d))
+}
+
+func timeout(d time.Duration) string {
+	return unless(d < 0 || !millis(d), fmt.Sprintf("must be a non-negative whole number of milliseconds, got %s", d))
+}
+
+func absoluteURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(s)
+	return unless(err != nil || u.Scheme == "" || u.Host == "", fmt.Sprintf("%q is not an absolute URL", s))
+}
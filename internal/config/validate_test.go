@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	base := func(t *testing.T) *Config {
+		cfg, err := LoadFrom(Sources{LookupEnv: mapEnv(map[string]string{"DISCORD_TOKEN": "t"})})
+		if err != nil {
+			t.Fatalf("defaults do not validate: %v", err)
+		}
+		return cfg
+	}
+	production := func(c *Config) {
+		c.App.Environment = "production"
+		c.HTTP.AllowedOrigins = []string{"https://wethegamers.org"}
+		c.Database.SSLMode = "verify-full"
+		c.Database.Password = "p"
+	}
+
+	for _, tt := range []struct {
+		name  string
+		apply func(c *Config)
+		want  []string // one entry per expected problem
+	}{
+		{"defaults", func(*Config) {}, nil},
+		{"port out of range", func(c *Config) { c.HTTP.Port = 70000 }, []string{"http.port: must be between 1 and 65535, got 70000"}},
+		{"idle above open", func(c *Config) { c.Database.MaxOpenConns, c.Database.MaxIdleConns = 5, 10 },
+			[]string{"database.max_idle_conns: 10 exceeds database.max_open_conns 5"}},
+		{"unlimited open", func(c *Config) { c.Database.MaxOpenConns, c.Database.MaxIdleConns = 0, 10 }, nil},
+		{"no shards", func(c *Config) { c.Discord.ShardCount = 0 }, []string{"discord.shard_count: must be at least 1, got 0"}},
+		{"bad origin", func(c *Config) { c.HTTP.AllowedOrigins = []string{"wethegamers.org"} },
+			[]string{`http.allowed_origins: "wethegamers.org" is not an origin`}},
+		{"unknown ssl mode", func(c *Config) { c.Database.SSLMode = "on" }, []string{`database.ssl_mode: must be one of disable`}},
+		{"oauth without redirect", func(c *Config) { c.Discord.ClientSecret = "s" },
+			[]string{"discord.oauth_redirect_url: is required when discord.client_secret is set"}},
+		{"several problems", func(c *Config) { c.Log.Level, c.HTTP.ReadTimeout, c.Discord.Token = "verbose", 0, "" },
+			[]string{"discord.token: is required", "http.read_timeout: must be positive", `log.level: must be one of debug, info, warn, error, got "verbose"`}},
+
+		{"production", production, nil},
+		{"development allows wildcard and plaintext", func(c *Config) { c.HTTP.AllowedOrigins = []string{"*"}; c.Database.SSLMode = "disable" }, nil},
+		{"production wildcard origin", func(c *Config) { production(c); c.HTTP.AllowedOrigins = []string{"*"} },
+			[]string{"http.allowed_origins: must list origins, not *, in production"}},
+		{"production wildcard without CORS", func(c *Config) { production(c); c.HTTP.AllowedOrigins = []string{"*"}; c.HTTP.EnableCORS = false }, nil},
+		{"production without TLS", func(c *Config) { production(c); c.Database.SSLMode = "disable" },
+			[]string{`database.ssl_mode: must be require, verify-ca or verify-full in production, got "disable"`}},
+		{"production debug and plain redirect", func(c *Config) {
+			production(c)
+			c.App.Debug = true
+			c.Discord.OAuthRedirectURL = "http://wethegamers.org/callback"
+		}, []string{"app.debug: must be off in production", "discord.oauth_redirect_url: must use https in production"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base(t)
+			tt.apply(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Validate = %v, want ErrInvalid", err)
+			}
+			lines := strings.Split(strings.TrimPrefix(err.Error(), ErrInvalid.Error()+": "), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d problems, want %d:\n%v", len(lines), len(tt.want), err)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	env := map[string]string{
+		"DISCORD_TOKEN":     "t",
+		"HTTP_PORT":         "70000",
+		"DB_MAX_OPEN_CONNS": "x",
+		"DB_MAX_IDLE_CONNS": "50",
+	}
+	_, err := LoadFrom(Sources{LookupEnv: mapEnv(env), Args: []string{"--database-ssl-mode=disable", "--app-environment=production"}})
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("LoadFrom = %v, want ErrInvalid", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"http.port: must be between 1 and 65535, got 70000 (from env HTTP_PORT)",
+		`database.max_open_conns: invalid value "x" from env DB_MAX_OPEN_CONNS`,
+		"database.ssl_mode: must be require, verify-ca or verify-full in production, got \"disable\" (from flag --database-ssl-mode)",
+		"http.allowed_origins: must list origins, not *, in production (from default)",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error lacks %q:\n%s", want, msg)
+		}
+	}
+	// The unparsable setting is reported once, not again by the rules.
+	if strings.Count(msg, "database.max_open_conns") != 1 {
+		t.Errorf("max_open_conns reported more than once:\n%s", msg)
+	}
+}
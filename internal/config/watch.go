@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WatchSignals reloads the configuration on every SIGHUP until ctx is
+// done.
+func (s *Store) WatchSignals(ctx context.Context) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			_, _ = s.Reload("signal")
+		}
+	}
+}
+
+// WatchFile checks path every interval and reloads the configuration when
+// its content changes, until ctx is done. Polling the content rather than
+// watching the inode follows the symlink swap Kubernetes uses to update
+// mounted ConfigMaps. A file that is briefly missing is skipped. The
+// first check always reloads, picking up changes made since the Store
+// was created.
+func (s *Store) WatchFile(ctx context.Context, path string, interval time.Duration) error {
+	var last []byte
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		sum, err := fileHash(path)
+		if err != nil || bytes.Equal(sum, last) {
+			continue
+		}
+		last = sum
+		_, _ = s.Reload("file")
+	}
+}
+
+func fileHash(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// Handler serves POST requests that reload the configuration and respond
+// with the sections that changed. Requests must carry
+// "Authorization: Bearer <token>"; with an empty token every request is
+// refused. A rejected configuration is reported with 422.
+func (s *Store) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		changed, err := s.Reload("admin")
+		if errors.Is(err, ErrRejected) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		if changed == nil {
+			changed = []Section{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"changed": changed})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,236 @@
+// Package consent provides per-type user consent with versioned consent
+// texts for AGIS.
+//
+// Every decision is appended to consent_records together with the text
+// version and locale it was made against, so the history is preserved.
+// Publishing a new text version makes earlier agreements stale: the user
+// must agree again, and until then consent is only assumed outside the
+// regions that require opt-in. Users in the EU, EEA and UK, and users whose
+// country is unknown, are denied until they explicitly agree.
+package consent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Type is a consent_records.consent_type value.
+type Type string
+
+// Consent types.
+const (
+	TypeAds             Type = "ads"
+	TypeAnalytics       Type = "analytics"
+	TypePersonalization Type = "personalization"
+)
+
+// Types lists every consent type in display order.
+var Types = []Type{TypeAds, TypeAnalytics, TypePersonalization}
+
+// Valid reports whether t is a known consent type.
+func (t Type) Valid() bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returned by the consent service.
+var (
+	ErrUnknownType    = errors.New("consent: unknown consent type")
+	ErrUnknownVersion = errors.New("consent: unknown consent text version")
+	ErrStaleVersion   = errors.New("consent: consent text version is not current")
+	ErrTextExists     = errors.New("consent: consent text already published")
+	ErrInvalidText    = errors.New("consent: invalid consent text")
+)
+
+// optInCountries require explicit opt-in: the EU member states, the rest of
+// the EEA, and the UK (reported as GB, or UK by some providers).
+var optInCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "HR": true, "CY": true, "CZ": true, "DK": true,
+	"EE": true, "FI": true, "FR": true, "DE": true, "GR": true, "HU": true, "IE": true,
+	"IT": true, "LV": true, "LT": true, "LU": true, "MT": true, "NL": true, "PL": true,
+	"PT": true, "RO": true, "SK": true, "SI": true, "ES": true, "SE": true,
+	"IS": true, "LI": true, "NO": true,
+	"GB": true, "UK": true,
+}
+
+// RequiresOptIn reports whether users in the given ISO 3166-1 alpha-2
+// country must opt in before consent is assumed. Unknown countries are
+// treated as requiring opt-in.
+func RequiresOptIn(country string) bool {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 || country == "XX" || country == "T1" {
+		return true
+	}
+	return optInCountries[country]
+}
+
+// Decision is the effective consent state of one type for a user.
+type Decision struct {
+	Type            Type       `json:"type"`
+	Granted         bool       `json:"granted"`
+	ConsentRequired bool       `json:"consent_required"`
+	Consented       *bool      `json:"consented,omitempty"`
+	Version         int        `json:"version,omitempty"`
+	CurrentVersion  int        `json:"current_version"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty"`
+}
+
+// record is the latest consent_records row for a type.
+type record struct {
+	consented bool
+	version   int
+	createdAt time.Time
+}
+
+// decide applies the consent rules to the latest record.
+func decide(t Type, rec *record, current int, country string) Decision {
+	d := Decision{Type: t, CurrentVersion: current}
+	optIn := RequiresOptIn(country)
+
+	if rec == nil {
+		d.Granted = !optIn
+		d.ConsentRequired = optIn
+		return d
+	}
+
+	d.Consented = &rec.consented
+	d.Version = rec.version
+	d.DecidedAt = &rec.createdAt
+	switch {
+	case rec.version >= current:
+		d.Granted = rec.consented
+	case !rec.consented:
+		// A refusal stands across text changes.
+	default:
+		d.Granted = !optIn
+		d.ConsentRequired = true
+	}
+	return d
+}
+
+// Service reads and records user consent.
+type Service struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewService creates a consent service.
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db, now: time.Now}
+}
+
+// Status returns the decision for every consent type.
+func (s *Service) Status(ctx context.Context, userID, country string) ([]Decision, error) {
+	current, err := s.currentVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (consent_type) consent_type, consented, COALESCE(text_version, 0), created_at
+		FROM consent_records
+		WHERE user_id = $1
+		ORDER BY consent_type, created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("consent: load records: %w", err)
+	}
+	defer rows.Close()
+
+	latest := make(map[Type]*record, len(Types))
+	for rows.Next() {
+		var (
+			t   Type
+			rec record
+		)
+		if err := rows.Scan(&t, &rec.consented, &rec.version, &rec.createdAt); err != nil {
+			return nil, fmt.Errorf("consent: scan record: %w", err)
+		}
+		latest[t] = &rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("consent: load records: %w", err)
+	}
+
+	decisions := make([]Decision, 0, len(Types))
+	for _, t := range Types {
+		decisions = append(decisions, decide(t, latest[t], current[t], country))
+	}
+	return decisions, nil
+}
+
+// Allowed reports whether the user has granted consent of type t.
+func (s *Service) Allowed(ctx context.Context, userID string, t Type, country string) (bool, error) {
+	decisions, err := s.Status(ctx, userID, country)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range decisions {
+		if d.Type == t {
+			return d.Granted, nil
+		}
+	}
+	return false, ErrUnknownType
+}
+
+// Update is a consent decision submitted by a user.
+type Update struct {
+	UserID    string
+	Type      Type
+	Consented bool
+	// Version is the text version the user was shown. Zero means the
+	// current version.
+	Version   int
+	Locale    string
+	IPAddress string
+	Country   string
+}
+
+// Record stores a consent decision against the current text version and
+// returns the resulting decision.
+func (s *Service) Record(ctx context.Context, u Update) (Decision, error) {
+	if !u.Type.Valid() {
+		return Decision{}, fmt.Errorf("%w: %q", ErrUnknownType, u.Type)
+	}
+	current, err := s.currentVersions(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	if current[u.Type] == 0 {
+		return Decision{}, fmt.Errorf("%w: no text published for %s", ErrUnknownVersion, u.Type)
+	}
+	if u.Version == 0 {
+		u.Version = current[u.Type]
+	}
+	if u.Version != current[u.Type] {
+		return Decision{}, fmt.Errorf("%w: %s v%d, current is v%d", ErrStaleVersion, u.Type, u.Version, current[u.Type])
+	}
+
+	text, err := s.Text(ctx, u.Type, u.Version, u.Locale)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	now := s.now().UTC()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO consent_records
+			(user_id, consent_type, consented, ip_address, ip_country, consent_text, text_version, locale, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`,
+		u.UserID, string(u.Type), u.Consented, nullString(u.IPAddress), nullString(strings.ToUpper(u.Country)),
+		text.Body, text.Version, text.Locale, now)
+	if err != nil {
+		return Decision{}, fmt.Errorf("consent: record: %w", err)
+	}
+	return decide(u.Type, &record{consented: u.Consented, version: u.Version, createdAt: now}, current[u.Type], u.Country), nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,194 @@
+package consent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRequiresOptIn(t *testing.T) {
+	cases := map[string]bool{
+		"DE": true, "fr": true, "GB": true, "UK": true, "NO": true,
+		"US": false, "BR": false,
+		"": true, "XX": true, "T1": true,
+	}
+	for country, want := range cases {
+		if got := RequiresOptIn(country); got != want {
+			t.Errorf("RequiresOptIn(%q) = %v, want %v", country, got, want)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	yes := &record{consented: true, version: 2, createdAt: testNow}
+	stale := &record{consented: true, version: 1, createdAt: testNow}
+	refused := &record{consented: false, version: 1, createdAt: testNow}
+
+	cases := []struct {
+		name            string
+		rec             *record
+		country         string
+		granted, prompt bool
+	}{
+		{"no record in EU", nil, "DE", false, true},
+		{"no record in US", nil, "US", true, false},
+		{"current consent", yes, "DE", true, false},
+		{"stale consent in EU", stale, "DE", false, true},
+		{"stale consent in US", stale, "US", true, true},
+		{"stale refusal", refused, "US", false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := decide(TypeAds, c.rec, 2, c.country)
+			if d.Granted != c.granted || d.ConsentRequired != c.prompt {
+				t.Errorf("got granted=%v required=%v, want %v %v", d.Granted, d.ConsentRequired, c.granted, c.prompt)
+			}
+		})
+	}
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	svc := NewService(db)
+	svc.now = func() time.Time { return testNow }
+	return svc, mock
+}
+
+func expectVersions(mock sqlmock.Sqlmock, ads int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT consent_type, MAX(version) FROM consent_texts`)).
+		WillReturnRows(sqlmock.NewRows([]string{"consent_type", "max"}).
+			AddRow("ads", ads).AddRow("analytics", 1).AddRow("personalization", 1))
+}
+
+func TestStatusRequiresReconsentAfterNewVersion(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectVersions(mock, 2)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM consent_records`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"consent_type", "consented", "text_version", "created_at"}).
+			AddRow("ads", true, 1, testNow).
+			AddRow("analytics", true, 1, testNow))
+
+	decisions, err := svc.Status(context.Background(), "u1", "DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := map[Type]Decision{}
+	for _, d := range decisions {
+		got[d.Type] = d
+	}
+	if d := got[TypeAds]; d.Granted || !d.ConsentRequired {
+		t.Errorf("expected ads to need re-consent, got %+v", d)
+	}
+	if d := got[TypeAnalytics]; !d.Granted {
+		t.Errorf("expected analytics granted, got %+v", d)
+	}
+	if d := got[TypePersonalization]; d.Granted {
+		t.Errorf("expected personalization denied by default in EU, got %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordRejectsStaleVersion(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectVersions(mock, 2)
+
+	_, err := svc.Record(context.Background(), Update{UserID: "u1", Type: TypeAds, Consented: true, Version: 1})
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("expected ErrStaleVersion, got %v", err)
+	}
+}
+
+func TestRecordStoresTextVersion(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectVersions(mock, 2)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM consent_texts`)).
+		WithArgs("ads", 2, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"consent_type", "version", "locale", "body", "published_at"}).
+			AddRow("ads", 2, "en", "I agree to ads v2.", testNow))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO consent_records`)).
+		WithArgs("u1", "ads", true, "203.0.113.7", "DE", "I agree to ads v2.", 2, "en", testNow).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	d, err := svc.Record(context.Background(), Update{
+		UserID: "u1", Type: TypeAds, Consented: true, Locale: "de-AT", IPAddress: "203.0.113.7", Country: "de",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.Granted || d.Version != 2 {
+		t.Errorf("unexpected decision %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPublishRules(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	expectVersions(mock, 2)
+	if _, err := svc.Publish(context.Background(), Text{Type: TypeAds, Version: 3, Locale: "de", Body: "Neu"}); !errors.Is(err, ErrInvalidText) {
+		t.Errorf("expected translation of an unpublished version to fail, got %v", err)
+	}
+
+	expectVersions(mock, 2)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO consent_texts`)).
+		WithArgs("ads", 3, "en", "New wording", testNow).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	text, err := svc.Publish(context.Background(), Text{Type: TypeAds, Body: "New wording"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text.Version != 3 {
+		t.Errorf("expected version 3, got %d", text.Version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLocaleCandidates(t *testing.T) {
+	got := localeCandidates("de-AT")
+	if len(got) != 3 || got[0] != "de-AT" || got[1] != "de" || got[2] != "en" {
+		t.Errorf("unexpected candidates %v", got)
+	}
+	if got := localeCandidates(""); len(got) != 1 || got[0] != DefaultLocale {
+		t.Errorf("expected default locale only, got %v", got)
+	}
+}
+
+func TestHandlerDeniesWithoutConsent(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectVersions(mock, 1)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM consent_records`)).
+		WillReturnRows(sqlmock.NewRows([]string{"consent_type", "consented", "text_version", "created_at"}))
+
+	called := false
+	h := svc.Handler(TypeAnalytics, func(r *http.Request) string { return "u1" })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodPost, "/track", http.NoBody)
+	req.Header.Set(CountryHeader, "FR")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden || called {
+		t.Errorf("expected 403 without calling next, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package consent
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// CountryHeader carries the client's ISO country code, as set by
+// Cloudflare in front of the ingress.
+const CountryHeader = "CF-IPCountry"
+
+// CountryFromRequest returns the client's country code, or "" if unknown.
+func CountryFromRequest(r *http.Request) string {
+	return strings.ToUpper(strings.TrimSpace(r.Header.Get(CountryHeader)))
+}
+
+// Check reports whether the user behind r has granted consent of type t.
+func (s *Service) Check(r *http.Request, userID string, t Type) (bool, error) {
+	return s.Allowed(r.Context(), userID, t, CountryFromRequest(r))
+}
+
+// Handler returns middleware that only passes requests whose user has
+// granted consent of type t. userFunc extracts the user ID from the
+// request; requests without one are rejected.
+func (s *Service) Handler(t Type, userFunc func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := userFunc(r)
+			if userID == "" {
+				http.Error(w, "consent required", http.StatusForbidden)
+				return
+			}
+			ok, err := s.Check(r, userID, t)
+			if err != nil {
+				slog.Error("consent check failed", "type", t, "error", err)
+				http.Error(w, "consent check failed", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "consent required: "+string(t), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
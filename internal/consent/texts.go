@@ -0,0 +1,154 @@
+package consent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultLocale is the locale every text version must be published in
+// first, and the fallback when a translation is missing.
+const DefaultLocale = "en"
+
+// Text is a row of consent_texts. Published texts are immutable; changing
+// the wording means publishing a new version.
+type Text struct {
+	Type        Type      `json:"type"`
+	Version     int       `json:"version"`
+	Locale      string    `json:"locale"`
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// localeCandidates returns the locales to try in order, for example
+// de-AT, de, en.
+func localeCandidates(locale string) []string {
+	locale = strings.TrimSpace(locale)
+	var out []string
+	if locale != "" {
+		out = append(out, locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			out = append(out, base)
+		}
+	}
+	if locale != DefaultLocale {
+		out = append(out, DefaultLocale)
+	}
+	return out
+}
+
+// currentVersions returns the highest published version of each type.
+func (s *Service) currentVersions(ctx context.Context) (map[Type]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT consent_type, MAX(version) FROM consent_texts GROUP BY consent_type`)
+	if err != nil {
+		return nil, fmt.Errorf("consent: load versions: %w", err)
+	}
+	defer rows.Close()
+
+	current := make(map[Type]int, len(Types))
+	for rows.Next() {
+		var (
+			t Type
+			v int
+		)
+		if err := rows.Scan(&t, &v); err != nil {
+			return nil, fmt.Errorf("consent: scan version: %w", err)
+		}
+		current[t] = v
+	}
+	return current, rows.Err()
+}
+
+// Text returns a specific text version in the closest available locale.
+func (s *Service) Text(ctx context.Context, t Type, version int, locale string) (Text, error) {
+	candidates := localeCandidates(locale)
+	var text Text
+	err := s.db.QueryRowContext(ctx, `
+		SELECT consent_type, version, locale, body, published_at
+		FROM consent_texts
+		WHERE consent_type = $1 AND version = $2 AND locale = ANY($3)
+		ORDER BY array_position($3, locale)
+		LIMIT 1`, string(t), version, pq.Array(candidates),
+	).Scan(&text.Type, &text.Version, &text.Locale, &text.Body, &text.PublishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Text{}, fmt.Errorf("%w: %s v%d", ErrUnknownVersion, t, version)
+	}
+	if err != nil {
+		return Text{}, fmt.Errorf("consent: load text: %w", err)
+	}
+	return text, nil
+}
+
+// CurrentTexts returns the current text of every type in the closest
+// available locale.
+func (s *Service) CurrentTexts(ctx context.Context, locale string) ([]Text, error) {
+	current, err := s.currentVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]Text, 0, len(Types))
+	for _, t := range Types {
+		if current[t] == 0 {
+			continue
+		}
+		text, err := s.Text(ctx, t, current[t], locale)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, nil
+}
+
+// Publish adds a consent text. A new version must be published in
+// DefaultLocale first; translations may then be added for the current
+// version. Publishing a new version requires users to consent again.
+func (s *Service) Publish(ctx context.Context, text Text) (Text, error) {
+	if !text.Type.Valid() {
+		return Text{}, fmt.Errorf("%w: %q", ErrUnknownType, text.Type)
+	}
+	text.Locale = strings.TrimSpace(text.Locale)
+	if text.Locale == "" {
+		text.Locale = DefaultLocale
+	}
+	if strings.TrimSpace(text.Body) == "" {
+		return Text{}, fmt.Errorf("%w: body is required", ErrInvalidText)
+	}
+
+	current, err := s.currentVersions(ctx)
+	if err != nil {
+		return Text{}, err
+	}
+	latest := current[text.Type]
+	if text.Version == 0 {
+		text.Version = latest
+		if text.Locale == DefaultLocale {
+			text.Version = latest + 1
+		}
+	}
+	switch {
+	case text.Locale == DefaultLocale && text.Version != latest+1:
+		return Text{}, fmt.Errorf("%w: next %s version is %d", ErrInvalidText, text.Type, latest+1)
+	case text.Locale != DefaultLocale && (latest == 0 || text.Version != latest):
+		return Text{}, fmt.Errorf("%w: translations must target the current %s version", ErrInvalidText, text.Type)
+	}
+
+	text.PublishedAt = s.now().UTC()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO consent_texts (consent_type, version, locale, body, published_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`,
+		string(text.Type), text.Version, text.Locale, text.Body, text.PublishedAt)
+	if err != nil {
+		return Text{}, fmt.Errorf("consent: publish text: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Text{}, ErrTextExists
+	}
+	return text, nil
+}
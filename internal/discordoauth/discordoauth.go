@@ -0,0 +1,237 @@
+// Package discordoauth provides the Discord OAuth2 authorization-code flow
+// with PKCE for AGIS account linking.
+//
+// Start stores a single-use state with the PKCE verifier server-side and
+// returns the Discord authorization URL. The callback consumes the state,
+// exchanges the code together with the verifier, and reads the verified
+// Discord identity from /users/@me.
+package discordoauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Discord endpoints.
+const (
+	DefaultAuthURL    = "https://discord.com/oauth2/authorize"
+	DefaultTokenURL   = "https://discord.com/api/oauth2/token"
+	DefaultAPIBaseURL = "https://discord.com/api/v10"
+)
+
+// StateTTL is how long a started link flow can be completed.
+const StateTTL = 10 * time.Minute
+
+// Errors returned by the OAuth flow.
+var (
+	ErrInvalidState  = errors.New("discordoauth: invalid or expired state")
+	ErrExchange      = errors.New("discordoauth: code exchange failed")
+	ErrNotConfigured = errors.New("discordoauth: client ID, secret and redirect URL are required")
+)
+
+// Config configures the OAuth client. Empty URLs use Discord's endpoints;
+// tests point TokenURL and APIBaseURL at an httptest server.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	AuthURL    string
+	TokenURL   string
+	APIBaseURL string
+}
+
+// Token is the token endpoint response.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// User is the verified Discord identity.
+type User struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+// Client talks to Discord's OAuth2 and user endpoints.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+	store      StateStore
+	now        func() time.Time
+}
+
+// NewClient creates a client that keeps link states in store.
+func NewClient(cfg Config, store StateStore) (*Client, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.RedirectURL == "" {
+		return nil, ErrNotConfigured
+	}
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = DefaultAuthURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultTokenURL
+	}
+	if cfg.APIBaseURL == "" {
+		cfg.APIBaseURL = DefaultAPIBaseURL
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"identify"}
+	}
+	return &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		store:      store,
+		now:        time.Now,
+	}, nil
+}
+
+// Start begins a link flow for a Wasp user and returns the URL to send the
+// browser to.
+func (c *Client) Start(ctx context.Context, userID int) (authURL string, expiresAt time.Time, err error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt = c.now().Add(StateTTL)
+	if err := c.store.Save(ctx, State{
+		State:        state,
+		UserID:       userID,
+		CodeVerifier: verifier,
+		ExpiresAt:    expiresAt,
+	}); err != nil {
+		return "", time.Time{}, fmt.Errorf("discordoauth: save state: %w", err)
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+		"prompt":                {"consent"},
+	}
+	return c.cfg.AuthURL + "?" + q.Encode(), expiresAt, nil
+}
+
+// Complete finishes a link flow: it consumes the state, exchanges the code
+// and returns the Wasp user the flow was started for with the verified
+// Discord user.
+func (c *Client) Complete(ctx context.Context, state, code string) (int, *User, error) {
+	st, err := c.store.Consume(ctx, state)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !c.now().Before(st.ExpiresAt) {
+		return 0, nil, ErrInvalidState
+	}
+
+	tok, err := c.Exchange(ctx, code, st.CodeVerifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	user, err := c.User(ctx, tok.AccessToken)
+	if err != nil {
+		return 0, nil, err
+	}
+	return st.UserID, user, nil
+}
+
+// Exchange trades an authorization code and PKCE verifier for a token.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("discordoauth: build token request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tok Token
+	if err := c.do(req, &tok); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%w: empty access token", ErrExchange)
+	}
+	return &tok, nil
+}
+
+// User returns the Discord user the access token belongs to.
+func (c *Client) User(ctx context.Context, accessToken string) (*User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.APIBaseURL+"/users/@me", http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("discordoauth: build user request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var u User
+	if err := c.do(req, &u); err != nil {
+		return nil, fmt.Errorf("discordoauth: fetch user: %w", err)
+	}
+	if u.ID == "" {
+		return nil, errors.New("discordoauth: fetch user: empty user ID")
+	}
+	return &u, nil
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// Challenge returns the S256 PKCE challenge for a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomToken returns 32 random bytes, base64url-encoded (43 characters,
+// a valid PKCE verifier).
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("discordoauth: random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,141 @@
+package discordoauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// fakeDiscord serves the token and user endpoints. It checks the PKCE
+// verifier against the challenge from the authorization URL.
+type fakeDiscord struct {
+	challenge string
+}
+
+func (f *fakeDiscord) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("code") != "good-code" || Challenge(r.PostForm.Get("code_verifier")) != f.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(Token{AccessToken: "access", TokenType: "Bearer"})
+	})
+	mux.HandleFunc("GET /api/users/@me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(User{ID: "987654321", Username: "player"})
+	})
+	return mux
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeDiscord) {
+	t.Helper()
+	fake := &fakeDiscord{}
+	srv := httptest.NewServer(fake.handler(t))
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://agis.example/callback",
+		TokenURL:     srv.URL + "/oauth2/token",
+		APIBaseURL:   srv.URL + "/api",
+	}, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, fake
+}
+
+func startFlow(t *testing.T, c *Client, fake *fakeDiscord) string {
+	t.Helper()
+	authURL, _, err := c.Start(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	fake.challenge = q.Get("code_challenge")
+	return q.Get("state")
+}
+
+func TestCompleteLinksVerifiedUser(t *testing.T) {
+	c, fake := newTestClient(t)
+	state := startFlow(t, c, fake)
+
+	userID, user, err := c.Complete(context.Background(), state, "good-code")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if userID != 42 || user.ID != "987654321" {
+		t.Errorf("unexpected result %d %+v", userID, user)
+	}
+
+	if _, _, err := c.Complete(context.Background(), state, "good-code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected state to be single-use, got %v", err)
+	}
+}
+
+func TestCompleteRejectsBadCode(t *testing.T) {
+	c, fake := newTestClient(t)
+	state := startFlow(t, c, fake)
+
+	if _, _, err := c.Complete(context.Background(), state, "stolen-code"); !errors.Is(err, ErrExchange) {
+		t.Errorf("expected ErrExchange, got %v", err)
+	}
+}
+
+func TestCompleteRejectsExpiredState(t *testing.T) {
+	c, fake := newTestClient(t)
+	state := startFlow(t, c, fake)
+	c.now = func() time.Time { return time.Now().Add(StateTTL + time.Second) }
+
+	if _, _, err := c.Complete(context.Background(), state, "good-code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
+
+func TestNewClientRequiresConfig(t *testing.T) {
+	if _, err := NewClient(Config{ClientID: "client"}, NewMemoryStore()); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("expected ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestPGStoreConsumeUnknownState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM oauth_link_states WHERE state_hash = $1`)).
+		WithArgs(hashState("missing")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "code_verifier", "expires_at"}))
+
+	if _, err := NewPGStore(db).Consume(context.Background(), "missing"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package discordoauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is a pending link flow.
+type State struct {
+	State        string
+	UserID       int
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// StateStore keeps pending link flows server-side. Consume must remove the
+// state so it can only be used once, and return ErrInvalidState if it does
+// not exist.
+type StateStore interface {
+	Save(ctx context.Context, st State) error
+	Consume(ctx context.Context, state string) (State, error)
+}
+
+// hashState keys stored states by hash so a database read does not leak
+// usable states.
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// PGStore keeps states in oauth_link_states.
+type PGStore struct {
+	db *sql.DB
+}
+
+// NewPGStore creates a Postgres-backed state store.
+func NewPGStore(db *sql.DB) *PGStore {
+	return &PGStore{db: db}
+}
+
+// Save stores a state and prunes expired ones.
+func (s *PGStore) Save(ctx context.Context, st State) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM oauth_link_states WHERE expires_at < $1`, st.ExpiresAt.Add(-StateTTL)); err != nil {
+		return fmt.Errorf("prune states: %w", err)
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_link_states (state_hash, user_id, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		hashState(st.State), st.UserID, st.CodeVerifier, st.ExpiresAt)
+	return err
+}
+
+// Consume deletes and returns a state in one statement, so concurrent
+// callbacks cannot both use it.
+func (s *PGStore) Consume(ctx context.Context, state string) (State, error) {
+	st := State{State: state}
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM oauth_link_states WHERE state_hash = $1
+		RETURNING user_id, code_verifier, expires_at`, hashState(state),
+	).Scan(&st.UserID, &st.CodeVerifier, &st.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return State{}, ErrInvalidState
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("discordoauth: consume state: %w", err)
+	}
+	return st, nil
+}
+
+// MemoryStore keeps states in process memory. It suits single-replica
+// deployments and tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+// NewMemoryStore creates an in-memory state store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]State)}
+}
+
+// Save stores a state and prunes expired ones.
+func (s *MemoryStore) Save(ctx context.Context, st State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := st.ExpiresAt.Add(-StateTTL)
+	for k, v := range s.states {
+		if v.ExpiresAt.Before(cutoff) {
+			delete(s.states, k)
+		}
+	}
+	s.states[hashState(st.State)] = st
+	return nil
+}
+
+// Consume removes and returns a state.
+func (s *MemoryStore) Consume(ctx context.Context, state string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := hashState(state)
+	st, ok := s.states[key]
+	if !ok {
+		return State{}, ErrInvalidState
+	}
+	delete(s.states, key)
+	return st, nil
+}
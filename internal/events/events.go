@@ -0,0 +1,226 @@
+// Package events provides the in-process server event bus for AGIS.
+//
+// Services publish server state transitions, player counts and cost
+// accrual; subscribers such as the dashboard SSE stream receive the events
+// for the servers their user owns. Events get increasing IDs and the bus
+// keeps a short replay buffer, so a reconnecting client can resume from
+// the last ID it saw.
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Type is the kind of server event.
+type Type string
+
+// Event types.
+const (
+	TypeStatus  Type = "status"
+	TypePlayers Type = "players"
+	TypeCost    Type = "cost"
+)
+
+// Server statuses reported in status events.
+const (
+	StatusCreating = "creating"
+	StatusReady    = "ready"
+	StatusStopping = "stopping"
+	StatusStopped  = "stopped"
+	StatusFailed   = "failed"
+)
+
+// Event is a change to one server.
+type Event struct {
+	ID       uint64    `json:"id"`
+	Type     Type      `json:"type"`
+	OwnerID  string    `json:"-"`
+	ServerID string    `json:"server_id"`
+	Time     time.Time `json:"time"`
+
+	Status      string `json:"status,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Players     *int   `json:"players,omitempty"`
+	MaxPlayers  int    `json:"max_players,omitempty"`
+	CostAccrued *int   `json:"cost_accrued,omitempty"`
+	CostPerHour int    `json:"cost_per_hour,omitempty"`
+}
+
+// StatusChanged builds a status event.
+func StatusChanged(ownerID, serverID, status, reason string) Event {
+	return Event{Type: TypeStatus, OwnerID: ownerID, ServerID: serverID, Status: status, Reason: reason}
+}
+
+// PlayersChanged builds a player count event.
+func PlayersChanged(ownerID, serverID string, players, maxPlayers int) Event {
+	return Event{Type: TypePlayers, OwnerID: ownerID, ServerID: serverID, Players: &players, MaxPlayers: maxPlayers}
+}
+
+// CostAccrued builds a cost event with the credits accrued so far.
+func CostAccrued(ownerID, serverID string, accrued, costPerHour int) Event {
+	return Event{Type: TypeCost, OwnerID: ownerID, ServerID: serverID, CostAccrued: &accrued, CostPerHour: costPerHour}
+}
+
+// Publisher accepts events. *Bus implements it.
+type Publisher interface {
+	Publish(e Event) Event
+}
+
+// ErrTooManySubscriptions is returned when an owner is at the subscription
+// cap.
+var ErrTooManySubscriptions = errors.New("events: too many subscriptions")
+
+// Options configures a Bus.
+type Options struct {
+	// ReplaySize is how many recent events are kept for resume.
+	ReplaySize int
+	// MaxPerOwner caps concurrent subscriptions per owner.
+	MaxPerOwner int
+	// Buffer is the per-subscription channel size. A subscriber that falls
+	// further behind is closed and must resume.
+	Buffer int
+}
+
+// DefaultOptions returns the options used by NewBus when fields are zero.
+func DefaultOptions() Options {
+	return Options{ReplaySize: 256, MaxPerOwner: 5, Buffer: 64}
+}
+
+// Bus fans events out to subscribers.
+type Bus struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	nextID  uint64
+	ring    []Event // oldest first, at most ReplaySize
+	subs    map[*Subscription]struct{}
+	byOwner map[string]int
+}
+
+// NewBus creates an event bus.
+func NewBus(opts Options) *Bus {
+	def := DefaultOptions()
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = def.ReplaySize
+	}
+	if opts.MaxPerOwner <= 0 {
+		opts.MaxPerOwner = def.MaxPerOwner
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = def.Buffer
+	}
+	return &Bus{
+		opts:    opts,
+		now:     time.Now,
+		nextID:  1,
+		subs:    make(map[*Subscription]struct{}),
+		byOwner: make(map[string]int),
+	}
+}
+
+// Publish assigns the event an ID and time, stores it for replay and
+// delivers it to the owner's subscribers without blocking.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID
+	b.nextID++
+	if e.Time.IsZero() {
+		e.Time = b.now().UTC()
+	}
+
+	if len(b.ring) == b.opts.ReplaySize {
+		copy(b.ring, b.ring[1:])
+		b.ring = b.ring[:len(b.ring)-1]
+	}
+	b.ring = append(b.ring, e)
+
+	for sub := range b.subs {
+		if sub.ownerID != e.OwnerID {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			// Lagging subscriber: drop it so the client resumes from its
+			// last ID rather than silently missing events.
+			b.removeLocked(sub)
+		}
+	}
+	return e
+}
+
+// Subscription receives one owner's events.
+type Subscription struct {
+	bus     *Bus
+	ownerID string
+	ch      chan Event
+
+	// Replay holds buffered events after the requested ID.
+	Replay []Event
+	// Truncated reports that events after the requested ID have already
+	// left the replay buffer, so the client should refetch full state.
+	Truncated bool
+}
+
+// C delivers live events. It is closed when the subscription ends.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.removeLocked(s)
+}
+
+// Subscribe registers for an owner's events. Events with IDs after
+// lastEventID that are still buffered are returned in Replay; pass zero
+// for a fresh stream.
+func (b *Bus) Subscribe(ownerID string, lastEventID uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.byOwner[ownerID] >= b.opts.MaxPerOwner {
+		return nil, ErrTooManySubscriptions
+	}
+
+	sub := &Subscription{bus: b, ownerID: ownerID, ch: make(chan Event, b.opts.Buffer)}
+	if lastEventID > 0 {
+		if len(b.ring) > 0 && b.ring[0].ID > lastEventID+1 {
+			sub.Truncated = true
+		}
+		for _, e := range b.ring {
+			if e.ID > lastEventID && e.OwnerID == ownerID {
+				sub.Replay = append(sub.Replay, e)
+			}
+		}
+	}
+
+	b.subs[sub] = struct{}{}
+	b.byOwner[ownerID]++
+	return sub, nil
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+func (b *Bus) removeLocked(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	if b.byOwner[sub.ownerID]--; b.byOwner[sub.ownerID] <= 0 {
+		delete(b.byOwner, sub.ownerID)
+	}
+	close(sub.ch)
+}
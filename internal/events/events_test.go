@@ -0,0 +1,101 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublishDeliversToOwnerOnly(t *testing.T) {
+	bus := NewBus(Options{})
+	alice, err := bus.Subscribe("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+
+	bus.Publish(StatusChanged("bob", "srv-1", StatusReady, ""))
+	e := bus.Publish(StatusChanged("alice", "srv-2", StatusCreating, ""))
+
+	got := <-alice.C()
+	if got.ID != e.ID || got.ServerID != "srv-2" || got.Time.IsZero() {
+		t.Errorf("unexpected event %+v", got)
+	}
+	select {
+	case extra := <-alice.C():
+		t.Errorf("unexpected extra event %+v", extra)
+	default:
+	}
+}
+
+func TestSubscribeReplaysAfterLastEventID(t *testing.T) {
+	bus := NewBus(Options{ReplaySize: 4})
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		ids = append(ids, bus.Publish(StatusChanged("alice", "srv", StatusReady, "")).ID)
+	}
+
+	sub, err := bus.Subscribe("alice", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if sub.Truncated || len(sub.Replay) != 2 || sub.Replay[0].ID != ids[1] {
+		t.Errorf("unexpected replay %+v truncated=%v", sub.Replay, sub.Truncated)
+	}
+}
+
+func TestSubscribeReportsTruncatedReplay(t *testing.T) {
+	bus := NewBus(Options{ReplaySize: 2})
+	first := bus.Publish(StatusChanged("alice", "srv", StatusCreating, ""))
+	for i := 0; i < 3; i++ {
+		bus.Publish(PlayersChanged("alice", "srv", i, 10))
+	}
+
+	sub, err := bus.Subscribe("alice", first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if !sub.Truncated || len(sub.Replay) != 2 {
+		t.Errorf("expected truncated replay of 2, got %d truncated=%v", len(sub.Replay), sub.Truncated)
+	}
+}
+
+func TestSubscribeCapsPerOwner(t *testing.T) {
+	bus := NewBus(Options{MaxPerOwner: 1})
+	sub, err := bus.Subscribe("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Subscribe("alice", 0); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Errorf("expected ErrTooManySubscriptions, got %v", err)
+	}
+	if _, err := bus.Subscribe("bob", 0); err != nil {
+		t.Errorf("expected other owner to subscribe, got %v", err)
+	}
+
+	sub.Close()
+	sub.Close() // idempotent
+	if _, err := bus.Subscribe("alice", 0); err != nil {
+		t.Errorf("expected slot to free after close, got %v", err)
+	}
+}
+
+func TestLaggingSubscriberIsClosed(t *testing.T) {
+	bus := NewBus(Options{Buffer: 1})
+	sub, err := bus.Subscribe("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(CostAccrued("alice", "srv", 10, 60))
+	bus.Publish(CostAccrued("alice", "srv", 20, 60))
+
+	<-sub.C()
+	if _, ok := <-sub.C(); ok {
+		t.Error("expected channel closed after overflow")
+	}
+	if bus.Subscribers() != 0 {
+		t.Errorf("expected subscriber removed, got %d", bus.Subscribers())
+	}
+}
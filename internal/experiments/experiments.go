@@ -0,0 +1,341 @@
+// Package experiments provides the A/B experiment engine for AGIS.
+//
+// Experiments and their variants are defined in ab_experiments and
+// ab_variants. Users are bucketed deterministically: a hash of the
+// experiment and user decides whether they fall inside traffic_alloc, and a
+// second, independent hash picks a variant weighted by allocation. The first
+// assignment is persisted in ab_assignments and is sticky from then on, so
+// later allocation changes only affect new users.
+package experiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status is an ab_experiments.status value.
+type Status string
+
+// Experiment statuses. Only running experiments assign users.
+const (
+	StatusDraft     Status = "draft"
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusCompleted Status = "completed"
+	StatusArchived  Status = "archived"
+)
+
+// Event types. Exposures and clicks are reported by clients; conversions
+// and revenue are only recorded by the server, from the payment path,
+// so users cannot move an experiment's results.
+const (
+	EventExposure   = "exposure"
+	EventClick      = "click"
+	EventConversion = "conversion"
+	EventRevenue    = "revenue"
+)
+
+// ClientEvent reports whether clients may record events of eventType.
+func ClientEvent(eventType string) bool {
+	return eventType == EventExposure || eventType == EventClick
+}
+
+// Errors returned by the experiment service.
+var (
+	ErrNotFound = errors.New("experiments: experiment not found")
+)
+
+// Experiment is an ab_experiments row with its variants.
+type Experiment struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description,omitempty"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	TrafficAlloc float64   `json:"traffic_alloc"`
+	TargetMetric string    `json:"target_metric"`
+	Status       Status    `json:"status"`
+	Variants     []Variant `json:"variants"`
+}
+
+// Variant is an ab_variants row.
+type Variant struct {
+	ID          string          `json:"variant_id"`
+	Name        string          `json:"variant_name"`
+	Allocation  float64         `json:"allocation"`
+	Config      json.RawMessage `json:"config"`
+	Description string          `json:"description,omitempty"`
+}
+
+// Active reports whether the experiment is running and inside its dates.
+func (e *Experiment) Active(now time.Time) bool {
+	return e.Status == StatusRunning && !now.Before(e.StartDate) && now.Before(e.EndDate)
+}
+
+// Variant returns the variant with the given ID.
+func (e *Experiment) Variant(id string) (Variant, bool) {
+	for _, v := range e.Variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// Pick returns the variant a user would be bucketed into, or false when the
+// user falls outside traffic_alloc or no variant has allocation. It does not
+// consult or persist assignments.
+func (e *Experiment) Pick(userID string) (Variant, bool) {
+	if bucket("traffic", e.ID, userID) >= e.TrafficAlloc {
+		return Variant{}, false
+	}
+
+	var total float64
+	for _, v := range e.Variants {
+		total += v.Allocation
+	}
+	if total <= 0 {
+		return Variant{}, false
+	}
+
+	// Allocations are normalised so they need not sum to exactly 1.
+	point := bucket("variant", e.ID, userID) * total
+	for _, v := range e.Variants {
+		if point < v.Allocation {
+			return v, true
+		}
+		point -= v.Allocation
+	}
+	return e.Variants[len(e.Variants)-1], true
+}
+
+// bucket maps (salt, experiment, user) uniformly onto [0, 1).
+func bucket(salt, experimentID, userID string) float64 {
+	sum := sha256.Sum256([]byte(salt + ":" + experimentID + ":" + userID))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// Assignment is a user's variant in an experiment. Enrolled is false when
+// the experiment is not active or the user is outside its traffic; callers
+// should then use their defaults.
+type Assignment struct {
+	ExperimentID string          `json:"experiment_id"`
+	UserID       string          `json:"user_id"`
+	Enrolled     bool            `json:"enrolled"`
+	VariantID    string          `json:"variant_id,omitempty"`
+	Config       json.RawMessage `json:"config,omitempty"`
+}
+
+// Service assigns users and records experiment events.
+type Service struct {
+	db  *sql.DB
+	now func() time.Time
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedExperiment
+}
+
+type cachedExperiment struct {
+	exp     *Experiment
+	expires time.Time
+}
+
+// NewService creates an experiment service. Experiment definitions are
+// cached for 30 seconds so hot paths such as ad callbacks do not reload
+// them on every lookup.
+func NewService(db *sql.DB) *Service {
+	return &Service{
+		db:    db,
+		now:   time.Now,
+		ttl:   30 * time.Second,
+		cache: make(map[string]cachedExperiment),
+	}
+}
+
+// Experiment loads an experiment and its variants.
+func (s *Service) Experiment(ctx context.Context, id string) (*Experiment, error) {
+	now := s.now()
+	s.mu.Lock()
+	if c, ok := s.cache[id]; ok && now.Before(c.expires) {
+		s.mu.Unlock()
+		return c.exp, nil
+	}
+	s.mu.Unlock()
+
+	exp := &Experiment{ID: id}
+	var description sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT name, description, start_date, end_date, traffic_alloc, target_metric, COALESCE(status, 'draft')
+		FROM ab_experiments
+		WHERE id = $1
+	`, id).Scan(&exp.Name, &description, &exp.StartDate, &exp.EndDate, &exp.TrafficAlloc, &exp.TargetMetric, &exp.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("experiments: load %s: %w", id, err)
+	}
+	exp.Description = description.String
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT variant_id, variant_name, allocation, config, COALESCE(description, '')
+		FROM ab_variants
+		WHERE experiment_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("experiments: load variants for %s: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v Variant
+		var config []byte
+		if err := rows.Scan(&v.ID, &v.Name, &v.Allocation, &config, &v.Description); err != nil {
+			return nil, fmt.Errorf("experiments: scan variant: %w", err)
+		}
+		v.Config = json.RawMessage(config)
+		exp.Variants = append(exp.Variants, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("experiments: load variants for %s: %w", id, err)
+	}
+
+	s.mu.Lock()
+	s.cache[id] = cachedExperiment{exp: exp, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return exp, nil
+}
+
+// Assign returns the user's sticky variant, assigning one on first use.
+// Existing assignments are honoured even if allocations have changed since,
+// but nobody is enrolled while the experiment is not running or outside its
+// start and end dates.
+func (s *Service) Assign(ctx context.Context, experimentID, userID string) (Assignment, error) {
+	a := Assignment{ExperimentID: experimentID, UserID: userID}
+
+	exp, err := s.Experiment(ctx, experimentID)
+	if err != nil {
+		return a, err
+	}
+	if !exp.Active(s.now()) {
+		return a, nil
+	}
+
+	var variantID string
+	err = s.db.QueryRowContext(ctx, `
+		SELECT variant_id FROM ab_assignments WHERE user_id = $1 AND experiment_id = $2
+	`, userID, experimentID).Scan(&variantID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		v, ok := exp.Pick(userID)
+		if !ok {
+			return a, nil
+		}
+		// A concurrent request may have assigned the user first; the no-op
+		// update makes RETURNING yield whichever row won.
+		err = s.db.QueryRowContext(ctx, `
+			INSERT INTO ab_assignments (user_id, experiment_id, variant_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, experiment_id) DO UPDATE SET sticky = ab_assignments.sticky
+			RETURNING variant_id
+		`, userID, experimentID, v.ID).Scan(&variantID)
+		if err != nil {
+			return a, fmt.Errorf("experiments: assign %s to %s: %w", userID, experimentID, err)
+		}
+	case err != nil:
+		return a, fmt.Errorf("experiments: lookup assignment: %w", err)
+	}
+
+	v, ok := exp.Variant(variantID)
+	if !ok {
+		// The variant was removed after assignment; treat as not enrolled.
+		return a, nil
+	}
+	a.Enrolled = true
+	a.VariantID = v.ID
+	a.Config = v.Config
+	return a, nil
+}
+
+// VariantConfig assigns the user and decodes the variant config into out.
+// It returns the variant ID, or "" with out untouched when the user is not
+// enrolled, so callers can prefill out with their defaults:
+//
+//	cfg := struct{ Multiplier float64 }{Multiplier: 1}
+//	variant, err := svc.VariantConfig(ctx, "ad-reward-multiplier", userID, &cfg)
+func (s *Service) VariantConfig(ctx context.Context, experimentID, userID string, out any) (string, error) {
+	a, err := s.Assign(ctx, experimentID, userID)
+	if err != nil || !a.Enrolled {
+		return "", err
+	}
+	if len(a.Config) > 0 {
+		if err := json.Unmarshal(a.Config, out); err != nil {
+			return "", fmt.Errorf("experiments: decode config for %s/%s: %w", experimentID, a.VariantID, err)
+		}
+	}
+	return a.VariantID, nil
+}
+
+// Record stores an event against the user's assigned variant. Events from
+// users who are not assigned are not part of the experiment and are
+// dropped; recorded reports whether the event was stored.
+func (s *Service) Record(ctx context.Context, experimentID, userID, eventType string, value float64, metadata map[string]any) (recorded bool, err error) {
+	var meta []byte
+	if len(metadata) > 0 {
+		if meta, err = json.Marshal(metadata); err != nil {
+			return false, fmt.Errorf("experiments: encode metadata: %w", err)
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO ab_events (user_id, experiment_id, variant_id, event_type, event_value, metadata)
+		SELECT user_id, experiment_id, variant_id, $3, $4, $5
+		FROM ab_assignments
+		WHERE user_id = $1 AND experiment_id = $2
+	`, userID, experimentID, eventType, value, meta)
+	if err != nil {
+		return false, fmt.Errorf("experiments: record %s event: %w", eventType, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("experiments: record %s event: %w", eventType, err)
+	}
+	return n > 0, nil
+}
+
+// RecordAll stores an event against every running experiment the user is
+// assigned to and returns how many were recorded. It is used for events
+// such as payments that are not tied to one experiment.
+func (s *Service) RecordAll(ctx context.Context, userID, eventType string, value float64, metadata map[string]any) (int64, error) {
+	var meta []byte
+	if len(metadata) > 0 {
+		var err error
+		if meta, err = json.Marshal(metadata); err != nil {
+			return 0, fmt.Errorf("experiments: encode metadata: %w", err)
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO ab_events (user_id, experiment_id, variant_id, event_type, event_value, metadata)
+		SELECT a.user_id, a.experiment_id, a.variant_id, $2, $3, $4
+		FROM ab_assignments a
+		JOIN ab_experiments e ON e.id = a.experiment_id
+		WHERE a.user_id = $1 AND e.status = $5
+	`, userID, eventType, value, meta, StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("experiments: record %s events: %w", eventType, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("experiments: record %s events: %w", eventType, err)
+	}
+	return n, nil
+}
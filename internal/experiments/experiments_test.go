@@ -0,0 +1,214 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testExperiment() *Experiment {
+	return &Experiment{
+		ID:           "ad-reward-multiplier",
+		StartDate:    testNow.Add(-24 * time.Hour),
+		EndDate:      testNow.Add(24 * time.Hour),
+		TrafficAlloc: 1,
+		TargetMetric: "conversion",
+		Status:       StatusRunning,
+		Variants: []Variant{
+			{ID: "control", Allocation: 0.5, Config: []byte(`{"multiplier":1}`)},
+			{ID: "boost", Allocation: 0.5, Config: []byte(`{"multiplier":1.5}`)},
+		},
+	}
+}
+
+func TestPickIsDeterministicAndBalanced(t *testing.T) {
+	exp := testExperiment()
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		v, ok := exp.Pick(user)
+		if !ok {
+			t.Fatalf("expected %s to be enrolled at full traffic", user)
+		}
+		if again, _ := exp.Pick(user); again.ID != v.ID {
+			t.Fatalf("assignment for %s is not deterministic", user)
+		}
+		counts[v.ID]++
+	}
+	if math.Abs(float64(counts["control"])/10000-0.5) > 0.03 {
+		t.Errorf("unbalanced split: %v", counts)
+	}
+}
+
+func TestPickRespectsTrafficAlloc(t *testing.T) {
+	exp := testExperiment()
+	exp.TrafficAlloc = 0.2
+
+	enrolled := 0
+	for i := 0; i < 10000; i++ {
+		if _, ok := exp.Pick(fmt.Sprintf("user-%d", i)); ok {
+			enrolled++
+		}
+	}
+	if math.Abs(float64(enrolled)/10000-0.2) > 0.03 {
+		t.Errorf("expected ~20%% enrolled, got %d", enrolled)
+	}
+
+	// Lowering traffic only removes users; the variant of those who remain
+	// is unchanged because traffic and variant use independent hashes.
+	full := testExperiment()
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if v, ok := exp.Pick(user); ok {
+			if w, _ := full.Pick(user); w.ID != v.ID {
+				t.Fatalf("variant for %s changed with traffic allocation", user)
+			}
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	exp := testExperiment()
+	if !exp.Active(testNow) {
+		t.Error("expected running experiment inside its dates to be active")
+	}
+	if exp.Active(exp.EndDate) {
+		t.Error("expected experiment to end at end_date")
+	}
+	exp.Status = StatusPaused
+	if exp.Active(testNow) {
+		t.Error("expected paused experiment to be inactive")
+	}
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	svc := NewService(db)
+	svc.now = func() time.Time { return testNow }
+	return svc, mock
+}
+
+func expectExperiment(mock sqlmock.Sqlmock, status Status) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM ab_experiments`)).
+		WithArgs("ad-reward-multiplier").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"name", "description", "start_date", "end_date", "traffic_alloc", "target_metric", "status",
+		}).AddRow("Ad reward multiplier", nil, testNow.Add(-time.Hour), testNow.Add(time.Hour), 1.0, "conversion", string(status)))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM ab_variants`)).
+		WithArgs("ad-reward-multiplier").
+		WillReturnRows(sqlmock.NewRows([]string{"variant_id", "variant_name", "allocation", "config", "description"}).
+			AddRow("control", "Control", 0.5, []byte(`{"multiplier":1}`), "").
+			AddRow("boost", "Boost", 0.5, []byte(`{"multiplier":1.5}`), ""))
+}
+
+func TestVariantConfigUsesStickyAssignment(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectExperiment(mock, StatusRunning)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_id FROM ab_assignments`)).
+		WithArgs("u1", "ad-reward-multiplier").
+		WillReturnRows(sqlmock.NewRows([]string{"variant_id"}).AddRow("boost"))
+
+	cfg := struct{ Multiplier float64 }{Multiplier: 1}
+	variant, err := svc.VariantConfig(context.Background(), "ad-reward-multiplier", "u1", &cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if variant != "boost" || cfg.Multiplier != 1.5 {
+		t.Errorf("expected boost config, got %q %+v", variant, cfg)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAssignSkipsPausedExperiment(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectExperiment(mock, StatusPaused)
+
+	a, err := svc.Assign(context.Background(), "ad-reward-multiplier", "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Enrolled {
+		t.Error("expected no enrolment while paused")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordAllUsesRunningAssignments(t *testing.T) {
+	svc, mock := newTestService(t)
+	mock.ExpectExec(regexp.QuoteMeta(`FROM ab_assignments a`)).
+		WithArgs("u1", EventRevenue, 4.99, []byte(`{"session_id":"cs_1"}`), StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := svc.RecordAll(context.Background(), "u1", EventRevenue, 4.99, map[string]any{"session_id": "cs_1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 events, got %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientEvent(t *testing.T) {
+	for eventType, want := range map[string]bool{
+		EventExposure: true, EventClick: true,
+		EventConversion: false, EventRevenue: false, "reward": false, "": false,
+	} {
+		if got := ClientEvent(eventType); got != want {
+			t.Errorf("ClientEvent(%q) = %v, want %v", eventType, got, want)
+		}
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	low, high := wilsonInterval(50, 100, z95)
+	if math.Abs(low-0.4038) > 0.0005 || math.Abs(high-0.5962) > 0.0005 {
+		t.Errorf("unexpected interval [%f, %f]", low, high)
+	}
+	if low, high := wilsonInterval(0, 0, z95); low != 0 || high != 0 {
+		t.Error("expected empty interval without samples")
+	}
+}
+
+func TestAnalyseSignificance(t *testing.T) {
+	r := &Results{Confidence: 0.95, Variants: []VariantResult{
+		{VariantID: "boost", SampleSize: 1000, Conversions: 130},
+		{VariantID: "control", SampleSize: 1000, Conversions: 100},
+	}}
+	r.analyse()
+
+	if r.Control != "control" {
+		t.Fatalf("expected control baseline, got %s", r.Control)
+	}
+	boost := r.Variants[0]
+	if math.Abs(boost.ZScore-2.103) > 0.01 || math.Abs(boost.PValue-0.0355) > 0.001 {
+		t.Errorf("unexpected z=%f p=%f", boost.ZScore, boost.PValue)
+	}
+	if !boost.Significant || math.Abs(boost.Lift-0.3) > 1e-9 {
+		t.Errorf("expected significant 30%% lift, got %+v", boost)
+	}
+
+	r.Variants[0].Conversions = 105
+	r.analyse()
+	if r.Variants[0].Significant {
+		t.Error("expected small difference not to be significant")
+	}
+}
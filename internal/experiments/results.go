@@ -0,0 +1,162 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// ControlVariantID is treated as the baseline when present; otherwise the
+// first variant is.
+const ControlVariantID = "control"
+
+// z95 is the two-sided critical value for 95% confidence.
+const z95 = 1.959963984540054
+
+// Results summarises an experiment's conversion rates against the
+// control variant.
+type Results struct {
+	ExperimentID string          `json:"experiment_id"`
+	TargetMetric string          `json:"target_metric"`
+	Status       Status          `json:"status"`
+	Confidence   float64         `json:"confidence"`
+	Control      string          `json:"control_variant_id"`
+	Variants     []VariantResult `json:"variants"`
+}
+
+// VariantResult is one variant's outcome. The conversion rate counts users
+// with at least one target_metric event, so repeat events do not inflate it.
+type VariantResult struct {
+	VariantID    string  `json:"variant_id"`
+	VariantName  string  `json:"variant_name"`
+	SampleSize   int64   `json:"sample_size"`
+	Conversions  int64   `json:"conversions"`
+	Rate         float64 `json:"conversion_rate"`
+	CILow        float64 `json:"ci_low"`
+	CIHigh       float64 `json:"ci_high"`
+	Lift         float64 `json:"lift"` // relative to control; 0 for control
+	ZScore       float64 `json:"z_score"`
+	PValue       float64 `json:"p_value"`
+	Significant  bool    `json:"significant"`
+	AvgReward    float64 `json:"avg_reward"`
+	TotalRevenue float64 `json:"total_revenue"`
+	FraudCount   int64   `json:"fraud_count"`
+}
+
+// Results computes per-variant conversion rates with 95% Wilson score
+// intervals and a two-proportion z-test of each variant against control.
+func (s *Service) Results(ctx context.Context, experimentID string) (*Results, error) {
+	exp, err := s.Experiment(ctx, experimentID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT v.variant_id, v.variant_name,
+		       COUNT(DISTINCT a.user_id),
+		       COUNT(DISTINCT ev.user_id) FILTER (WHERE ev.event_type = e.target_metric),
+		       COALESCE(AVG(ev.event_value) FILTER (WHERE ev.event_type = 'reward'), 0),
+		       COALESCE(SUM(ev.event_value) FILTER (WHERE ev.event_type = 'revenue'), 0),
+		       COUNT(ev.id) FILTER (WHERE ev.event_type = 'fraud')
+		FROM ab_experiments e
+		JOIN ab_variants v ON v.experiment_id = e.id
+		LEFT JOIN ab_assignments a ON a.experiment_id = e.id AND a.variant_id = v.variant_id
+		LEFT JOIN ab_events ev ON ev.experiment_id = e.id AND ev.user_id = a.user_id AND ev.variant_id = a.variant_id
+		WHERE e.id = $1
+		GROUP BY v.id, v.variant_id, v.variant_name
+		ORDER BY v.id
+	`, experimentID)
+	if err != nil {
+		return nil, fmt.Errorf("experiments: results for %s: %w", experimentID, err)
+	}
+	defer rows.Close()
+
+	res := &Results{
+		ExperimentID: exp.ID,
+		TargetMetric: exp.TargetMetric,
+		Status:       exp.Status,
+		Confidence:   0.95,
+	}
+	for rows.Next() {
+		var v VariantResult
+		if err := rows.Scan(&v.VariantID, &v.VariantName, &v.SampleSize, &v.Conversions,
+			&v.AvgReward, &v.TotalRevenue, &v.FraudCount); err != nil {
+			return nil, fmt.Errorf("experiments: scan results: %w", err)
+		}
+		res.Variants = append(res.Variants, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("experiments: results for %s: %w", experimentID, err)
+	}
+
+	res.analyse()
+	return res, nil
+}
+
+// analyse fills in rates, intervals and significance.
+func (r *Results) analyse() {
+	if len(r.Variants) == 0 {
+		return
+	}
+	control := 0
+	for i, v := range r.Variants {
+		if v.VariantID == ControlVariantID {
+			control = i
+			break
+		}
+	}
+	r.Control = r.Variants[control].VariantID
+
+	for i := range r.Variants {
+		v := &r.Variants[i]
+		if v.SampleSize > 0 {
+			v.Rate = float64(v.Conversions) / float64(v.SampleSize)
+		}
+		v.CILow, v.CIHigh = wilsonInterval(v.Conversions, v.SampleSize, z95)
+	}
+
+	c := r.Variants[control]
+	for i := range r.Variants {
+		if i == control {
+			continue
+		}
+		v := &r.Variants[i]
+		if c.Rate > 0 {
+			v.Lift = (v.Rate - c.Rate) / c.Rate
+		}
+		v.ZScore, v.PValue = twoProportionZTest(c.Conversions, c.SampleSize, v.Conversions, v.SampleSize)
+		v.Significant = v.PValue < 1-r.Confidence
+	}
+}
+
+// wilsonInterval returns the Wilson score interval for successes out of n.
+// It behaves well for small samples and rates near 0 or 1.
+func wilsonInterval(successes, n int64, z float64) (low, high float64) {
+	if n <= 0 {
+		return 0, 0
+	}
+	nf := float64(n)
+	p := float64(successes) / nf
+	z2 := z * z
+	denom := 1 + z2/nf
+	centre := (p + z2/(2*nf)) / denom
+	margin := z * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / denom
+	return math.Max(0, centre-margin), math.Min(1, centre+margin)
+}
+
+// twoProportionZTest compares two conversion rates using the pooled
+// standard error and returns the z statistic and two-sided p-value.
+func twoProportionZTest(c1, n1, c2, n2 int64) (z, p float64) {
+	if n1 <= 0 || n2 <= 0 {
+		return 0, 1
+	}
+	p1 := float64(c1) / float64(n1)
+	p2 := float64(c2) / float64(n2)
+	pooled := float64(c1+c2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0, 1
+	}
+	z = (p2 - p1) / se
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
@@ -0,0 +1,148 @@
+package flags
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wethegamers/agis/internal/experiments"
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// Variants an experiment-backed flag's users are assigned to. The
+// experiment's ab_variants rows must use these IDs.
+const (
+	VariantControl   = experiments.ControlVariantID // flag off
+	VariantTreatment = "treatment"                  // flag on
+)
+
+// Exposure records that a user was served an experiment-backed flag.
+type Exposure struct {
+	Flag       Key
+	Experiment string
+	UserID     string
+	GuildID    string
+	Value      bool
+	Reason     Reason
+	Time       time.Time
+}
+
+// Variant returns the variant the exposure counts towards.
+func (e Exposure) Variant() string {
+	if e.Value {
+		return VariantTreatment
+	}
+	return VariantControl
+}
+
+// ExposureLog writes exposures to the A/B tables in the background. The
+// first exposure assigns the user to the variant they were served in
+// ab_assignments, which keeps it as the experiment's sample even if a
+// later rollout change serves them the other value; each exposure is an
+// "exposure" event in ab_events. Repeats of the same user, experiment and
+// variant are written once per process.
+type ExposureLog struct {
+	db     *sql.DB
+	queue  chan Exposure
+	logger *slog.Logger
+
+	seen map[string]bool // touched only by Run
+}
+
+// maxSeen bounds the repeat filter; it is cleared when full.
+const maxSeen = 100_000
+
+// NewExposureLog creates an exposure log that queues up to 1024
+// exposures; RecordExposure drops exposures while the queue is full.
+func NewExposureLog(db *sql.DB) *ExposureLog {
+	return &ExposureLog{
+		db:     db,
+		queue:  make(chan Exposure, 1024),
+		logger: slog.Default(),
+		seen:   make(map[string]bool),
+	}
+}
+
+// SetLogger sets the logger used to report failed writes.
+func (l *ExposureLog) SetLogger(logger *slog.Logger) {
+	l.logger = logger
+}
+
+// RecordExposure queues e without blocking.
+func (l *ExposureLog) RecordExposure(e Exposure) {
+	select {
+	case l.queue <- e:
+	default:
+		metrics.FlagExposuresTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run writes queued exposures until ctx is done, then writes what is
+// still queued within five seconds.
+func (l *ExposureLog) Run(ctx context.Context) error {
+	for {
+		select {
+		case e := <-l.queue:
+			l.write(ctx, e)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case e := <-l.queue:
+					l.write(flushCtx, e)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (l *ExposureLog) write(ctx context.Context, e Exposure) {
+	id := e.Experiment + "\x00" + e.UserID + "\x00" + e.Variant()
+	if l.seen[id] {
+		return
+	}
+	if err := l.insert(ctx, e); err != nil {
+		metrics.FlagExposuresTotal.WithLabelValues("failed").Inc()
+		l.logger.Warn("failed to record flag exposure", "flag", e.Flag, "experiment", e.Experiment, "error", err)
+		return
+	}
+	metrics.FlagExposuresTotal.WithLabelValues("recorded").Inc()
+	if len(l.seen) >= maxSeen {
+		clear(l.seen)
+	}
+	l.seen[id] = true
+}
+
+func (l *ExposureLog) insert(ctx context.Context, e Exposure) error {
+	meta := map[string]any{"flag": e.Flag, "reason": e.Reason}
+	if e.GuildID != "" {
+		meta["guild_id"] = e.GuildID
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	// The no-op update makes RETURNING yield the user's existing
+	// assignment, so the event counts towards the variant they are
+	// sampled in.
+	_, err = l.db.ExecContext(ctx, `
+		WITH a AS (
+			INSERT INTO ab_assignments (user_id, experiment_id, variant_id, assigned_at)
+			VALUES ($1, $2, $3, $5)
+			ON CONFLICT (user_id, experiment_id) DO UPDATE SET sticky = ab_assignments.sticky
+			RETURNING variant_id
+		)
+		INSERT INTO ab_events (user_id, experiment_id, variant_id, event_type, event_value, metadata, created_at)
+		SELECT $1, $2, variant_id, 'exposure', 1, $4, $5 FROM a
+	`, e.UserID, e.Experiment, e.Variant(), metaJSON, e.Time)
+	if err != nil {
+		return fmt.Errorf("flags: record exposure of %s to %s: %w", e.UserID, e.Experiment, err)
+	}
+	return nil
+}
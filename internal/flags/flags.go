@@ -0,0 +1,236 @@
+// Package flags provides typed feature flags for AGIS.
+//
+// Flags come from three sources, each overriding the one before: the
+// features section of the bot settings (FEATURE_* variables, see
+// internal/config), the on/off features map in hot-config.yaml, and the
+// targeted definitions under flags: in hot-config.yaml. A flag is
+// evaluated against an EvalContext of user, guild, tier and environment:
+// a kill switch forces it off, then the first matching rule decides, then
+// a percentage rollout, then its default. Rollouts hash the flag key with
+// the user (or guild) ID, so a user keeps the same answer as long as the
+// percentage does not drop below their bucket.
+//
+// Every Evaluation carries the reason for its value. Flags tied to an
+// A/B experiment record an exposure for each user they are evaluated for,
+// which ExposureLog writes to ab_assignments and ab_events.
+package flags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wethegamers/agis/internal/config"
+	"github.com/wethegamers/agis/internal/hotconfig"
+)
+
+// EvalContext is what a flag is evaluated against. Empty fields match no
+// rule that lists values for them.
+type EvalContext struct {
+	UserID      string `json:"user_id,omitempty"`
+	GuildID     string `json:"guild_id,omitempty"`
+	Tier        string `json:"tier,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+// Reason explains an evaluation's value.
+type Reason string
+
+const (
+	// ReasonKilled means the flag's kill switch is on.
+	ReasonKilled Reason = "killed"
+	// ReasonRule means a targeting rule matched.
+	ReasonRule Reason = "rule"
+	// ReasonRollout means the percentage rollout decided.
+	ReasonRollout Reason = "rollout"
+	// ReasonDefault means nothing else applied.
+	ReasonDefault Reason = "default"
+	// ReasonUnknown means no source defines the flag; it is off.
+	ReasonUnknown Reason = "unknown"
+)
+
+// Sources a flag definition can come from, as reported in evaluations.
+const (
+	SourceHotConfigFlags    = "hot-config flags"
+	SourceHotConfigFeatures = "hot-config features"
+)
+
+// Flag is a flag definition and the source it came from.
+type Flag struct {
+	Key    Key    `json:"key"`
+	Source string `json:"source"`
+	hotconfig.Flag
+}
+
+// Evaluation is a flag's value for one context and why.
+type Evaluation struct {
+	Key    Key    `json:"key"`
+	Value  bool   `json:"value"`
+	Reason Reason `json:"reason"`
+	// Rule is the 1-based index of the rule that decided, for ReasonRule.
+	Rule int `json:"rule,omitempty"`
+	// Bucket is the context's rollout position in [0, 100), when a
+	// rollout was consulted.
+	Bucket float64 `json:"bucket,omitempty"`
+	Source string  `json:"source,omitempty"`
+}
+
+// Evaluate returns the flag's value for ec.
+func (f *Flag) Evaluate(ec EvalContext) Evaluation {
+	ev := Evaluation{Key: f.Key, Source: f.Source}
+	if f.Kill {
+		ev.Reason = ReasonKilled
+		return ev
+	}
+	b, bucketed := bucket(f.Key, f.unit(ec))
+	for i, r := range f.Rules {
+		if !matches(r, ec) {
+			continue
+		}
+		if r.Rollout != nil {
+			if !bucketed || b >= *r.Rollout {
+				continue
+			}
+			ev.Bucket = b
+		}
+		ev.Value, ev.Reason, ev.Rule = r.Value, ReasonRule, i+1
+		return ev
+	}
+	if f.Rollout != nil && bucketed {
+		ev.Value, ev.Reason, ev.Bucket = b < *f.Rollout, ReasonRollout, b
+		return ev
+	}
+	ev.Value, ev.Reason = f.Default, ReasonDefault
+	return ev
+}
+
+// unit returns the ID rollouts are bucketed by.
+func (f *Flag) unit(ec EvalContext) string {
+	if f.BucketBy == "guild" {
+		return ec.GuildID
+	}
+	return ec.UserID
+}
+
+// matches reports whether ec satisfies every condition the rule sets.
+func matches(r hotconfig.FlagRule, ec EvalContext) bool {
+	for _, c := range []struct {
+		values []string
+		v      string
+	}{
+		{r.Users, ec.UserID},
+		{r.Guilds, ec.GuildID},
+		{r.Tiers, ec.Tier},
+		{r.Environments, ec.Environment},
+	} {
+		if len(c.values) > 0 && (c.v == "" || !slices.Contains(c.values, c.v)) {
+			return false
+		}
+	}
+	return true
+}
+
+// bucket maps (flag, unit) uniformly onto [0, 100). It reports false for
+// an empty unit, which no rollout includes.
+func bucket(key Key, unit string) (float64, bool) {
+	if unit == "" {
+		return 0, false
+	}
+	sum := sha256.Sum256([]byte(string(key) + ":" + unit))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53) * 100, true
+}
+
+// Set is an immutable snapshot of flag definitions.
+type Set struct {
+	flags map[Key]*Flag
+	// environment fills in contexts that do not name one.
+	environment string
+}
+
+// NewSet returns a Set of flags evaluated in environment by default.
+// A later flag with the same key replaces an earlier one.
+func NewSet(environment string, flags ...Flag) *Set {
+	s := &Set{flags: make(map[Key]*Flag, len(flags)), environment: environment}
+	for i := range flags {
+		s.flags[flags[i].Key] = &flags[i]
+	}
+	return s
+}
+
+// Build merges the flag sources. cfg supplies the features settings and
+// the default environment, hot the features map and flags section; either
+// may be nil.
+func Build(cfg *config.Config, hot *hotconfig.File) *Set {
+	var flags []Flag
+	var environment string
+	if cfg != nil {
+		environment = cfg.App.Environment
+		for _, s := range cfg.Settings() {
+			key, ok := strings.CutPrefix(s.Key, "features.")
+			if !ok {
+				continue
+			}
+			on, _ := strconv.ParseBool(s.Value)
+			flags = append(flags, Flag{Key: Key(key), Source: "settings (" + s.Origin.String() + ")", Flag: hotconfig.Flag{Default: on}})
+		}
+	}
+	if hot != nil {
+		for _, key := range sortedKeys(hot.Features) {
+			flags = append(flags, Flag{Key: Key(key), Source: SourceHotConfigFeatures, Flag: hotconfig.Flag{Default: hot.Features[key]}})
+		}
+		for _, key := range sortedKeys(hot.Flags) {
+			flags = append(flags, Flag{Key: Key(key), Source: SourceHotConfigFlags, Flag: hot.Flags[key]})
+		}
+	}
+	return NewSet(environment, flags...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Flag returns the definition of key.
+func (s *Set) Flag(key Key) (*Flag, bool) {
+	f, ok := s.flags[key]
+	return f, ok
+}
+
+// Keys returns every defined key in order.
+func (s *Set) Keys() []Key {
+	keys := make([]Key, 0, len(s.flags))
+	for k := range s.flags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Evaluate returns key's value for ec. An undefined flag is off.
+func (s *Set) Evaluate(ec EvalContext, key Key) Evaluation {
+	if ec.Environment == "" {
+		ec.Environment = s.environment
+	}
+	f, ok := s.flags[key]
+	if !ok {
+		return Evaluation{Key: key, Reason: ReasonUnknown}
+	}
+	return f.Evaluate(ec)
+}
+
+// EvaluateAll evaluates every flag for ec, in key order.
+func (s *Set) EvaluateAll(ec EvalContext) []Evaluation {
+	keys := s.Keys()
+	out := make([]Evaluation, len(keys))
+	for i, k := range keys {
+		out[i] = s.Evaluate(ec, k)
+	}
+	return out
+}
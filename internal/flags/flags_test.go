@@ -0,0 +1,158 @@
+package flags
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/config"
+	"github.com/wethegamers/agis/internal/hotconfig"
+)
+
+func pct(v float64) *float64 { return &v }
+
+func TestEvaluate(t *testing.T) {
+	set := NewSet("production",
+		Flag{Key: "new_shop", Source: SourceHotConfigFlags, Flag: hotconfig.Flag{
+			Rules: []hotconfig.FlagRule{
+				{Users: []string{"42"}, Value: false},
+				{Tiers: []string{"premium"}, Environments: []string{"production"}, Value: true},
+				{Environments: []string{"development"}, Value: true},
+			},
+			Rollout: pct(0),
+		}},
+		Flag{Key: "beta_lobby", Flag: hotconfig.Flag{Default: true}},
+		Flag{Key: "broken", Flag: hotconfig.Flag{Default: true, Kill: true, Rules: []hotconfig.FlagRule{{Users: []string{"1"}, Value: true}}}},
+	)
+
+	for _, tt := range []struct {
+		ec     EvalContext
+		key    Key
+		value  bool
+		reason Reason
+		rule   int
+	}{
+		{EvalContext{UserID: "42", Tier: "premium"}, "new_shop", false, ReasonRule, 1},
+		{EvalContext{UserID: "7", Tier: "premium"}, "new_shop", true, ReasonRule, 2},
+		{EvalContext{UserID: "7", Tier: "premium", Environment: "staging"}, "new_shop", false, ReasonRollout, 0},
+		{EvalContext{UserID: "7", Environment: "development"}, "new_shop", true, ReasonRule, 3},
+		{EvalContext{Tier: "free"}, "new_shop", false, ReasonDefault, 0}, // no user to bucket
+		{EvalContext{UserID: "7"}, "beta_lobby", true, ReasonDefault, 0},
+		{EvalContext{UserID: "1"}, "broken", false, ReasonKilled, 0},
+		{EvalContext{UserID: "7"}, "missing", false, ReasonUnknown, 0},
+	} {
+		ev := set.Evaluate(tt.ec, tt.key)
+		if ev.Value != tt.value || ev.Reason != tt.reason || ev.Rule != tt.rule {
+			t.Errorf("Evaluate(%+v, %s) = %+v, want %v by %s (rule %d)", tt.ec, tt.key, ev, tt.value, tt.reason, tt.rule)
+		}
+	}
+}
+
+func TestRolloutIsStableAndProportional(t *testing.T) {
+	f := Flag{Key: "new_shop", Flag: hotconfig.Flag{Rollout: pct(25)}}
+	on := 0
+	for i := 0; i < 10000; i++ {
+		ec := EvalContext{UserID: fmt.Sprint(i)}
+		ev := f.Evaluate(ec)
+		if again := f.Evaluate(ec); again != ev {
+			t.Fatalf("user %d got %+v then %+v", i, ev, again)
+		}
+		if ev.Value {
+			on++
+		}
+	}
+	if math.Abs(float64(on)/10000-0.25) > 0.02 {
+		t.Errorf("%d of 10000 users enabled at 25%%", on)
+	}
+
+	// Raising the percentage only adds users.
+	wider := Flag{Key: "new_shop", Flag: hotconfig.Flag{Rollout: pct(50)}}
+	for i := 0; i < 1000; i++ {
+		ec := EvalContext{UserID: fmt.Sprint(i)}
+		if f.Evaluate(ec).Value && !wider.Evaluate(ec).Value {
+			t.Fatalf("user %d dropped when the rollout grew", i)
+		}
+	}
+
+	// Another flag buckets the same users independently.
+	other := Flag{Key: "other", Flag: hotconfig.Flag{Rollout: pct(25)}}
+	same := 0
+	for i := 0; i < 1000; i++ {
+		ec := EvalContext{UserID: fmt.Sprint(i)}
+		if f.Evaluate(ec).Value == other.Evaluate(ec).Value {
+			same++
+		}
+	}
+	if same > 700 {
+		t.Errorf("flags agree for %d of 1000 users; buckets are correlated", same)
+	}
+
+	// Guild bucketing gives every member of a guild the same answer.
+	byGuild := Flag{Key: "guild_shop", Flag: hotconfig.Flag{Rollout: pct(50), BucketBy: "guild"}}
+	first := byGuild.Evaluate(EvalContext{UserID: "1", GuildID: "g"}).Value
+	for i := 2; i < 50; i++ {
+		if byGuild.Evaluate(EvalContext{UserID: fmt.Sprint(i), GuildID: "g"}).Value != first {
+			t.Fatal("members of one guild were bucketed differently")
+		}
+	}
+}
+
+func TestRuleRolloutFallsThrough(t *testing.T) {
+	f := Flag{Key: "new_shop", Flag: hotconfig.Flag{
+		Default: false,
+		Rules:   []hotconfig.FlagRule{{Tiers: []string{"premium"}, Rollout: pct(50), Value: true}},
+	}}
+	counts := map[Reason]int{}
+	for i := 0; i < 1000; i++ {
+		ev := f.Evaluate(EvalContext{UserID: fmt.Sprint(i), Tier: "premium"})
+		counts[ev.Reason]++
+		if ev.Reason == ReasonRule && (!ev.Value || ev.Bucket >= 50) {
+			t.Fatalf("rule evaluation %+v", ev)
+		}
+	}
+	if counts[ReasonRule] < 400 || counts[ReasonDefault] < 400 {
+		t.Errorf("reasons = %v, want about half each", counts)
+	}
+}
+
+func TestBuildPrecedence(t *testing.T) {
+	cfg, err := config.LoadFrom(config.Sources{LookupEnv: func(k string) (string, bool) {
+		v, ok := map[string]string{"DISCORD_TOKEN": "t", "FEATURE_PREMIUM": "true", "APP_ENV": "staging"}[k]
+		return v, ok
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := &hotconfig.File{
+		Features: map[string]bool{"daily_bonus": true, "analytics": false},
+		Flags:    map[string]hotconfig.Flag{"premium": {Kill: true}},
+	}
+	set := Build(cfg, hot)
+
+	for _, tt := range []struct {
+		key    Key
+		value  bool
+		source string
+	}{
+		{Premium, false, SourceHotConfigFlags},
+		{Analytics, false, SourceHotConfigFeatures},
+		{WebSocket, true, "settings (default)"},
+		{DailyBonus, true, SourceHotConfigFeatures},
+	} {
+		ev := set.Evaluate(EvalContext{UserID: "1"}, tt.key)
+		if ev.Value != tt.value || ev.Source != tt.source {
+			t.Errorf("%s = %+v, want %v from %s", tt.key, ev, tt.value, tt.source)
+		}
+	}
+	if f, _ := set.Flag(Premium); f.Source != SourceHotConfigFlags {
+		t.Errorf("premium defined by %s", f.Source)
+	}
+	if set.environment != "staging" {
+		t.Errorf("environment = %q", set.environment)
+	}
+
+	// Settings alone still give the FEATURE_* flags.
+	if ev := Build(cfg, nil).Evaluate(EvalContext{}, Premium); !ev.Value || ev.Source != "settings (env FEATURE_PREMIUM)" {
+		t.Errorf("premium from settings = %+v", ev)
+	}
+}
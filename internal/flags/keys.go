@@ -0,0 +1,36 @@
+package flags
+
+// Key names a flag. The constants below are the flags the bot defines;
+// hot-config.yaml may define more.
+type Key string
+
+// Flags backed by the features settings (FEATURE_* variables).
+const (
+	Premium      Key = "premium"
+	Analytics    Key = "analytics"
+	WebSocket    Key = "websocket"
+	HealthChecks Key = "health_checks"
+	Metrics      Key = "metrics"
+	OpenSaaS     Key = "opensaas"
+	RateLimiting Key = "rate_limiting"
+)
+
+// Flags in the hot-config.yaml features map.
+const (
+	DailyBonus       Key = "daily_bonus"
+	WorkCommand      Key = "work_command"
+	AdRewards        Key = "ad_rewards"
+	GiftCredits      Key = "gift_credits"
+	CreditTransfer   Key = "credit_transfer"
+	ServerCreation   Key = "server_creation"
+	ServerBackups    Key = "server_backups"
+	ServerScheduling Key = "server_scheduling"
+	PublicLobby      Key = "public_lobby"
+	StripePayments   Key = "stripe_payments"
+	Subscriptions    Key = "subscriptions"
+	GuildSystem      Key = "guild_system"
+	GuildTreasury    Key = "guild_treasury"
+	ClusterCommands  Key = "cluster_commands"
+	DebugMode        Key = "debug_mode"
+	VerboseLogging   Key = "verbose_logging"
+)
@@ -0,0 +1,186 @@
+package flags
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wethegamers/agis/internal/config"
+	"github.com/wethegamers/agis/internal/hotconfig"
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// ExposureRecorder receives exposures to experiment-backed flags. It must
+// not block; ExposureLog queues them.
+type ExposureRecorder interface {
+	RecordExposure(Exposure)
+}
+
+// Service serves flag evaluations from the current sources. Refresh
+// rebuilds the Set when the settings or hot-config change; evaluations
+// in flight keep the snapshot they started with.
+type Service struct {
+	settings func() *config.Config
+	hot      *hotconfig.Source
+	logger   *slog.Logger
+	now      func() time.Time
+
+	current   atomic.Pointer[Set]
+	refreshMu sync.Mutex
+	exposures ExposureRecorder
+}
+
+// NewService builds the flags from settings, which returns the current
+// bot settings (nil if there are none), and hot.
+func NewService(settings func() *config.Config, hot *hotconfig.Source) *Service {
+	s := &Service{settings: settings, hot: hot, logger: slog.Default(), now: time.Now}
+	s.current.Store(s.build())
+	return s
+}
+
+// SetLogger sets the logger used to report flag changes.
+func (s *Service) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SetExposures sets where exposures to experiment-backed flags go.
+// Without it they are not recorded.
+func (s *Service) SetExposures(r ExposureRecorder) {
+	s.exposures = r
+}
+
+func (s *Service) build() *Set {
+	var cfg *config.Config
+	if s.settings != nil {
+		cfg = s.settings()
+	}
+	var hot *hotconfig.File
+	if s.hot != nil {
+		hot = s.hot.Current()
+	}
+	return Build(cfg, hot)
+}
+
+// Current returns the active snapshot.
+func (s *Service) Current() *Set {
+	return s.current.Load()
+}
+
+// Refresh rebuilds the flags from the sources and reports whether any
+// definition changed.
+func (s *Service) Refresh() bool {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	set := s.build()
+	if reflect.DeepEqual(set, s.current.Load()) {
+		return false
+	}
+	s.current.Store(set)
+	s.logger.Info("feature flags updated", "flags", len(set.flags))
+	return true
+}
+
+// Watch re-reads hot-config.yaml every interval and refreshes the flags,
+// until ctx is done. A file that fails to load keeps the previous flags.
+func (s *Service) Watch(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		if s.hot != nil {
+			if err := s.hot.Reload(); err != nil {
+				s.logger.Warn("hot-config reload failed, keeping previous flags", "error", err)
+				continue
+			}
+		}
+		s.Refresh()
+	}
+}
+
+// Evaluate returns key's value for ec. For a flag tied to an experiment,
+// a user the flag was decided for is recorded as exposed.
+func (s *Service) Evaluate(ec EvalContext, key Key) Evaluation {
+	set := s.current.Load()
+	ev := set.Evaluate(ec, key)
+	metrics.FlagEvaluationsTotal.WithLabelValues(string(key), string(ev.Reason)).Inc()
+
+	if s.exposures == nil || ec.UserID == "" || ev.Reason == ReasonKilled || ev.Reason == ReasonUnknown {
+		return ev
+	}
+	if f, _ := set.Flag(key); f.Experiment != "" {
+		s.exposures.RecordExposure(Exposure{
+			Flag:       key,
+			Experiment: f.Experiment,
+			UserID:     ec.UserID,
+			GuildID:    ec.GuildID,
+			Value:      ev.Value,
+			Reason:     ev.Reason,
+			Time:       s.now(),
+		})
+	}
+	return ev
+}
+
+// Enabled reports whether key is on for ec.
+func (s *Service) Enabled(ec EvalContext, key Key) bool {
+	return s.Evaluate(ec, key).Value
+}
+
+// Handler serves GET requests that evaluate every flag, or those named
+// by repeated key parameters, for the context given by the user_id,
+// guild_id, tier and environment parameters, with the reason for each
+// value. Requests must carry "Authorization: Bearer <token>"; with an
+// empty token every request is refused. Evaluations made here are not
+// recorded as exposures.
+func (s *Service) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		q := r.URL.Query()
+		ec := EvalContext{
+			UserID:      q.Get("user_id"),
+			GuildID:     q.Get("guild_id"),
+			Tier:        q.Get("tier"),
+			Environment: q.Get("environment"),
+		}
+		set := s.current.Load()
+		if ec.Environment == "" {
+			ec.Environment = set.environment
+		}
+		var evals []Evaluation
+		if keys := q["key"]; len(keys) > 0 {
+			for _, k := range keys {
+				evals = append(evals, set.Evaluate(ec, Key(k)))
+			}
+		} else {
+			evals = set.EvaluateAll(ec)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"context": ec, "flags": evals})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
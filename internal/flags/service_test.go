@@ -0,0 +1,203 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/wethegamers/agis/internal/hotconfig"
+)
+
+type exposureSink []Exposure
+
+func (s *exposureSink) RecordExposure(e Exposure) { *s = append(*s, e) }
+
+const testHotConfig = `
+features:
+  daily_bonus: true
+flags:
+  new_shop:
+    rollout: 100
+    experiment: shop-redesign
+    rules:
+      - users: ["42"]
+        value: false
+  broken:
+    default: true
+    kill: true
+    experiment: broken-test
+`
+
+func testSource(t *testing.T, data string) (*hotconfig.Source, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hot-config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := hotconfig.NewSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src, path
+}
+
+func TestServiceExposures(t *testing.T) {
+	src, _ := testSource(t, testHotConfig)
+	s := NewService(nil, src)
+	var sink exposureSink
+	s.SetExposures(&sink)
+	s.now = func() time.Time { return time.Unix(100, 0) }
+
+	if !s.Enabled(EvalContext{UserID: "7", GuildID: "g"}, "new_shop") {
+		t.Error("new_shop off for user 7")
+	}
+	if s.Enabled(EvalContext{UserID: "42"}, "new_shop") {
+		t.Error("new_shop on for user 42")
+	}
+	s.Enabled(EvalContext{GuildID: "g"}, "new_shop") // no user: nothing to record
+	s.Enabled(EvalContext{UserID: "7"}, "broken")    // killed: not part of the experiment
+	s.Enabled(EvalContext{UserID: "7"}, DailyBonus)  // no experiment
+
+	want := exposureSink{
+		{Flag: "new_shop", Experiment: "shop-redesign", UserID: "7", GuildID: "g", Value: true, Reason: ReasonRollout, Time: time.Unix(100, 0)},
+		{Flag: "new_shop", Experiment: "shop-redesign", UserID: "42", Value: false, Reason: ReasonRule, Time: time.Unix(100, 0)},
+	}
+	if len(sink) != len(want) || sink[0] != want[0] || sink[1] != want[1] {
+		t.Errorf("exposures = %+v", sink)
+	}
+	if sink[0].Variant() != VariantTreatment || sink[1].Variant() != VariantControl {
+		t.Errorf("variants %s, %s", sink[0].Variant(), sink[1].Variant())
+	}
+}
+
+func TestServiceWatch(t *testing.T) {
+	src, path := testSource(t, testHotConfig)
+	s := NewService(nil, src)
+	if s.Refresh() {
+		t.Error("Refresh reported a change with the same sources")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Watch(ctx, 10*time.Millisecond) }()
+
+	// A file that fails to parse keeps the flags; a fixed one applies.
+	if err := os.WriteFile(path, []byte("flags: [not, a, map]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !s.Enabled(EvalContext{}, DailyBonus) {
+		t.Fatal("invalid file replaced the flags")
+	}
+	if err := os.WriteFile(path, []byte("features: {daily_bonus: false}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Enabled(EvalContext{}, DailyBonus) {
+		if time.Now().After(deadline) {
+			t.Fatal("change not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	src, _ := testSource(t, testHotConfig)
+	s := NewService(nil, src)
+	var sink exposureSink
+	s.SetExposures(&sink)
+	h := s.Handler("secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/flags?user_id=42&tier=premium", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: %d", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Context EvalContext  `json:"context"`
+		Flags   []Evaluation `json:"flags"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Context.UserID != "42" || body.Context.Tier != "premium" || len(body.Flags) != 3 {
+		t.Fatalf("body = %+v", body)
+	}
+	if f := body.Flags[1]; f.Key != "daily_bonus" || !f.Value || f.Reason != ReasonDefault || f.Source != SourceHotConfigFeatures {
+		t.Errorf("daily_bonus = %+v", f)
+	}
+	if f := body.Flags[2]; f.Key != "new_shop" || f.Value || f.Reason != ReasonRule || f.Rule != 1 {
+		t.Errorf("new_shop = %+v", f)
+	}
+	if len(sink) != 0 {
+		t.Errorf("admin evaluations recorded exposures: %+v", sink)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/flags?user_id=7&key=broken&key=nope", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Flags) != 2 || body.Flags[0].Reason != ReasonKilled || body.Flags[1].Reason != ReasonUnknown {
+		t.Errorf("selected flags = %+v", body.Flags)
+	}
+}
+
+func TestExposureLog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l := NewExposureLog(db)
+
+	at := time.Unix(100, 0)
+	e := Exposure{Flag: "new_shop", Experiment: "shop-redesign", UserID: "7", GuildID: "g", Value: true, Reason: ReasonRollout, Time: at}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ab_events")).
+		WithArgs("7", "shop-redesign", VariantTreatment, []byte(`{"flag":"new_shop","guild_id":"g","reason":"rollout"}`), at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ab_events")).
+		WithArgs("7", "shop-redesign", VariantControl, sqlmock.AnyArg(), at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	l.RecordExposure(e)
+	l.RecordExposure(e) // repeat: written once
+	e.Value, e.Reason = false, ReasonDefault
+	l.RecordExposure(e)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
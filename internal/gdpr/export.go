@@ -0,0 +1,193 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Record is one exported row, keyed by column name.
+type Record map[string]any
+
+// Bundle is a subject access export of everything AGIS stores about a user.
+// Retention gives, per section, the basis for keeping it after erasure.
+type Bundle struct {
+	SubjectID   string              `json:"subject_id"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Sections    map[string][]Record `json:"sections"`
+	Retention   map[string]string   `json:"retention,omitempty"`
+}
+
+// section is a named export query. $1 is the Discord ID.
+type section struct {
+	name  string
+	table string
+	query string
+}
+
+// exportSections lists what is exported. Tables that do not exist in the
+// deployment are skipped.
+var exportSections = []section{
+	{"user", "users", `SELECT * FROM users WHERE discord_id = $1`},
+	{"transactions", "credit_transactions",
+		`SELECT * FROM credit_transactions WHERE from_user = $1 OR to_user = $1 ORDER BY created_at`},
+	{"ledger_postings", "ledger_postings", `
+		SELECT p.entry_id, p.currency, p.amount, e.entry_type, e.description, e.created_at
+		FROM ledger_postings p JOIN ledger_entries e ON e.id = p.entry_id
+		WHERE p.account = 'user:' || $1
+		ORDER BY e.created_at, p.entry_id`},
+	{"servers", "game_servers", `SELECT * FROM game_servers WHERE discord_id = $1 ORDER BY created_at`},
+	{"schedules", "server_schedules", `SELECT * FROM server_schedules WHERE discord_id = $1 ORDER BY id`},
+	{"ad_conversions", "ad_conversions", `SELECT * FROM ad_conversions WHERE discord_id = $1 ORDER BY created_at`},
+	{"payments", "payment_transactions", `SELECT * FROM payment_transactions WHERE discord_id = $1 ORDER BY created_at`},
+	{"subscriptions", "subscriptions", `SELECT * FROM subscriptions WHERE discord_id = $1 ORDER BY created_at`},
+	{"consent", "consent_records", `SELECT * FROM consent_records WHERE user_id = $1 ORDER BY created_at`},
+	{"ab_assignments", "ab_assignments", `SELECT * FROM ab_assignments WHERE user_id = $1 ORDER BY assigned_at`},
+	{"ab_events", "ab_events", `SELECT * FROM ab_events WHERE user_id = $1 ORDER BY created_at`},
+	{"audit_log", "audit_log", `
+		SELECT occurred_at, actor, action, target_type, target_id, request_id, ip_address
+		FROM audit_log WHERE actor = $1 OR target_id = $1
+		ORDER BY id`},
+}
+
+// Export collects the user's data from every section.
+func (s *Service) Export(ctx context.Context, discordID string) (*Bundle, error) {
+	tables := make([]string, len(exportSections))
+	for i, sec := range exportSections {
+		tables[i] = sec.table
+	}
+	present, err := existingTables(ctx, s.db, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		SubjectID:   discordID,
+		GeneratedAt: s.now().UTC(),
+		Sections:    make(map[string][]Record, len(exportSections)),
+	}
+	for _, sec := range exportSections {
+		if !present[sec.table] {
+			continue
+		}
+		records, err := queryRecords(ctx, s.db, sec.query, discordID)
+		if err != nil {
+			return nil, fmt.Errorf("gdpr: export %s: %w", sec.name, err)
+		}
+		b.Sections[sec.name] = records
+		if basis, ok := retentionBasis(sec.table); ok {
+			if b.Retention == nil {
+				b.Retention = make(map[string]string)
+			}
+			b.Retention[sec.name] = basis
+		}
+	}
+	if len(b.Sections["user"]) == 0 {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+// queryRecords scans arbitrary rows into column maps so exports keep up
+// with schema changes without code changes.
+func queryRecords(ctx context.Context, q querier, query string, args ...any) ([]Record, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		rec := make(Record, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				rec[col] = string(b)
+			} else {
+				rec[col] = values[i]
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// WriteJSON writes the bundle as a single indented JSON document.
+func (b *Bundle) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// WriteZIP writes one JSON file per section plus a manifest listing the
+// SHA-256 of each file, so the archive can be checked for completeness,
+// and the retention basis of retained sections.
+func (b *Bundle) WriteZIP(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	manifest := struct {
+		SubjectID   string            `json:"subject_id"`
+		GeneratedAt time.Time         `json:"generated_at"`
+		Files       map[string]string `json:"files"`
+		Retention   map[string]string `json:"retention,omitempty"`
+	}{b.SubjectID, b.GeneratedAt, make(map[string]string, len(b.Sections)), b.Retention}
+
+	for _, sec := range exportSections {
+		records, ok := b.Sections[sec.name]
+		if !ok {
+			continue
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("gdpr: encode %s: %w", sec.name, err)
+		}
+		name := sec.name + ".json"
+		if err := writeZipFile(zw, name, data, b.GeneratedAt); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("gdpr: encode manifest: %w", err)
+	}
+	if err := writeZipFile(zw, "manifest.json", data, b.GeneratedAt); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte, modified time.Time) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("gdpr: add %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("gdpr: write %s: %w", name, err)
+	}
+	return nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
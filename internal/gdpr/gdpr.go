@@ -0,0 +1,489 @@
+// Package gdpr provides subject access exports and right-to-erasure
+// handling for AGIS.
+//
+// Erasure is requested by the user and carried out once a cooling-off
+// period has passed, during which it can be cancelled. Personal data with
+// no retention obligation is deleted. Financial records (transactions,
+// payments, ledger postings) are kept for bookkeeping with the Discord ID
+// replaced by a keyed pseudonym. The audit log is kept unchanged, since its
+// entries are hash-chained; the receipt and exports state the basis for
+// keeping it. The user then receives a receipt, signed with HMAC-SHA256,
+// that lists what was erased and what was retained.
+package gdpr
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+// DefaultCoolingOff is how long an erasure request can be cancelled.
+const DefaultCoolingOff = 30 * 24 * time.Hour
+
+// Erasure request statuses.
+const (
+	StatusPending   = "pending"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Errors returned by the GDPR service.
+var (
+	ErrNotFound        = errors.New("gdpr: user not found")
+	ErrNoRequest       = errors.New("gdpr: no erasure request")
+	ErrNotCancellable  = errors.New("gdpr: erasure request can no longer be cancelled")
+	ErrInvalidReceipt  = errors.New("gdpr: receipt signature is invalid")
+	ErrSigningKeyEmpty = errors.New("gdpr: signing key is required")
+)
+
+// ErasureRequest is a row of gdpr_erasure_requests.
+type ErasureRequest struct {
+	ID           int64      `json:"id"`
+	SubjectHash  string     `json:"subject_hash"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Receipt      *Receipt   `json:"receipt,omitempty"`
+}
+
+// Service exports and erases user data.
+type Service struct {
+	db          *sql.DB
+	key         []byte
+	coolingOff  time.Duration
+	beforeErase func(ctx context.Context, discordID string) error
+	audit       audit.Recorder
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+// NewService creates a GDPR service. The key derives pseudonyms and signs
+// erasure receipts; it must stay stable across restarts.
+func NewService(db *sql.DB, key []byte, logger *slog.Logger) (*Service, error) {
+	if len(key) == 0 {
+		return nil, ErrSigningKeyEmpty
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Service{
+		db:         db,
+		key:        key,
+		coolingOff: DefaultCoolingOff,
+		logger:     logger,
+		now:        time.Now,
+	}, nil
+}
+
+// SetCoolingOff overrides the cooling-off period for new requests.
+func (s *Service) SetCoolingOff(d time.Duration) {
+	s.coolingOff = d
+}
+
+// SetBeforeErase registers a hook run before a user's data is erased, for
+// example to stop their running servers. An error postpones the erasure to
+// the next run.
+func (s *Service) SetBeforeErase(fn func(ctx context.Context, discordID string) error) {
+	s.beforeErase = fn
+}
+
+// SetAuditLog records completed erasures in the audit log, keyed by
+// subject hash.
+func (s *Service) SetAuditLog(r audit.Recorder) {
+	s.audit = r
+}
+
+// SubjectHash identifies a user in erasure records without storing the
+// Discord ID. Anyone holding the ID can recompute it.
+func SubjectHash(discordID string) string {
+	sum := sha256.Sum256([]byte(discordID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Pseudonym returns the ID that replaces discordID in retained records. It
+// is keyed so that guessable Discord IDs cannot be matched back to it.
+func (s *Service) Pseudonym(discordID string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("pseudonym:" + discordID))
+	return "erased-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// RequestErasure schedules erasure of the user's data after the cooling-off
+// period. An existing pending request is returned unchanged.
+func (s *Service) RequestErasure(ctx context.Context, discordID string) (*ErasureRequest, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE discord_id = $1)`, discordID,
+	).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("gdpr: lookup user: %w", err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	now := s.now().UTC()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO gdpr_erasure_requests (subject_hash, discord_id, status, requested_at, scheduled_for)
+		VALUES ($1, $2, 'pending', $3, $4)
+		ON CONFLICT (subject_hash) WHERE status = 'pending' DO NOTHING`,
+		SubjectHash(discordID), discordID, now, now.Add(s.coolingOff))
+	if err != nil {
+		return nil, fmt.Errorf("gdpr: request erasure: %w", err)
+	}
+	return s.ErasureStatus(ctx, discordID)
+}
+
+// CancelErasure withdraws a pending erasure request.
+func (s *Service) CancelErasure(ctx context.Context, discordID string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE gdpr_erasure_requests SET status = 'cancelled', cancelled_at = $2
+		WHERE subject_hash = $1 AND status = 'pending'`,
+		SubjectHash(discordID), s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("gdpr: cancel erasure: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.ErasureStatus(ctx, discordID); err != nil {
+			return err
+		}
+		return ErrNotCancellable
+	}
+	return nil
+}
+
+// ErasureStatus returns the user's most recent erasure request, including
+// the receipt once it has completed.
+func (s *Service) ErasureStatus(ctx context.Context, discordID string) (*ErasureRequest, error) {
+	var (
+		req                    ErasureRequest
+		cancelledAt, completed sql.NullTime
+		receipt                []byte
+		signature              sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, subject_hash, status, requested_at, scheduled_for, cancelled_at, completed_at,
+		       receipt, receipt_signature
+		FROM gdpr_erasure_requests
+		WHERE subject_hash = $1
+		ORDER BY requested_at DESC, id DESC
+		LIMIT 1`, SubjectHash(discordID),
+	).Scan(&req.ID, &req.SubjectHash, &req.Status, &req.RequestedAt, &req.ScheduledFor,
+		&cancelledAt, &completed, &receipt, &signature)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRequest
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gdpr: erasure status: %w", err)
+	}
+	if cancelledAt.Valid {
+		req.CancelledAt = &cancelledAt.Time
+	}
+	if completed.Valid {
+		req.CompletedAt = &completed.Time
+	}
+	if len(receipt) > 0 {
+		var r Receipt
+		if err := json.Unmarshal(receipt, &r); err != nil {
+			return nil, fmt.Errorf("gdpr: decode receipt: %w", err)
+		}
+		r.Signature = signature.String
+		req.Receipt = &r
+	}
+	return &req, nil
+}
+
+// ProcessDue erases the data of every user whose cooling-off period has
+// ended. Failures are logged and retried on the next run.
+func (s *Service) ProcessDue(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, discord_id, requested_at FROM gdpr_erasure_requests
+		WHERE status = 'pending' AND scheduled_for <= $1
+		ORDER BY scheduled_for`, s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("gdpr: list due erasures: %w", err)
+	}
+	type due struct {
+		id          int64
+		discordID   string
+		requestedAt time.Time
+	}
+	var pending []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.discordID, &d.requestedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("gdpr: scan due erasure: %w", err)
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("gdpr: list due erasures: %w", err)
+	}
+
+	for _, d := range pending {
+		if _, err := s.erase(ctx, d.id, d.discordID, d.requestedAt); err != nil {
+			s.logger.Error("erasure failed", "request_id", d.id, "error", err)
+		}
+	}
+	return nil
+}
+
+// Run processes due erasures every hour until ctx is cancelled. It is
+// intended for app.NewBackgroundService.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := s.ProcessDue(ctx); err != nil {
+			s.logger.Error("erasure run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// erase carries out one erasure request in a single transaction and
+// stores the signed receipt.
+func (s *Service) erase(ctx context.Context, requestID int64, discordID string, requestedAt time.Time) (*Receipt, error) {
+	if s.beforeErase != nil {
+		if err := s.beforeErase(ctx, discordID); err != nil {
+			return nil, fmt.Errorf("gdpr: before erase: %w", err)
+		}
+	}
+
+	tables := make([]string, 0, len(erasureSteps)+len(retainedTables))
+	for _, step := range erasureSteps {
+		tables = append(tables, step.table)
+	}
+	for _, r := range retainedTables {
+		tables = append(tables, r.table)
+	}
+
+	pseudonym := s.Pseudonym(discordID)
+	receipt := &Receipt{
+		RequestID:   requestID,
+		SubjectHash: SubjectHash(discordID),
+		Pseudonym:   pseudonym,
+		RequestedAt: requestedAt.UTC(),
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		present, err := existingTables(ctx, tx, tables)
+		if err != nil {
+			return err
+		}
+		for _, step := range erasureSteps {
+			if !present[step.table] {
+				continue
+			}
+			res, err := tx.ExecContext(ctx, step.query, discordID, pseudonym)
+			if err != nil {
+				return fmt.Errorf("gdpr: erase %s: %w", step.table, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("gdpr: erase %s: %w", step.table, err)
+			}
+			receipt.Actions = append(receipt.Actions, Action{Table: step.table, Action: step.action, Rows: n})
+		}
+		for _, r := range retainedTables {
+			if !present[r.table] {
+				continue
+			}
+			var n int64
+			if err := tx.QueryRowContext(ctx, r.count, discordID).Scan(&n); err != nil {
+				return fmt.Errorf("gdpr: count retained %s: %w", r.table, err)
+			}
+			receipt.Retained = append(receipt.Retained, Retention{Table: r.table, Basis: r.basis, Rows: n})
+		}
+
+		receipt.ErasedAt = s.now().UTC()
+		body, sig, err := s.sign(receipt)
+		if err != nil {
+			return err
+		}
+		receipt.Signature = sig
+		_, err = tx.ExecContext(ctx, `
+			UPDATE gdpr_erasure_requests
+			SET status = 'completed', completed_at = $2, discord_id = NULL,
+			    pseudonym = $3, receipt = $4, receipt_signature = $5
+			WHERE id = $1 AND status = 'pending'`,
+			requestID, receipt.ErasedAt, pseudonym, body, sig)
+		if err != nil {
+			return fmt.Errorf("gdpr: complete erasure: %w", err)
+		}
+		if s.audit == nil {
+			return nil
+		}
+		_, err = s.audit.RecordTx(ctx, tx, audit.Event{
+			Actor:  audit.SystemActor,
+			Action: "gdpr.erasure_completed",
+			Target: audit.Target{Type: "gdpr_subject", ID: receipt.SubjectHash},
+			After: map[string]any{
+				"request_id": requestID,
+				"pseudonym":  pseudonym,
+				"actions":    receipt.Actions,
+				"retained":   receipt.Retained,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("erasure completed", "request_id", requestID, "pseudonym", pseudonym)
+	return receipt, nil
+}
+
+// Erasure actions recorded on receipts.
+const (
+	ActionDeleted       = "deleted"
+	ActionPseudonymised = "pseudonymised"
+)
+
+// erasureStep is one statement of an erasure. $1 is the Discord ID and $2
+// the pseudonym.
+type erasureStep struct {
+	table  string
+	action string
+	query  string
+}
+
+// erasureSteps run in order. The tombstone user row is created before
+// financial records are re-pointed at it so foreign keys to users hold, and
+// the original row is deleted last.
+var erasureSteps = []erasureStep{
+	// Personal data with no retention obligation.
+	{"consent_records", ActionDeleted, `DELETE FROM consent_records WHERE user_id = $1`},
+	{"ab_events", ActionDeleted, `DELETE FROM ab_events WHERE user_id = $1`},
+	{"ab_assignments", ActionDeleted, `DELETE FROM ab_assignments WHERE user_id = $1`},
+	{"server_schedules", ActionDeleted, `DELETE FROM server_schedules WHERE discord_id = $1`},
+	{"api_keys", ActionDeleted, `DELETE FROM api_keys WHERE discord_id = $1`},
+	{"user_stats", ActionDeleted, `DELETE FROM user_stats WHERE discord_id = $1`},
+	{"webhook_subscriptions", ActionDeleted, `
+		DELETE FROM webhook_subscriptions WHERE owner_type = 'user' AND owner_id = $1`},
+
+	// Tombstone carrying the balances so the ledger user cache still agrees.
+	{"users", ActionPseudonymised, `
+		INSERT INTO users (discord_id, credits, wtg_coins)
+		SELECT $2, COALESCE(credits, 0), COALESCE(wtg_coins, 0) FROM users WHERE discord_id = $1
+		ON CONFLICT (discord_id) DO NOTHING`},
+
+	// Financial records, kept under the pseudonym.
+	{"credit_transactions", ActionPseudonymised, `
+		UPDATE credit_transactions
+		SET from_user = CASE WHEN from_user = $1 THEN $2 ELSE from_user END,
+		    to_user = CASE WHEN to_user = $1 THEN $2 ELSE to_user END,
+		    description = replace(description, $1, $2)
+		WHERE from_user = $1 OR to_user = $1`},
+	{"payment_transactions", ActionPseudonymised, `UPDATE payment_transactions SET discord_id = $2 WHERE discord_id = $1`},
+	{"subscriptions", ActionPseudonymised, `UPDATE subscriptions SET discord_id = $2 WHERE discord_id = $1`},
+	{"ad_conversions", ActionPseudonymised, `
+		UPDATE ad_conversions SET discord_id = $2, ip_address = NULL, user_agent = NULL
+		WHERE discord_id = $1`},
+	{"game_servers", ActionPseudonymised, `
+		UPDATE game_servers SET discord_id = $2, name = 'erased-' || id WHERE discord_id = $1`},
+	{"ledger_postings", ActionPseudonymised, `
+		UPDATE ledger_postings SET account = 'user:' || $2 WHERE account = 'user:' || $1`},
+	{"ledger_balances", ActionPseudonymised, `
+		UPDATE ledger_balances SET account = 'user:' || $2 WHERE account = 'user:' || $1`},
+	{"ledger_entries", ActionPseudonymised, `
+		UPDATE ledger_entries
+		SET created_by = CASE WHEN created_by = $1 THEN $2 ELSE created_by END,
+		    description = replace(description, $1, $2)
+		WHERE created_by = $1 OR description LIKE '%' || $1 || '%'`},
+	{"treasury_transactions", ActionPseudonymised, `
+		UPDATE treasury_transactions
+		SET created_by = CASE WHEN created_by = $1 THEN $2 ELSE created_by END,
+		    description = replace(description, $1, $2)
+		WHERE created_by = $1 OR description LIKE '%' || $1 || '%'`},
+	{"server_provision_requests", ActionPseudonymised, `
+		UPDATE server_provision_requests
+		SET requested_by = CASE WHEN requested_by = $1 THEN $2 ELSE requested_by END,
+		    approved_by = CASE WHEN approved_by = $1 THEN $2 ELSE approved_by END
+		WHERE requested_by = $1 OR approved_by = $1`},
+
+	{"users", ActionDeleted, `DELETE FROM users WHERE discord_id = $1`},
+}
+
+// AuditLogBasis is why erasure keeps the subject's audit log entries.
+const AuditLogBasis = "Kept under GDPR Art. 17(3)(b) and (e): the audit log is the tamper-evident " +
+	"record of payments, treasury movements and admin actions, needed to meet bookkeeping " +
+	"obligations and to establish or defend legal claims. Its entries are hash-chained and " +
+	"cannot be altered without breaking the chain."
+
+// retainedTable is a table erasure leaves unchanged. count returns the
+// number of the subject's rows; $1 is the Discord ID.
+type retainedTable struct {
+	table string
+	basis string
+	count string
+}
+
+// retainedTables are reported on receipts and in exports with their basis.
+var retainedTables = []retainedTable{
+	{"audit_log", AuditLogBasis, `SELECT COUNT(*) FROM audit_log WHERE actor = $1 OR target_id = $1`},
+}
+
+// retentionBasis returns the basis for keeping table through erasure.
+func retentionBasis(table string) (string, bool) {
+	for _, r := range retainedTables {
+		if r.table == table {
+			return r.basis, true
+		}
+	}
+	return "", false
+}
+
+// existingTables reports which of the named tables exist in the current
+// schema, since some are owned by optional components.
+func existingTables(ctx context.Context, q querier, names []string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = ANY($1)`, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("gdpr: list tables: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool, len(names))
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("gdpr: list tables: %w", err)
+		}
+		present[name] = true
+	}
+	return present, rows.Err()
+}
+
+func (s *Service) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("gdpr: begin: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("gdpr: commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	svc, err := NewService(db, []byte("test-key"), nil)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	svc.now = func() time.Time { return testNow }
+	return svc, mock
+}
+
+func expectTables(mock sqlmock.Sqlmock, names ...string) {
+	rows := sqlmock.NewRows([]string{"table_name"})
+	for _, n := range names {
+		rows.AddRow(n)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM information_schema.tables`)).WillReturnRows(rows)
+}
+
+func TestExportSkipsMissingTables(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectTables(mock, "users", "consent_records")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM users WHERE discord_id = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"discord_id", "credits", "tier"}).AddRow("u1", 500, []byte("free")))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM consent_records WHERE user_id = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"consent_type", "consented"}).AddRow("ads", true))
+
+	b, err := svc.Export(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.Sections) != 2 {
+		t.Fatalf("expected 2 sections, got %v", b.Sections)
+	}
+	if tier := b.Sections["user"][0]["tier"]; tier != "free" {
+		t.Errorf("expected bytes converted to string, got %#v", tier)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportStatesAuditLogRetention(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectTables(mock, "users", "audit_log")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM users WHERE discord_id = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"discord_id"}).AddRow("u1"))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM audit_log WHERE actor = $1 OR target_id = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"actor", "action", "ip_address"}).AddRow("u1", "treasury.contribute", "203.0.113.7"))
+
+	b, err := svc.Export(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.Sections["audit_log"]) != 1 {
+		t.Errorf("expected audit log entries exported, got %v", b.Sections["audit_log"])
+	}
+	if len(b.Retention) != 1 || b.Retention["audit_log"] != AuditLogBasis {
+		t.Errorf("expected audit log retention basis, got %v", b.Retention)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportUnknownUser(t *testing.T) {
+	svc, mock := newTestService(t)
+	expectTables(mock, "users")
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users`)).WillReturnRows(sqlmock.NewRows([]string{"discord_id"}))
+
+	if _, err := svc.Export(context.Background(), "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWriteZIPManifest(t *testing.T) {
+	b := &Bundle{SubjectID: "u1", GeneratedAt: testNow, Sections: map[string][]Record{
+		"user":    {{"discord_id": "u1"}},
+		"servers": {},
+	}}
+	var buf bytes.Buffer
+	if err := b.WriteZIP(&buf); err != nil {
+		t.Fatalf("WriteZIP: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var manifest struct {
+		Files map[string]string `json:"files"`
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("expected 2 files in manifest, got %v", manifest.Files)
+	}
+	for name, want := range manifest.Files {
+		sum := sha256.Sum256(files[name])
+		if hex.EncodeToString(sum[:]) != want {
+			t.Errorf("checksum mismatch for %s", name)
+		}
+	}
+}
+
+func TestPseudonymIsStableAndKeyed(t *testing.T) {
+	svc, _ := newTestService(t)
+	p := svc.Pseudonym("123456789")
+	if p != svc.Pseudonym("123456789") {
+		t.Error("expected stable pseudonym")
+	}
+	if len(p) > 32 {
+		t.Errorf("pseudonym %q does not fit discord_id", p)
+	}
+	other, _ := NewService(nil, []byte("other-key"), nil)
+	if p == other.Pseudonym("123456789") {
+		t.Error("expected pseudonym to depend on the key")
+	}
+}
+
+func TestRequestErasureSchedulesAfterCoolingOff(t *testing.T) {
+	svc, mock := newTestService(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS`)).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO gdpr_erasure_requests`)).
+		WithArgs(SubjectHash("u1"), "u1", testNow, testNow.Add(DefaultCoolingOff)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM gdpr_erasure_requests`)).
+		WithArgs(SubjectHash("u1")).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "subject_hash", "status", "requested_at", "scheduled_for", "cancelled_at", "completed_at",
+			"receipt", "receipt_signature",
+		}).AddRow(1, SubjectHash("u1"), StatusPending, testNow, testNow.Add(DefaultCoolingOff), nil, nil, nil, nil))
+
+	req, err := svc.RequestErasure(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Status != StatusPending || !req.ScheduledFor.Equal(testNow.Add(DefaultCoolingOff)) {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEraseIssuesVerifiableReceipt(t *testing.T) {
+	svc, mock := newTestService(t)
+	pseudonym := svc.Pseudonym("u1")
+
+	mock.ExpectBegin()
+	expectTables(mock, "users", "consent_records", "credit_transactions", "audit_log")
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM consent_records`)).
+		WithArgs("u1", pseudonym).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users`)).
+		WithArgs("u1", pseudonym).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE credit_transactions`)).
+		WithArgs("u1", pseudonym).WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users`)).
+		WithArgs("u1", pseudonym).WillReturnResult(sqlmock.NewResult(0, 1))
+	// The audit log is never updated, only counted for the receipt.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM audit_log WHERE actor = $1 OR target_id = $1`)).
+		WithArgs("u1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectExec(regexp.QuoteMeta(`SET status = 'completed'`)).
+		WithArgs(int64(9), testNow, pseudonym, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	receipt, err := svc.erase(context.Background(), 9, "u1", testNow.Add(-DefaultCoolingOff))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(receipt.Actions) != 4 || receipt.Actions[2].Rows != 7 {
+		t.Errorf("unexpected actions %+v", receipt.Actions)
+	}
+	if len(receipt.Retained) != 1 || receipt.Retained[0] != (Retention{Table: "audit_log", Basis: AuditLogBasis, Rows: 5}) {
+		t.Errorf("expected audit log retention, got %+v", receipt.Retained)
+	}
+	if err := svc.VerifyReceipt(*receipt); err != nil {
+		t.Errorf("expected valid receipt: %v", err)
+	}
+
+	// Round-trip through JSON as the user would store it, then tamper.
+	data, _ := json.Marshal(receipt)
+	var stored Receipt
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.VerifyReceipt(stored); err != nil {
+		t.Errorf("expected stored receipt to verify: %v", err)
+	}
+	stored.Actions[2].Rows = 0
+	if err := svc.VerifyReceipt(stored); !errors.Is(err, ErrInvalidReceipt) {
+		t.Errorf("expected tampered receipt to fail, got %v", err)
+	}
+	stored.Actions[2].Rows = 7
+	stored.Retained = nil
+	if err := svc.VerifyReceipt(stored); !errors.Is(err, ErrInvalidReceipt) {
+		t.Errorf("expected receipt without retention to fail, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEraseHookPostpones(t *testing.T) {
+	svc, mock := newTestService(t)
+	svc.SetBeforeErase(func(ctx context.Context, discordID string) error {
+		return errors.New("servers still running")
+	})
+
+	if _, err := svc.erase(context.Background(), 9, "u1", testNow); err == nil {
+		t.Error("expected hook error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,64 @@
+package gdpr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Action is one line of an erasure receipt.
+type Action struct {
+	Table  string `json:"table"`
+	Action string `json:"action"`
+	Rows   int64  `json:"rows"`
+}
+
+// Retention is a table an erasure left unchanged, with the legal basis for
+// keeping the subject's rows in it.
+type Retention struct {
+	Table string `json:"table"`
+	Basis string `json:"basis"`
+	Rows  int64  `json:"rows"`
+}
+
+// Receipt records what an erasure did. The signature covers every other
+// field, so a receipt presented later can be checked with VerifyReceipt.
+type Receipt struct {
+	RequestID   int64       `json:"request_id"`
+	SubjectHash string      `json:"subject_hash"`
+	Pseudonym   string      `json:"pseudonym"`
+	RequestedAt time.Time   `json:"requested_at"`
+	ErasedAt    time.Time   `json:"erased_at"`
+	Actions     []Action    `json:"actions"`
+	Retained    []Retention `json:"retained,omitempty"`
+	Signature   string      `json:"signature,omitempty"`
+}
+
+// sign returns the canonical receipt body and its hex HMAC-SHA256.
+func (s *Service) sign(r *Receipt) ([]byte, string, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+	body, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, "", fmt.Errorf("gdpr: encode receipt: %w", err)
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(body)
+	return body, hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyReceipt checks that the receipt was issued by this service and has
+// not been altered.
+func (s *Service) VerifyReceipt(r Receipt) error {
+	_, want, err := s.sign(&r)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(want), []byte(r.Signature)) {
+		return ErrInvalidReceipt
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Package hotconfig provides a typed, read-only view of hot-config.yaml for AGIS.
+//
+// The agis-core hot-config manager owns watching the file and serving bot
+// commands. Internal services that only need the game, pricing and feature
+// sections (for example server templates) load them through this package so
+// they do not depend on the manager's lifecycle.
+package hotconfig
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/wethegamers/agis/internal/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the subset of hot-config.yaml used by internal services. Unknown
+// sections (commands, messages, ...) are ignored.
+type File struct {
+	Games      map[string]Game `yaml:"games" json:"games"`
+	Pricing    Pricing         `yaml:"pricing" json:"pricing"`
+	Features   map[string]bool `yaml:"features" json:"features"`
+	Flags      map[string]Flag `yaml:"flags" json:"flags,omitempty"`
+	RateLimits RateLimits      `yaml:"rate_limits" json:"rate_limits"`
+}
+
+// Game is a per-game definition under games.
+type Game struct {
+	Name               string            `yaml:"name" json:"name"`
+	Enabled            bool              `yaml:"enabled" json:"enabled"`
+	Description        string            `yaml:"description" json:"description"`
+	Image              string            `yaml:"image" json:"image"`
+	ImageTag           string            `yaml:"image_tag" json:"image_tag"`
+	Tier               string            `yaml:"tier" json:"tier"`
+	BaseCostPerHour    int               `yaml:"base_cost_per_hour" json:"base_cost_per_hour"`
+	DefaultSlots       int               `yaml:"default_slots" json:"default_slots"`
+	MaxSlots           int               `yaml:"max_slots" json:"max_slots"`
+	WarmPoolSize       int               `yaml:"warm_pool_size" json:"warm_pool_size"`
+	GracePeriodMinutes int               `yaml:"grace_period_minutes" json:"grace_period_minutes"`
+	RequiresGuild      bool              `yaml:"requires_guild" json:"requires_guild"`
+	AgonesFleetName    string            `yaml:"agones_fleet_name" json:"agones_fleet_name,omitempty"`
+	Resources          Resources         `yaml:"resources" json:"resources"`
+	Ports              []Port            `yaml:"ports" json:"ports"`
+	Environment        map[string]string `yaml:"environment" json:"environment,omitempty"`
+}
+
+// ImageRef returns image:tag, defaulting the tag to latest.
+func (g Game) ImageRef() string {
+	if g.Image == "" {
+		return ""
+	}
+	tag := g.ImageTag
+	if tag == "" {
+		tag = "latest"
+	}
+	return g.Image + ":" + tag
+}
+
+// Resources are Kubernetes resource requests and limits as quantity strings.
+type Resources struct {
+	RequestsCPU    string `yaml:"requests_cpu" json:"requests_cpu"`
+	RequestsMemory string `yaml:"requests_memory" json:"requests_memory"`
+	LimitsCPU      string `yaml:"limits_cpu" json:"limits_cpu"`
+	LimitsMemory   string `yaml:"limits_memory" json:"limits_memory"`
+}
+
+// Port is a container port exposed by a game server.
+type Port struct {
+	Name     string `yaml:"name" json:"name"`
+	Port     int    `yaml:"port" json:"port"`
+	Protocol string `yaml:"protocol" json:"protocol"`
+}
+
+// Pricing holds the global pricing rules.
+type Pricing struct {
+	BaseMultiplier  float64     `yaml:"base_multiplier" json:"base_multiplier"`
+	PremiumDiscount float64     `yaml:"premium_discount" json:"premium_discount"`
+	GuildDiscount   float64     `yaml:"guild_discount" json:"guild_discount"`
+	PeakHours       []PeakHour  `yaml:"peak_hours" json:"peak_hours,omitempty"`
+	Promotions      []Promotion `yaml:"promotions" json:"promotions,omitempty"`
+}
+
+// PeakHour multiplies prices between StartHour and EndHour on Days
+// (0 = Sunday; empty means every day).
+type PeakHour struct {
+	Name       string  `yaml:"name" json:"name"`
+	StartHour  int     `yaml:"start_hour" json:"start_hour"`
+	EndHour    int     `yaml:"end_hour" json:"end_hour"`
+	Multiplier float64 `yaml:"multiplier" json:"multiplier"`
+	Days       []int   `yaml:"days" json:"days,omitempty"`
+}
+
+// Promotion discounts Games (empty means all) between StartDate and
+// EndDate, RFC 3339 times.
+type Promotion struct {
+	Name      string   `yaml:"name" json:"name"`
+	Games     []string `yaml:"games" json:"games,omitempty"`
+	Discount  float64  `yaml:"discount" json:"discount"`
+	StartDate string   `yaml:"start_date" json:"start_date"`
+	EndDate   string   `yaml:"end_date" json:"end_date"`
+	Code      string   `yaml:"code" json:"code,omitempty"`
+}
+
+// Flag is a targeted feature flag under flags. Unlike the on/off
+// features map, a flag is evaluated per user, guild, tier and environment
+// by internal/flags: Kill forces it off, then the first matching rule
+// decides, then Rollout, then Default.
+type Flag struct {
+	Description string `yaml:"description" json:"description,omitempty"`
+	Default     bool   `yaml:"default" json:"default"`
+	Kill        bool   `yaml:"kill" json:"kill,omitempty"`
+	// Rollout is the percentage (0-100) of users, or guilds with
+	// bucket_by: guild, that no rule matched who get the flag.
+	Rollout  *float64   `yaml:"rollout" json:"rollout,omitempty"`
+	BucketBy string     `yaml:"bucket_by" json:"bucket_by,omitempty"`
+	Rules    []FlagRule `yaml:"rules" json:"rules,omitempty"`
+	// Experiment is an ab_experiments ID; users the flag is evaluated for
+	// are recorded as exposed to its control or treatment variant.
+	Experiment string `yaml:"experiment" json:"experiment,omitempty"`
+}
+
+// FlagRule serves Value to contexts matching every condition it sets.
+// Each condition lists the accepted values. With Rollout, only that
+// percentage of matching contexts get Value; the rest fall through to the
+// next rule.
+type FlagRule struct {
+	Users        []string `yaml:"users" json:"users,omitempty"`
+	Guilds       []string `yaml:"guilds" json:"guilds,omitempty"`
+	Tiers        []string `yaml:"tiers" json:"tiers,omitempty"`
+	Environments []string `yaml:"environments" json:"environments,omitempty"`
+	Value        bool     `yaml:"value" json:"value"`
+	Rollout      *float64 `yaml:"rollout" json:"rollout,omitempty"`
+}
+
+// RateLimits holds abuse-prevention limits.
+type RateLimits struct {
+	CommandsPerMinute       int `yaml:"commands_per_minute" json:"commands_per_minute"`
+	ServerCreationsPerHour  int `yaml:"server_creations_per_hour" json:"server_creations_per_hour"`
+	GiftsPerDay             int `yaml:"gifts_per_day" json:"gifts_per_day"`
+	MaxActiveServers        int `yaml:"max_active_servers" json:"max_active_servers"`
+	PremiumMaxActiveServers int `yaml:"premium_max_active_servers" json:"premium_max_active_servers"`
+}
+
+// Parse decodes hot-config YAML.
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("hotconfig: parse: %w", err)
+	}
+	return &f, nil
+}
+
+// Load reads and decodes a hot-config file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("hotconfig: read %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Source serves the most recently loaded hot-config. It is safe for
+// concurrent use; Reload swaps the snapshot atomically.
+type Source struct {
+	path    string
+	current atomic.Pointer[File]
+}
+
+// NewSource loads path and returns a Source serving it. The initial load
+// is not linted, so a file with problems still starts; callers report
+// them with Lint.
+func NewSource(path string) (*Source, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{path: path}
+	s.current.Store(f)
+	return s, nil
+}
+
+// StaticSource returns a Source that always serves f. Reload is a no-op.
+func StaticSource(f *File) *Source {
+	s := &Source{}
+	s.current.Store(f)
+	return s
+}
+
+// Reload re-reads the file and admits it only if Check finds no
+// problems. On error the previous snapshot is kept.
+func (s *Source) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		metrics.HotConfigReloadsTotal.WithLabelValues("failed").Inc()
+		return fmt.Errorf("hotconfig: read %s: %w", s.path, err)
+	}
+	f, err := Check(data)
+	if err != nil {
+		metrics.HotConfigReloadsTotal.WithLabelValues("rejected").Inc()
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	metrics.HotConfigReloadsTotal.WithLabelValues("admitted").Inc()
+	s.current.Store(f)
+	return nil
+}
+
+// Current returns the active snapshot.
+func (s *Source) Current() *File {
+	if f := s.current.Load(); f != nil {
+		return f
+	}
+	return &File{}
+}
+
+// Game returns the definition for a game type.
+func (s *Source) Game(gameType string) (Game, bool) {
+	g, ok := s.Current().Games[gameType]
+	return g, ok
+}
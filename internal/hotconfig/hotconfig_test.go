@@ -0,0 +1,226 @@
+package hotconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRepositoryConfig(t *testing.T) {
+	f, err := Load(filepath.Join("..", "..", "configs", "hot-config.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	mc, ok := f.Games["minecraft"]
+	if !ok {
+		t.Fatal("expected minecraft game definition")
+	}
+	if mc.Resources.RequestsCPU != "500m" || mc.Resources.LimitsMemory != "4Gi" {
+		t.Errorf("unexpected minecraft resources: %+v", mc.Resources)
+	}
+	if mc.ImageRef() != "itzg/minecraft-server:latest" {
+		t.Errorf("unexpected image ref %q", mc.ImageRef())
+	}
+	if !f.Features["guild_treasury"] {
+		t.Error("expected guild_treasury feature to be enabled")
+	}
+	if f.Pricing.GuildDiscount != 0.05 {
+		t.Errorf("unexpected guild discount %v", f.Pricing.GuildDiscount)
+	}
+}
+
+func TestSourceReloadKeepsSnapshotOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hot-config.yaml")
+	if err := os.WriteFile(path, []byte("games:\n  terraria:\n    enabled: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewSource(path)
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("games: [not a map"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Reload(); err == nil {
+		t.Fatal("expected reload error for invalid YAML")
+	}
+	if g, ok := src.Game("terraria"); !ok || !g.Enabled {
+		t.Error("expected previous snapshot to be kept")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f, err := Load(filepath.Join("..", "..", "configs", "hot-config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("repository config should be valid: %v", err)
+	}
+
+	bad, err := Parse([]byte(`
+games:
+  rust:
+    name: Rust
+    enabled: true
+    image: rust
+    base_cost_per_hour: 0
+    default_slots: 200
+    max_slots: 100
+    resources:
+      requests_cpu: "4"
+      limits_cpu: "2"
+      requests_memory: lots
+    ports:
+      - {name: game, port: 70000, protocol: UDP}
+      - {name: game, port: 28016, protocol: SCTP}
+pricing:
+  guild_discount: 1.5
+features:
+  daily_bonus: true
+flags:
+  daily_bonus: {default: true}
+  new_shop:
+    rollout: 150
+    bucket_by: server
+    rules:
+      - value: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bad.Validate()
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	for _, want := range []string{
+		"games.rust.base_cost_per_hour",
+		"games.rust.default_slots: 200 exceeds max_slots 100",
+		"games.rust.resources.requests_cpu: 4 exceeds limits_cpu 2",
+		`games.rust.resources.requests_memory: "lots" is not a quantity`,
+		"games.rust.ports[0].port",
+		"games.rust.ports[1].protocol",
+		`games.rust.ports[1].name: duplicate port name "game"`,
+		"pricing.guild_discount",
+		"flags.daily_bonus: is also defined under features",
+		"flags.new_shop.rollout: must be between 0 and 100, got 150",
+		`flags.new_shop.bucket_by: must be user or guild, got "server"`,
+		"flags.new_shop.rules[0]: needs a condition or a rollout",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "configs", "hot-config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := Lint(data); len(problems) > 0 {
+		t.Errorf("repository config has problems: %v", problems)
+	}
+
+	problems := Lint([]byte(`games:
+  rust:
+    name: Rust
+    enabled: true
+    imgae: rust
+    tier: epic
+    base_cost_per_hour: -5
+    default_slots: 200
+    max_slots: 100
+    resources:
+      requests_cpu: "4"
+      limits_cpu: "2"
+    ports:
+      - {name: game, port: 28015, protocol: UDP}
+      - {name: rcon, port: 28015, protocol: TCPUDP}
+      - {name: query, port: 28017, protocol: SCTP}
+pricing:
+  promotions:
+    - name: Holiday
+      games: [rust, minecraft]
+      discount: 0.25
+      start_date: "2025-12-31T00:00:00Z"
+      end_date: "2025-12-20"
+    - name: Spring
+      discount: 0.1
+      start_date: "2026-04-10T00:00:00Z"
+      end_date: "2026-04-01T00:00:00Z"
+rate_limit:
+  commands_per_minute: 30
+`))
+	want := []string{
+		"3:5: games.rust.image: is required for enabled games",
+		`5:5: games.rust.imgae: unknown key (did you mean "image"?)`,
+		`6:11: games.rust.tier: must be one of solo, moderate, premium, titan, got "epic"`,
+		"7:25: games.rust.base_cost_per_hour: must be at least 0, got -5",
+		"8:20: games.rust.default_slots: 200 exceeds max_slots 100",
+		"11:21: games.rust.resources.requests_cpu: 4 exceeds limits_cpu 2",
+		"15:28: games.rust.ports[1].port: 28015/UDP is also used by ports[0]",
+		`16:46: games.rust.ports[2].protocol: must be one of TCP, UDP, TCPUDP, got "SCTP"`,
+		`20:21: pricing.promotions[0].games[1]: unknown game "minecraft"`,
+		`23:17: pricing.promotions[0].end_date: "2025-12-20" is not an RFC 3339 date-time`,
+		"27:17: pricing.promotions[1].end_date: 2026-04-01T00:00:00Z is not after start_date 2026-04-10T00:00:00Z",
+		`28:1: rate_limit: unknown key (did you mean "rate_limits"?)`,
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems, want %d:\n%s", len(problems), len(want), joinProblems(problems))
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(problems[i].Error(), w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, problems[i], w)
+		}
+	}
+
+	problems = Lint([]byte("games:\n  rust: {name: Rust\n"))
+	if len(problems) != 1 || problems[0].Line == 0 {
+		t.Errorf("syntax error = %v", problems)
+	}
+}
+
+func joinProblems(problems []Problem) string {
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = p.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSourceReloadAdmission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hot-config.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rate_limits: {max_active_servers: 3}\n")
+	src, err := NewSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("rate_limits: {max_active_servers: 3, premium_max_active_servers: 1}\n")
+	err = src.Reload()
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "1:66: rate_limits.premium_max_active_servers: 1 is below max_active_servers 3") {
+		t.Fatalf("Reload = %v", err)
+	}
+	if src.Current().RateLimits.PremiumMaxActiveServers != 0 {
+		t.Error("rejected file was applied")
+	}
+
+	write("rate_limits: {max_active_servers: 3, premium_max_active_servers: 10}\n")
+	if err := src.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if src.Current().RateLimits.PremiumMaxActiveServers != 10 {
+		t.Error("admitted file was not applied")
+	}
+}
@@ -0,0 +1,170 @@
+package hotconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a lint finding. Line and Column are 1-based positions in
+// the file, or 0 when the problem was found without one (by Validate).
+type Problem struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", p.Line, p.Column)
+	}
+	if p.Path != "" {
+		b.WriteString(p.Path + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// Lint checks hot-config YAML against the schema and then, on the values
+// that decode, the semantic rules Validate applies. Every problem is
+// returned in file order with its line and column; a value the schema
+// rejects is not reported again by the semantic rules. Syntax errors
+// stop the check.
+func Lint(data []byte) []Problem {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []Problem{syntaxProblem(err)}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	problems := fileSchema.validate(root, "")
+
+	var f File
+	if err := root.Decode(&f); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return append(problems, syntaxProblem(err))
+		}
+		// Mismatched values are left zero and were reported by the
+		// schema; the rest decoded and can still be checked.
+	}
+	for _, p := range f.check() {
+		if covered(problems, p.Path) {
+			continue
+		}
+		n := lookup(root, p.Path)
+		p.Line, p.Column = n.Line, n.Column
+		problems = append(problems, p)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return problems
+}
+
+// Check lints data and decodes it. Any problem is returned as an error
+// wrapping ErrInvalid that lists them all with their positions.
+func Check(data []byte) (*File, error) {
+	if problems := Lint(data); len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i, p := range problems {
+			errs[i] = p
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	return Parse(data)
+}
+
+// covered reports whether a schema problem is at path, inside it or
+// above it.
+func covered(problems []Problem, path string) bool {
+	for _, p := range problems {
+		if p.Path == path || strings.HasPrefix(p.Path, path+".") || strings.HasPrefix(p.Path, path+"[") ||
+			strings.HasPrefix(path, p.Path+".") || strings.HasPrefix(path, p.Path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// pathPart matches one step of a path such as games.rust.ports[1].name.
+var pathPart = regexp.MustCompile(`^([^.\[]*)((?:\[\d+\])*)`)
+
+// lookup returns the node at path, or the deepest node on the way there
+// when the path does not exist in the file (a missing key is reported at
+// the mapping that lacks it).
+func lookup(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for rest := path; rest != ""; {
+		m := pathPart.FindStringSubmatch(rest)
+		rest = strings.TrimPrefix(rest[len(m[0]):], ".")
+		if m[1] != "" {
+			next := child(n, m[1])
+			if next == nil {
+				return n
+			}
+			n = next
+		}
+		for _, idx := range strings.Split(strings.Trim(m[2], "[]"), "][") {
+			if idx == "" {
+				continue
+			}
+			i, _ := strconv.Atoi(idx)
+			if n.Kind != yaml.SequenceNode || i >= len(n.Content) {
+				return n
+			}
+			n = n.Content[i]
+		}
+		if m[0] == "" {
+			break
+		}
+	}
+	return n
+}
+
+// child returns the value of key in mapping n, or nil.
+func child(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlLine finds the line yaml.v3 reports in its error messages.
+var yamlLine = regexp.MustCompile(`^yaml: (?:line (\d+): )?`)
+
+// syntaxProblem turns a YAML parse error into a Problem. yaml.v3 reports
+// lines but not columns.
+func syntaxProblem(err error) Problem {
+	msg := err.Error()
+	p := Problem{Message: msg}
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+		p.Message = msg[len(m[0]):]
+	}
+	if p.Line > 0 {
+		p.Column = 1
+	}
+	return p
+}
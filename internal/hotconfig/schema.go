@@ -0,0 +1,325 @@
+package hotconfig
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaJSON is the JSON Schema for hot-config.yaml. Editors with YAML
+// language support can use it directly; Lint checks files against it.
+//
+//go:embed schema.json
+var schemaJSON []byte
+
+// Schema returns the JSON Schema for hot-config.yaml.
+func Schema() []byte {
+	return schemaJSON
+}
+
+// fileSchema is the compiled schemaJSON.
+var fileSchema = mustCompileSchema(schemaJSON)
+
+// schema is the subset of JSON Schema that schema.json uses: types,
+// properties, additionalProperties, required, enum, items, numeric
+// bounds, minLength, pattern, the date-time format and $ref into $defs.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Enum                 []any              `json:"enum"`
+	Items                *schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum"`
+	MinLength            int                `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+	Format               string             `json:"format"`
+	Defs                 map[string]*schema `json:"$defs"`
+
+	// Compiled from the fields above.
+	closed  bool    // additionalProperties: false
+	extra   *schema // additionalProperties: {...}
+	pattern *regexp.Regexp
+	ref     *schema
+}
+
+func mustCompileSchema(data []byte) *schema {
+	var root schema
+	if err := json.Unmarshal(data, &root); err != nil {
+		panic("hotconfig: schema.json: " + err.Error())
+	}
+	if err := root.compile(&root); err != nil {
+		panic("hotconfig: schema.json: " + err.Error())
+	}
+	return &root
+}
+
+// compile resolves references and parses patterns and
+// additionalProperties throughout s.
+func (s *schema) compile(root *schema) error {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		if !ok || root.Defs[name] == nil {
+			return fmt.Errorf("unresolvable $ref %q", s.Ref)
+		}
+		s.ref = root.Defs[name]
+	}
+	switch raw := strings.TrimSpace(string(s.AdditionalProperties)); raw {
+	case "", "true":
+	case "false":
+		s.closed = true
+	default:
+		s.extra = new(schema)
+		if err := json.Unmarshal(s.AdditionalProperties, s.extra); err != nil {
+			return err
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	for _, child := range s.children() {
+		if err := child.compile(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schema) children() []*schema {
+	var out []*schema
+	for _, m := range []map[string]*schema{s.Properties, s.Defs} {
+		for _, c := range m {
+			out = append(out, c)
+		}
+	}
+	for _, c := range []*schema{s.extra, s.Items} {
+		if c != nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// validate checks n against s and returns a problem for each violation,
+// positioned at the offending node. path is n's dotted path in the file.
+func (s *schema) validate(n *yaml.Node, path string) []Problem {
+	if s.ref != nil {
+		return s.ref.validate(n, path)
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	var problems []Problem
+	bad := func(node *yaml.Node, path, format string, args ...any) {
+		problems = append(problems, Problem{Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(n, s.Type) {
+		bad(n, path, "must be %s %s, got %s", article(s.Type), s.Type, describe(n))
+		return problems
+	}
+	if len(s.Enum) > 0 {
+		if !inEnum(n, s.Enum) {
+			bad(n, path, "must be one of %s, got %s", enumList(s.Enum), describe(n))
+		}
+		return problems
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		seen := make(map[string]bool, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			seen[k.Value] = true
+			child := join(path, k.Value)
+			switch {
+			case s.Properties[k.Value] != nil:
+				problems = append(problems, s.Properties[k.Value].validate(v, child)...)
+			case s.extra != nil:
+				problems = append(problems, s.extra.validate(v, child)...)
+			case s.closed:
+				bad(k, child, "unknown key%s", suggest(k.Value, s.Properties))
+			}
+		}
+		for _, key := range s.Required {
+			if !seen[key] {
+				bad(n, join(path, key), "is required")
+			}
+		}
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for i, item := range n.Content {
+				problems = append(problems, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" {
+			if len([]rune(n.Value)) < s.MinLength {
+				bad(n, path, "must not be empty")
+			}
+			if s.pattern != nil && !s.pattern.MatchString(n.Value) {
+				bad(n, path, "%q does not match %s", n.Value, s.Pattern)
+			}
+			if s.Format == "date-time" {
+				if _, err := time.Parse(time.RFC3339, n.Value); err != nil {
+					bad(n, path, "%q is not an RFC 3339 date-time such as 2025-12-20T00:00:00Z", n.Value)
+				}
+			}
+		}
+		if v, err := strconv.ParseFloat(n.Value, 64); err == nil && (n.Tag == "!!int" || n.Tag == "!!float") {
+			if msg := s.checkBounds(v); msg != "" {
+				bad(n, path, "%s, got %s", msg, n.Value)
+			}
+		}
+	}
+	return problems
+}
+
+// checkBounds describes the first numeric bound v violates, if any.
+func (s *schema) checkBounds(v float64) string {
+	switch {
+	case s.Minimum != nil && s.Maximum != nil && (v < *s.Minimum || v > *s.Maximum):
+		return fmt.Sprintf("must be between %v and %v", *s.Minimum, *s.Maximum)
+	case s.Minimum != nil && v < *s.Minimum:
+		return fmt.Sprintf("must be at least %v", *s.Minimum)
+	case s.Maximum != nil && v > *s.Maximum:
+		return fmt.Sprintf("must be at most %v", *s.Maximum)
+	case s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum:
+		return fmt.Sprintf("must be above %v", *s.ExclusiveMinimum)
+	case s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum:
+		return fmt.Sprintf("must be below %v", *s.ExclusiveMaximum)
+	}
+	return ""
+}
+
+// hasType reports whether n is of JSON Schema type t. YAML integers are
+// also numbers; null is accepted for objects and arrays, which YAML
+// writes as an empty value.
+func hasType(n *yaml.Node, t string) bool {
+	switch t {
+	case "object":
+		return n.Kind == yaml.MappingNode || n.Tag == "!!null"
+	case "array":
+		return n.Kind == yaml.SequenceNode || n.Tag == "!!null"
+	case "string":
+		return n.Tag == "!!str"
+	case "integer":
+		return n.Tag == "!!int"
+	case "number":
+		return n.Tag == "!!int" || (n.Tag == "!!float" && !math.IsNaN(parseFloat(n.Value)))
+	case "boolean":
+		return n.Tag == "!!bool"
+	}
+	return false
+}
+
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+// describe names n's type for error messages.
+func describe(n *yaml.Node) string {
+	switch {
+	case n.Kind == yaml.MappingNode:
+		return "a mapping"
+	case n.Kind == yaml.SequenceNode:
+		return "a list"
+	case n.Tag == "!!null":
+		return "nothing"
+	}
+	return strconv.Quote(n.Value)
+}
+
+func article(t string) string {
+	if t == "array" || t == "object" || t == "integer" {
+		return "an"
+	}
+	return "a"
+}
+
+func inEnum(n *yaml.Node, enum []any) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	for _, e := range enum {
+		if fmt.Sprint(e) == n.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []any) string {
+	s := make([]string, len(enum))
+	for i, e := range enum {
+		s[i] = fmt.Sprint(e)
+	}
+	return strings.Join(s, ", ")
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest names the closest known key to a misspelt one.
+func suggest(key string, known map[string]*schema) string {
+	best, bestDist := "", 3
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if d := editDistance(key, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
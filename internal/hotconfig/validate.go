@@ -0,0 +1,235 @@
+package hotconfig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ErrInvalid is returned by Validate when the file parses but its values
+// cannot be used.
+var ErrInvalid = errors.New("hotconfig: invalid configuration")
+
+// Port protocols supported by Agones.
+var protocols = map[string]bool{"TCP": true, "UDP": true, "TCPUDP": true}
+
+// Tiers are the game tiers pricing and guild requirements are based on.
+var Tiers = []string{"solo", "moderate", "premium", "titan"}
+
+// Validate checks the values the bot relies on. Every problem is reported,
+// each prefixed with its YAML path such as games.rust.max_slots.
+func (f *File) Validate() error {
+	problems := f.check()
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Error() < problems[j].Error() })
+	errs := make([]error, len(problems))
+	for i, p := range problems {
+		errs[i] = p
+	}
+	return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+}
+
+// check returns the semantic problems in f, without positions.
+func (f *File) check() []Problem {
+	var problems []Problem
+	add := func(path, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	ids := make([]string, 0, len(f.Games))
+	for id := range f.Games {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		g := f.Games[id]
+		p := "games." + id
+		if g.Name == "" {
+			add(p+".name", "is required")
+		}
+		if g.Enabled && g.Image == "" {
+			add(p+".image", "is required for enabled games")
+		}
+		if g.Tier != "" && !slices.Contains(Tiers, g.Tier) {
+			add(p+".tier", "must be one of %s, got %q", strings.Join(Tiers, ", "), g.Tier)
+		}
+		switch {
+		case g.BaseCostPerHour < 0:
+			add(p+".base_cost_per_hour", "must not be negative, got %d", g.BaseCostPerHour)
+		case g.Enabled && g.BaseCostPerHour == 0:
+			add(p+".base_cost_per_hour", "must be positive for enabled games, got 0")
+		}
+		if g.DefaultSlots < 0 || g.MaxSlots < 0 || g.WarmPoolSize < 0 || g.GracePeriodMinutes < 0 {
+			add(p, "slots, warm_pool_size and grace_period_minutes must not be negative")
+		}
+		if g.MaxSlots > 0 && g.DefaultSlots > g.MaxSlots {
+			add(p+".default_slots", "%d exceeds max_slots %d", g.DefaultSlots, g.MaxSlots)
+		}
+		validatePair(add, p+".resources", "cpu", g.Resources.RequestsCPU, g.Resources.LimitsCPU)
+		validatePair(add, p+".resources", "memory", g.Resources.RequestsMemory, g.Resources.LimitsMemory)
+
+		names := make(map[string]bool)
+		used := make(map[string]int)
+		for i, port := range g.Ports {
+			pp := fmt.Sprintf("%s.ports[%d]", p, i)
+			if port.Port < 1 || port.Port > 65535 {
+				add(pp+".port", "must be between 1 and 65535, got %d", port.Port)
+			}
+			if !protocols[port.Protocol] {
+				add(pp+".protocol", "must be TCP, UDP or TCPUDP, got %q", port.Protocol)
+			}
+			if port.Name != "" && names[port.Name] {
+				add(pp+".name", "duplicate port name %q", port.Name)
+			}
+			names[port.Name] = true
+			for _, proto := range portProtocols(port.Protocol) {
+				key := fmt.Sprintf("%d/%s", port.Port, proto)
+				if j, ok := used[key]; ok {
+					add(pp+".port", "%s is also used by ports[%d]", key, j)
+					break
+				}
+				used[key] = i
+			}
+		}
+	}
+
+	for i, ph := range f.Pricing.PeakHours {
+		p := fmt.Sprintf("pricing.peak_hours[%d]", i)
+		for field, h := range map[string]int{"start_hour": ph.StartHour, "end_hour": ph.EndHour} {
+			if h < 0 || h > 23 {
+				add(p+"."+field, "must be between 0 and 23, got %d", h)
+			}
+		}
+		if ph.Multiplier <= 0 {
+			add(p+".multiplier", "must be positive, got %v", ph.Multiplier)
+		}
+		for j, d := range ph.Days {
+			if d < 0 || d > 6 {
+				add(fmt.Sprintf("%s.days[%d]", p, j), "must be between 0 (Sunday) and 6, got %d", d)
+			}
+		}
+	}
+	for i, promo := range f.Pricing.Promotions {
+		p := fmt.Sprintf("pricing.promotions[%d]", i)
+		if promo.Discount <= 0 || promo.Discount >= 1 {
+			add(p+".discount", "must be above 0 and below 1, got %v", promo.Discount)
+		}
+		start, startErr := time.Parse(time.RFC3339, promo.StartDate)
+		end, endErr := time.Parse(time.RFC3339, promo.EndDate)
+		if startErr != nil {
+			add(p+".start_date", "%q is not an RFC 3339 date-time such as 2025-12-20T00:00:00Z", promo.StartDate)
+		}
+		if endErr != nil {
+			add(p+".end_date", "%q is not an RFC 3339 date-time such as 2025-12-20T00:00:00Z", promo.EndDate)
+		}
+		if startErr == nil && endErr == nil && !end.After(start) {
+			add(p+".end_date", "%s is not after start_date %s", promo.EndDate, promo.StartDate)
+		}
+		for j, game := range promo.Games {
+			if _, ok := f.Games[game]; !ok {
+				add(fmt.Sprintf("%s.games[%d]", p, j), "unknown game %q", game)
+			}
+		}
+	}
+
+	if f.Pricing.BaseMultiplier < 0 {
+		add("pricing.base_multiplier", "must not be negative, got %v", f.Pricing.BaseMultiplier)
+	}
+	for field, d := range map[string]float64{
+		"pricing.premium_discount": f.Pricing.PremiumDiscount,
+		"pricing.guild_discount":   f.Pricing.GuildDiscount,
+	} {
+		if d < 0 || d >= 1 {
+			add(field, "must be at least 0 and below 1, got %v", d)
+		}
+	}
+
+	keys := make([]string, 0, len(f.Flags))
+	for key := range f.Flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fl := f.Flags[key]
+		p := "flags." + key
+		if _, ok := f.Features[key]; ok {
+			add(p, "is also defined under features; use one")
+		}
+		validateRollout(add, p+".rollout", fl.Rollout)
+		if fl.BucketBy != "" && fl.BucketBy != "user" && fl.BucketBy != "guild" {
+			add(p+".bucket_by", "must be user or guild, got %q", fl.BucketBy)
+		}
+		for i, r := range fl.Rules {
+			rp := fmt.Sprintf("%s.rules[%d]", p, i)
+			if len(r.Users)+len(r.Guilds)+len(r.Tiers)+len(r.Environments) == 0 && r.Rollout == nil {
+				add(rp, "needs a condition or a rollout")
+			}
+			validateRollout(add, rp+".rollout", r.Rollout)
+		}
+	}
+
+	r := f.RateLimits
+	if r.CommandsPerMinute < 0 || r.ServerCreationsPerHour < 0 || r.GiftsPerDay < 0 ||
+		r.MaxActiveServers < 0 || r.PremiumMaxActiveServers < 0 {
+		add("rate_limits", "limits must not be negative")
+	}
+	if r.PremiumMaxActiveServers > 0 && r.PremiumMaxActiveServers < r.MaxActiveServers {
+		add("rate_limits.premium_max_active_servers", "%d is below max_active_servers %d",
+			r.PremiumMaxActiveServers, r.MaxActiveServers)
+	}
+
+	return problems
+}
+
+// portProtocols returns the protocols a port listens on.
+func portProtocols(protocol string) []string {
+	if protocol == "TCPUDP" {
+		return []string{"TCP", "UDP"}
+	}
+	return []string{protocol}
+}
+
+// validateRollout checks that a rollout, if set, is a percentage.
+func validateRollout(add func(path, format string, args ...any), path string, rollout *float64) {
+	if rollout != nil && (*rollout < 0 || *rollout > 100) {
+		add(path, "must be between 0 and 100, got %v", *rollout)
+	}
+}
+
+// validatePair parses a request and limit and checks request <= limit.
+// Empty values are allowed; the template or Kubernetes default applies.
+func validatePair(add func(path, format string, args ...any), path, kind, request, limit string) {
+	var req, lim *resource.Quantity
+	for _, v := range []struct {
+		field string
+		value string
+		dst   **resource.Quantity
+	}{
+		{"requests_" + kind, request, &req},
+		{"limits_" + kind, limit, &lim},
+	} {
+		if v.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(v.value)
+		if err != nil {
+			add(path+"."+v.field, "%q is not a quantity", v.value)
+			continue
+		}
+		if q.Sign() <= 0 {
+			add(path+"."+v.field, "%q must be positive", v.value)
+			continue
+		}
+		*v.dst = &q
+	}
+	if req != nil && lim != nil && req.Cmp(*lim) > 0 {
+		add(path+".requests_"+kind, "%s exceeds limits_%s %s", request, kind, limit)
+	}
+}
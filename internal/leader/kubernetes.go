@@ -0,0 +1,157 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// LeaseLocker elects a leader with a coordination.k8s.io Lease. The
+// fencing token is the lease's transition count, which every acquisition
+// increments.
+type LeaseLocker struct {
+	leases   coordinationclient.LeaseInterface
+	name     string
+	identity string
+	duration time.Duration
+	now      func() time.Time
+}
+
+// NewLeaseLocker creates a locker for the named Lease in namespace.
+// identity must be unique per replica, e.g. the pod name; a lease not
+// renewed within duration may be taken over.
+func NewLeaseLocker(client kubernetes.Interface, namespace, name, identity string, duration time.Duration) *LeaseLocker {
+	return &LeaseLocker{
+		leases:   client.CoordinationV1().Leases(namespace),
+		name:     name,
+		identity: identity,
+		duration: duration,
+		now:      time.Now,
+	}
+}
+
+// TryAcquire creates the lease or takes it over once its holder has
+// released it or stopped renewing. A concurrent update by another
+// replica is reported as not acquired.
+func (l *LeaseLocker) TryAcquire(ctx context.Context) (int64, bool, error) {
+	now := metav1.NewMicroTime(l.now())
+	seconds := int32(l.duration / time.Second)
+	lease, err := l.leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		transitions := int32(1)
+		_, err := l.leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: l.name},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+				LeaseTransitions:     &transitions,
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("create lease %s: %w", l.name, err)
+		}
+		return int64(transitions), true, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("get lease %s: %w", l.name, err)
+	}
+	if l.heldByOther(lease) {
+		return 0, false, nil
+	}
+
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseTransitions = &transitions
+	if _, err := l.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("take over lease %s: %w", l.name, err)
+	}
+	return int64(transitions), true, nil
+}
+
+// Renew bumps the lease's renew time while it is still ours.
+func (l *LeaseLocker) Renew(ctx context.Context, token int64) error {
+	lease, err := l.get(ctx, token)
+	if err != nil {
+		return err
+	}
+	now := metav1.NewMicroTime(l.now())
+	lease.Spec.RenewTime = &now
+	if _, err := l.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("renew lease %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// Release clears the holder so the next replica to try takes over at
+// once. A lease already taken over is left alone.
+func (l *LeaseLocker) Release(ctx context.Context, token int64) error {
+	lease, err := l.get(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrLost) {
+			return nil
+		}
+		return err
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+	if _, err := l.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("release lease %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// get fetches the lease, returning ErrLost unless it is held by us under
+// token.
+func (l *LeaseLocker) get(ctx context.Context, token int64) (*coordinationv1.Lease, error) {
+	lease, err := l.leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrLost
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get lease %s: %w", l.name, err)
+	}
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity != l.identity ||
+		spec.LeaseTransitions == nil || int64(*spec.LeaseTransitions) != token {
+		return nil, ErrLost
+	}
+	return lease, nil
+}
+
+// heldByOther reports whether another replica holds an unexpired lease.
+func (l *LeaseLocker) heldByOther(lease *coordinationv1.Lease) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == l.identity {
+		return false
+	}
+	if spec.RenewTime == nil {
+		return false
+	}
+	duration := l.duration
+	if spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	return spec.RenewTime.Add(duration).After(l.now())
+}
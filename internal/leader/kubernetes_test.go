@@ -0,0 +1,61 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaseLocker(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a := NewLeaseLocker(client, "agis", "agis-cleanup", "pod-a", 15*time.Second)
+	b := NewLeaseLocker(client, "agis", "agis-cleanup", "pod-b", 15*time.Second)
+	a.now, b.now = clock, clock
+
+	token, ok, err := a.TryAcquire(ctx)
+	if err != nil || !ok || token != 1 {
+		t.Fatalf("pod-a TryAcquire = %d, %v, %v; want 1, true", token, ok, err)
+	}
+	if _, ok, err := b.TryAcquire(ctx); err != nil || ok {
+		t.Fatalf("pod-b TryAcquire while held = %v, %v; want false", ok, err)
+	}
+
+	// pod-a stops renewing; pod-b takes over once the lease expires.
+	now = now.Add(10 * time.Second)
+	if err := a.Renew(ctx, token); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	now = now.Add(16 * time.Second)
+	tokenB, ok, err := b.TryAcquire(ctx)
+	if err != nil || !ok || tokenB != 2 {
+		t.Fatalf("pod-b TryAcquire after expiry = %d, %v, %v; want 2, true", tokenB, ok, err)
+	}
+	if err := a.Renew(ctx, token); !errors.Is(err, ErrLost) {
+		t.Errorf("stale Renew = %v, want ErrLost", err)
+	}
+	if err := a.Release(ctx, token); err != nil {
+		t.Errorf("stale Release = %v, want nil", err)
+	}
+
+	// A graceful release hands over at once.
+	if err := b.Release(ctx, tokenB); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	lease, err := client.CoordinationV1().Leases("agis").Get(ctx, "agis-cleanup", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity != nil {
+		t.Errorf("holder = %q after release", *lease.Spec.HolderIdentity)
+	}
+	if token, ok, err := a.TryAcquire(ctx); err != nil || !ok || token != 3 {
+		t.Errorf("pod-a TryAcquire after release = %d, %v, %v; want 3, true", token, ok, err)
+	}
+}
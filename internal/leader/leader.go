@@ -0,0 +1,193 @@
+// Package leader provides leader election for singleton background jobs in AGIS.
+//
+// Every replica runs the same jobs, but an Elector only runs its job while
+// the replica holds leadership through a Locker: a Kubernetes Lease or a
+// PostgreSQL advisory lock. Each acquisition yields a fencing token that
+// increases across leaders; jobs read it with Token and pass it to writes
+// that must be rejected once a newer leader exists.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wethegamers/agis/internal/app"
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+// ErrLost is returned when leadership is lost while the job runs.
+var ErrLost = errors.New("leader: leadership lost")
+
+// Locker is a leader election backend.
+type Locker interface {
+	// TryAcquire makes one attempt to take leadership. It returns the
+	// fencing token and true if this replica is now the leader.
+	TryAcquire(ctx context.Context) (token int64, ok bool, err error)
+	// Renew extends leadership. It returns ErrLost if another replica
+	// has taken over; other errors are retried until the renew deadline.
+	Renew(ctx context.Context, token int64) error
+	// Release gives up leadership so another replica can take over
+	// without waiting for it to expire.
+	Release(ctx context.Context, token int64) error
+}
+
+// Timing configures how often an Elector campaigns and renews.
+type Timing struct {
+	// RetryPeriod is the interval between acquisition attempts and
+	// between renewals.
+	RetryPeriod time.Duration
+	// RenewDeadline is how long renewals may fail before the leader
+	// steps down. It must be shorter than the lease duration.
+	RenewDeadline time.Duration
+}
+
+// DefaultTiming matches client-go's leader election defaults for a 15
+// second lease.
+func DefaultTiming() Timing {
+	return Timing{RetryPeriod: 2 * time.Second, RenewDeadline: 10 * time.Second}
+}
+
+// releaseTimeout bounds the release on shutdown.
+const releaseTimeout = 5 * time.Second
+
+type tokenKey struct{}
+
+// Token returns the fencing token of the leadership the job runs under.
+func Token(ctx context.Context) (int64, bool) {
+	t, ok := ctx.Value(tokenKey{}).(int64)
+	return t, ok
+}
+
+// Elector runs a job while holding leadership of a named election.
+type Elector struct {
+	name       string
+	locker     Locker
+	timing     Timing
+	stopOnLoss bool
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+// NewElector creates an elector for the named election.
+func NewElector(name string, locker Locker, logger *slog.Logger) *Elector {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Elector{
+		name:   name,
+		locker: locker,
+		timing: DefaultTiming(),
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// SetTiming overrides the retry period and renew deadline.
+func (e *Elector) SetTiming(t Timing) {
+	e.timing = t
+}
+
+// SetStopOnLoss makes Run return ErrLost when leadership is lost instead
+// of campaigning again. It is for jobs that cannot be started twice in
+// one process; supervised with app.RestartNever, losing leadership then
+// shuts the replica down.
+func (e *Elector) SetStopOnLoss(stop bool) {
+	e.stopOnLoss = stop
+}
+
+// Run campaigns until this replica leads, then runs job under a context
+// carrying the fencing token, cancelled when leadership is lost. It
+// returns nil once ctx is done, or the job's result when it returns on
+// its own; either way leadership is released for another replica.
+func (e *Elector) Run(ctx context.Context, job func(context.Context) error) error {
+	for {
+		token, ok, err := e.locker.TryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.Warn("leader election attempt failed", "election", e.name, "error", err)
+		}
+		if ok {
+			err := e.lead(ctx, token, job)
+			if !errors.Is(err, ErrLost) || e.stopOnLoss {
+				return err
+			}
+			e.logger.Warn("leadership lost, campaigning again", "election", e.name, "error", err)
+		}
+
+		t := time.NewTimer(e.timing.RetryPeriod)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// lead runs job until it returns, ctx is done or leadership is lost.
+func (e *Elector) lead(ctx context.Context, token int64, job func(context.Context) error) error {
+	jobCtx, cancel := context.WithCancel(context.WithValue(ctx, tokenKey{}, token))
+	defer cancel()
+	e.logger.Info("acquired leadership", "election", e.name, "token", token)
+	metrics.LeaderElectionIsLeader.WithLabelValues(e.name).Set(1)
+	metrics.LeaderElectionTransitionsTotal.WithLabelValues(e.name, "acquired").Inc()
+	defer metrics.LeaderElectionIsLeader.WithLabelValues(e.name).Set(0)
+
+	jobDone := make(chan error, 1)
+	go func() { jobDone <- job(jobCtx) }()
+
+	ticker := time.NewTicker(e.timing.RetryPeriod)
+	defer ticker.Stop()
+	renewed := e.now()
+	for {
+		select {
+		case err := <-jobDone:
+			e.release(token)
+			return err
+		case <-ctx.Done():
+			cancel()
+			<-jobDone
+			e.release(token)
+			return nil
+		case <-ticker.C:
+			err := e.locker.Renew(ctx, token)
+			if err == nil {
+				renewed = e.now()
+				continue
+			}
+			if !errors.Is(err, ErrLost) {
+				if e.now().Sub(renewed) < e.timing.RenewDeadline {
+					e.logger.Warn("renewing leadership failed", "election", e.name, "error", err)
+					continue
+				}
+				err = fmt.Errorf("%w: not renewed within %s: %w", ErrLost, e.timing.RenewDeadline, err)
+			}
+			cancel()
+			<-jobDone
+			metrics.LeaderElectionTransitionsTotal.WithLabelValues(e.name, "lost").Inc()
+			return err
+		}
+	}
+}
+
+// release hands leadership over; it runs after ctx may be done.
+func (e *Elector) release(token int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := e.locker.Release(ctx, token); err != nil {
+		e.logger.Warn("releasing leadership failed", "election", e.name, "error", err)
+		return
+	}
+	metrics.LeaderElectionTransitionsTotal.WithLabelValues(e.name, "released").Inc()
+	e.logger.Info("released leadership", "election", e.name, "token", token)
+}
+
+// NewService wraps job in a supervised app.BackgroundService, named after
+// the election, that runs it only while this replica leads.
+func NewService(e *Elector, job func(context.Context) error) *app.BackgroundService {
+	return app.NewBackgroundService(e.name, func(ctx context.Context) error {
+		return e.Run(ctx, job)
+	})
+}
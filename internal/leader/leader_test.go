@@ -0,0 +1,215 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLocker is an in-memory Locker shared by several electors.
+type fakeLocker struct {
+	mu       sync.Mutex
+	holder   string
+	term     int64
+	renewErr error
+	released []int64
+}
+
+// as returns a Locker view for one replica.
+func (f *fakeLocker) as(identity string) Locker { return &fakeReplica{f, identity} }
+
+func (f *fakeLocker) takeOver(identity string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.holder = identity
+	f.term++
+	return f.term
+}
+
+func (f *fakeLocker) setRenewErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewErr = err
+}
+
+type fakeReplica struct {
+	*fakeLocker
+	identity string
+}
+
+func (r *fakeReplica) TryAcquire(context.Context) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.holder != "" {
+		return 0, false, nil
+	}
+	r.holder = r.identity
+	r.term++
+	return r.term, true, nil
+}
+
+func (r *fakeReplica) Renew(_ context.Context, token int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.renewErr != nil {
+		return r.renewErr
+	}
+	if r.holder != r.identity || r.term != token {
+		return ErrLost
+	}
+	return nil
+}
+
+func (r *fakeReplica) Release(_ context.Context, token int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.holder == r.identity && r.term == token {
+		r.holder = ""
+		r.released = append(r.released, token)
+	}
+	return nil
+}
+
+var fastTiming = Timing{RetryPeriod: 5 * time.Millisecond, RenewDeadline: 50 * time.Millisecond}
+
+func newTestElector(name string, l Locker) *Elector {
+	e := NewElector(name, l, nil)
+	e.SetTiming(fastTiming)
+	return e
+}
+
+// leaderJob reports each token it runs under and blocks until cancelled.
+func leaderJob(tokens chan<- int64) func(context.Context) error {
+	return func(ctx context.Context) error {
+		token, _ := Token(ctx)
+		tokens <- token
+		<-ctx.Done()
+		return nil
+	}
+}
+
+func receive(t *testing.T, ch <-chan int64) int64 {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out")
+		return 0
+	}
+}
+
+func TestElectorHandsOverOnShutdown(t *testing.T) {
+	locker := &fakeLocker{}
+	tokens := make(chan int64, 2)
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan error, 1)
+	go func() { doneA <- newTestElector("cleanup", locker.as("pod-a")).Run(ctxA, leaderJob(tokens)) }()
+	if got := receive(t, tokens); got != 1 {
+		t.Fatalf("pod-a token = %d, want 1", got)
+	}
+
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	go newTestElector("cleanup", locker.as("pod-b")).Run(ctxB, leaderJob(tokens))
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-tokens:
+		t.Fatal("pod-b ran the job while pod-a leads")
+	default:
+	}
+
+	stopA()
+	if err := <-doneA; err != nil {
+		t.Fatalf("Run after shutdown = %v", err)
+	}
+	if got := receive(t, tokens); got != 2 {
+		t.Errorf("pod-b token = %d, want 2", got)
+	}
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	if len(locker.released) != 1 || locker.released[0] != 1 {
+		t.Errorf("released = %v, want [1]", locker.released)
+	}
+}
+
+func TestElectorCampaignsAgainAfterLoss(t *testing.T) {
+	locker := &fakeLocker{}
+	tokens := make(chan int64, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newTestElector("role-sync", locker.as("pod-a")).Run(ctx, leaderJob(tokens))
+	receive(t, tokens)
+
+	// Another replica takes over, then lets the lease lapse.
+	locker.takeOver("pod-b")
+	time.Sleep(20 * time.Millisecond)
+	locker.mu.Lock()
+	locker.holder = ""
+	locker.mu.Unlock()
+
+	if got := receive(t, tokens); got != 3 {
+		t.Errorf("token after re-election = %d, want 3", got)
+	}
+}
+
+func TestElectorStopOnLoss(t *testing.T) {
+	locker := &fakeLocker{}
+	e := newTestElector("scheduler", locker.as("pod-a"))
+	e.SetStopOnLoss(true)
+	locker.setRenewErr(errors.New("apiserver unavailable"))
+
+	jobStopped := make(chan struct{})
+	err := e.Run(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		close(jobStopped)
+		return nil
+	})
+	if !errors.Is(err, ErrLost) {
+		t.Fatalf("Run = %v, want ErrLost after the renew deadline", err)
+	}
+	select {
+	case <-jobStopped:
+	default:
+		t.Error("job still running after leadership was lost")
+	}
+}
+
+func TestElectorJobErrorReleases(t *testing.T) {
+	locker := &fakeLocker{}
+	want := errors.New("cleanup failed")
+	err := newTestElector("cleanup", locker.as("pod-a")).Run(context.Background(), func(context.Context) error {
+		return want
+	})
+	if !errors.Is(err, want) {
+		t.Fatalf("Run = %v, want the job's error", err)
+	}
+	if locker.holder != "" {
+		t.Errorf("holder = %q after job failure, want released", locker.holder)
+	}
+}
+
+func TestNewServiceRunsUnderSupervision(t *testing.T) {
+	locker := &fakeLocker{}
+	tokens := make(chan int64, 1)
+	svc := NewService(newTestElector("cleanup", locker.as("pod-a")), leaderJob(tokens))
+	if svc.Name() != "cleanup" {
+		t.Errorf("Name = %q", svc.Name())
+	}
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, tokens)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := svc.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if locker.holder != "" {
+		t.Errorf("holder = %q after Stop, want released", locker.holder)
+	}
+}
@@ -0,0 +1,129 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// PGLocker elects a leader with a PostgreSQL session advisory lock held on
+// a dedicated connection, so leadership ends when the session does. The
+// fencing token is the election's term in leader_elections, incremented
+// on every acquisition.
+type PGLocker struct {
+	db       *sql.DB
+	name     string
+	identity string
+	key      int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+	term int64
+}
+
+// NewPGLocker creates a locker for the named election. identity is
+// recorded as the holder, e.g. the pod name.
+func NewPGLocker(db *sql.DB, name, identity string) *PGLocker {
+	return &PGLocker{db: db, name: name, identity: identity, key: lockKey(name)}
+}
+
+// lockKey derives the advisory lock key from the election name.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("agis:leader:" + name))
+	return int64(h.Sum64())
+}
+
+// TryAcquire takes the advisory lock without waiting and starts a new
+// term.
+func (l *PGLocker) TryAcquire(ctx context.Context) (int64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		return 0, false, fmt.Errorf("leader: election %s already held", l.name)
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("open election connection: %w", err)
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return 0, false, fmt.Errorf("try advisory lock: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return 0, false, nil
+	}
+
+	var term int64
+	err = conn.QueryRowContext(ctx, `
+		INSERT INTO leader_elections (name, term, holder, acquired_at)
+		VALUES ($1, 1, $2, NOW())
+		ON CONFLICT (name) DO UPDATE
+		SET term = leader_elections.term + 1, holder = EXCLUDED.holder, acquired_at = EXCLUDED.acquired_at
+		RETURNING term`, l.name, l.identity).Scan(&term)
+	if err != nil {
+		l.closeConn(conn)
+		return 0, false, fmt.Errorf("start election term: %w", err)
+	}
+	l.conn, l.term = conn, term
+	return term, true, nil
+}
+
+// Renew checks that the session is alive and the term is still ours. A
+// dead session has lost the lock.
+func (l *PGLocker) Renew(ctx context.Context, token int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil || l.term != token {
+		return ErrLost
+	}
+	var term int64
+	err := l.conn.QueryRowContext(ctx, `SELECT term FROM leader_elections WHERE name = $1`, l.name).Scan(&term)
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		l.conn.Close()
+		l.conn = nil
+		return fmt.Errorf("%w: %w", ErrLost, err)
+	}
+	if err != nil {
+		return fmt.Errorf("check election term: %w", err)
+	}
+	if term != token {
+		l.closeConn(l.conn)
+		l.conn = nil
+		return ErrLost
+	}
+	return nil
+}
+
+// Release unlocks and returns the connection to the pool.
+func (l *PGLocker) Release(ctx context.Context, token int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil || l.term != token {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		// Discard the session so the server drops the lock with it.
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+		return fmt.Errorf("advisory unlock: %w", err)
+	}
+	return conn.Close()
+}
+
+// closeConn unlocks and closes conn after a failed or superseded term.
+func (l *PGLocker) closeConn(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
@@ -0,0 +1,89 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPGLocker(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	l := NewPGLocker(db, "scheduler", "pod-a")
+
+	// Another replica holds the lock.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).
+		WithArgs(lockKey("scheduler")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+	if _, ok, err := l.TryAcquire(ctx); err != nil || ok {
+		t.Fatalf("TryAcquire while held = %v, %v; want false", ok, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).
+		WithArgs(lockKey("scheduler")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO leader_elections`)).
+		WithArgs("scheduler", "pod-a").
+		WillReturnRows(sqlmock.NewRows([]string{"term"}).AddRow(7))
+	token, ok, err := l.TryAcquire(ctx)
+	if err != nil || !ok || token != 7 {
+		t.Fatalf("TryAcquire = %d, %v, %v; want 7, true", token, ok, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT term FROM leader_elections WHERE name = $1`)).
+		WithArgs("scheduler").
+		WillReturnRows(sqlmock.NewRows([]string{"term"}).AddRow(7))
+	if err := l.Renew(ctx, token); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(lockKey("scheduler")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := l.Release(ctx, token); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := l.Renew(ctx, token); !errors.Is(err, ErrLost) {
+		t.Errorf("Renew after release = %v, want ErrLost", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPGLockerSupersededTerm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	l := NewPGLocker(db, "cleanup", "pod-a")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO leader_elections`)).
+		WillReturnRows(sqlmock.NewRows([]string{"term"}).AddRow(1))
+	token, _, err := l.TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT term FROM leader_elections WHERE name = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"term"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := l.Renew(ctx, token); !errors.Is(err, ErrLost) {
+		t.Fatalf("Renew with newer term = %v, want ErrLost", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
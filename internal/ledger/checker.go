@@ -0,0 +1,209 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Violation describes a single broken ledger invariant.
+type Violation struct {
+	Invariant string `json:"invariant"`
+	Account   string `json:"account,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	EntryID   int64  `json:"entry_id,omitempty"`
+	Expected  int64  `json:"expected"`
+	Actual    int64  `json:"actual"`
+}
+
+func (v Violation) String() string {
+	var b strings.Builder
+	b.WriteString(v.Invariant)
+	if v.EntryID != 0 {
+		fmt.Fprintf(&b, " entry=%d", v.EntryID)
+	}
+	if v.Account != "" {
+		fmt.Fprintf(&b, " account=%s", v.Account)
+	}
+	if v.Currency != "" {
+		fmt.Fprintf(&b, " currency=%s", v.Currency)
+	}
+	fmt.Fprintf(&b, " expected=%d actual=%d", v.Expected, v.Actual)
+	return b.String()
+}
+
+// Report is the result of an invariant check.
+type Report struct {
+	// Totals is the sum of all postings per currency; it must be zero.
+	Totals     map[Currency]int64 `json:"totals"`
+	Violations []Violation        `json:"violations"`
+}
+
+// OK reports whether every invariant holds.
+func (r *Report) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// Invariant names used in Violation.Invariant.
+const (
+	InvariantConservation   = "conservation"
+	InvariantEntryBalanced  = "entry_balanced"
+	InvariantBalanceDerived = "balance_matches_postings"
+	InvariantUserCache      = "user_cache_matches_ledger"
+	InvariantGuildCache     = "guild_treasury_matches_ledger"
+)
+
+// Check verifies the ledger invariants:
+//
+//   - the sum of every account is conserved (all postings sum to zero per currency),
+//   - every entry is balanced per currency, including WTG-to-GC conversions,
+//   - materialised balances equal the balances derived from postings,
+//   - users.credits and users.wtg_coins equal the ledger balances,
+//   - guild_treasury.balance equals the guild's ledger GC balance.
+func (l *Ledger) Check(ctx context.Context) (*Report, error) {
+	report := &Report{Totals: make(map[Currency]int64)}
+
+	if err := l.checkConservation(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := l.checkEntries(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := l.checkBalances(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := l.checkUserCache(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := l.checkGuildCache(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (l *Ledger) checkConservation(ctx context.Context, report *Report) error {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT currency, COALESCE(SUM(amount), 0) FROM ledger_postings GROUP BY currency`)
+	if err != nil {
+		return fmt.Errorf("ledger: conservation check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cur   string
+			total int64
+		)
+		if err := rows.Scan(&cur, &total); err != nil {
+			return fmt.Errorf("ledger: conservation check: %w", err)
+		}
+		report.Totals[Currency(cur)] = total
+		if total != 0 {
+			report.Violations = append(report.Violations, Violation{
+				Invariant: InvariantConservation,
+				Currency:  cur,
+				Expected:  0,
+				Actual:    total,
+			})
+		}
+	}
+	return rows.Err()
+}
+
+func (l *Ledger) checkEntries(ctx context.Context, report *Report) error {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT entry_id, currency, SUM(amount)
+		FROM ledger_postings
+		GROUP BY entry_id, currency
+		HAVING SUM(amount) <> 0
+		ORDER BY entry_id
+	`)
+	if err != nil {
+		return fmt.Errorf("ledger: entry check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := Violation{Invariant: InvariantEntryBalanced}
+		if err := rows.Scan(&v.EntryID, &v.Currency, &v.Actual); err != nil {
+			return fmt.Errorf("ledger: entry check: %w", err)
+		}
+		report.Violations = append(report.Violations, v)
+	}
+	return rows.Err()
+}
+
+func (l *Ledger) checkBalances(ctx context.Context, report *Report) error {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT COALESCE(b.account, d.account), COALESCE(b.currency, d.currency),
+		       COALESCE(d.balance, 0), COALESCE(b.balance, 0)
+		FROM ledger_balances b
+		FULL OUTER JOIN ledger_derived_balances d
+		  ON d.account = b.account AND d.currency = b.currency
+		WHERE COALESCE(b.balance, 0) <> COALESCE(d.balance, 0)
+	`)
+	if err != nil {
+		return fmt.Errorf("ledger: balance check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := Violation{Invariant: InvariantBalanceDerived}
+		if err := rows.Scan(&v.Account, &v.Currency, &v.Expected, &v.Actual); err != nil {
+			return fmt.Errorf("ledger: balance check: %w", err)
+		}
+		report.Violations = append(report.Violations, v)
+	}
+	return rows.Err()
+}
+
+func (l *Ledger) checkUserCache(ctx context.Context, report *Report) error {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT u.discord_id, c.currency, COALESCE(b.balance, 0), c.cached
+		FROM users u
+		CROSS JOIN LATERAL (VALUES ('GC', COALESCE(u.credits, 0)), ('WTG', COALESCE(u.wtg_coins, 0))) AS c(currency, cached)
+		LEFT JOIN ledger_balances b
+		  ON b.account = 'user:' || u.discord_id AND b.currency = c.currency
+		WHERE COALESCE(b.balance, 0) <> c.cached
+	`)
+	if err != nil {
+		return fmt.Errorf("ledger: user cache check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var discordID string
+		v := Violation{Invariant: InvariantUserCache}
+		if err := rows.Scan(&discordID, &v.Currency, &v.Expected, &v.Actual); err != nil {
+			return fmt.Errorf("ledger: user cache check: %w", err)
+		}
+		v.Account = UserAccount(discordID).String()
+		report.Violations = append(report.Violations, v)
+	}
+	return rows.Err()
+}
+
+func (l *Ledger) checkGuildCache(ctx context.Context, report *Report) error {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT g.guild_id, COALESCE(b.balance, 0), COALESCE(g.balance, 0)
+		FROM guild_treasury g
+		LEFT JOIN ledger_balances b
+		  ON b.account = 'guild:' || g.guild_id AND b.currency = 'GC'
+		WHERE COALESCE(b.balance, 0) <> COALESCE(g.balance, 0)
+	`)
+	if err != nil {
+		return fmt.Errorf("ledger: guild cache check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guildID string
+		v := Violation{Invariant: InvariantGuildCache, Currency: string(CurrencyGC)}
+		if err := rows.Scan(&guildID, &v.Expected, &v.Actual); err != nil {
+			return fmt.Errorf("ledger: guild cache check: %w", err)
+		}
+		v.Account = GuildAccount(guildID).String()
+		report.Violations = append(report.Violations, v)
+	}
+	return rows.Err()
+}
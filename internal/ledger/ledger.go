@@ -0,0 +1,477 @@
+// Package ledger provides a double-entry ledger for AGIS credits and WTG coins.
+//
+// Every balance movement is an Entry made of Postings that sum to zero per
+// currency. User and guild balances are derived from those postings. Each
+// posting on a user also adds its amount to users.credits or
+// users.wtg_coins in the same serializable transaction. agis-core still
+// changes those columns directly for some flows, so they are adjusted
+// rather than overwritten, and Check reports any drift from the ledger.
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Currency identifies the unit a posting is denominated in.
+type Currency string
+
+const (
+	// CurrencyGC is GameCredits, the in-game currency spent on servers.
+	CurrencyGC Currency = "GC"
+	// CurrencyWTG is WTG coins, the premium currency bought with real money.
+	CurrencyWTG Currency = "WTG"
+)
+
+// WTGToGCRate is the number of GameCredits one WTG coin converts into.
+const WTGToGCRate = 1000
+
+// AccountKind classifies ledger accounts.
+type AccountKind string
+
+const (
+	KindUser   AccountKind = "user"
+	KindGuild  AccountKind = "guild"
+	KindSystem AccountKind = "system"
+)
+
+// Account identifies a ledger account such as a user wallet or a guild treasury.
+type Account struct {
+	Kind AccountKind
+	ID   string
+}
+
+// System accounts. They represent the outside world and may carry negative
+// balances: a negative STRIPE balance is the total value sold for money.
+var (
+	Stripe = Account{Kind: KindSystem, ID: "STRIPE"}
+	Ads    = Account{Kind: KindSystem, ID: "ADS"}
+	System = Account{Kind: KindSystem, ID: "SYSTEM"}
+	Burn   = Account{Kind: KindSystem, ID: "BURN"}
+)
+
+// UserAccount returns the wallet account for a Discord user.
+func UserAccount(discordID string) Account {
+	return Account{Kind: KindUser, ID: discordID}
+}
+
+// GuildAccount returns the treasury account for a guild.
+func GuildAccount(guildID string) Account {
+	return Account{Kind: KindGuild, ID: guildID}
+}
+
+// ParseAccount parses the storage form produced by Account.String.
+func ParseAccount(s string) (Account, error) {
+	kind, id, ok := strings.Cut(s, ":")
+	if !ok {
+		switch s {
+		case Stripe.ID, Ads.ID, System.ID, Burn.ID:
+			return Account{Kind: KindSystem, ID: s}, nil
+		}
+		return Account{}, fmt.Errorf("unknown system account %q", s)
+	}
+	switch AccountKind(kind) {
+	case KindUser, KindGuild:
+		if id == "" {
+			return Account{}, fmt.Errorf("account %q has empty id", s)
+		}
+		return Account{Kind: AccountKind(kind), ID: id}, nil
+	}
+	return Account{}, fmt.Errorf("unknown account kind %q", kind)
+}
+
+// String returns the storage form of the account, e.g. "user:123" or "STRIPE".
+func (a Account) String() string {
+	if a.Kind == KindSystem {
+		return a.ID
+	}
+	return string(a.Kind) + ":" + a.ID
+}
+
+// AllowsNegative reports whether the account may hold a negative balance.
+func (a Account) AllowsNegative() bool {
+	return a.Kind == KindSystem
+}
+
+// Posting is a single signed movement on one account.
+// Positive amounts credit the account, negative amounts debit it.
+type Posting struct {
+	Account  Account
+	Currency Currency
+	Amount   int64
+}
+
+// Entry is a balanced set of postings describing one business event.
+type Entry struct {
+	ID             int64
+	Type           string
+	Description    string
+	IdempotencyKey string
+	CreatedBy      string
+	CreatedAt      time.Time
+	Postings       []Posting
+}
+
+// Errors returned by the ledger.
+var (
+	ErrUnbalanced        = errors.New("ledger: entry postings do not balance")
+	ErrInsufficientFunds = errors.New("ledger: insufficient funds")
+	ErrDuplicate         = errors.New("ledger: entry already posted")
+	ErrInvalidEntry      = errors.New("ledger: invalid entry")
+)
+
+// Validate checks that the entry is well-formed and balanced per currency.
+func (e *Entry) Validate() error {
+	if e.Type == "" {
+		return fmt.Errorf("%w: type is required", ErrInvalidEntry)
+	}
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings are required", ErrInvalidEntry)
+	}
+	sums := make(map[Currency]int64)
+	for _, p := range e.Postings {
+		if p.Amount == 0 {
+			return fmt.Errorf("%w: zero amount posting on %s", ErrInvalidEntry, p.Account)
+		}
+		if p.Currency != CurrencyGC && p.Currency != CurrencyWTG {
+			return fmt.Errorf("%w: unknown currency %q", ErrInvalidEntry, p.Currency)
+		}
+		if p.Account.ID == "" {
+			return fmt.Errorf("%w: posting without account", ErrInvalidEntry)
+		}
+		sums[p.Currency] += p.Amount
+	}
+	for cur, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s off by %d", ErrUnbalanced, cur, sum)
+		}
+	}
+	return nil
+}
+
+// TransferEntry builds a two-posting entry moving amount from one account to another.
+func TransferEntry(from, to Account, cur Currency, amount int64, entryType, description string) Entry {
+	return Entry{
+		Type:        entryType,
+		Description: description,
+		Postings: []Posting{
+			{Account: from, Currency: cur, Amount: -amount},
+			{Account: to, Currency: cur, Amount: amount},
+		},
+	}
+}
+
+// ConversionEntry builds the entry for converting WTG coins to GameCredits.
+// The user's WTG goes to SYSTEM and SYSTEM issues the equivalent GC, so both
+// currencies stay balanced independently.
+func ConversionEntry(discordID string, wtg int64) Entry {
+	user := UserAccount(discordID)
+	gc := wtg * WTGToGCRate
+	return Entry{
+		Type:        "conversion",
+		Description: fmt.Sprintf("Converted %d WTG to %d GC", wtg, gc),
+		Postings: []Posting{
+			{Account: user, Currency: CurrencyWTG, Amount: -wtg},
+			{Account: System, Currency: CurrencyWTG, Amount: wtg},
+			{Account: System, Currency: CurrencyGC, Amount: -gc},
+			{Account: user, Currency: CurrencyGC, Amount: gc},
+		},
+	}
+}
+
+// Ledger posts entries to PostgreSQL.
+type Ledger struct {
+	db         *sql.DB
+	maxRetries int
+}
+
+// New creates a ledger backed by the given database.
+func New(db *sql.DB) *Ledger {
+	return &Ledger{db: db, maxRetries: 3}
+}
+
+// DB returns the underlying database handle.
+func (l *Ledger) DB() *sql.DB {
+	return l.db
+}
+
+// TxFunc performs additional writes inside the ledger transaction, after the
+// entry's postings have been recorded. It may run more than once when the
+// transaction is retried.
+type TxFunc func(ctx context.Context, tx *sql.Tx, entryID int64) error
+
+// Post records the entry and updates balances at serializable isolation.
+// Serialization failures are retried; an entry whose idempotency key was
+// already posted returns ErrDuplicate together with the original entry ID.
+func (l *Ledger) Post(ctx context.Context, e Entry) (int64, error) {
+	return l.PostWith(ctx, e, nil)
+}
+
+// PostWith is like Post but also runs fn in the same transaction, so that
+// domain tables (treasury_transactions, provisioning records, ...) commit or
+// roll back together with the postings.
+func (l *Ledger) PostWith(ctx context.Context, e Entry, fn TxFunc) (int64, error) {
+	if err := e.Validate(); err != nil {
+		return 0, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= l.maxRetries; attempt++ {
+		id, err := l.post(ctx, &e, fn)
+		if err == nil || !isSerializationFailure(err) {
+			return id, err
+		}
+		lastErr = err
+	}
+	return 0, fmt.Errorf("ledger: giving up after %d serialization retries: %w", l.maxRetries, lastErr)
+}
+
+func (l *Ledger) post(ctx context.Context, e *Entry, fn TxFunc) (int64, error) {
+	tx, err := l.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return 0, fmt.Errorf("ledger: begin: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // Rollback after commit is a no-op
+
+	if e.IdempotencyKey != "" {
+		var existing int64
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM ledger_entries WHERE idempotency_key = $1`, e.IdempotencyKey,
+		).Scan(&existing)
+		if err == nil {
+			return existing, ErrDuplicate
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("ledger: idempotency lookup: %w", err)
+		}
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO ledger_entries (entry_type, description, idempotency_key, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		RETURNING id, created_at
+	`, e.Type, e.Description, e.IdempotencyKey, e.CreatedBy).Scan(&id, &e.CreatedAt)
+	if isDuplicateKey(err) {
+		// A concurrent post with the same key committed after our lookup.
+		// Release the aborted transaction before reading the winner.
+		_ = tx.Rollback()
+		return l.existingEntry(ctx, e.IdempotencyKey), ErrDuplicate
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ledger: insert entry: %w", err)
+	}
+
+	for _, p := range e.Postings {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_postings (entry_id, account, currency, amount)
+			VALUES ($1, $2, $3, $4)
+		`, id, p.Account.String(), string(p.Currency), p.Amount); err != nil {
+			return 0, fmt.Errorf("ledger: insert posting: %w", err)
+		}
+
+		var balance int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO ledger_balances (account, currency, balance)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (account, currency)
+			DO UPDATE SET balance = ledger_balances.balance + EXCLUDED.balance, updated_at = NOW()
+			RETURNING balance
+		`, p.Account.String(), string(p.Currency), p.Amount).Scan(&balance)
+		if err != nil {
+			return 0, fmt.Errorf("ledger: update balance: %w", err)
+		}
+		if balance < 0 && !p.Account.AllowsNegative() {
+			return 0, fmt.Errorf("%w: %s would have %d %s", ErrInsufficientFunds, p.Account, balance, p.Currency)
+		}
+
+		if p.Account.Kind == KindUser {
+			if err := syncUserBalance(ctx, tx, p.Account.ID, p.Currency, p.Amount); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := writeLegacyTransaction(ctx, tx, e); err != nil {
+		return 0, err
+	}
+
+	if fn != nil {
+		if err := fn(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ledger: commit: %w", err)
+	}
+	e.ID = id
+	return id, nil
+}
+
+// syncUserBalance adds a posting's amount to the users table column.
+// Writing the ledger balance instead would undo changes agis-core made to
+// the column directly since the last posting.
+func syncUserBalance(ctx context.Context, tx *sql.Tx, discordID string, cur Currency, amount int64) error {
+	column := "credits"
+	if cur == CurrencyWTG {
+		column = "wtg_coins"
+	}
+	//nolint:gosec // column is one of two constants above
+	query := fmt.Sprintf(`
+		INSERT INTO users (discord_id, %[1]s)
+		VALUES ($1, $2)
+		ON CONFLICT (discord_id) DO UPDATE SET %[1]s = COALESCE(users.%[1]s, 0) + EXCLUDED.%[1]s
+	`, column)
+	if _, err := tx.ExecContext(ctx, query, discordID, amount); err != nil {
+		return fmt.Errorf("ledger: sync users.%s: %w", column, err)
+	}
+	return nil
+}
+
+// legacyTypeLen is the width of credit_transactions.transaction_type.
+const legacyTypeLen = 20
+
+// writeLegacyTransaction mirrors simple transfers to a user into
+// credit_transactions so existing history commands keep working. It runs in
+// the ledger transaction, so the two logs can no longer diverge.
+//
+// from_user and to_user reference users(discord_id) and to_user is NOT
+// NULL, so transfers to a guild or system account are not mirrored and a
+// non-user sender is written as NULL. Entry types are cut to fit the
+// column.
+func writeLegacyTransaction(ctx context.Context, tx *sql.Tx, e *Entry) error {
+	if len(e.Postings) != 2 || e.Postings[0].Currency != e.Postings[1].Currency {
+		return nil
+	}
+	from, to := e.Postings[0], e.Postings[1]
+	if from.Amount > 0 {
+		from, to = to, from
+	}
+	if to.Account.Kind != KindUser {
+		return nil
+	}
+	var fromUser any
+	if from.Account.Kind == KindUser {
+		fromUser = from.Account.ID
+	}
+	entryType := e.Type
+	if len(entryType) > legacyTypeLen {
+		entryType = entryType[:legacyTypeLen]
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO credit_transactions (
+			from_user, to_user, amount, transaction_type, description, currency_type
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`, fromUser, to.Account.ID, to.Amount, entryType, e.Description, string(to.Currency))
+	if err != nil {
+		return fmt.Errorf("ledger: write credit_transactions: %w", err)
+	}
+	return nil
+}
+
+// Transfer moves amount between two accounts as a single entry.
+func (l *Ledger) Transfer(ctx context.Context, from, to Account, cur Currency, amount int64, entryType, description, idempotencyKey string) (int64, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("%w: amount must be positive", ErrInvalidEntry)
+	}
+	e := TransferEntry(from, to, cur, amount, entryType, description)
+	e.IdempotencyKey = idempotencyKey
+	return l.Post(ctx, e)
+}
+
+// ConvertWTGToGC converts a user's WTG coins into GameCredits.
+func (l *Ledger) ConvertWTGToGC(ctx context.Context, discordID string, wtg int64, idempotencyKey string) (int64, error) {
+	if wtg <= 0 {
+		return 0, fmt.Errorf("%w: amount must be positive", ErrInvalidEntry)
+	}
+	e := ConversionEntry(discordID, wtg)
+	e.IdempotencyKey = idempotencyKey
+	e.CreatedBy = discordID
+	return l.Post(ctx, e)
+}
+
+// Balance returns the current balance of an account.
+func (l *Ledger) Balance(ctx context.Context, acct Account, cur Currency) (int64, error) {
+	var balance int64
+	err := l.db.QueryRowContext(ctx,
+		`SELECT balance FROM ledger_balances WHERE account = $1 AND currency = $2`,
+		acct.String(), string(cur),
+	).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ledger: balance: %w", err)
+	}
+	return balance, nil
+}
+
+// Postings returns the most recent postings on an account, newest first.
+func (l *Ledger) Postings(ctx context.Context, acct Account, limit int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT e.id, e.entry_type, COALESCE(e.description, ''), COALESCE(e.idempotency_key, ''),
+		       COALESCE(e.created_by, ''), e.created_at, p.currency, p.amount
+		FROM ledger_postings p
+		JOIN ledger_entries e ON e.id = p.entry_id
+		WHERE p.account = $1
+		ORDER BY e.id DESC
+		LIMIT $2
+	`, acct.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: postings: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var (
+			e   Entry
+			p   Posting
+			cur string
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &e.Description, &e.IdempotencyKey, &e.CreatedBy, &e.CreatedAt, &cur, &p.Amount); err != nil {
+			return nil, fmt.Errorf("ledger: scan posting: %w", err)
+		}
+		p.Account = acct
+		p.Currency = Currency(cur)
+		e.Postings = []Posting{p}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// idempotencyKeyConstraint is the unique constraint PostgreSQL names for
+// ledger_entries.idempotency_key.
+const idempotencyKeyConstraint = "ledger_entries_idempotency_key_key"
+
+// isDuplicateKey reports whether err is a unique violation (SQLSTATE
+// 23505) on the idempotency key.
+func isDuplicateKey(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == idempotencyKeyConstraint
+}
+
+// existingEntry returns the ID of the entry posted with key, or 0 if it
+// cannot be read.
+func (l *Ledger) existingEntry(ctx context.Context, key string) int64 {
+	var id int64
+	_ = l.db.QueryRowContext(ctx, `SELECT id FROM ledger_entries WHERE idempotency_key = $1`, key).Scan(&id)
+	return id
+}
+
+// isSerializationFailure reports whether err is a PostgreSQL serialization
+// failure (SQLSTATE 40001) that should be retried.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "40001"
+}
@@ -0,0 +1,380 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestEntryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   Entry
+		wantErr error
+	}{
+		{
+			name:  "balanced transfer",
+			entry: TransferEntry(Stripe, UserAccount("1"), CurrencyWTG, 10, "purchase", ""),
+		},
+		{
+			name: "unbalanced",
+			entry: Entry{Type: "gift", Postings: []Posting{
+				{Account: UserAccount("1"), Currency: CurrencyGC, Amount: -10},
+				{Account: UserAccount("2"), Currency: CurrencyGC, Amount: 9},
+			}},
+			wantErr: ErrUnbalanced,
+		},
+		{
+			name: "balanced across currencies is still unbalanced",
+			entry: Entry{Type: "gift", Postings: []Posting{
+				{Account: UserAccount("1"), Currency: CurrencyWTG, Amount: -10},
+				{Account: UserAccount("1"), Currency: CurrencyGC, Amount: 10},
+			}},
+			wantErr: ErrUnbalanced,
+		},
+		{
+			name:    "single posting",
+			entry:   Entry{Type: "gift", Postings: []Posting{{Account: Burn, Currency: CurrencyGC, Amount: 1}}},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name: "zero amount",
+			entry: Entry{Type: "gift", Postings: []Posting{
+				{Account: UserAccount("1"), Currency: CurrencyGC, Amount: 0},
+				{Account: UserAccount("2"), Currency: CurrencyGC, Amount: 0},
+			}},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "missing type",
+			entry:   TransferEntry(Ads, UserAccount("1"), CurrencyGC, 5, "", ""),
+			wantErr: ErrInvalidEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConversionEntryConservesBothCurrencies(t *testing.T) {
+	e := ConversionEntry("42", 3)
+	if err := e.Validate(); err != nil {
+		t.Fatalf("conversion entry should validate: %v", err)
+	}
+
+	net := make(map[string]int64)
+	for _, p := range e.Postings {
+		net[p.Account.String()+"/"+string(p.Currency)] += p.Amount
+	}
+	if net["user:42/WTG"] != -3 {
+		t.Errorf("expected user to lose 3 WTG, got %d", net["user:42/WTG"])
+	}
+	if net["user:42/GC"] != 3*WTGToGCRate {
+		t.Errorf("expected user to gain %d GC, got %d", 3*WTGToGCRate, net["user:42/GC"])
+	}
+}
+
+func TestParseAccountRoundTrip(t *testing.T) {
+	for _, a := range []Account{UserAccount("123"), GuildAccount("456"), Stripe, Ads, System, Burn} {
+		got, err := ParseAccount(a.String())
+		if err != nil {
+			t.Fatalf("ParseAccount(%q): %v", a.String(), err)
+		}
+		if got != a {
+			t.Errorf("round trip mismatch: %+v != %+v", got, a)
+		}
+	}
+	for _, bad := range []string{"bank", "user:", "wallet:1"} {
+		if _, err := ParseAccount(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func expectTransfer(mock sqlmock.Sqlmock, balances [2]int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key`)).
+		WithArgs("cs_test_1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WithArgs(7, "STRIPE", "WTG", -10).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WithArgs("STRIPE", "WTG", -10).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(balances[0]))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WithArgs(7, "user:42", "WTG", 10).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WithArgs("user:42", "WTG", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(balances[1]))
+}
+
+func TestTransfer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// The user already held 15 WTG; the users column is adjusted by the
+	// posting, not overwritten with the ledger balance.
+	expectTransfer(mock, [2]int64{-10, 25})
+	mock.ExpectExec(regexp.QuoteMeta(`wtg_coins = COALESCE(users.wtg_coins, 0) + EXCLUDED.wtg_coins`)).
+		WithArgs("42", 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO credit_transactions`)).
+		WithArgs(nil, "42", 10, "purchase", "Stripe payment", "WTG").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	l := New(db)
+	id, err := l.Transfer(context.Background(), Stripe, UserAccount("42"), CurrencyWTG, 10, "purchase", "Stripe payment", "cs_test_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 7 {
+		t.Errorf("expected entry id 7, got %d", id)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(8, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(-5))
+	mock.ExpectRollback()
+
+	l := New(db)
+	_, err = l.Transfer(context.Background(), UserAccount("1"), UserAccount("2"), CurrencyGC, 10, "gift", "", "")
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransferDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key`)).
+		WithArgs("conv-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectRollback()
+
+	l := New(db)
+	id, err := l.Transfer(context.Background(), Ads, UserAccount("1"), CurrencyGC, 50, "ad_reward", "", "conv-1")
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if id != 3 {
+		t.Errorf("expected original entry id 3, got %d", id)
+	}
+}
+
+// legacyColumn checks a credit_transactions argument against the column's
+// constraints in agis-core's schema.
+type legacyColumn struct {
+	nullable bool // false for to_user NOT NULL
+	user     bool // REFERENCES users(discord_id)
+	maxLen   int  // VARCHAR(n)
+}
+
+func (c legacyColumn) Match(v driver.Value) bool {
+	if v == nil {
+		return c.nullable
+	}
+	s, ok := v.(string)
+	if !ok || (c.maxLen > 0 && len(s) > c.maxLen) {
+		return false
+	}
+	return !c.user || !strings.ContainsAny(s, ":ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+func TestLegacyTransactionMeetsColumnConstraints(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  Account
+		entryType string
+		mirrored  bool
+	}{
+		{"stripe purchase", Stripe, UserAccount("42"), "purchase", true},
+		{"gift", UserAccount("41"), UserAccount("42"), "gift", true},
+		{"long entry type", System, UserAccount("42"), "treasury_member_contribution", true},
+		{"treasury contribution", UserAccount("42"), GuildAccount("g1"), "treasury_member_contribution", false},
+		{"negative admin adjustment", UserAccount("42"), System, "admin_adjustment", false},
+		{"treasury grant", System, GuildAccount("g1"), "treasury_platform_grant", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+			for _, acct := range []Account{tt.from, tt.to} {
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+					WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(100))
+				if acct.Kind == KindUser {
+					mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users`)).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+			if tt.mirrored {
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO credit_transactions`)).
+					WithArgs(
+						legacyColumn{nullable: true, user: true, maxLen: 32},
+						legacyColumn{user: true, maxLen: 32},
+						10,
+						legacyColumn{maxLen: 20},
+						"test",
+						legacyColumn{maxLen: 10},
+					).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectCommit()
+
+			if _, err := New(db).Transfer(context.Background(), tt.from, tt.to, CurrencyGC, 10, tt.entryType, "test", ""); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTransferConcurrentDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// Another post with the key commits between the lookup and the insert.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key`)).
+		WithArgs("conv-1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "ledger_entries_idempotency_key_key"})
+	mock.ExpectRollback()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key`)).
+		WithArgs("conv-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	l := New(db)
+	id, err := l.Transfer(context.Background(), Ads, UserAccount("1"), CurrencyGC, 50, "ad_reward", "", "conv-1")
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if id != 3 {
+		t.Errorf("expected original entry id 3, got %d", id)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostRetriesSerializationFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM ledger_entries WHERE idempotency_key`)).
+		WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectRollback()
+
+	expectTransfer(mock, [2]int64{-10, 10})
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO credit_transactions`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	l := New(db)
+	if _, err := l.Transfer(context.Background(), Stripe, UserAccount("42"), CurrencyWTG, 10, "purchase", "Stripe payment", "cs_test_1"); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT currency, COALESCE(SUM(amount), 0) FROM ledger_postings`)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "sum"}).AddRow("GC", 0).AddRow("WTG", 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`HAVING SUM(amount) <> 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"entry_id", "currency", "sum"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`FULL OUTER JOIN ledger_derived_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"account", "currency", "derived", "balance"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users u`)).
+		WillReturnRows(sqlmock.NewRows([]string{"discord_id", "currency", "ledger", "cached"}).AddRow("42", "GC", 100, 150))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM guild_treasury g`)).
+		WillReturnRows(sqlmock.NewRows([]string{"guild_id", "ledger", "cached"}))
+
+	l := New(db)
+	report, err := l.Check(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.OK() {
+		t.Fatal("expected a violation for the drifted users cache")
+	}
+	v := report.Violations[0]
+	if v.Invariant != InvariantUserCache || v.Account != "user:42" || v.Expected != 100 || v.Actual != 150 {
+		t.Errorf("unexpected violation: %s", v)
+	}
+}
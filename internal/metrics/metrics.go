@@ -214,6 +214,122 @@ var (
 	)
 )
 
+// Service supervision metrics
+var (
+	ServiceUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "service_up",
+			Help:      "Whether a supervised background service is running (1) or not (0)",
+		},
+		[]string{"service"},
+	)
+
+	ServiceFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "service_failures_total",
+			Help:      "Total supervised background service failures",
+		},
+		[]string{"service", "reason"},
+	)
+
+	ServiceRestartsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "service_restarts_total",
+			Help:      "Total supervised background service restarts",
+		},
+		[]string{"service"},
+	)
+)
+
+// Leader election metrics
+var (
+	LeaderElectionIsLeader = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "leader_election_is_leader",
+			Help:      "Whether this replica leads the election (1) or not (0)",
+		},
+		[]string{"election"},
+	)
+
+	LeaderElectionTransitionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "leader_election_transitions_total",
+			Help:      "Total leadership changes by event (acquired, lost, released)",
+		},
+		[]string{"election", "event"},
+	)
+)
+
+// Configuration reload metrics
+var (
+	ConfigReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "config_reloads_total",
+			Help:      "Total configuration reloads by trigger and result (applied, unchanged, rejected)",
+		},
+		[]string{"trigger", "result"},
+	)
+
+	ConfigLastReloadTimestamp = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "config_last_reload_timestamp_seconds",
+			Help:      "Unix time of the last configuration snapshot that was applied",
+		},
+	)
+)
+
+// Secret reference metrics
+var (
+	SecretRefreshesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "secret_refreshes_total",
+			Help:      "Total secret lease renewals and re-reads by scheme and result (renewed, unchanged, rotated, failed)",
+		},
+		[]string{"scheme", "result"},
+	)
+)
+
+// Hot-config metrics
+var (
+	HotConfigReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "hot_config_reloads_total",
+			Help:      "Total hot-config.yaml reloads by result (admitted, rejected, failed)",
+		},
+		[]string{"result"},
+	)
+)
+
+// Feature flag metrics
+var (
+	FlagEvaluationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "flag_evaluations_total",
+			Help:      "Total feature flag evaluations by flag and reason (killed, rule, rollout, default, unknown)",
+		},
+		[]string{"flag", "reason"},
+	)
+
+	FlagExposuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "flag_exposures_total",
+			Help:      "Total experiment exposures from feature flags by result (recorded, dropped, failed)",
+		},
+		[]string{"result"},
+	)
+)
+
 // Build info metric
 var BuildInfo = promauto.NewGaugeVec(
 	prometheus.GaugeOpts{
@@ -4,6 +4,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
@@ -122,6 +123,15 @@ func (rl *RateLimiter) cleanupLoop() {
 	}
 }
 
+// SetLimits changes the rate and burst for every key. Buckets keep their
+// tokens, capped at the new burst on their next request.
+func (rl *RateLimiter) SetLimits(requestsPerSecond float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = requestsPerSecond
+	rl.burst = burst
+}
+
 // Allow checks if a request is allowed.
 func (rl *RateLimiter) Allow(key string) bool {
 	rl.mu.Lock()
@@ -210,15 +220,16 @@ func Recover(next http.Handler) http.Handler {
 
 // CORS adds CORS headers.
 func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
-	originsSet := make(map[string]bool)
-	for _, o := range allowedOrigins {
-		originsSet[o] = true
-	}
+	return CORSFunc(func() []string { return allowedOrigins })
+}
 
+// CORSFunc adds CORS headers for the origins returned by allowedOrigins,
+// which is called on every request so the list can change at runtime.
+func CORSFunc(allowedOrigins func() []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
-			if originsSet[origin] || originsSet["*"] {
+			if slices.ContainsFunc(allowedOrigins(), func(o string) bool { return o == origin || o == "*" }) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
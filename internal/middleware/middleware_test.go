@@ -127,6 +127,40 @@ func TestRateLimiterRefill(t *testing.T) {
 	}
 }
 
+func TestRateLimiterSetLimits(t *testing.T) {
+	rl := NewRateLimiter(0, 1)
+	if !rl.Allow("k") || rl.Allow("k") {
+		t.Fatal("expected a burst of one")
+	}
+	rl.SetLimits(0, 3)
+	if rl.Allow("k") {
+		t.Error("raising the burst should not refill an empty bucket")
+	}
+	if !rl.Allow("new") || !rl.Allow("new") || !rl.Allow("new") || rl.Allow("new") {
+		t.Error("expected new keys to get the raised burst of three")
+	}
+}
+
+func TestCORSFunc(t *testing.T) {
+	origins := []string{"https://example.com"}
+	handler := CORSFunc(func() []string { return origins })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	allowed := func(origin string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	if !allowed("https://example.com") || allowed("https://wethegamers.org") {
+		t.Fatal("unexpected origins before change")
+	}
+	origins = []string{"https://wethegamers.org"}
+	if allowed("https://example.com") || !allowed("https://wethegamers.org") {
+		t.Error("origin change not applied to the next request")
+	}
+}
+
 func TestCORS(t *testing.T) {
 	handler := CORS([]string{"https://example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
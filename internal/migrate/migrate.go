@@ -0,0 +1,634 @@
+// Package migrate provides the versioned database migration runner for
+// AGIS.
+//
+// Migrations are vX.Y.Z-name.sql files, usually the embedded
+// deployments/migrations set, applied in numeric version order. Each runs
+// in its own transaction together with its schema_migrations row, which
+// stores a SHA-256 of the file so that a file edited after it was applied
+// is detected. Up and Down hold a PostgreSQL advisory lock, so replicas
+// starting together apply each migration exactly once.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+// lockKey is the advisory lock held while migrating ("schemamg").
+const lockKey = 0x736368656d616d67
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration's file has
+	// changed since it was applied.
+	ErrChecksumMismatch = errors.New("migrate: migration file changed after it was applied")
+	// ErrIrreversible is returned when rolling back a migration that has
+	// no down file.
+	ErrIrreversible = errors.New("migrate: migration has no down file")
+	// ErrUnknownVersion is returned for a target version with no file.
+	ErrUnknownVersion = errors.New("migrate: unknown version")
+	// ErrOrphaned is returned when rolling back while the database holds
+	// migrations this build has no file for.
+	ErrOrphaned = errors.New("migrate: database has migrations unknown to this build")
+)
+
+// Migration is one migration file.
+type Migration struct {
+	Version string
+	Up      string
+	// Down is empty when the migration cannot be reverted.
+	Down string
+	// Checksum is the hex SHA-256 of Up.
+	Checksum string
+}
+
+// Load reads the migrations in the root of fsys, ordered by version. The
+// version is the file name without .sql, matching what each file inserts
+// into schema_migrations.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: list migrations: %w", err)
+	}
+	var ms []Migration
+	downs := make(map[string]string)
+	for _, name := range names {
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", name, err)
+		}
+		if v, ok := strings.CutSuffix(name, ".down.sql"); ok {
+			downs[v] = string(body)
+			continue
+		}
+		v := strings.TrimSuffix(name, ".sql")
+		if len(versionNumbers(v)) == 0 {
+			return nil, fmt.Errorf("migrate: %s: name must start with a version such as v2.8.0-", name)
+		}
+		sum := sha256.Sum256(body)
+		ms = append(ms, Migration{Version: v, Up: string(body), Checksum: hex.EncodeToString(sum[:])})
+	}
+	if len(ms) == 0 {
+		return nil, errors.New("migrate: no migrations found")
+	}
+	for i := range ms {
+		if down, ok := downs[ms[i].Version]; ok {
+			ms[i].Down = down
+			delete(downs, ms[i].Version)
+		}
+	}
+	for v := range downs {
+		return nil, fmt.Errorf("migrate: %s.down.sql has no matching up migration", v)
+	}
+	sort.Slice(ms, func(i, j int) bool { return versionLess(ms[i].Version, ms[j].Version) })
+	return ms, nil
+}
+
+// versionLess orders "v1.7.0-x" < "v2.0-y" < "v2.1.0-z" < "v2.10.0-w" by
+// comparing the dotted numbers before the first dash.
+func versionLess(a, b string) bool {
+	na, nb := versionNumbers(a), versionNumbers(b)
+	for i := 0; i < len(na) && i < len(nb); i++ {
+		if na[i] != nb[i] {
+			return na[i] < nb[i]
+		}
+	}
+	if len(na) != len(nb) {
+		return len(na) < len(nb)
+	}
+	return a < b
+}
+
+func versionNumbers(v string) []int {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// State is where a migration stands against the database.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateApplied State = "applied"
+	// StateModified means the file no longer matches what was applied.
+	StateModified State = "modified"
+	// StateUnverified means the migration was applied before checksums
+	// were recorded; the next Up adopts the current file's checksum.
+	StateUnverified State = "unverified"
+	// StateOrphaned means the database records a migration with no file,
+	// typically one applied by a newer build.
+	StateOrphaned State = "orphaned"
+)
+
+// Status describes one migration.
+type Status struct {
+	Version         string     `json:"version"`
+	State           State      `json:"state"`
+	AppliedAt       *time.Time `json:"applied_at,omitempty"`
+	Checksum        string     `json:"checksum,omitempty"`
+	AppliedChecksum string     `json:"applied_checksum,omitempty"`
+	Reversible      bool       `json:"reversible"`
+}
+
+// Options controls Up and Down.
+type Options struct {
+	// Target is the last version to apply for Up, or the version to roll
+	// back to (and keep) for Down. Empty means every pending migration
+	// for Up and Steps migrations for Down.
+	Target string
+	// Steps is how many migrations Down reverts when Target is empty;
+	// zero means one.
+	Steps int
+	// DryRun reports the plan without taking the lock or writing.
+	DryRun bool
+	// Actor is recorded in the audit log; empty means audit.SystemActor.
+	Actor string
+}
+
+// Result lists the migrations Up or Down applied or reverted, in order.
+type Result struct {
+	Versions []string `json:"versions"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+// queryer is satisfied by *sql.DB and *sql.Conn.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Runner applies and reverts migrations.
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+	audit      audit.Recorder
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+// New loads the migrations in fsys. A nil logger uses slog.Default().
+func New(db *sql.DB, fsys fs.FS, logger *slog.Logger) (*Runner, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Runner{db: db, migrations: ms, logger: logger, now: time.Now}, nil
+}
+
+// SetAuditLog records every applied and reverted migration in the audit
+// log, in the migration's transaction, once the audit_log table exists.
+func (r *Runner) SetAuditLog(rec audit.Recorder) {
+	r.audit = rec
+}
+
+// Migrations returns the loaded migrations in version order.
+func (r *Runner) Migrations() []Migration {
+	return r.migrations
+}
+
+// OnStart returns a hook for app.WithOnStart that applies pending
+// migrations before any service starts.
+func (r *Runner) OnStart() func(context.Context) error {
+	return func(ctx context.Context) error {
+		res, err := r.Up(ctx, Options{})
+		if err != nil {
+			return err
+		}
+		if len(res.Versions) > 0 {
+			r.logger.Info("database migrated", "applied", res.Versions)
+		}
+		return nil
+	}
+}
+
+// Status reports every migration file and any recorded migration that
+// has no file, in version order.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	return r.status(ctx, r.db)
+}
+
+// Up applies pending migrations in version order, up to and including
+// opts.Target. It refuses to run while an applied migration's file has
+// changed.
+func (r *Runner) Up(ctx context.Context, opts Options) (*Result, error) {
+	if err := r.checkTarget(opts.Target); err != nil {
+		return nil, err
+	}
+	res := &Result{Versions: []string{}, DryRun: opts.DryRun}
+	plan := func(statuses []Status) ([]Migration, error) {
+		if err := checkModified(statuses); err != nil {
+			return nil, err
+		}
+		applied := make(map[string]bool)
+		for _, s := range statuses {
+			applied[s.Version] = s.State != StatePending
+		}
+		var pending []Migration
+		for _, m := range r.migrations {
+			if opts.Target != "" && versionLess(opts.Target, m.Version) {
+				break
+			}
+			if !applied[m.Version] {
+				pending = append(pending, m)
+			}
+		}
+		return pending, nil
+	}
+
+	if opts.DryRun {
+		statuses, err := r.status(ctx, r.db)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := plan(statuses)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range pending {
+			res.Versions = append(res.Versions, m.Version)
+		}
+		return res, nil
+	}
+
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		if err := bootstrap(ctx, conn); err != nil {
+			return err
+		}
+		statuses, err := r.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		pending, err := plan(statuses)
+		if err != nil {
+			return err
+		}
+		if err := r.adopt(ctx, conn, statuses); err != nil {
+			return err
+		}
+		for _, m := range pending {
+			if err := r.apply(ctx, conn, m, opts.Actor); err != nil {
+				return err
+			}
+			res.Versions = append(res.Versions, m.Version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Down reverts applied migrations newest first: those after opts.Target
+// or, without a target, the last opts.Steps. Every migration to revert
+// must have a down file, or nothing is reverted.
+func (r *Runner) Down(ctx context.Context, opts Options) (*Result, error) {
+	if err := r.checkTarget(opts.Target); err != nil {
+		return nil, err
+	}
+	steps := opts.Steps
+	if steps <= 0 {
+		steps = 1
+	}
+	res := &Result{Versions: []string{}, DryRun: opts.DryRun}
+	plan := func(statuses []Status) ([]Migration, error) {
+		if err := checkModified(statuses); err != nil {
+			return nil, err
+		}
+		var orphaned []string
+		applied := make(map[string]bool)
+		for _, s := range statuses {
+			switch s.State {
+			case StateOrphaned:
+				orphaned = append(orphaned, s.Version)
+			case StatePending:
+			default:
+				applied[s.Version] = true
+			}
+		}
+		if len(orphaned) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrOrphaned, strings.Join(orphaned, ", "))
+		}
+		var revert []Migration
+		for i := len(r.migrations) - 1; i >= 0; i-- {
+			m := r.migrations[i]
+			if opts.Target != "" && !versionLess(opts.Target, m.Version) {
+				break
+			}
+			if opts.Target == "" && len(revert) == steps {
+				break
+			}
+			if !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return nil, fmt.Errorf("%w: %s", ErrIrreversible, m.Version)
+			}
+			revert = append(revert, m)
+		}
+		return revert, nil
+	}
+
+	if opts.DryRun {
+		statuses, err := r.status(ctx, r.db)
+		if err != nil {
+			return nil, err
+		}
+		revert, err := plan(statuses)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range revert {
+			res.Versions = append(res.Versions, m.Version)
+		}
+		return res, nil
+	}
+
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		if err := bootstrap(ctx, conn); err != nil {
+			return err
+		}
+		statuses, err := r.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		revert, err := plan(statuses)
+		if err != nil {
+			return err
+		}
+		for _, m := range revert {
+			if err := r.revert(ctx, conn, m, opts.Actor); err != nil {
+				return err
+			}
+			res.Versions = append(res.Versions, m.Version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *Runner) checkTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+	for _, m := range r.migrations {
+		if m.Version == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownVersion, target)
+}
+
+func checkModified(statuses []Status) error {
+	var modified []string
+	for _, s := range statuses {
+		if s.State == StateModified {
+			modified = append(modified, s.Version)
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(modified, ", "))
+	}
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock.
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: connect: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, int64(lockKey)); err != nil {
+		return fmt.Errorf("migrate: acquire lock: %w", err)
+	}
+	defer func() {
+		// Unlock even if ctx was cancelled. If that fails, discard the
+		// connection rather than return a session holding the lock to
+		// the pool.
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, int64(lockKey)); err != nil {
+			r.logger.Error("release migration lock", "error", err)
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	return fn(conn)
+}
+
+// bootstrap creates schema_migrations or brings the v2.0 table up to
+// date: its VARCHAR(20) version column is too short for the file names.
+func bootstrap(ctx context.Context, q queryer) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE schema_migrations ALTER COLUMN version TYPE VARCHAR(255)`,
+		`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum CHAR(64)`,
+		`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS execution_ms INTEGER`,
+	} {
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: prepare schema_migrations: %w", err)
+		}
+	}
+	return nil
+}
+
+type record struct {
+	appliedAt sql.NullTime
+	checksum  sql.NullString
+}
+
+// readApplied reads schema_migrations, which may not exist yet or may
+// predate the checksum column.
+func readApplied(ctx context.Context, q queryer) (map[string]record, error) {
+	var exists, hasChecksum bool
+	if err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL,
+		EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'checksum')`,
+	).Scan(&exists, &hasChecksum); err != nil {
+		return nil, fmt.Errorf("migrate: check schema_migrations: %w", err)
+	}
+	out := make(map[string]record)
+	if !exists {
+		return out, nil
+	}
+	query := `SELECT version, applied_at, NULL FROM schema_migrations`
+	if hasChecksum {
+		query = `SELECT version, applied_at, checksum FROM schema_migrations`
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		var rec record
+		if err := rows.Scan(&v, &rec.appliedAt, &rec.checksum); err != nil {
+			return nil, fmt.Errorf("migrate: scan schema_migrations: %w", err)
+		}
+		out[v] = rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: read schema_migrations: %w", err)
+	}
+	return out, nil
+}
+
+func (r *Runner) status(ctx context.Context, q queryer) ([]Status, error) {
+	done, err := readApplied(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(r.migrations)+len(done))
+	for _, m := range r.migrations {
+		s := Status{Version: m.Version, State: StatePending, Checksum: m.Checksum, Reversible: m.Down != ""}
+		if rec, ok := done[m.Version]; ok {
+			s.State, s.AppliedAt, s.AppliedChecksum = compare(m.Checksum, rec)
+			delete(done, m.Version)
+		}
+		out = append(out, s)
+	}
+	for v, rec := range done {
+		s := Status{Version: v, State: StateOrphaned}
+		_, s.AppliedAt, s.AppliedChecksum = compare("", rec)
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return versionLess(out[i].Version, out[j].Version) })
+	return out, nil
+}
+
+func compare(checksum string, rec record) (State, *time.Time, string) {
+	var at *time.Time
+	if rec.appliedAt.Valid {
+		t := rec.appliedAt.Time
+		at = &t
+	}
+	applied := strings.TrimSpace(rec.checksum.String)
+	switch {
+	case !rec.checksum.Valid:
+		return StateUnverified, at, ""
+	case applied != checksum:
+		return StateModified, at, applied
+	default:
+		return StateApplied, at, applied
+	}
+}
+
+// adopt records the current checksum of migrations applied before
+// checksums existed, so later edits to them are detected.
+func (r *Runner) adopt(ctx context.Context, q queryer, statuses []Status) error {
+	for _, s := range statuses {
+		if s.State != StateUnverified {
+			continue
+		}
+		if _, err := q.ExecContext(ctx,
+			`UPDATE schema_migrations SET checksum = $2 WHERE version = $1 AND checksum IS NULL`, s.Version, s.Checksum,
+		); err != nil {
+			return fmt.Errorf("migrate: record checksum of %s: %w", s.Version, err)
+		}
+		r.logger.Warn("recorded checksum of migration applied without one", "version", s.Version)
+	}
+	return nil
+}
+
+func (r *Runner) apply(ctx context.Context, conn *sql.Conn, m Migration, actor string) error {
+	start := r.now()
+	return r.inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return fmt.Errorf("migrate: apply %s: %w", m.Version, err)
+		}
+		// Most files insert their own row; this fills in the checksum.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, applied_at, checksum, execution_ms)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (version) DO UPDATE SET applied_at = EXCLUDED.applied_at,
+				checksum = EXCLUDED.checksum, execution_ms = EXCLUDED.execution_ms`,
+			m.Version, start.UTC(), m.Checksum, r.now().Sub(start).Milliseconds(),
+		); err != nil {
+			return fmt.Errorf("migrate: record %s: %w", m.Version, err)
+		}
+		r.logger.Info("applied migration", "version", m.Version)
+		return r.recordAudit(ctx, tx, actor, "schema.migrate", m, map[string]any{"checksum": m.Checksum})
+	})
+}
+
+func (r *Runner) revert(ctx context.Context, conn *sql.Conn, m Migration, actor string) error {
+	return r.inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return fmt.Errorf("migrate: revert %s: %w", m.Version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+			return fmt.Errorf("migrate: unrecord %s: %w", m.Version, err)
+		}
+		r.logger.Info("reverted migration", "version", m.Version)
+		return r.recordAudit(ctx, tx, actor, "schema.rollback", m, nil)
+	})
+}
+
+func (r *Runner) inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migrate: begin: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migrate: commit: %w", err)
+	}
+	return nil
+}
+
+// recordAudit writes the audit entry once audit_log exists, i.e. from the
+// migration that creates it onwards and until it is reverted.
+func (r *Runner) recordAudit(ctx context.Context, tx *sql.Tx, actor, action string, m Migration, after map[string]any) error {
+	if r.audit == nil {
+		return nil
+	}
+	var auditable bool
+	if err := tx.QueryRowContext(ctx, `SELECT to_regclass('audit_log') IS NOT NULL`).Scan(&auditable); err != nil {
+		return fmt.Errorf("migrate: check audit_log: %w", err)
+	}
+	if !auditable {
+		return nil
+	}
+	if actor == "" {
+		actor = audit.SystemActor
+	}
+	_, err := r.audit.RecordTx(ctx, tx, audit.Event{
+		Actor:  actor,
+		Action: action,
+		Target: audit.Target{Type: "schema_migration", ID: m.Version},
+		After:  after,
+	})
+	return err
+}
@@ -0,0 +1,287 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/wethegamers/agis/deployments/migrations"
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+var testFS = fstest.MapFS{
+	"v2.10.0-later.sql":      {Data: []byte("CREATE TABLE later (id INT);")},
+	"v2.10.0-later.down.sql": {Data: []byte("DROP TABLE later;")},
+	"v2.0-base.sql":          {Data: []byte("CREATE TABLE base (id INT);")},
+	"v2.2.0-next.sql":        {Data: []byte("CREATE TABLE next (id INT);")},
+}
+
+func newRunner(t *testing.T, fsys fstest.MapFS) (*Runner, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	r, err := New(db, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+	return r, mock
+}
+
+func expectLocked(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).
+		WithArgs(int64(lockKey)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE schema_migrations ALTER COLUMN version TYPE VARCHAR(255)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ADD COLUMN IF NOT EXISTS checksum`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ADD COLUMN IF NOT EXISTS execution_ms`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlocked(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(int64(lockKey)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectApplied returns schema_migrations rows of version and checksum
+// (nil for rows recorded before checksums existed).
+func expectApplied(mock sqlmock.Sqlmock, rows ...any) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksum"}).AddRow(true, true))
+	r := sqlmock.NewRows([]string{"version", "applied_at", "checksum"})
+	for i := 0; i < len(rows); i += 2 {
+		r.AddRow(rows[i], time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), rows[i+1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at, checksum FROM schema_migrations`)).WillReturnRows(r)
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, m := range ms {
+		versions = append(versions, m.Version)
+	}
+	if got := strings.Join(versions, ","); got != "v2.0-base,v2.2.0-next,v2.10.0-later" {
+		t.Errorf("order %s", got)
+	}
+	if ms[2].Down != "DROP TABLE later;" || ms[1].Down != "" {
+		t.Errorf("down files not paired: %+v", ms)
+	}
+	if ms[0].Checksum != sum("CREATE TABLE base (id INT);") {
+		t.Errorf("checksum %s", ms[0].Checksum)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"unpaired down": {"v1.0-a.sql": {}, "v1.1-b.down.sql": {}},
+		"bad name":      {"indexes.sql": {}},
+		"empty":         {},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	ms, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms[0].Version != "v1.7.0-rest-api-scheduling" || ms[len(ms)-1].Version != "v2.10.0-provisioning-terminating" {
+		t.Errorf("unexpected range %s .. %s", ms[0].Version, ms[len(ms)-1].Version)
+	}
+	for _, m := range ms {
+		if !strings.Contains(m.Up, "'"+m.Version+"'") && m.Version != "v1.7.0-rest-api-scheduling" {
+			t.Errorf("%s does not record its own version", m.Version)
+		}
+	}
+}
+
+func TestUp_AppliesPendingUnderLock(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	expectLocked(mock)
+	// v2.0 was applied by hand before checksums were recorded.
+	expectApplied(mock, "v2.0-base", nil)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE schema_migrations SET checksum = $2 WHERE version = $1 AND checksum IS NULL`)).
+		WithArgs("v2.0-base", sum("CREATE TABLE base (id INT);")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, v := range []string{"v2.2.0-next", "v2.10.0-later"} {
+		m := testFS[v+".sql"]
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(string(m.Data))).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, applied_at, checksum, execution_ms)`)).
+			WithArgs(v, r.now(), sum(string(m.Data)), int64(0)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	expectUnlocked(mock)
+
+	res, err := r.Up(context.Background(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(res.Versions, ","); got != "v2.2.0-next,v2.10.0-later" {
+		t.Errorf("applied %s", got)
+	}
+}
+
+func TestUp_Target(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksum"}).AddRow(false, false))
+
+	res, err := r.Up(context.Background(), Options{Target: "v2.2.0-next", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(res.Versions, ","); got != "v2.0-base,v2.2.0-next" || !res.DryRun {
+		t.Errorf("plan %s", got)
+	}
+
+	if _, err := r.Up(context.Background(), Options{Target: "v9.0-missing"}); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestUp_ChecksumMismatch(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	expectLocked(mock)
+	expectApplied(mock, "v2.0-base", sum("CREATE TABLE base (id BIGINT);"))
+	expectUnlocked(mock)
+
+	_, err := r.Up(context.Background(), Options{})
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "v2.0-base") {
+		t.Errorf("got %v, want ErrChecksumMismatch naming v2.0-base", err)
+	}
+}
+
+func TestUp_FailedMigrationRollsBack(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	expectLocked(mock)
+	expectApplied(mock, "v2.0-base", sum("CREATE TABLE base (id INT);"))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE next`)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlocked(mock)
+
+	if _, err := r.Up(context.Background(), Options{}); err == nil || !strings.Contains(err.Error(), "apply v2.2.0-next") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	expectApplied(mock,
+		"v2.0-base", sum("CREATE TABLE base (id INT);"),
+		"v2.2.0-next", sum("edited"),
+		"v2.11.0-newer", sum("x"),
+	)
+
+	statuses, err := r.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range statuses {
+		got = append(got, s.Version+"="+string(s.State))
+	}
+	want := "v2.0-base=applied,v2.2.0-next=modified,v2.10.0-later=pending,v2.11.0-newer=orphaned"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, ","), want)
+	}
+	if !statuses[2].Reversible || statuses[0].Reversible {
+		t.Errorf("reversible flags wrong: %+v", statuses)
+	}
+}
+
+type fakeRecorder struct {
+	events []audit.Event
+}
+
+func (f *fakeRecorder) RecordTx(_ context.Context, _ *sql.Tx, e audit.Event) (*audit.Entry, error) {
+	f.events = append(f.events, e)
+	return &audit.Entry{}, nil
+}
+
+func TestDown_RevertsNewestAndAudits(t *testing.T) {
+	r, mock := newRunner(t, testFS)
+	rec := &fakeRecorder{}
+	r.SetAuditLog(rec)
+	expectLocked(mock)
+	expectApplied(mock,
+		"v2.0-base", sum("CREATE TABLE base (id INT);"),
+		"v2.2.0-next", sum("CREATE TABLE next (id INT);"),
+		"v2.10.0-later", sum("CREATE TABLE later (id INT);"),
+	)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE later;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM schema_migrations WHERE version = $1`)).
+		WithArgs("v2.10.0-later").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('audit_log') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectCommit()
+	expectUnlocked(mock)
+
+	res, err := r.Down(context.Background(), Options{Actor: "ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(res.Versions, ",") != "v2.10.0-later" {
+		t.Errorf("reverted %v", res.Versions)
+	}
+	if len(rec.events) != 1 || rec.events[0].Action != "schema.rollback" || rec.events[0].Actor != "ops@example.com" ||
+		rec.events[0].Target.ID != "v2.10.0-later" {
+		t.Errorf("audit events %+v", rec.events)
+	}
+}
+
+func TestDown_Refusals(t *testing.T) {
+	applied := []any{
+		"v2.0-base", sum("CREATE TABLE base (id INT);"),
+		"v2.2.0-next", sum("CREATE TABLE next (id INT);"),
+		"v2.10.0-later", sum("CREATE TABLE later (id INT);"),
+	}
+
+	// v2.2.0 has no down file, so reverting to v2.0 reverts nothing.
+	r, mock := newRunner(t, testFS)
+	expectApplied(mock, applied...)
+	if _, err := r.Down(context.Background(), Options{Target: "v2.0-base", DryRun: true}); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("got %v, want ErrIrreversible", err)
+	}
+
+	r, mock = newRunner(t, testFS)
+	expectApplied(mock, append(applied, "v2.11.0-newer", sum("x"))...)
+	if _, err := r.Down(context.Background(), Options{DryRun: true}); !errors.Is(err, ErrOrphaned) {
+		t.Errorf("got %v, want ErrOrphaned", err)
+	}
+}
@@ -0,0 +1,118 @@
+package opensaas
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+// AuditLog defines the interface for the audit log. *audit.Log
+// implements it.
+type AuditLog interface {
+	Record(ctx context.Context, e audit.Event) (*audit.Entry, error)
+	Query(ctx context.Context, f audit.Filter) ([]audit.Entry, error)
+	Verify(ctx context.Context) (*audit.Report, error)
+}
+
+// SetAuditLog wires the audit log used by admin endpoints.
+func (h *Handler) SetAuditLog(l AuditLog) {
+	h.auditLog = l
+}
+
+func (h *Handler) registerAuditRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/admin/audit", h.adminMiddleware(h.handleQueryAudit))
+	mux.HandleFunc("GET /api/opensaas/v1/admin/audit/verify", h.adminMiddleware(h.handleVerifyAudit))
+}
+
+// recordAudit appends an entry for an admin action taken by the caller.
+// The action has already happened, so a failure is logged rather than
+// returned to the client.
+func (h *Handler) recordAudit(r *http.Request, action string, target audit.Target, before, after any) {
+	if h.auditLog == nil {
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+	_, err := h.auditLog.Record(r.Context(), audit.Event{
+		Actor:  userID,
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	})
+	if err != nil {
+		h.logger.Error("audit record failed", "action", action, "target", target.ID, "error", err)
+	}
+}
+
+// handleQueryAudit filters the audit log by actor, action, target and
+// time range (RFC 3339), newest first. Page with before_id.
+func (h *Handler) handleQueryAudit(w http.ResponseWriter, r *http.Request) {
+	if h.auditLog == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Audit log not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	f := audit.Filter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", name+" must be an RFC 3339 time")
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "before_id must be an integer")
+			return
+		}
+		f.BeforeID = id
+	}
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+
+	entries, err := h.auditLog.Query(r.Context(), f)
+	if err != nil {
+		h.logger.Error("audit query failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Audit query failed")
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	h.respondJSON(w, http.StatusOK, entries)
+}
+
+// handleVerifyAudit recomputes the hash chain. A broken chain is reported
+// in the body with 200; the request itself succeeded.
+func (h *Handler) handleVerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if h.auditLog == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Audit log not configured")
+		return
+	}
+
+	report, err := h.auditLog.Verify(r.Context())
+	if err != nil {
+		h.logger.Error("audit verify failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Audit verification failed")
+		return
+	}
+	if !report.OK() {
+		h.logger.Error("audit chain broken", "entry_id", report.BrokenAt, "reason", report.Reason)
+	}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":     report.OK(),
+		"report": report,
+	})
+}
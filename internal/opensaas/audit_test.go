@@ -0,0 +1,145 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+)
+
+type mockAuditLog struct {
+	events []audit.Event
+	ctxs   []context.Context
+	filter audit.Filter
+	report audit.Report
+}
+
+func (m *mockAuditLog) Record(ctx context.Context, e audit.Event) (*audit.Entry, error) {
+	m.events = append(m.events, e)
+	m.ctxs = append(m.ctxs, ctx)
+	return &audit.Entry{ID: int64(len(m.events))}, nil
+}
+
+func (m *mockAuditLog) Query(ctx context.Context, f audit.Filter) ([]audit.Entry, error) {
+	m.filter = f
+	return []audit.Entry{{ID: 1, Actor: f.Actor}}, nil
+}
+
+func (m *mockAuditLog) Verify(ctx context.Context) (*audit.Report, error) {
+	return &m.report, nil
+}
+
+func newAuditMux(log *mockAuditLog) *http.ServeMux {
+	h := NewHandler(newMockUserService(), nil, &mockServerService{}, slog.Default())
+	h.SetTemplateService(newMockTemplateService())
+	h.SetAdminAuthorizer(mockAdminAuthorizer{})
+	h.SetAuditLog(log)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+func TestAudit_QueryFilters(t *testing.T) {
+	log := &mockAuditLog{}
+	mux := newAuditMux(log)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/opensaas/v1/admin/audit?actor=admin&target_type=guild&target_id=42&since=2025-06-01T00:00:00Z&before_id=90&limit=20",
+		http.NoBody)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := audit.Filter{
+		Actor: "admin", TargetType: "guild", TargetID: "42",
+		Since: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), BeforeID: 90, Limit: 20,
+	}
+	if log.filter != want {
+		t.Errorf("filter = %+v, want %+v", log.filter, want)
+	}
+}
+
+func TestAudit_QueryRejectsBadTime(t *testing.T) {
+	mux := newAuditMux(&mockAuditLog{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/admin/audit?until=yesterday", http.NoBody)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestAudit_AdminRequired(t *testing.T) {
+	mux := newAuditMux(&mockAuditLog{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/admin/audit", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestAudit_VerifyReportsBrokenChain(t *testing.T) {
+	log := &mockAuditLog{report: audit.Report{Checked: 4, BrokenAt: 5, Reason: "entry contents do not match its hash"}}
+	mux := newAuditMux(log)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/admin/audit/verify", http.NoBody)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data struct {
+			OK     bool         `json:"ok"`
+			Report audit.Report `json:"report"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Data.OK || resp.Data.Report.BrokenAt != 5 {
+		t.Errorf("unexpected response %s", rec.Body.String())
+	}
+}
+
+func TestAudit_TemplateUpdateRecorded(t *testing.T) {
+	log := &mockAuditLog{}
+	mux := newAuditMux(log)
+
+	body := `{"name":"Minecraft Large","game_type":"minecraft","size":"large"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/opensaas/v1/admin/templates/minecraft-large", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	req.Header.Set("X-Request-ID", "req-7")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(log.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(log.events))
+	}
+	e := log.events[0]
+	if e.Actor != "admin" || e.Action != "template.update" || e.Target.ID != "minecraft-large" || e.Before == nil {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if got := audit.RequestFromContext(log.ctxs[0]); got.ID != "req-7" || got.IP != "203.0.113.9" {
+		t.Errorf("request = %+v", got)
+	}
+}
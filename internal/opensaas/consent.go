@@ -0,0 +1,178 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/consent"
+	"github.com/wethegamers/agis/internal/middleware"
+)
+
+// ConsentService defines the interface for consent management.
+type ConsentService interface {
+	Status(ctx context.Context, userID, country string) ([]consent.Decision, error)
+	Allowed(ctx context.Context, userID string, t consent.Type, country string) (bool, error)
+	Record(ctx context.Context, u consent.Update) (consent.Decision, error)
+	CurrentTexts(ctx context.Context, locale string) ([]consent.Text, error)
+	Publish(ctx context.Context, text consent.Text) (consent.Text, error)
+}
+
+// SetConsentService wires the consent management service.
+func (h *Handler) SetConsentService(svc ConsentService) {
+	h.consentService = svc
+}
+
+func (h *Handler) registerConsentRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/consent/texts", h.handleConsentTexts)
+	mux.HandleFunc("GET /api/opensaas/v1/user/me/consent", h.authMiddleware(h.handleGetConsent))
+	mux.HandleFunc("PUT /api/opensaas/v1/user/me/consent/{type}", h.authMiddleware(h.handleUpdateConsent))
+	mux.HandleFunc("POST /api/opensaas/v1/admin/consent/texts", h.adminMiddleware(h.handlePublishConsentText))
+}
+
+// requireConsent wraps an authenticated handler so it only runs when the
+// user has granted consent of type t. Use it for analytics and ad actions.
+func (h *Handler) requireConsent(t consent.Type, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.consentService == nil {
+			h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Consent service not configured")
+			return
+		}
+		userID := r.Context().Value(contextKeyUserID).(string)
+
+		ok, err := h.consentService.Allowed(r.Context(), userID, t, consent.CountryFromRequest(r))
+		if err != nil {
+			h.respondConsentError(w, err)
+			return
+		}
+		if !ok {
+			h.respondError(w, http.StatusForbidden, "CONSENT_REQUIRED", "Consent required: "+string(t))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) handleConsentTexts(w http.ResponseWriter, r *http.Request) {
+	if h.consentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Consent service not configured")
+		return
+	}
+
+	texts, err := h.consentService.CurrentTexts(r.Context(), requestLocale(r))
+	if err != nil {
+		h.respondConsentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, texts)
+}
+
+func (h *Handler) handleGetConsent(w http.ResponseWriter, r *http.Request) {
+	if h.consentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Consent service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	decisions, err := h.consentService.Status(r.Context(), userID, consent.CountryFromRequest(r))
+	if err != nil {
+		h.respondConsentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, decisions)
+}
+
+func (h *Handler) handleUpdateConsent(w http.ResponseWriter, r *http.Request) {
+	if h.consentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Consent service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	var req struct {
+		Consented *bool  `json:"consented"`
+		Version   int    `json:"version"`
+		Locale    string `json:"locale"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Consented == nil {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "consented is required")
+		return
+	}
+	if req.Locale == "" {
+		req.Locale = requestLocale(r)
+	}
+
+	d, err := h.consentService.Record(r.Context(), consent.Update{
+		UserID:    userID,
+		Type:      consent.Type(r.PathValue("type")),
+		Consented: *req.Consented,
+		Version:   req.Version,
+		Locale:    req.Locale,
+		IPAddress: middleware.IPKeyFunc(r),
+		Country:   consent.CountryFromRequest(r),
+	})
+	if err != nil {
+		h.respondConsentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, d)
+}
+
+func (h *Handler) handlePublishConsentText(w http.ResponseWriter, r *http.Request) {
+	if h.consentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Consent service not configured")
+		return
+	}
+
+	var text consent.Text
+	if err := json.NewDecoder(r.Body).Decode(&text); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	published, err := h.consentService.Publish(r.Context(), text)
+	if err != nil {
+		h.respondConsentError(w, err)
+		return
+	}
+	h.recordAudit(r, "consent_text.publish",
+		audit.Target{Type: "consent_text", ID: string(published.Type) + ":" + strconv.Itoa(published.Version) + ":" + published.Locale},
+		nil, published)
+	h.respondJSON(w, http.StatusCreated, published)
+}
+
+// requestLocale returns the locale query parameter, or the first language
+// of Accept-Language.
+func requestLocale(r *http.Request) string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		return locale
+	}
+	lang, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	return strings.TrimSpace(lang)
+}
+
+// respondConsentError maps consent errors to API errors.
+func (h *Handler) respondConsentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, consent.ErrUnknownType), errors.Is(err, consent.ErrInvalidText):
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+	case errors.Is(err, consent.ErrUnknownVersion):
+		h.respondError(w, http.StatusNotFound, "CONSENT_TEXT_NOT_FOUND", err.Error())
+	case errors.Is(err, consent.ErrStaleVersion):
+		h.respondError(w, http.StatusConflict, "CONSENT_TEXT_OUTDATED", err.Error())
+	case errors.Is(err, consent.ErrTextExists):
+		h.respondError(w, http.StatusConflict, "CONSENT_TEXT_EXISTS", "Consent text already published")
+	default:
+		h.logger.Error("consent operation failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Consent operation failed")
+	}
+}
@@ -0,0 +1,132 @@
+package opensaas
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/consent"
+)
+
+type mockConsentService struct {
+	granted bool
+	updates []consent.Update
+	locale  string
+}
+
+func (m *mockConsentService) Status(ctx context.Context, userID, country string) ([]consent.Decision, error) {
+	return []consent.Decision{{Type: consent.TypeAds, Granted: m.granted, ConsentRequired: consent.RequiresOptIn(country)}}, nil
+}
+
+func (m *mockConsentService) Allowed(ctx context.Context, userID string, t consent.Type, country string) (bool, error) {
+	return m.granted, nil
+}
+
+func (m *mockConsentService) Record(ctx context.Context, u consent.Update) (consent.Decision, error) {
+	if !u.Type.Valid() {
+		return consent.Decision{}, consent.ErrUnknownType
+	}
+	if u.Version == 1 {
+		return consent.Decision{}, consent.ErrStaleVersion
+	}
+	m.updates = append(m.updates, u)
+	return consent.Decision{Type: u.Type, Granted: u.Consented}, nil
+}
+
+func (m *mockConsentService) CurrentTexts(ctx context.Context, locale string) ([]consent.Text, error) {
+	m.locale = locale
+	return []consent.Text{{Type: consent.TypeAds, Version: 2, Locale: consent.DefaultLocale}}, nil
+}
+
+func (m *mockConsentService) Publish(ctx context.Context, text consent.Text) (consent.Text, error) {
+	return text, nil
+}
+
+func newConsentMux(svc ConsentService) *http.ServeMux {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	h.SetConsentService(svc)
+	h.SetExperimentService(&mockExperimentService{})
+	h.SetAdminAuthorizer(mockAdminAuthorizer{})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+func TestConsent_UpdateRecordsRequestContext(t *testing.T) {
+	svc := &mockConsentService{}
+	mux := newConsentMux(svc)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/opensaas/v1/user/me/consent/ads",
+		strings.NewReader(`{"consented":true,"version":2}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	req.Header.Set(consent.CountryHeader, "de")
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || len(svc.updates) != 1 {
+		t.Fatalf("expected 200 and one update, got %d: %s", rec.Code, rec.Body.String())
+	}
+	u := svc.updates[0]
+	if u.UserID != "123456789" || u.Country != "DE" || u.Locale != "de-DE" {
+		t.Errorf("unexpected update %+v", u)
+	}
+}
+
+func TestConsent_UpdateStaleVersion(t *testing.T) {
+	mux := newConsentMux(&mockConsentService{})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/opensaas/v1/user/me/consent/ads",
+		strings.NewReader(`{"consented":true,"version":1}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestConsent_UpdateRequiresDecision(t *testing.T) {
+	mux := newConsentMux(&mockConsentService{})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/opensaas/v1/user/me/consent/ads", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestConsent_TextsUseQueryLocale(t *testing.T) {
+	svc := &mockConsentService{}
+	mux := newConsentMux(svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/consent/texts?locale=fr", http.NoBody)
+	req.Header.Set("Accept-Language", "de")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || svc.locale != "fr" {
+		t.Errorf("expected texts in fr, got %d %q", rec.Code, svc.locale)
+	}
+}
+
+func TestConsent_RequireConsentBlocksAnalytics(t *testing.T) {
+	mux := newConsentMux(&mockConsentService{granted: false})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/experiments/ad-reward-multiplier/events",
+		strings.NewReader(`{"event_type":"exposure"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "CONSENT_REQUIRED") {
+		t.Errorf("expected 403 CONSENT_REQUIRED, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,160 @@
+package opensaas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/wethegamers/agis/internal/discordoauth"
+)
+
+// ErrDiscordAlreadyLinked is returned by UserService.LinkDiscordAccount
+// when the Discord account is linked to another user.
+var ErrDiscordAlreadyLinked = errors.New("opensaas: discord account already linked to another user")
+
+// DiscordOAuth runs the Discord OAuth2 PKCE flow. *discordoauth.Client
+// implements it.
+type DiscordOAuth interface {
+	Start(ctx context.Context, userID int) (authURL string, expiresAt time.Time, err error)
+	Complete(ctx context.Context, state, code string) (int, *discordoauth.User, error)
+}
+
+// SetDiscordOAuth wires Discord account linking. If returnURL is set, the
+// callback redirects the browser there with discord_link and, on failure,
+// error query parameters; otherwise it responds with JSON.
+func (h *Handler) SetDiscordOAuth(oauth DiscordOAuth, returnURL string) {
+	h.discordOAuth = oauth
+	h.linkReturnURL = returnURL
+}
+
+// handleLinkDiscordStart begins linking a Discord account to the
+// authenticated Wasp user.
+func (h *Handler) handleLinkDiscordStart(w http.ResponseWriter, r *http.Request) {
+	if h.discordOAuth == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Discord linking not configured")
+		return
+	}
+	subject := r.Context().Value(contextKeyUserID).(string)
+
+	user, err := h.resolveWaspUser(r.Context(), subject)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+
+	authURL, expiresAt, err := h.discordOAuth.Start(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Error("failed to start discord link", "user_id", user.ID, "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start Discord linking")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"authorization_url": authURL,
+		"expires_at":        expiresAt,
+	})
+}
+
+// handleLinkDiscordCallback is Discord's redirect target. It carries no
+// bearer token; the server-side state identifies the Wasp user.
+func (h *Handler) handleLinkDiscordCallback(w http.ResponseWriter, r *http.Request) {
+	if h.discordOAuth == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Discord linking not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		h.respondLink(w, r, http.StatusBadRequest, "AUTHORIZATION_DENIED", "Discord authorization was denied", nil)
+		return
+	}
+	if q.Get("state") == "" || q.Get("code") == "" {
+		h.respondLink(w, r, http.StatusBadRequest, "INVALID_REQUEST", "state and code are required", nil)
+		return
+	}
+
+	userID, discordUser, err := h.discordOAuth.Complete(r.Context(), q.Get("state"), q.Get("code"))
+	switch {
+	case errors.Is(err, discordoauth.ErrInvalidState):
+		h.respondLink(w, r, http.StatusBadRequest, "INVALID_STATE", "Link request is invalid or has expired", nil)
+		return
+	case errors.Is(err, discordoauth.ErrExchange):
+		h.respondLink(w, r, http.StatusBadRequest, "EXCHANGE_FAILED", "Discord authorization code was rejected", nil)
+		return
+	case err != nil:
+		h.logger.Error("discord link callback failed", "error", err)
+		h.respondLink(w, r, http.StatusBadGateway, "DISCORD_UNAVAILABLE", "Could not verify Discord account", nil)
+		return
+	}
+
+	// The account may already be linked, to this user or someone else.
+	if existing, err := h.userService.GetUserByDiscordID(r.Context(), discordUser.ID); err == nil && existing != nil {
+		if existing.ID != userID {
+			h.respondLink(w, r, http.StatusConflict, "DISCORD_ALREADY_LINKED", "Discord account is linked to another user", nil)
+			return
+		}
+		h.respondLink(w, r, http.StatusOK, "", "", discordUser)
+		return
+	}
+
+	if err := h.userService.LinkDiscordAccount(r.Context(), userID, discordUser.ID); err != nil {
+		if errors.Is(err, ErrDiscordAlreadyLinked) {
+			h.respondLink(w, r, http.StatusConflict, "DISCORD_ALREADY_LINKED", "Discord account is linked to another user", nil)
+			return
+		}
+		h.logger.Error("failed to link discord account", "user_id", userID, "error", err)
+		h.respondLink(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to link Discord account", nil)
+		return
+	}
+	h.logger.Info("discord account linked", "user_id", userID, "discord_id", discordUser.ID)
+	h.respondLink(w, r, http.StatusOK, "", "", discordUser)
+}
+
+// resolveWaspUser finds the Wasp user for an authenticated subject. Until
+// Wasp JWTs are validated the subject is either a linked Discord ID or the
+// account email.
+func (h *Handler) resolveWaspUser(ctx context.Context, subject string) (*User, error) {
+	if user, err := h.userService.GetUserByDiscordID(ctx, subject); err == nil && user != nil {
+		return user, nil
+	}
+	user, err := h.userService.GetUserByEmail(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+// respondLink finishes the callback, redirecting to the configured return
+// URL when there is one.
+func (h *Handler) respondLink(w http.ResponseWriter, r *http.Request, status int, code, message string, user *discordoauth.User) {
+	if h.linkReturnURL != "" {
+		u, err := url.Parse(h.linkReturnURL)
+		if err == nil {
+			q := u.Query()
+			if code == "" {
+				q.Set("discord_link", "linked")
+			} else {
+				q.Set("discord_link", "error")
+				q.Set("error", code)
+			}
+			u.RawQuery = q.Encode()
+			http.Redirect(w, r, u.String(), http.StatusFound)
+			return
+		}
+		h.logger.Error("invalid discord link return URL", "error", err)
+	}
+
+	if code != "" {
+		h.respondError(w, status, code, message)
+		return
+	}
+	h.respondJSON(w, status, map[string]string{
+		"status":     "linked",
+		"discord_id": user.ID,
+		"username":   user.Username,
+	})
+}
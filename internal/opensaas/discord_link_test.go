@@ -0,0 +1,155 @@
+package opensaas
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/discordoauth"
+)
+
+// newFakeDiscord stubs Discord's token and user endpoints, returning
+// discordID as the verified user.
+func newFakeDiscord(t *testing.T, discordID string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("GET /users/@me", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id": discordID, "username": "player"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newLinkMux(t *testing.T, users *mockUserService, discordID, returnURL string) *http.ServeMux {
+	t.Helper()
+	srv := newFakeDiscord(t, discordID)
+	client, err := discordoauth.NewClient(discordoauth.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://agis.example/api/opensaas/v1/user/link-discord/callback",
+		TokenURL:     srv.URL + "/token",
+		APIBaseURL:   srv.URL,
+	}, discordoauth.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(users, nil, nil, slog.Default())
+	h.SetDiscordOAuth(client, returnURL)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+// startLink runs the start endpoint as subject and returns the state.
+func startLink(t *testing.T, mux *http.ServeMux, subject string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/user/link-discord/start", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+subject)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("start: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(resp.Data.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state")
+}
+
+func callback(mux *http.ServeMux, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/opensaas/v1/user/link-discord/callback?code=code&state="+url.QueryEscape(state), http.NoBody)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLinkDiscord_LinksVerifiedAccount(t *testing.T) {
+	users := newMockUserService()
+	users.users["wasp-2"] = &User{ID: 2, Email: "new@example.com"}
+	mux := newLinkMux(t, users, "555", "")
+
+	state := startLink(t, mux, "new@example.com")
+	rec := callback(mux, state)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if users.linked[2] != "555" {
+		t.Errorf("expected user 2 linked to 555, got %v", users.linked)
+	}
+
+	// The state is single-use.
+	if rec := callback(mux, state); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected replayed state to fail, got %d", rec.Code)
+	}
+}
+
+func TestLinkDiscord_ConflictWithOtherUser(t *testing.T) {
+	users := newMockUserService()
+	users.users["wasp-2"] = &User{ID: 2, Email: "new@example.com"}
+	// 123456789 already belongs to user 1.
+	mux := newLinkMux(t, users, "123456789", "")
+
+	rec := callback(mux, startLink(t, mux, "new@example.com"))
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+	if len(users.linked) != 0 {
+		t.Errorf("expected no link, got %v", users.linked)
+	}
+}
+
+func TestLinkDiscord_RedirectsToReturnURL(t *testing.T) {
+	users := newMockUserService()
+	mux := newLinkMux(t, users, "555", "https://app.example/settings")
+
+	rec := callback(mux, "forged-state")
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d", rec.Code)
+	}
+	loc := rec.Header().Get("Location")
+	if !strings.HasPrefix(loc, "https://app.example/settings?") || !strings.Contains(loc, "error=INVALID_STATE") {
+		t.Errorf("unexpected redirect %s", loc)
+	}
+}
+
+func TestLinkDiscord_NotConfigured(t *testing.T) {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/user/link-discord/start", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wethegamers/agis/internal/consent"
+	"github.com/wethegamers/agis/internal/experiments"
+)
+
+// ExperimentService defines the interface for A/B experiment operations.
+type ExperimentService interface {
+	Assign(ctx context.Context, experimentID, userID string) (experiments.Assignment, error)
+	Record(ctx context.Context, experimentID, userID, eventType string, value float64, metadata map[string]any) (bool, error)
+	Results(ctx context.Context, experimentID string) (*experiments.Results, error)
+}
+
+// SetExperimentService wires the A/B experiment service.
+func (h *Handler) SetExperimentService(svc ExperimentService) {
+	h.experimentService = svc
+}
+
+func (h *Handler) registerExperimentRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/experiments/{id}/assignment", h.authMiddleware(h.handleExperimentAssignment))
+	mux.HandleFunc("POST /api/opensaas/v1/experiments/{id}/events", h.authMiddleware(h.requireConsent(consent.TypeAnalytics, h.handleExperimentEvent)))
+	mux.HandleFunc("GET /api/opensaas/v1/admin/experiments/{id}/results", h.adminMiddleware(h.handleExperimentResults))
+}
+
+func (h *Handler) handleExperimentAssignment(w http.ResponseWriter, r *http.Request) {
+	if h.experimentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Experiment service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	a, err := h.experimentService.Assign(r.Context(), r.PathValue("id"), userID)
+	if err != nil {
+		h.respondExperimentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) handleExperimentEvent(w http.ResponseWriter, r *http.Request) {
+	if h.experimentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Experiment service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	var req struct {
+		EventType string         `json:"event_type"`
+		Value     *float64       `json:"value"`
+		Metadata  map[string]any `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.EventType == "" {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "event_type is required")
+		return
+	}
+	// Conversions and revenue come from payments, never from clients.
+	if !experiments.ClientEvent(req.EventType) {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "event_type must be exposure or click")
+		return
+	}
+	if req.Value != nil {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "value is not accepted")
+		return
+	}
+
+	recorded, err := h.experimentService.Record(r.Context(), r.PathValue("id"), userID, req.EventType, 0, req.Metadata)
+	if err != nil {
+		h.respondExperimentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusAccepted, map[string]bool{"recorded": recorded})
+}
+
+func (h *Handler) handleExperimentResults(w http.ResponseWriter, r *http.Request) {
+	if h.experimentService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Experiment service not configured")
+		return
+	}
+
+	res, err := h.experimentService.Results(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.respondExperimentError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, res)
+}
+
+// respondExperimentError maps experiment errors to API errors.
+func (h *Handler) respondExperimentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, experiments.ErrNotFound) {
+		h.respondError(w, http.StatusNotFound, "EXPERIMENT_NOT_FOUND", "Experiment not found")
+		return
+	}
+	h.logger.Error("experiment operation failed", "error", err)
+	h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Experiment operation failed")
+}
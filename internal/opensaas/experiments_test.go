@@ -0,0 +1,104 @@
+package opensaas
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/experiments"
+)
+
+type mockExperimentService struct {
+	events int
+}
+
+func (m *mockExperimentService) Assign(ctx context.Context, experimentID, userID string) (experiments.Assignment, error) {
+	if experimentID != "ad-reward-multiplier" {
+		return experiments.Assignment{}, experiments.ErrNotFound
+	}
+	return experiments.Assignment{ExperimentID: experimentID, UserID: userID, Enrolled: true, VariantID: "boost"}, nil
+}
+
+func (m *mockExperimentService) Record(ctx context.Context, experimentID, userID, eventType string, value float64, metadata map[string]any) (bool, error) {
+	m.events++
+	return true, nil
+}
+
+func (m *mockExperimentService) Results(ctx context.Context, experimentID string) (*experiments.Results, error) {
+	return &experiments.Results{ExperimentID: experimentID}, nil
+}
+
+func newExperimentMux(svc ExperimentService) *http.ServeMux {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	h.SetExperimentService(svc)
+	h.SetConsentService(&mockConsentService{granted: true})
+	h.SetAdminAuthorizer(mockAdminAuthorizer{})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+func TestExperiments_AssignmentNotFound(t *testing.T) {
+	mux := newExperimentMux(&mockExperimentService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/experiments/unknown/assignment", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestExperiments_RecordEvent(t *testing.T) {
+	svc := &mockExperimentService{}
+	mux := newExperimentMux(svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/experiments/ad-reward-multiplier/events",
+		strings.NewReader(`{"event_type":"click"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted || svc.events != 1 {
+		t.Errorf("expected 202 and one event, got %d and %d", rec.Code, svc.events)
+	}
+}
+
+func TestExperiments_RejectsServerEvents(t *testing.T) {
+	for _, body := range []string{
+		`{"event_type":"conversion"}`,
+		`{"event_type":"revenue","value":100}`,
+		`{"event_type":"exposure","value":1}`,
+	} {
+		svc := &mockExperimentService{}
+		mux := newExperimentMux(svc)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/experiments/ad-reward-multiplier/events",
+			strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer 123456789")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest || svc.events != 0 {
+			t.Errorf("%s: expected 400 and no event, got %d and %d", body, rec.Code, svc.events)
+		}
+	}
+}
+
+func TestExperiments_ResultsRequireAdmin(t *testing.T) {
+	mux := newExperimentMux(&mockExperimentService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/admin/experiments/ad-reward-multiplier/results", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
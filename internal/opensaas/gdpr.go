@@ -0,0 +1,149 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/wethegamers/agis/internal/gdpr"
+)
+
+// GDPRService defines the interface for data export and erasure.
+type GDPRService interface {
+	Export(ctx context.Context, discordID string) (*gdpr.Bundle, error)
+	RequestErasure(ctx context.Context, discordID string) (*gdpr.ErasureRequest, error)
+	CancelErasure(ctx context.Context, discordID string) error
+	ErasureStatus(ctx context.Context, discordID string) (*gdpr.ErasureRequest, error)
+	VerifyReceipt(r gdpr.Receipt) error
+}
+
+// SetGDPRService wires the data export and erasure service.
+func (h *Handler) SetGDPRService(svc GDPRService) {
+	h.gdprService = svc
+}
+
+func (h *Handler) registerGDPRRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/user/me/export", h.authMiddleware(h.handleExportUserData))
+	mux.HandleFunc("DELETE /api/opensaas/v1/user/me", h.authMiddleware(h.handleRequestErasure))
+	mux.HandleFunc("GET /api/opensaas/v1/user/me/erasure", h.authMiddleware(h.handleErasureStatus))
+	mux.HandleFunc("DELETE /api/opensaas/v1/user/me/erasure", h.authMiddleware(h.handleCancelErasure))
+	mux.HandleFunc("POST /api/opensaas/v1/gdpr/receipts/verify", h.handleVerifyReceipt)
+}
+
+func (h *Handler) handleExportUserData(w http.ResponseWriter, r *http.Request) {
+	if h.gdprService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GDPR service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "format must be json or zip")
+		return
+	}
+
+	bundle, err := h.gdprService.Export(r.Context(), userID)
+	if err != nil {
+		h.respondGDPRError(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("agis-export-%s.%s", bundle.GeneratedAt.Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		err = bundle.WriteZIP(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = bundle.WriteJSON(w)
+	}
+	if err != nil {
+		// Headers are already sent; all we can do is log.
+		h.logger.Error("failed to write data export", "error", err)
+	}
+}
+
+func (h *Handler) handleRequestErasure(w http.ResponseWriter, r *http.Request) {
+	if h.gdprService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GDPR service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	req, err := h.gdprService.RequestErasure(r.Context(), userID)
+	if err != nil {
+		h.respondGDPRError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusAccepted, req)
+}
+
+func (h *Handler) handleErasureStatus(w http.ResponseWriter, r *http.Request) {
+	if h.gdprService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GDPR service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	req, err := h.gdprService.ErasureStatus(r.Context(), userID)
+	if err != nil {
+		h.respondGDPRError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, req)
+}
+
+func (h *Handler) handleCancelErasure(w http.ResponseWriter, r *http.Request) {
+	if h.gdprService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GDPR service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	if err := h.gdprService.CancelErasure(r.Context(), userID); err != nil {
+		h.respondGDPRError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, map[string]string{"status": gdpr.StatusCancelled})
+}
+
+func (h *Handler) handleVerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	if h.gdprService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GDPR service not configured")
+		return
+	}
+
+	var receipt gdpr.Receipt
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	err := h.gdprService.VerifyReceipt(receipt)
+	if err != nil && !errors.Is(err, gdpr.ErrInvalidReceipt) {
+		h.respondGDPRError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, map[string]bool{"valid": err == nil})
+}
+
+// respondGDPRError maps GDPR errors to API errors.
+func (h *Handler) respondGDPRError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gdpr.ErrNotFound):
+		h.respondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+	case errors.Is(err, gdpr.ErrNoRequest):
+		h.respondError(w, http.StatusNotFound, "NO_ERASURE_REQUEST", "No erasure request")
+	case errors.Is(err, gdpr.ErrNotCancellable):
+		h.respondError(w, http.StatusConflict, "NOT_CANCELLABLE", "Erasure request can no longer be cancelled")
+	default:
+		h.logger.Error("gdpr operation failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "GDPR operation failed")
+	}
+}
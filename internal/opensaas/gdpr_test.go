@@ -0,0 +1,129 @@
+package opensaas
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/gdpr"
+)
+
+type mockGDPRService struct {
+	erasures int
+}
+
+func (m *mockGDPRService) Export(ctx context.Context, discordID string) (*gdpr.Bundle, error) {
+	return &gdpr.Bundle{
+		SubjectID:   discordID,
+		GeneratedAt: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Sections:    map[string][]gdpr.Record{"user": {{"discord_id": discordID}}},
+	}, nil
+}
+
+func (m *mockGDPRService) RequestErasure(ctx context.Context, discordID string) (*gdpr.ErasureRequest, error) {
+	m.erasures++
+	return &gdpr.ErasureRequest{ID: 1, Status: gdpr.StatusPending}, nil
+}
+
+func (m *mockGDPRService) CancelErasure(ctx context.Context, discordID string) error {
+	return gdpr.ErrNotCancellable
+}
+
+func (m *mockGDPRService) ErasureStatus(ctx context.Context, discordID string) (*gdpr.ErasureRequest, error) {
+	return nil, gdpr.ErrNoRequest
+}
+
+func (m *mockGDPRService) VerifyReceipt(r gdpr.Receipt) error {
+	if r.Signature != "good" {
+		return gdpr.ErrInvalidReceipt
+	}
+	return nil
+}
+
+func newGDPRMux(svc GDPRService) *http.ServeMux {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	h.SetGDPRService(svc)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+func TestGDPR_ExportZIP(t *testing.T) {
+	mux := newGDPRMux(&mockGDPRService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/user/me/export?format=zip", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected zip download, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Errorf("expected user.json and manifest.json, got %d files", len(zr.File))
+	}
+}
+
+func TestGDPR_ExportRejectsUnknownFormat(t *testing.T) {
+	mux := newGDPRMux(&mockGDPRService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/user/me/export?format=xml", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestGDPR_RequestErasure(t *testing.T) {
+	svc := &mockGDPRService{}
+	mux := newGDPRMux(svc)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/opensaas/v1/user/me", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted || svc.erasures != 1 {
+		t.Errorf("expected 202 and one request, got %d and %d", rec.Code, svc.erasures)
+	}
+}
+
+func TestGDPR_CancelCompletedErasure(t *testing.T) {
+	mux := newGDPRMux(&mockGDPRService{})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/opensaas/v1/user/me/erasure", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestGDPR_VerifyReceipt(t *testing.T) {
+	mux := newGDPRMux(&mockGDPRService{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/gdpr/receipts/verify",
+		strings.NewReader(`{"request_id":1,"signature":"bad"}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"valid":false`) {
+		t.Errorf("expected invalid receipt, got %d %s", rec.Code, rec.Body.String())
+	}
+}
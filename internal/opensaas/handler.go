@@ -8,14 +8,21 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/events"
+	"github.com/wethegamers/agis/internal/templates"
 )
 
 // UserService defines the interface for user operations.
 type UserService interface {
 	GetUserByDiscordID(ctx context.Context, discordID string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// LinkDiscordAccount links a verified Discord ID to a Wasp user. It
+	// returns ErrDiscordAlreadyLinked if the ID belongs to another user.
 	LinkDiscordAccount(ctx context.Context, userID int, discordID string) error
 	GetUserCredits(ctx context.Context, userID int) (credits int, wtgCoins int, err error)
 	UpdateUserTier(ctx context.Context, userID int, tier string, expiresAt *time.Time) error
@@ -31,17 +38,71 @@ type PaymentService interface {
 // ServerService defines the interface for server operations.
 type ServerService interface {
 	GetUserServers(ctx context.Context, userID int) ([]Server, error)
-	CreateServer(ctx context.Context, userID int, gameType, name string) (*Server, error)
+	// CreateServer creates a server from spec. A spec without resources
+	// uses the game's default resources.
+	CreateServer(ctx context.Context, userID int, spec ServerSpec) (*Server, error)
 	DeleteServer(ctx context.Context, userID int, serverID int) error
 	ControlServer(ctx context.Context, userID int, serverID int, action string) error
 }
 
+// ServerSpec describes a server to create. The resource fields come from
+// the chosen template and are empty when none was chosen.
+type ServerSpec struct {
+	GameType      string
+	Name          string
+	TemplateID    string
+	DockerImage   string
+	MaxPlayers    int
+	CPURequest    string
+	MemoryRequest string
+	CPULimit      string
+	MemoryLimit   string
+}
+
+// SpecFromTemplate builds a ServerSpec named name with t's game and resources.
+func SpecFromTemplate(name string, t *templates.Template) ServerSpec {
+	return ServerSpec{
+		GameType:      t.GameType,
+		Name:          name,
+		TemplateID:    t.ID,
+		DockerImage:   t.DockerImage,
+		MaxPlayers:    t.MaxPlayers,
+		CPURequest:    t.CPURequest,
+		MemoryRequest: t.MemoryRequest,
+		CPULimit:      t.CPULimit,
+		MemoryLimit:   t.MemoryLimit,
+	}
+}
+
 // Handler provides HTTP handlers for OpenSaaS integration.
 type Handler struct {
 	userService    UserService
 	paymentService PaymentService
 	serverService  ServerService
 	logger         *slog.Logger
+
+	treasuryService   TreasuryService
+	templateService   TemplateService
+	experimentService ExperimentService
+	gdprService       GDPRService
+	consentService    ConsentService
+	webhookService    WebhookService
+	auditLog          AuditLog
+	discordOAuth      DiscordOAuth
+	linkReturnURL     string
+	serverEvents      ServerEventSource
+	sseHeartbeat      time.Duration
+	adminAuthorizer   AdminAuthorizer
+}
+
+// AdminAuthorizer decides whether a Discord user is a platform admin.
+type AdminAuthorizer interface {
+	IsPlatformAdmin(ctx context.Context, discordID string) (bool, error)
+}
+
+// SetAdminAuthorizer wires the platform admin check used by admin endpoints.
+func (h *Handler) SetAdminAuthorizer(a AdminAuthorizer) {
+	h.adminAuthorizer = a
 }
 
 // User represents a user in the system.
@@ -75,6 +136,7 @@ type Server struct {
 	UserID      int       `json:"user_id"`
 	Name        string    `json:"name"`
 	GameType    string    `json:"game_type"`
+	TemplateID  string    `json:"template_id,omitempty"`
 	Status      string    `json:"status"`
 	Address     string    `json:"address,omitempty"`
 	Port        int       `json:"port,omitempty"`
@@ -94,6 +156,7 @@ func NewHandler(
 		paymentService: paymentSvc,
 		serverService:  serverSvc,
 		logger:         logger,
+		sseHeartbeat:   sseHeartbeat,
 	}
 }
 
@@ -101,7 +164,8 @@ func NewHandler(
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// User endpoints
 	mux.HandleFunc("GET /api/opensaas/v1/user/me", h.authMiddleware(h.handleGetCurrentUser))
-	mux.HandleFunc("POST /api/opensaas/v1/user/link-discord", h.authMiddleware(h.handleLinkDiscord))
+	mux.HandleFunc("POST /api/opensaas/v1/user/link-discord/start", h.authMiddleware(h.handleLinkDiscordStart))
+	mux.HandleFunc("GET /api/opensaas/v1/user/link-discord/callback", h.handleLinkDiscordCallback)
 	mux.HandleFunc("GET /api/opensaas/v1/user/credits", h.authMiddleware(h.handleGetCredits))
 
 	// Server endpoints
@@ -109,6 +173,7 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/opensaas/v1/servers", h.authMiddleware(h.handleCreateServer))
 	mux.HandleFunc("DELETE /api/opensaas/v1/servers/{id}", h.authMiddleware(h.handleDeleteServer))
 	mux.HandleFunc("POST /api/opensaas/v1/servers/{id}/control", h.authMiddleware(h.handleControlServer))
+	h.registerServerEventRoutes(mux)
 
 	// Payment endpoints (Stripe/LemonSqueezy compatible)
 	mux.HandleFunc("POST /api/opensaas/v1/payments/checkout", h.authMiddleware(h.handleCreateCheckout))
@@ -120,6 +185,27 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/opensaas/v1/subscription/upgrade", h.authMiddleware(h.handleUpgradeSubscription))
 	mux.HandleFunc("POST /api/opensaas/v1/subscription/cancel", h.authMiddleware(h.handleCancelSubscription))
 
+	// Guild treasury endpoints
+	h.registerTreasuryRoutes(mux)
+
+	// Server templates
+	h.registerTemplateRoutes(mux)
+
+	// A/B experiments
+	h.registerExperimentRoutes(mux)
+
+	// GDPR export and erasure
+	h.registerGDPRRoutes(mux)
+
+	// Consent management
+	h.registerConsentRoutes(mux)
+
+	// Outbound webhooks
+	h.registerWebhookRoutes(mux)
+
+	// Audit log
+	h.registerAuditRoutes(mux)
+
 	// Game catalog
 	mux.HandleFunc("GET /api/opensaas/v1/games", h.handleListGames)
 	mux.HandleFunc("GET /api/opensaas/v1/shop/packages", h.handleListPackages)
@@ -186,10 +272,33 @@ func (h *Handler) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Extract user ID from context (set by Wasp middleware or our validation)
 		ctx := context.WithValue(r.Context(), contextKeyUserID, token)
+		ctx = audit.WithRequest(ctx, audit.RequestFromHTTP(r))
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// adminMiddleware authenticates the request and requires a platform admin.
+func (h *Handler) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if h.adminAuthorizer == nil {
+			h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Admin authorization not configured")
+			return
+		}
+		userID := r.Context().Value(contextKeyUserID).(string)
+		ok, err := h.adminAuthorizer.IsPlatformAdmin(r.Context(), userID)
+		if err != nil {
+			h.logger.Error("admin authorization failed", "error", err)
+			h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Admin authorization failed")
+			return
+		}
+		if !ok {
+			h.respondError(w, http.StatusForbidden, "FORBIDDEN", "Platform admin required")
+			return
+		}
+		next(w, r)
+	})
+}
+
 // Handler implementations
 
 func (h *Handler) handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
@@ -204,21 +313,6 @@ func (h *Handler) handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, user)
 }
 
-func (h *Handler) handleLinkDiscord(w http.ResponseWriter, r *http.Request) {
-	// Parse request
-	var req struct {
-		DiscordID string `json:"discord_id"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
-		return
-	}
-
-	// TODO: Get user ID from Wasp JWT
-	// For now, placeholder
-	h.respondJSON(w, http.StatusOK, map[string]string{"status": "linked"})
-}
-
 func (h *Handler) handleGetCredits(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(contextKeyUserID).(string)
 
@@ -245,22 +339,60 @@ func (h *Handler) handleListServers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleCreateServer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+
 	var req struct {
-		GameType string `json:"game_type"`
-		Name     string `json:"name"`
+		GameType   string `json:"game_type"`
+		Name       string `json:"name"`
+		TemplateID string `json:"template_id"` // optional: small, medium or large variant
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
 
-	if req.GameType == "" || req.Name == "" {
-		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "game_type and name are required")
+	spec := ServerSpec{GameType: req.GameType, Name: req.Name}
+	if req.TemplateID != "" {
+		if h.templateService == nil {
+			h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+			return
+		}
+		tmpl, err := h.templateService.Resolve(r.Context(), req.TemplateID)
+		if err != nil {
+			h.respondTemplateError(w, err)
+			return
+		}
+		if req.GameType != "" && req.GameType != tmpl.GameType {
+			h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("template %s is for %s, not %s", tmpl.ID, tmpl.GameType, req.GameType))
+			return
+		}
+		spec = SpecFromTemplate(req.Name, tmpl)
+	}
+
+	if spec.GameType == "" || spec.Name == "" {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "game_type (or template_id) and name are required")
+		return
+	}
+
+	if h.serverService == nil || h.userService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Server service not configured")
 		return
 	}
 
-	// TODO: Create server via ServerService
-	h.respondJSON(w, http.StatusCreated, map[string]string{"status": "creating"})
+	user, err := h.userService.GetUserByDiscordID(r.Context(), userID)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+	server, err := h.serverService.CreateServer(r.Context(), user.ID, spec)
+	if err != nil {
+		h.logger.Error("create server failed", "error", err, "game_type", spec.GameType, "template_id", spec.TemplateID)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create server")
+		return
+	}
+	h.publishServerEvent(events.StatusChanged(userID, strconv.Itoa(server.ID), events.StatusCreating, ""))
+	h.respondJSON(w, http.StatusCreated, server)
 }
 
 func (h *Handler) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
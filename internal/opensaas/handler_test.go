@@ -12,7 +12,8 @@ import (
 )
 
 type mockUserService struct {
-	users map[string]*User
+	users  map[string]*User
+	linked map[int]string
 }
 
 func newMockUserService() *mockUserService {
@@ -38,10 +39,19 @@ func (m *mockUserService) GetUserByDiscordID(ctx context.Context, id string) (*U
 }
 
 func (m *mockUserService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	for _, u := range m.users {
+		if u.Email != "" && u.Email == email {
+			return u, nil
+		}
+	}
 	return nil, nil
 }
 
 func (m *mockUserService) LinkDiscordAccount(ctx context.Context, uid int, did string) error {
+	if m.linked == nil {
+		m.linked = map[int]string{}
+	}
+	m.linked[uid] = did
 	return nil
 }
 
@@ -53,14 +63,17 @@ func (m *mockUserService) UpdateUserTier(ctx context.Context, uid int, tier stri
 	return nil
 }
 
-type mockServerService struct{}
+type mockServerService struct {
+	created []ServerSpec
+}
 
 func (m *mockServerService) GetUserServers(ctx context.Context, uid int) ([]Server, error) {
 	return []Server{}, nil
 }
 
-func (m *mockServerService) CreateServer(ctx context.Context, uid int, g, n string) (*Server, error) {
-	return &Server{ID: 1, Name: n, GameType: g}, nil
+func (m *mockServerService) CreateServer(ctx context.Context, uid int, spec ServerSpec) (*Server, error) {
+	m.created = append(m.created, spec)
+	return &Server{ID: 1, UserID: uid, Name: spec.Name, GameType: spec.GameType, TemplateID: spec.TemplateID}, nil
 }
 
 func (m *mockServerService) DeleteServer(ctx context.Context, uid, sid int) error {
@@ -174,6 +187,22 @@ func TestHandleCreateServer_ValidationError(t *testing.T) {
 	}
 }
 
+func TestHandleCreateServer_NoServerService(t *testing.T) {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/servers", strings.NewReader(`{"game_type":"minecraft","name":"survival"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+}
+
 func TestHandleControlServer_InvalidAction(t *testing.T) {
 	h := NewHandler(newMockUserService(), nil, &mockServerService{}, slog.Default())
 	mux := http.NewServeMux()
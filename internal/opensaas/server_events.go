@@ -0,0 +1,130 @@
+package opensaas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wethegamers/agis/internal/events"
+)
+
+// ServerEventSource provides the server event stream. *events.Bus
+// implements it.
+type ServerEventSource interface {
+	events.Publisher
+	Subscribe(ownerID string, lastEventID uint64) (*events.Subscription, error)
+}
+
+// sseHeartbeat keeps idle streams alive through proxies.
+const sseHeartbeat = 15 * time.Second
+
+// SetServerEvents wires the server event bus used by the SSE stream and
+// by server endpoints that publish status changes.
+func (h *Handler) SetServerEvents(src ServerEventSource) {
+	h.serverEvents = src
+}
+
+func (h *Handler) registerServerEventRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/servers/events", h.authMiddleware(h.handleServerEvents))
+}
+
+// publishServerEvent reports a server change if the bus is configured.
+func (h *Handler) publishServerEvent(e events.Event) {
+	if h.serverEvents != nil {
+		h.serverEvents.Publish(e)
+	}
+}
+
+// handleServerEvents streams the caller's server events as Server-Sent
+// Events. Clients resume with Last-Event-ID; a "reset" event tells them the
+// replay buffer no longer covers the gap and they should refetch servers.
+func (h *Handler) handleServerEvents(w http.ResponseWriter, r *http.Request) {
+	if h.serverEvents == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Server events not configured")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.respondError(w, http.StatusInternalServerError, "STREAMING_UNSUPPORTED", "Streaming unsupported")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id") // EventSource polyfills
+	}
+	var after uint64
+	if lastID != "" {
+		n, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "INVALID_LAST_EVENT_ID", "Last-Event-ID must be numeric")
+			return
+		}
+		after = n
+	}
+
+	sub, err := h.serverEvents.Subscribe(userID, after)
+	if errors.Is(err, events.ErrTooManySubscriptions) {
+		h.respondError(w, http.StatusTooManyRequests, "TOO_MANY_STREAMS", "Too many open event streams")
+		return
+	}
+	if err != nil {
+		h.logger.Error("server event subscribe failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to open event stream")
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Truncated {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range sub.Replay {
+		if err := writeSSE(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				// Dropped for lagging; the client reconnects and resumes.
+				return
+			}
+			if err := writeSSE(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
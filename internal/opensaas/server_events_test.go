@@ -0,0 +1,149 @@
+package opensaas
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/events"
+)
+
+func newEventServer(t *testing.T, bus *events.Bus, heartbeat time.Duration) *httptest.Server {
+	t.Helper()
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	h.SetServerEvents(bus)
+	h.sseHeartbeat = heartbeat
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/opensaas/v1/servers/events", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer 123456789")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// readUntil reads SSE lines until one has the given prefix.
+func readUntil(t *testing.T, r *bufio.Reader, prefix string) string {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before %q: %v", prefix, err)
+		}
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(line)
+		}
+	}
+}
+
+func waitForSubscribers(t *testing.T, bus *events.Bus, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for bus.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, bus.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerEvents_StreamsOwnEvents(t *testing.T) {
+	bus := events.NewBus(events.Options{})
+	srv := newEventServer(t, bus, 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp := openStream(t, ctx, srv.URL, "")
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	waitForSubscribers(t, bus, 1)
+
+	bus.Publish(events.StatusChanged("someone-else", "9", events.StatusReady, ""))
+	e := bus.Publish(events.PlayersChanged("123456789", "1", 3, 10))
+
+	r := bufio.NewReader(resp.Body)
+	if id := readUntil(t, r, "id:"); id != "id: "+itoa(e.ID) {
+		t.Errorf("expected own event only, got %s", id)
+	}
+	if ev := readUntil(t, r, "event:"); ev != "event: players" {
+		t.Errorf("unexpected event line %s", ev)
+	}
+	if data := readUntil(t, r, "data:"); !strings.Contains(data, `"players":3`) {
+		t.Errorf("unexpected data %s", data)
+	}
+	readUntil(t, r, ": heartbeat")
+}
+
+func TestServerEvents_ResumesFromLastEventID(t *testing.T) {
+	bus := events.NewBus(events.Options{})
+	first := bus.Publish(events.StatusChanged("123456789", "1", events.StatusCreating, ""))
+	second := bus.Publish(events.StatusChanged("123456789", "1", events.StatusReady, ""))
+	srv := newEventServer(t, bus, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp := openStream(t, ctx, srv.URL, itoa(first.ID))
+	defer resp.Body.Close()
+
+	if id := readUntil(t, bufio.NewReader(resp.Body), "id:"); id != "id: "+itoa(second.ID) {
+		t.Errorf("expected replay of %d, got %s", second.ID, id)
+	}
+}
+
+func TestServerEvents_CapsConnections(t *testing.T) {
+	bus := events.NewBus(events.Options{MaxPerOwner: 1})
+	srv := newEventServer(t, bus, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := openStream(t, ctx, srv.URL, "")
+	defer first.Body.Close()
+	waitForSubscribers(t, bus, 1)
+
+	second := openStream(t, ctx, srv.URL, "")
+	defer second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", second.StatusCode)
+	}
+
+	// Disconnecting frees the slot.
+	cancel()
+	waitForSubscribers(t, bus, 0)
+}
+
+func TestServerEvents_RejectsBadLastEventID(t *testing.T) {
+	srv := newEventServer(t, events.NewBus(events.Options{}), time.Minute)
+
+	resp := openStream(t, context.Background(), srv.URL, "abc")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func itoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,163 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/templates"
+)
+
+// TemplateService defines the interface for server template management.
+type TemplateService interface {
+	List(ctx context.Context, includeInactive bool) ([]templates.Template, error)
+	Get(ctx context.Context, id string) (*templates.Template, error)
+	Resolve(ctx context.Context, id string) (*templates.Template, error)
+	Create(ctx context.Context, t templates.Template) (*templates.Template, error)
+	Update(ctx context.Context, t templates.Template) (*templates.Template, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// SetTemplateService wires the server template service.
+func (h *Handler) SetTemplateService(svc TemplateService) {
+	h.templateService = svc
+}
+
+func (h *Handler) registerTemplateRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/templates", h.authMiddleware(h.handleListTemplates))
+	mux.HandleFunc("GET /api/opensaas/v1/templates/{id}", h.authMiddleware(h.handleGetTemplate))
+
+	mux.HandleFunc("GET /api/opensaas/v1/admin/templates", h.adminMiddleware(h.handleAdminListTemplates))
+	mux.HandleFunc("POST /api/opensaas/v1/admin/templates", h.adminMiddleware(h.handleCreateTemplate))
+	mux.HandleFunc("PUT /api/opensaas/v1/admin/templates/{id}", h.adminMiddleware(h.handleUpdateTemplate))
+	mux.HandleFunc("DELETE /api/opensaas/v1/admin/templates/{id}", h.adminMiddleware(h.handleDeleteTemplate))
+}
+
+// handleListTemplates lists templates users can currently pick.
+func (h *Handler) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	all, err := h.templateService.List(r.Context(), false)
+	if err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	available := make([]templates.Template, 0, len(all))
+	for _, t := range all {
+		if t.Available {
+			available = append(available, t)
+		}
+	}
+	h.respondJSON(w, http.StatusOK, available)
+}
+
+func (h *Handler) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	t, err := h.templateService.Resolve(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, t)
+}
+
+func (h *Handler) handleAdminListTemplates(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	all, err := h.templateService.List(r.Context(), r.URL.Query().Get("include_inactive") == "true")
+	if err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, all)
+}
+
+func (h *Handler) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	var t templates.Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	created, err := h.templateService.Create(r.Context(), t)
+	if err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	h.recordAudit(r, "template.create", audit.Target{Type: "template", ID: created.ID}, nil, created)
+	h.respondJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	var t templates.Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	t.ID = r.PathValue("id")
+	before, _ := h.templateService.Get(r.Context(), t.ID)
+
+	updated, err := h.templateService.Update(r.Context(), t)
+	if err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	h.recordAudit(r, "template.update", audit.Target{Type: "template", ID: t.ID}, before, updated)
+	h.respondJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if h.templateService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Template service not configured")
+		return
+	}
+
+	id := r.PathValue("id")
+	before, _ := h.templateService.Get(r.Context(), id)
+
+	if err := h.templateService.Delete(r.Context(), id); err != nil {
+		h.respondTemplateError(w, err)
+		return
+	}
+	h.recordAudit(r, "template.deactivate", audit.Target{Type: "template", ID: id}, before, nil)
+	h.respondJSON(w, http.StatusOK, map[string]string{"status": "deactivated"})
+}
+
+// respondTemplateError maps template errors to API errors.
+func (h *Handler) respondTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, templates.ErrNotFound):
+		h.respondError(w, http.StatusNotFound, "TEMPLATE_NOT_FOUND", "Template not found")
+	case errors.Is(err, templates.ErrUnavailable):
+		h.respondError(w, http.StatusConflict, "TEMPLATE_UNAVAILABLE", "Template is not currently available")
+	case errors.Is(err, templates.ErrExists):
+		h.respondError(w, http.StatusConflict, "TEMPLATE_EXISTS", "Template already exists")
+	case errors.Is(err, templates.ErrInvalidTemplate):
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+	default:
+		h.logger.Error("template operation failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Template operation failed")
+	}
+}
@@ -0,0 +1,180 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/templates"
+)
+
+type mockTemplateService struct {
+	templates map[string]templates.Template
+}
+
+func newMockTemplateService() *mockTemplateService {
+	return &mockTemplateService{templates: map[string]templates.Template{
+		"minecraft-large": {ID: "minecraft-large", GameType: "minecraft", Size: templates.SizeLarge, IsActive: true, Available: true,
+			DockerImage: "itzg/minecraft-server:latest", CPURequest: "2", MemoryRequest: "4Gi", CPULimit: "4", MemoryLimit: "8Gi"},
+		"ark-large": {ID: "ark-large", GameType: "ark", Size: templates.SizeLarge, IsActive: true},
+	}}
+}
+
+func (m *mockTemplateService) List(ctx context.Context, includeInactive bool) ([]templates.Template, error) {
+	out := make([]templates.Template, 0, len(m.templates))
+	for _, t := range m.templates {
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (m *mockTemplateService) Get(ctx context.Context, id string) (*templates.Template, error) {
+	t, ok := m.templates[id]
+	if !ok {
+		return nil, templates.ErrNotFound
+	}
+	return &t, nil
+}
+
+func (m *mockTemplateService) Resolve(ctx context.Context, id string) (*templates.Template, error) {
+	t, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Available {
+		return nil, templates.ErrUnavailable
+	}
+	return t, nil
+}
+
+func (m *mockTemplateService) Create(ctx context.Context, t templates.Template) (*templates.Template, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (m *mockTemplateService) Update(ctx context.Context, t templates.Template) (*templates.Template, error) {
+	return &t, nil
+}
+
+func (m *mockTemplateService) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+type mockAdminAuthorizer struct{}
+
+func (mockAdminAuthorizer) IsPlatformAdmin(ctx context.Context, discordID string) (bool, error) {
+	return discordID == "admin", nil
+}
+
+func newTemplateMux() *http.ServeMux {
+	mux, _ := newTemplateMuxWithServers()
+	return mux
+}
+
+func newTemplateMuxWithServers() (*http.ServeMux, *mockServerService) {
+	servers := &mockServerService{}
+	h := NewHandler(newMockUserService(), nil, servers, slog.Default())
+	h.SetTemplateService(newMockTemplateService())
+	h.SetAdminAuthorizer(mockAdminAuthorizer{})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux, servers
+}
+
+func TestTemplates_AdminRequired(t *testing.T) {
+	mux := newTemplateMux()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/admin/templates", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestTemplates_CreateValidationError(t *testing.T) {
+	mux := newTemplateMux()
+
+	body := `{"id":"rust-small","name":"Rust","game_type":"rust","size":"small","cost_per_hour":100,
+		"max_players":10,"cpu_request":"4Gi","memory_request":"8Gi","docker_image":"rust:latest"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/admin/templates", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestTemplates_ListHidesUnavailable(t *testing.T) {
+	mux := newTemplateMux()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/templates", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data []templates.Template `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != "minecraft-large" {
+		t.Errorf("expected only the available template, got %+v", resp.Data)
+	}
+}
+
+func TestHandleCreateServer_WithTemplate(t *testing.T) {
+	mux, servers := newTemplateMuxWithServers()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/servers",
+		strings.NewReader(`{"name":"survival","template_id":"minecraft-large"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data Server `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Data.GameType != "minecraft" || resp.Data.TemplateID != "minecraft-large" {
+		t.Errorf("expected template game type and ID, got %+v", resp.Data)
+	}
+	if len(servers.created) != 1 {
+		t.Fatalf("expected one server created, got %d", len(servers.created))
+	}
+	want := ServerSpec{GameType: "minecraft", Name: "survival", TemplateID: "minecraft-large",
+		DockerImage: "itzg/minecraft-server:latest", CPURequest: "2", MemoryRequest: "4Gi", CPULimit: "4", MemoryLimit: "8Gi"}
+	if got := servers.created[0]; got != want {
+		t.Errorf("expected template resources to reach CreateServer, got %+v", got)
+	}
+}
+
+func TestHandleCreateServer_TemplateGameMismatch(t *testing.T) {
+	mux := newTemplateMux()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/servers",
+		strings.NewReader(`{"name":"survival","game_type":"valheim","template_id":"minecraft-large"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
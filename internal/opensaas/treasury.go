@@ -0,0 +1,164 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+// TreasuryService defines the interface for guild treasury operations.
+// Implementations enforce guild role permissions for the acting user.
+type TreasuryService interface {
+	Summary(ctx context.Context, guildID, actorID string) (*treasury.Summary, error)
+	Contribute(ctx context.Context, guildID, actorID string, amount int64) (*treasury.Transaction, error)
+	Spend(ctx context.Context, guildID, actorID string, amount int64, description string) (*treasury.Transaction, error)
+	Grant(ctx context.Context, guildID, actorID string, amount int64, reason string) (*treasury.Transaction, error)
+	History(ctx context.Context, guildID, actorID string, limit, offset int) ([]treasury.Transaction, error)
+}
+
+// SetTreasuryService wires the guild treasury service.
+func (h *Handler) SetTreasuryService(svc TreasuryService) {
+	h.treasuryService = svc
+}
+
+func (h *Handler) registerTreasuryRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/guilds/{id}/treasury", h.authMiddleware(h.handleGetTreasury))
+	mux.HandleFunc("POST /api/opensaas/v1/guilds/{id}/treasury/contribute", h.authMiddleware(h.handleTreasuryContribute))
+	mux.HandleFunc("POST /api/opensaas/v1/guilds/{id}/treasury/spend", h.authMiddleware(h.handleTreasurySpend))
+	mux.HandleFunc("POST /api/opensaas/v1/guilds/{id}/treasury/grant", h.authMiddleware(h.handleTreasuryGrant))
+	mux.HandleFunc("GET /api/opensaas/v1/guilds/{id}/treasury/history", h.authMiddleware(h.handleTreasuryHistory))
+}
+
+func (h *Handler) handleGetTreasury(w http.ResponseWriter, r *http.Request) {
+	if h.treasuryService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Treasury service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	summary, err := h.treasuryService.Summary(r.Context(), r.PathValue("id"), userID)
+	if err != nil {
+		h.respondTreasuryError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, summary)
+}
+
+func (h *Handler) handleTreasuryContribute(w http.ResponseWriter, r *http.Request) {
+	if h.treasuryService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Treasury service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	var req struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	tx, err := h.treasuryService.Contribute(r.Context(), r.PathValue("id"), userID, req.Amount)
+	if err != nil {
+		h.respondTreasuryError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusCreated, tx)
+}
+
+func (h *Handler) handleTreasurySpend(w http.ResponseWriter, r *http.Request) {
+	if h.treasuryService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Treasury service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	var req struct {
+		Amount      int64  `json:"amount"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Description == "" {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "description is required")
+		return
+	}
+
+	tx, err := h.treasuryService.Spend(r.Context(), r.PathValue("id"), userID, req.Amount, req.Description)
+	if err != nil {
+		h.respondTreasuryError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusCreated, tx)
+}
+
+func (h *Handler) handleTreasuryGrant(w http.ResponseWriter, r *http.Request) {
+	if h.treasuryService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Treasury service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	var req struct {
+		Amount int64  `json:"amount"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Reason == "" {
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "reason is required")
+		return
+	}
+
+	tx, err := h.treasuryService.Grant(r.Context(), r.PathValue("id"), userID, req.Amount, req.Reason)
+	if err != nil {
+		h.respondTreasuryError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusCreated, tx)
+}
+
+func (h *Handler) handleTreasuryHistory(w http.ResponseWriter, r *http.Request) {
+	if h.treasuryService == nil {
+		h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Treasury service not configured")
+		return
+	}
+	userID := r.Context().Value(contextKeyUserID).(string)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	txs, err := h.treasuryService.History(r.Context(), r.PathValue("id"), userID, limit, offset)
+	if err != nil {
+		h.respondTreasuryError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, txs)
+}
+
+// respondTreasuryError maps treasury and ledger errors to API errors.
+func (h *Handler) respondTreasuryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, treasury.ErrForbidden):
+		h.respondError(w, http.StatusForbidden, "FORBIDDEN", "You do not have permission for this treasury action")
+	case errors.Is(err, treasury.ErrNotFound):
+		h.respondError(w, http.StatusNotFound, "TREASURY_NOT_FOUND", "Guild treasury not found")
+	case errors.Is(err, treasury.ErrInvalidAmount):
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "amount must be positive")
+	case errors.Is(err, ledger.ErrInsufficientFunds):
+		h.respondError(w, http.StatusPaymentRequired, "INSUFFICIENT_FUNDS", "Insufficient funds")
+	default:
+		h.logger.Error("treasury operation failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Treasury operation failed")
+	}
+}
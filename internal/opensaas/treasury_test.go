@@ -0,0 +1,105 @@
+package opensaas
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+type mockTreasuryService struct {
+	balance int64
+}
+
+func (m *mockTreasuryService) Summary(ctx context.Context, guildID, actorID string) (*treasury.Summary, error) {
+	if actorID != "123456789" {
+		return nil, treasury.ErrForbidden
+	}
+	return &treasury.Summary{GuildID: guildID, Balance: m.balance}, nil
+}
+
+func (m *mockTreasuryService) Contribute(ctx context.Context, guildID, actorID string, amount int64) (*treasury.Transaction, error) {
+	return &treasury.Transaction{ID: 1, GuildID: guildID, Amount: amount, Type: "credit", CreatedBy: actorID}, nil
+}
+
+func (m *mockTreasuryService) Spend(ctx context.Context, guildID, actorID string, amount int64, description string) (*treasury.Transaction, error) {
+	if amount > m.balance {
+		return nil, ledger.ErrInsufficientFunds
+	}
+	return &treasury.Transaction{ID: 2, GuildID: guildID, Amount: amount, Type: "debit", CreatedBy: actorID}, nil
+}
+
+func (m *mockTreasuryService) Grant(ctx context.Context, guildID, actorID string, amount int64, reason string) (*treasury.Transaction, error) {
+	return nil, treasury.ErrForbidden
+}
+
+func (m *mockTreasuryService) History(ctx context.Context, guildID, actorID string, limit, offset int) ([]treasury.Transaction, error) {
+	return []treasury.Transaction{}, nil
+}
+
+func newTreasuryMux(svc TreasuryService) *http.ServeMux {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	if svc != nil {
+		h.SetTreasuryService(svc)
+	}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+
+func TestTreasury_Unavailable(t *testing.T) {
+	mux := newTreasuryMux(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/guilds/g1/treasury", http.NoBody)
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+}
+
+func TestTreasury_SummaryForbidden(t *testing.T) {
+	mux := newTreasuryMux(&mockTreasuryService{balance: 100})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/opensaas/v1/guilds/g1/treasury", http.NoBody)
+	req.Header.Set("Authorization", "Bearer someone_else")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestTreasury_Contribute(t *testing.T) {
+	mux := newTreasuryMux(&mockTreasuryService{balance: 100})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/guilds/g1/treasury/contribute", strings.NewReader(`{"amount":50}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", rec.Code)
+	}
+}
+
+func TestTreasury_SpendInsufficientFunds(t *testing.T) {
+	mux := newTreasuryMux(&mockTreasuryService{balance: 100})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/opensaas/v1/guilds/g1/treasury/spend", strings.NewReader(`{"amount":500,"description":"server"}`))
+	req.Header.Set("Authorization", "Bearer 123456789")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPaymentRequired {
+		t.Errorf("expected 402, got %d", rec.Code)
+	}
+}
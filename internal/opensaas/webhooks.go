@@ -0,0 +1,269 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wethegamers/agis/internal/webhooks"
+)
+
+// WebhookService defines the interface for outbound webhook management.
+// Implementations check that the acting user may manage the owner's
+// subscriptions.
+type WebhookService interface {
+	Create(ctx context.Context, actorID string, owner webhooks.Owner, in webhooks.Input) (*webhooks.Subscription, error)
+	List(ctx context.Context, actorID string, owner webhooks.Owner) ([]webhooks.Subscription, error)
+	Get(ctx context.Context, actorID string, id int64) (*webhooks.Subscription, error)
+	Update(ctx context.Context, actorID string, id int64, u webhooks.Update) (*webhooks.Subscription, error)
+	Delete(ctx context.Context, actorID string, id int64) error
+	Deliveries(ctx context.Context, actorID string, id int64, status string, limit int) ([]webhooks.Delivery, error)
+	Delivery(ctx context.Context, actorID string, id, deliveryID int64) (*webhooks.Delivery, []webhooks.Attempt, error)
+	Redeliver(ctx context.Context, actorID string, id, deliveryID int64) (*webhooks.Delivery, error)
+	SendTest(ctx context.Context, actorID string, id int64) (*webhooks.Delivery, error)
+}
+
+// SetWebhookService wires the outbound webhook service.
+func (h *Handler) SetWebhookService(svc WebhookService) {
+	h.webhookService = svc
+}
+
+func (h *Handler) registerWebhookRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/opensaas/v1/webhooks", h.authMiddleware(h.requireWebhooks(h.handleListUserWebhooks)))
+	mux.HandleFunc("POST /api/opensaas/v1/webhooks", h.authMiddleware(h.requireWebhooks(h.handleCreateUserWebhook)))
+	mux.HandleFunc("GET /api/opensaas/v1/guilds/{id}/webhooks", h.authMiddleware(h.requireWebhooks(h.handleListGuildWebhooks)))
+	mux.HandleFunc("POST /api/opensaas/v1/guilds/{id}/webhooks", h.authMiddleware(h.requireWebhooks(h.handleCreateGuildWebhook)))
+	mux.HandleFunc("GET /api/opensaas/v1/webhooks/{id}", h.authMiddleware(h.requireWebhooks(h.handleGetWebhook)))
+	mux.HandleFunc("PATCH /api/opensaas/v1/webhooks/{id}", h.authMiddleware(h.requireWebhooks(h.handleUpdateWebhook)))
+	mux.HandleFunc("DELETE /api/opensaas/v1/webhooks/{id}", h.authMiddleware(h.requireWebhooks(h.handleDeleteWebhook)))
+	mux.HandleFunc("POST /api/opensaas/v1/webhooks/{id}/test", h.authMiddleware(h.requireWebhooks(h.handleTestWebhook)))
+	mux.HandleFunc("GET /api/opensaas/v1/webhooks/{id}/deliveries", h.authMiddleware(h.requireWebhooks(h.handleWebhookDeliveries)))
+	mux.HandleFunc("GET /api/opensaas/v1/webhooks/{id}/deliveries/{delivery}", h.authMiddleware(h.requireWebhooks(h.handleWebhookDelivery)))
+	mux.HandleFunc("POST /api/opensaas/v1/webhooks/{id}/deliveries/{delivery}/redeliver", h.authMiddleware(h.requireWebhooks(h.handleRedeliverWebhook)))
+}
+
+// requireWebhooks answers 503 when the webhook service is not wired.
+func (h *Handler) requireWebhooks(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.webhookService == nil {
+			h.respondError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Webhook service not configured")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// pathInt64 parses a numeric path segment, answering 400 if it is not one.
+func (h *Handler) pathInt64(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	n, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || n <= 0 {
+		h.respondError(w, http.StatusBadRequest, "INVALID_ID", name+" must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+func (h *Handler) handleListUserWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	h.listWebhooks(w, r, userID, webhooks.User(userID))
+}
+
+func (h *Handler) handleListGuildWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	h.listWebhooks(w, r, userID, webhooks.Guild(r.PathValue("id")))
+}
+
+func (h *Handler) listWebhooks(w http.ResponseWriter, r *http.Request, userID string, owner webhooks.Owner) {
+	subs, err := h.webhookService.List(r.Context(), userID, owner)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	if subs == nil {
+		subs = []webhooks.Subscription{}
+	}
+	h.respondJSON(w, http.StatusOK, subs)
+}
+
+func (h *Handler) handleCreateUserWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	h.createWebhook(w, r, userID, webhooks.User(userID))
+}
+
+func (h *Handler) handleCreateGuildWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	h.createWebhook(w, r, userID, webhooks.Guild(r.PathValue("id")))
+}
+
+// createWebhook registers an endpoint. The response is the only time the
+// signing secret is returned.
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request, userID string, owner webhooks.Owner) {
+	var in webhooks.Input
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	sub, err := h.webhookService.Create(r.Context(), userID, owner, in)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusCreated, sub)
+}
+
+func (h *Handler) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+
+	sub, err := h.webhookService.Get(r.Context(), userID, id)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, sub)
+}
+
+func (h *Handler) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+	var u webhooks.Update
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		h.respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	sub, err := h.webhookService.Update(r.Context(), userID, id, u)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, sub)
+}
+
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(r.Context(), userID, id); err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (h *Handler) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+
+	d, err := h.webhookService.SendTest(r.Context(), userID, id)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusAccepted, d)
+}
+
+// handleWebhookDeliveries returns the delivery log. ?status=dead lists the
+// dead-letter queue.
+func (h *Handler) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusDead:
+	default:
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "status must be pending, delivered or dead")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	deliveries, err := h.webhookService.Deliveries(r.Context(), userID, id, status, limit)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []webhooks.Delivery{}
+	}
+	h.respondJSON(w, http.StatusOK, deliveries)
+}
+
+func (h *Handler) handleWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := h.pathInt64(w, r, "delivery")
+	if !ok {
+		return
+	}
+
+	d, attempts, err := h.webhookService.Delivery(r.Context(), userID, id, deliveryID)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	if attempts == nil {
+		attempts = []webhooks.Attempt{}
+	}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"delivery": d,
+		"attempts": attempts,
+	})
+}
+
+func (h *Handler) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextKeyUserID).(string)
+	id, ok := h.pathInt64(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := h.pathInt64(w, r, "delivery")
+	if !ok {
+		return
+	}
+
+	d, err := h.webhookService.Redeliver(r.Context(), userID, id, deliveryID)
+	if err != nil {
+		h.respondWebhookError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusAccepted, d)
+}
+
+func (h *Handler) respondWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		h.respondError(w, http.StatusNotFound, "WEBHOOK_NOT_FOUND", "Webhook not found")
+	case errors.Is(err, webhooks.ErrForbidden):
+		h.respondError(w, http.StatusForbidden, "FORBIDDEN", "You do not have permission to manage these webhooks")
+	case errors.Is(err, webhooks.ErrInvalidURL), errors.Is(err, webhooks.ErrInvalidEvent):
+		h.respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+	case errors.Is(err, webhooks.ErrLimitReached):
+		h.respondError(w, http.StatusConflict, "WEBHOOK_LIMIT_REACHED", "Webhook subscription limit reached")
+	case errors.Is(err, webhooks.ErrNotDead):
+		h.respondError(w, http.StatusConflict, "DELIVERY_NOT_DEAD", "Only dead-lettered deliveries can be redelivered")
+	default:
+		h.logger.Error("webhook operation failed", "error", err)
+		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Webhook operation failed")
+	}
+}
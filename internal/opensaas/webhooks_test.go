@@ -0,0 +1,149 @@
+package opensaas
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/webhooks"
+)
+
+func newWebhookMux(t *testing.T) (*http.ServeMux, *webhooks.Service) {
+	t.Helper()
+	svc := webhooks.NewService(webhooks.NewMemoryStore(), nil, slog.Default())
+	svc.SetAllowPrivateTargets(true)
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	h.SetWebhookService(svc)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux, svc
+}
+
+func doWebhookRequest(mux *http.ServeMux, method, path, subject, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+subject)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhooks_CreateTestAndDeliveryLog(t *testing.T) {
+	received := make(chan error, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhooks.Verify(secret, r.Header, body, webhooks.DefaultTolerance, time.Now())
+	}))
+	defer receiver.Close()
+	mux, svc := newWebhookMux(t)
+
+	rec := doWebhookRequest(mux, http.MethodPost, "/api/opensaas/v1/webhooks", "123456789",
+		`{"url":"`+receiver.URL+`","events":["server.started","payment.succeeded"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var sub webhooks.Subscription
+	decodeData(t, rec, &sub)
+	if sub.Secret == "" {
+		t.Fatal("expected the signing secret on create")
+	}
+	secret = sub.Secret
+	base := "/api/opensaas/v1/webhooks/" + strconv.FormatInt(sub.ID, 10)
+
+	if rec := doWebhookRequest(mux, http.MethodPost, base+"/test", "123456789", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("test: expected 202, got %d", rec.Code)
+	}
+	if _, err := svc.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; err != nil {
+		t.Fatalf("receiver rejected delivery: %v", err)
+	}
+
+	rec = doWebhookRequest(mux, http.MethodGet, base+"/deliveries", "123456789", "")
+	var log []webhooks.Delivery
+	decodeData(t, rec, &log)
+	if len(log) != 1 || log[0].Status != webhooks.StatusDelivered || log[0].EventType != webhooks.EventPing {
+		t.Fatalf("unexpected delivery log %+v", log)
+	}
+
+	rec = doWebhookRequest(mux, http.MethodGet, base+"/deliveries/"+strconv.FormatInt(log[0].ID, 10), "123456789", "")
+	var detail struct {
+		Attempts []webhooks.Attempt `json:"attempts"`
+	}
+	decodeData(t, rec, &detail)
+	if len(detail.Attempts) != 1 || detail.Attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("unexpected attempts %+v", detail.Attempts)
+	}
+
+	// The secret is not returned again.
+	rec = doWebhookRequest(mux, http.MethodGet, base, "123456789", "")
+	if strings.Contains(rec.Body.String(), secret) {
+		t.Error("get must not return the secret")
+	}
+}
+
+func TestWebhooks_OtherUsersSeeNotFound(t *testing.T) {
+	mux, _ := newWebhookMux(t)
+	rec := doWebhookRequest(mux, http.MethodPost, "/api/opensaas/v1/webhooks", "123456789",
+		`{"url":"https://hooks.example.com","events":["server.stopped"]}`)
+	var sub webhooks.Subscription
+	decodeData(t, rec, &sub)
+
+	rec = doWebhookRequest(mux, http.MethodDelete, "/api/opensaas/v1/webhooks/"+strconv.FormatInt(sub.ID, 10), "someone-else", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestWebhooks_ValidationAndGuildPermissions(t *testing.T) {
+	mux, _ := newWebhookMux(t)
+
+	rec := doWebhookRequest(mux, http.MethodPost, "/api/opensaas/v1/webhooks", "123456789",
+		`{"url":"https://hooks.example.com","events":["server.exploded"]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown event, got %d", rec.Code)
+	}
+
+	// Without a guild authorizer nobody can manage guild webhooks.
+	rec = doWebhookRequest(mux, http.MethodGet, "/api/opensaas/v1/guilds/g1/webhooks", "123456789", "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	rec = doWebhookRequest(mux, http.MethodGet, "/api/opensaas/v1/webhooks/abc/deliveries", "123456789", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad id, got %d", rec.Code)
+	}
+}
+
+func TestWebhooks_NotConfigured(t *testing.T) {
+	h := NewHandler(newMockUserService(), nil, nil, slog.Default())
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rec := doWebhookRequest(mux, http.MethodGet, "/api/opensaas/v1/webhooks", "123456789", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,821 @@
+// Package provisioning provides the guild server provisioning workflow for AGIS.
+//
+// Requests in server_provision_requests move through an explicit state machine:
+//
+//	pending → approved → provisioning → active → terminating → terminated
+//	   │          │            │
+//	   └──────────┴────────────┴──→ failed
+//
+// Approval reserves the setup cost plus the requested hours from the guild
+// treasury and claims the request for provisioning in the same
+// transaction. Failed provisioning refunds the reservation, early
+// termination refunds the unused whole hours, and auto-renewing servers are
+// extended for another term while the treasury can pay for it. A request
+// is marked terminating before its server is removed, so a failed removal
+// is retried rather than forgotten. Every transition is recorded in
+// server_provision_events in the same transaction as the state change and
+// any treasury movement.
+package provisioning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/events"
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+// Status is a server_provision_requests.status value.
+type Status string
+
+// Request statuses.
+const (
+	StatusPending      Status = "pending"
+	StatusApproved     Status = "approved"
+	StatusProvisioning Status = "provisioning"
+	StatusActive       Status = "active"
+	StatusTerminating  Status = "terminating"
+	StatusTerminated   Status = "terminated"
+	StatusFailed       Status = "failed"
+)
+
+// SystemActor is recorded as the actor for scheduler-driven transitions.
+const SystemActor = "system"
+
+// DefaultStaleAfter is how long a request may stay provisioning or
+// terminating before the scheduler assumes the worker handling it died.
+const DefaultStaleAfter = 15 * time.Minute
+
+// transitions lists the statuses reachable from each status. Active to
+// active is a renewal; terminated and failed are final.
+var transitions = map[Status][]Status{
+	StatusPending:      {StatusApproved, StatusFailed},
+	StatusApproved:     {StatusProvisioning, StatusFailed},
+	StatusProvisioning: {StatusActive, StatusFailed},
+	StatusActive:       {StatusActive, StatusTerminating},
+	StatusTerminating:  {StatusTerminated},
+}
+
+// Errors returned by the provisioning service.
+var (
+	ErrNotFound          = errors.New("provisioning: request not found")
+	ErrInvalidTransition = errors.New("provisioning: invalid status transition")
+	ErrConflict          = errors.New("provisioning: request was modified concurrently")
+	ErrInvalidRequest    = errors.New("provisioning: invalid request")
+)
+
+// ValidateTransition reports whether a request may move from one status to
+// another.
+func ValidateTransition(from, to Status) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+// Terminal reports whether no further transitions are possible.
+func (s Status) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Request is a row of server_provision_requests joined with its template.
+type Request struct {
+	ID                     int64      `json:"id"`
+	GuildID                string     `json:"guild_id"`
+	RequestedBy            string     `json:"requested_by"`
+	TemplateID             string     `json:"template_id"`
+	ServerName             string     `json:"server_name"`
+	DurationHours          int        `json:"duration_hours"`
+	AutoRenew              bool       `json:"auto_renew"`
+	RequestedAt            time.Time  `json:"requested_at"`
+	ApprovedAt             *time.Time `json:"approved_at,omitempty"`
+	ApprovedBy             string     `json:"approved_by,omitempty"`
+	Status                 Status     `json:"status"`
+	ServerID               string     `json:"server_id,omitempty"`
+	TerminationScheduledAt *time.Time `json:"termination_scheduled_at,omitempty"`
+	TotalCost              int64      `json:"total_cost"`
+	Notes                  string     `json:"notes,omitempty"`
+
+	// From server_templates.
+	GameType    string `json:"game_type"`
+	CostPerHour int64  `json:"cost_per_hour"`
+	SetupCost   int64  `json:"setup_cost"`
+}
+
+// ReservationCost is the amount reserved at approval: the setup cost plus
+// the requested hours.
+func (r *Request) ReservationCost() int64 {
+	return r.SetupCost + r.RenewalCost()
+}
+
+// RenewalCost is the amount charged to extend an active server by another
+// term of DurationHours.
+func (r *Request) RenewalCost() int64 {
+	return r.CostPerHour * int64(r.DurationHours)
+}
+
+// Event is a row of server_provision_events.
+type Event struct {
+	ID         int64     `json:"id"`
+	RequestID  int64     `json:"request_id"`
+	FromStatus Status    `json:"from_status,omitempty"`
+	ToStatus   Status    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Reason     string    `json:"reason,omitempty"`
+	Amount     int64     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Funds moves GameCredits in and out of a guild treasury. fn runs in the
+// same database transaction as the movement. *treasury.Service implements
+// Funds.
+type Funds interface {
+	Debit(ctx context.Context, guildID, actorID string, amount int64, source, description, idempotencyKey string, fn ledger.TxFunc) (*treasury.Transaction, error)
+	Refund(ctx context.Context, guildID, actorID string, amount int64, description, idempotencyKey string, fn ledger.TxFunc) (*treasury.Transaction, error)
+}
+
+// Provisioner creates and removes the game server behind a request.
+type Provisioner interface {
+	// Provision starts a server for the request and returns its ID.
+	Provision(ctx context.Context, req *Request) (serverID string, err error)
+	// Deprovision stops and removes the request's server.
+	Deprovision(ctx context.Context, req *Request) error
+}
+
+// Service drives provisioning requests through their lifecycle.
+type Service struct {
+	db         *sql.DB
+	funds      Funds
+	authz      treasury.Authorizer
+	servers    Provisioner
+	events     events.Publisher
+	audit      audit.Recorder
+	logger     *slog.Logger
+	now        func() time.Time
+	interval   time.Duration
+	staleAfter time.Duration
+}
+
+// NewService creates a provisioning workflow service.
+func NewService(db *sql.DB, funds Funds, authz treasury.Authorizer, servers Provisioner, logger *slog.Logger) *Service {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Service{
+		db:         db,
+		funds:      funds,
+		authz:      authz,
+		servers:    servers,
+		logger:     logger,
+		now:        time.Now,
+		interval:   time.Minute,
+		staleAfter: DefaultStaleAfter,
+	}
+}
+
+// SetStaleAfter overrides how long a request may stay provisioning or
+// terminating before the scheduler recovers it. It must exceed the
+// longest Provision or Deprovision call.
+func (s *Service) SetStaleAfter(d time.Duration) {
+	s.staleAfter = d
+}
+
+// SetEventPublisher publishes server status changes for the requester's
+// dashboard.
+func (s *Service) SetEventPublisher(p events.Publisher) {
+	s.events = p
+}
+
+// SetAuditLog records every status transition in the audit log, in the
+// same transaction as the transition.
+func (s *Service) SetAuditLog(r audit.Recorder) {
+	s.audit = r
+}
+
+// publish reports a committed status change. Requests without a server yet
+// are identified by request ID.
+func (s *Service) publish(req *Request, status, reason string) {
+	if s.events == nil {
+		return
+	}
+	serverID := req.ServerID
+	if serverID == "" {
+		serverID = fmt.Sprintf("provision-%d", req.ID)
+	}
+	s.events.Publish(events.StatusChanged(req.RequestedBy, serverID, status, reason))
+}
+
+// authorize checks that actorID holds a guild role that permits action.
+func (s *Service) authorize(ctx context.Context, guildID, actorID string, action treasury.Action) error {
+	role, err := s.authz.GuildRole(ctx, guildID, actorID)
+	if err != nil {
+		return fmt.Errorf("provisioning: resolve guild role: %w", err)
+	}
+	if !role.Can(action) {
+		return fmt.Errorf("%w: %s requires a higher role than %s", treasury.ErrForbidden, action, role)
+	}
+	return nil
+}
+
+// Submit files a new pending request on behalf of a guild member.
+func (s *Service) Submit(ctx context.Context, guildID, actorID, templateID, serverName string, durationHours int, autoRenew bool) (*Request, error) {
+	if err := s.authorize(ctx, guildID, actorID, treasury.ActionRequest); err != nil {
+		return nil, err
+	}
+	if templateID == "" || serverName == "" || durationHours <= 0 {
+		return nil, fmt.Errorf("%w: template, server name and a positive duration are required", ErrInvalidRequest)
+	}
+
+	req := &Request{
+		GuildID:       guildID,
+		RequestedBy:   actorID,
+		TemplateID:    templateID,
+		ServerName:    serverName,
+		DurationHours: durationHours,
+		AutoRenew:     autoRenew,
+		Status:        StatusPending,
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			SELECT game_type, cost_per_hour, setup_cost
+			FROM server_templates
+			WHERE id = $1 AND is_active = TRUE
+		`, templateID).Scan(&req.GameType, &req.CostPerHour, &req.SetupCost)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: unknown template %q", ErrInvalidRequest, templateID)
+		}
+		if err != nil {
+			return fmt.Errorf("provisioning: load template: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO guild_treasury (guild_id) VALUES ($1) ON CONFLICT (guild_id) DO NOTHING`, guildID,
+		); err != nil {
+			return fmt.Errorf("provisioning: ensure treasury: %w", err)
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO server_provision_requests (guild_id, requested_by, template_id, server_name, duration_hours, auto_renew, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, requested_at
+		`, guildID, actorID, templateID, serverName, durationHours, autoRenew, StatusPending).Scan(&req.ID, &req.RequestedAt)
+		if err != nil {
+			return fmt.Errorf("provisioning: insert request: %w", err)
+		}
+		return s.recordEvent(ctx, tx, req.ID, "", StatusPending, actorID, "submitted", 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Approve reserves the request's cost from the guild treasury and starts
+// provisioning. Only guild admins may approve. The reservation, the
+// approval and the claim for provisioning commit together, so the
+// scheduler never sees the request approved but unclaimed. If
+// provisioning fails the request is marked failed, the reservation is
+// refunded and the returned error describes the failure.
+func (s *Service) Approve(ctx context.Context, id int64, actorID string) (*Request, error) {
+	req, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, req.GuildID, actorID, treasury.ActionApprove); err != nil {
+		return nil, err
+	}
+	if err := ValidateTransition(req.Status, StatusApproved); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	next := *req
+	next.Status = StatusApproved
+	next.ApprovedAt = &now
+	next.ApprovedBy = actorID
+	next.TotalCost = req.ReservationCost()
+	claimed := next
+	claimed.Status = StatusProvisioning
+
+	_, err = s.funds.Debit(ctx, req.GuildID, actorID, next.TotalCost, treasury.SourceServerProvisioning,
+		fmt.Sprintf("Reserve %dh of %s for %q", req.DurationHours, req.TemplateID, req.ServerName),
+		fmt.Sprintf("provision:%d:reserve", req.ID),
+		func(ctx context.Context, tx *sql.Tx, _ int64) error {
+			if err := s.transition(ctx, tx, req.Status, &next, actorID, "approved", next.TotalCost); err != nil {
+				return err
+			}
+			return s.transition(ctx, tx, next.Status, &claimed, SystemActor, "provisioning started", 0)
+		})
+	if errors.Is(err, ledger.ErrDuplicate) {
+		return nil, fmt.Errorf("%w: request %d already approved", ErrConflict, req.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.provision(ctx, &claimed)
+}
+
+// Reject fails a pending request without reserving funds.
+func (s *Service) Reject(ctx context.Context, id int64, actorID, reason string) (*Request, error) {
+	req, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, req.GuildID, actorID, treasury.ActionApprove); err != nil {
+		return nil, err
+	}
+	if req.Status != StatusPending {
+		return nil, fmt.Errorf("%w: only pending requests can be rejected", ErrInvalidTransition)
+	}
+
+	next := *req
+	next.Status = StatusFailed
+	next.Notes = "rejected: " + reason
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, req.Status, &next, actorID, next.Notes, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Terminate stops an active server before its scheduled end and refunds
+// the unused whole hours to the guild treasury. The requester or a guild
+// admin may terminate. The request is marked terminating, with the
+// refund, before the server is removed; if removal fails the request
+// stays terminating and the scheduler retries it.
+func (s *Service) Terminate(ctx context.Context, id int64, actorID, reason string) (*Request, error) {
+	req, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if actorID != req.RequestedBy {
+		if err := s.authorize(ctx, req.GuildID, actorID, treasury.ActionApprove); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateTransition(req.Status, StatusTerminating); err != nil {
+		return nil, err
+	}
+
+	refund := s.unusedCost(req)
+	next := *req
+	next.Status = StatusTerminating
+	next.TotalCost = req.TotalCost - refund
+	if reason == "" {
+		reason = "terminated early"
+	}
+
+	if refund <= 0 {
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			return s.transition(ctx, tx, req.Status, &next, actorID, reason, 0)
+		})
+	} else {
+		_, err = s.funds.Refund(ctx, req.GuildID, actorID, refund,
+			fmt.Sprintf("Refund unused hours of %q", req.ServerName),
+			fmt.Sprintf("provision:%d:terminate", req.ID),
+			func(ctx context.Context, tx *sql.Tx, _ int64) error {
+				return s.transition(ctx, tx, req.Status, &next, actorID, reason, refund)
+			})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.deprovision(ctx, &next, actorID, reason)
+}
+
+// unusedCost is the refund for the whole hours remaining before the
+// scheduled termination. Partial hours are not refunded.
+func (s *Service) unusedCost(req *Request) int64 {
+	if req.TerminationScheduledAt == nil {
+		return 0
+	}
+	remaining := req.TerminationScheduledAt.Sub(s.now())
+	if remaining <= 0 {
+		return 0
+	}
+	return int64(remaining/time.Hour) * req.CostPerHour
+}
+
+// claim moves an approved request to provisioning. The guarded update
+// lets only one caller claim it; the others get ErrConflict.
+func (s *Service) claim(ctx context.Context, req *Request) (*Request, error) {
+	next := *req
+	next.Status = StatusProvisioning
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, req.Status, &next, SystemActor, "provisioning started", 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// provision starts the server for a request this caller has claimed and
+// marks it active. The server ID is stored as soon as the server exists,
+// so recovery can remove it if the request never becomes active. On
+// failure the request is failed and its reservation refunded.
+func (s *Service) provision(ctx context.Context, req *Request) (*Request, error) {
+	s.publish(req, events.StatusCreating, "")
+
+	serverID, provErr := s.servers.Provision(ctx, req)
+	if provErr != nil {
+		failed, err := s.fail(ctx, req, fmt.Sprintf("provisioning failed: %v", provErr))
+		if err != nil {
+			return nil, errors.Join(provErr, err)
+		}
+		return failed, fmt.Errorf("provisioning: request %d: %w", req.ID, provErr)
+	}
+
+	provisioned := *req
+	provisioned.ServerID = serverID
+	if err := s.recordServer(ctx, &provisioned); err != nil {
+		// Nobody else knows about this server; remove it now.
+		if rmErr := s.servers.Deprovision(ctx, &provisioned); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("remove unrecorded server %s: %w", serverID, rmErr))
+		}
+		return nil, err
+	}
+
+	ends := s.now().Add(time.Duration(req.DurationHours) * time.Hour)
+	active := provisioned
+	active.Status = StatusActive
+	active.TerminationScheduledAt = &ends
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, req.Status, &active, SystemActor, "server "+serverID+" active", 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(&active, events.StatusReady, "")
+	return &active, nil
+}
+
+// recordServer stores the server ID of a request that is still
+// provisioning.
+func (s *Service) recordServer(ctx context.Context, req *Request) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE server_provision_requests SET server_id = $2
+		WHERE id = $1 AND status = $3
+	`, req.ID, req.ServerID, StatusProvisioning)
+	if err != nil {
+		return fmt.Errorf("provisioning: record server for request %d: %w", req.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("provisioning: record server for request %d: %w", req.ID, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: request %d is no longer %s", ErrConflict, req.ID, StatusProvisioning)
+	}
+	return nil
+}
+
+// fail marks a request failed and refunds everything charged so far.
+func (s *Service) fail(ctx context.Context, req *Request, reason string) (*Request, error) {
+	next := *req
+	next.Status = StatusFailed
+	next.Notes = reason
+	next.TotalCost = 0
+
+	var err error
+	if req.TotalCost <= 0 {
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			return s.transition(ctx, tx, req.Status, &next, SystemActor, reason, 0)
+		})
+	} else {
+		_, err = s.funds.Refund(ctx, req.GuildID, SystemActor, req.TotalCost,
+			fmt.Sprintf("Refund failed provisioning of %q", req.ServerName),
+			fmt.Sprintf("provision:%d:refund", req.ID),
+			func(ctx context.Context, tx *sql.Tx, _ int64) error {
+				return s.transition(ctx, tx, req.Status, &next, SystemActor, reason, req.TotalCost)
+			})
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.publish(&next, events.StatusFailed, reason)
+	return &next, nil
+}
+
+// renew extends an active server by another term, or terminates it when
+// auto-renew is off or the treasury cannot pay.
+func (s *Service) renew(ctx context.Context, req *Request) error {
+	if !req.AutoRenew {
+		return s.expire(ctx, req, "scheduled termination")
+	}
+
+	cost := req.RenewalCost()
+	ends := req.TerminationScheduledAt.Add(time.Duration(req.DurationHours) * time.Hour)
+	next := *req
+	next.TerminationScheduledAt = &ends
+	next.TotalCost = req.TotalCost + cost
+
+	_, err := s.funds.Debit(ctx, req.GuildID, SystemActor, cost, treasury.SourceServerProvisioning,
+		fmt.Sprintf("Renew %q for %dh", req.ServerName, req.DurationHours),
+		fmt.Sprintf("provision:%d:renew:%d", req.ID, req.TerminationScheduledAt.Unix()),
+		func(ctx context.Context, tx *sql.Tx, _ int64) error {
+			return s.transition(ctx, tx, req.Status, &next, SystemActor, "auto-renewed", cost)
+		})
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		return s.expire(ctx, req, "insufficient treasury funds to renew")
+	}
+	return err
+}
+
+// expire deprovisions a server at the end of its term without a refund.
+func (s *Service) expire(ctx context.Context, req *Request, reason string) error {
+	next := *req
+	next.Status = StatusTerminating
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, req.Status, &next, SystemActor, reason, 0)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.deprovision(ctx, &next, SystemActor, reason)
+	return err
+}
+
+// deprovision removes the server of a terminating request and marks it
+// terminated. On failure the request stays terminating for the scheduler
+// to retry.
+func (s *Service) deprovision(ctx context.Context, req *Request, actorID, reason string) (*Request, error) {
+	s.publish(req, events.StatusStopping, reason)
+	if err := s.servers.Deprovision(ctx, req); err != nil {
+		return req, fmt.Errorf("provisioning: deprovision request %d: %w", req.ID, err)
+	}
+	next := *req
+	next.Status = StatusTerminated
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, req.Status, &next, actorID, reason, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(&next, events.StatusStopped, reason)
+	return &next, nil
+}
+
+// ProcessDue provisions approved requests that nobody has claimed,
+// recovers requests whose worker died mid-provisioning or mid-removal,
+// and renews or terminates active servers whose term has ended. Errors
+// for individual requests are logged so one bad request does not stall
+// the rest.
+func (s *Service) ProcessDue(ctx context.Context) error {
+	approved, err := s.list(ctx, `WHERE r.status = $1 ORDER BY r.id`, StatusApproved)
+	if err != nil {
+		return err
+	}
+	for i := range approved {
+		req, err := s.claim(ctx, &approved[i])
+		if errors.Is(err, ErrConflict) {
+			continue // claimed by an approval or another replica
+		}
+		if err == nil {
+			_, err = s.provision(ctx, req)
+		}
+		if err != nil {
+			s.logger.Error("provisioning approved request failed", "request_id", approved[i].ID, "error", err)
+		}
+	}
+
+	// Provisioning that outlived staleAfter was interrupted: the request
+	// is failed and refunded, and the server recorded by recordServer, if
+	// any, removed.
+	stuck, err := s.stale(ctx, StatusProvisioning)
+	if err != nil {
+		return err
+	}
+	for i := range stuck {
+		req := &stuck[i]
+		if _, err := s.fail(ctx, req, "provisioning interrupted"); err != nil {
+			if !errors.Is(err, ErrConflict) {
+				s.logger.Error("failing interrupted request failed", "request_id", req.ID, "error", err)
+			}
+			continue
+		}
+		if err := s.servers.Deprovision(ctx, req); err != nil {
+			s.logger.Error("removing interrupted server failed", "request_id", req.ID, "error", err)
+		}
+	}
+
+	terminating, err := s.stale(ctx, StatusTerminating)
+	if err != nil {
+		return err
+	}
+	for i := range terminating {
+		if _, err := s.deprovision(ctx, &terminating[i], SystemActor, "server removal retried"); err != nil && !errors.Is(err, ErrConflict) {
+			s.logger.Error("removing terminated server failed", "request_id", terminating[i].ID, "error", err)
+		}
+	}
+
+	due, err := s.list(ctx, `WHERE r.status = $1 AND r.termination_scheduled_at <= $2 ORDER BY r.termination_scheduled_at`,
+		StatusActive, s.now())
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		if err := s.renew(ctx, &due[i]); err != nil {
+			s.logger.Error("renewing provisioned server failed", "request_id", due[i].ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// stale lists requests that have been in status for longer than
+// staleAfter, by their latest recorded transition.
+func (s *Service) stale(ctx context.Context, status Status) ([]Request, error) {
+	return s.list(ctx, `
+		WHERE r.status = $1 AND (
+			SELECT MAX(e.created_at) FROM server_provision_events e WHERE e.request_id = r.id
+		) <= $2
+		ORDER BY r.id`, status, s.now().Add(-s.staleAfter))
+}
+
+// Run calls ProcessDue every minute until ctx is cancelled. It is intended
+// for app.NewBackgroundService.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.ProcessDue(ctx); err != nil {
+			s.logger.Error("provisioning scheduler pass failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// transition writes next's status and lifecycle columns, guarded on the
+// request still being in from, and appends the audit event.
+func (s *Service) transition(ctx context.Context, tx *sql.Tx, from Status, next *Request, actorID, reason string, amount int64) error {
+	if err := ValidateTransition(from, next.Status); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE server_provision_requests
+		SET status = $2, approved_at = $3, approved_by = $4, server_id = $5,
+		    termination_scheduled_at = $6, total_cost = $7, notes = $8
+		WHERE id = $1 AND status = $9
+	`, next.ID, next.Status, next.ApprovedAt, nullString(next.ApprovedBy), nullString(next.ServerID),
+		next.TerminationScheduledAt, next.TotalCost, nullString(next.Notes), from)
+	if err != nil {
+		return fmt.Errorf("provisioning: update request %d: %w", next.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("provisioning: update request %d: %w", next.ID, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: request %d is no longer %s", ErrConflict, next.ID, from)
+	}
+	if err := s.recordEvent(ctx, tx, next.ID, from, next.Status, actorID, reason, amount); err != nil {
+		return err
+	}
+	if s.audit == nil {
+		return nil
+	}
+	_, err = s.audit.RecordTx(ctx, tx, audit.Event{
+		Actor:  actorID,
+		Action: "provision." + string(next.Status),
+		Target: audit.Target{Type: "provision_request", ID: strconv.FormatInt(next.ID, 10)},
+		Before: map[string]any{"status": from},
+		After: map[string]any{
+			"status":     next.Status,
+			"guild_id":   next.GuildID,
+			"server_id":  next.ServerID,
+			"total_cost": next.TotalCost,
+			"amount":     amount,
+			"reason":     reason,
+		},
+	})
+	return err
+}
+
+func (s *Service) recordEvent(ctx context.Context, tx *sql.Tx, requestID int64, from, to Status, actorID, reason string, amount int64) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO server_provision_events (request_id, from_status, to_status, actor, reason, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, requestID, nullString(string(from)), to, actorID, reason, amount)
+	if err != nil {
+		return fmt.Errorf("provisioning: record event: %w", err)
+	}
+	return nil
+}
+
+// Events returns the audit trail for a request, oldest first.
+func (s *Service) Events(ctx context.Context, requestID int64) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, request_id, COALESCE(from_status, ''), to_status, actor, COALESCE(reason, ''), amount, created_at
+		FROM server_provision_events
+		WHERE request_id = $1
+		ORDER BY created_at, id
+	`, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning: events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.RequestID, &e.FromStatus, &e.ToStatus, &e.Actor, &e.Reason, &e.Amount, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("provisioning: scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+const selectRequest = `
+	SELECT r.id, r.guild_id, r.requested_by, r.template_id, r.server_name, r.duration_hours,
+	       COALESCE(r.auto_renew, FALSE), r.requested_at, r.approved_at, COALESCE(r.approved_by, ''),
+	       r.status, COALESCE(r.server_id, ''), r.termination_scheduled_at, COALESCE(r.total_cost, 0),
+	       COALESCE(r.notes, ''), COALESCE(t.game_type, ''), COALESCE(t.cost_per_hour, 0), COALESCE(t.setup_cost, 0)
+	FROM server_provision_requests r
+	LEFT JOIN server_templates t ON t.id = r.template_id
+`
+
+// Get loads a request by ID.
+func (s *Service) Get(ctx context.Context, id int64) (*Request, error) {
+	req, err := scanRequest(s.db.QueryRowContext(ctx, selectRequest+`WHERE r.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("provisioning: get request %d: %w", id, err)
+	}
+	return req, nil
+}
+
+func (s *Service) list(ctx context.Context, where string, args ...any) ([]Request, error) {
+	rows, err := s.db.QueryContext(ctx, selectRequest+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning: list requests: %w", err)
+	}
+	defer rows.Close()
+
+	var reqs []Request
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("provisioning: scan request: %w", err)
+		}
+		reqs = append(reqs, *req)
+	}
+	return reqs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRequest(row scanner) (*Request, error) {
+	var (
+		req                   Request
+		approvedAt, terminate sql.NullTime
+	)
+	err := row.Scan(&req.ID, &req.GuildID, &req.RequestedBy, &req.TemplateID, &req.ServerName, &req.DurationHours,
+		&req.AutoRenew, &req.RequestedAt, &approvedAt, &req.ApprovedBy,
+		&req.Status, &req.ServerID, &terminate, &req.TotalCost,
+		&req.Notes, &req.GameType, &req.CostPerHour, &req.SetupCost)
+	if err != nil {
+		return nil, err
+	}
+	if approvedAt.Valid {
+		req.ApprovedAt = &approvedAt.Time
+	}
+	if terminate.Valid {
+		req.TerminationScheduledAt = &terminate.Time
+	}
+	return &req, nil
+}
+
+func (s *Service) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("provisioning: begin: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("provisioning: commit: %w", err)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,495 @@
+package provisioning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/wethegamers/agis/internal/events"
+	"github.com/wethegamers/agis/internal/ledger"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+type fakeAuthorizer struct {
+	roles map[string]treasury.Role
+}
+
+func (f *fakeAuthorizer) GuildRole(_ context.Context, _, discordID string) (treasury.Role, error) {
+	return f.roles[discordID], nil
+}
+
+func (f *fakeAuthorizer) IsPlatformAdmin(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+// fakeFunds runs the workflow callback in a plain transaction without
+// touching the ledger.
+type fakeFunds struct {
+	db      *sql.DB
+	debits  []int64
+	refunds []int64
+	err     error
+}
+
+func (f *fakeFunds) Debit(ctx context.Context, _, _ string, amount int64, _, _, _ string, fn ledger.TxFunc) (*treasury.Transaction, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.debits = append(f.debits, amount)
+	return f.run(ctx, fn)
+}
+
+func (f *fakeFunds) Refund(ctx context.Context, _, _ string, amount int64, _, _ string, fn ledger.TxFunc) (*treasury.Transaction, error) {
+	f.refunds = append(f.refunds, amount)
+	return f.run(ctx, fn)
+}
+
+func (f *fakeFunds) run(ctx context.Context, fn ledger.TxFunc) (*treasury.Transaction, error) {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(ctx, tx, 1); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &treasury.Transaction{ID: 1}, tx.Commit()
+}
+
+type fakeProvisioner struct {
+	err            error
+	deprovisionErr error
+	provisioned    []int64
+	deprovisioned  []int64
+	removed        []string
+}
+
+func (f *fakeProvisioner) Provision(_ context.Context, req *Request) (string, error) {
+	f.provisioned = append(f.provisioned, req.ID)
+	if f.err != nil {
+		return "", f.err
+	}
+	return "42", nil
+}
+
+func (f *fakeProvisioner) Deprovision(_ context.Context, req *Request) error {
+	f.deprovisioned = append(f.deprovisioned, req.ID)
+	f.removed = append(f.removed, req.ServerID)
+	return f.deprovisionErr
+}
+
+var requestColumns = []string{
+	"id", "guild_id", "requested_by", "template_id", "server_name", "duration_hours",
+	"auto_renew", "requested_at", "approved_at", "approved_by",
+	"status", "server_id", "termination_scheduled_at", "total_cost",
+	"notes", "game_type", "cost_per_hour", "setup_cost",
+}
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock, *fakeFunds, *fakeProvisioner) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	funds := &fakeFunds{db: db}
+	servers := &fakeProvisioner{}
+	authz := &fakeAuthorizer{roles: map[string]treasury.Role{
+		"member": treasury.RoleMember,
+		"admin":  treasury.RoleAdmin,
+	}}
+	svc := NewService(db, funds, authz, servers, nil)
+	svc.now = func() time.Time { return testNow }
+	return svc, mock, funds, servers
+}
+
+func expectGet(mock sqlmock.Sqlmock, status Status, autoRenew bool, terminate any, totalCost int64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM server_provision_requests r`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(requestColumns).AddRow(
+			7, "g1", "member", "minecraft-small", "survival", 24,
+			autoRenew, testNow.Add(-time.Hour), nil, "",
+			string(status), "42", terminate, totalCost,
+			"", "minecraft", 100, 500))
+}
+
+// requestRows returns one request row with ID 7 in status.
+func requestRows(status Status, terminate any, totalCost int64) *sqlmock.Rows {
+	return sqlmock.NewRows(requestColumns).AddRow(
+		7, "g1", "member", "minecraft-small", "survival", 24,
+		true, testNow.Add(-25*time.Hour), nil, "",
+		string(status), "", terminate, totalCost,
+		"", "minecraft", 100, 500)
+}
+
+// expectDue expects one of ProcessDue's lookups: approved requests,
+// stale provisioning or terminating requests, or active requests due.
+// nil rows return nothing.
+func expectDue(mock sqlmock.Sqlmock, status Status, rows *sqlmock.Rows) {
+	if rows == nil {
+		rows = sqlmock.NewRows(requestColumns)
+	}
+	switch status {
+	case StatusApproved:
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM server_provision_requests r`)).
+			WithArgs(status).WillReturnRows(rows)
+	case StatusActive:
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM server_provision_requests r`)).
+			WithArgs(status, testNow).WillReturnRows(rows)
+	default:
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT MAX(e.created_at) FROM server_provision_events`)).
+			WithArgs(status, testNow.Add(-DefaultStaleAfter)).WillReturnRows(rows)
+	}
+}
+
+// expectRecordServer expects the server ID of request 7 to be stored
+// while it is provisioning; n is the number of rows updated.
+func expectRecordServer(mock sqlmock.Sqlmock, n int64) {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE server_provision_requests SET server_id = $2`)).
+		WithArgs(7, "42", StatusProvisioning).
+		WillReturnResult(sqlmock.NewResult(0, n))
+}
+
+func expectTransition(mock sqlmock.Sqlmock, from, to Status, amount int64) {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE server_provision_requests`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO server_provision_events`)).
+		WithArgs(7, string(from), to, sqlmock.AnyArg(), sqlmock.AnyArg(), amount).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		ok       bool
+	}{
+		{StatusPending, StatusApproved, true},
+		{StatusPending, StatusActive, false},
+		{StatusApproved, StatusProvisioning, true},
+		{StatusProvisioning, StatusActive, true},
+		{StatusProvisioning, StatusFailed, true},
+		{StatusActive, StatusActive, true},
+		{StatusActive, StatusTerminating, true},
+		{StatusActive, StatusTerminated, false},
+		{StatusTerminating, StatusTerminated, true},
+		{StatusActive, StatusFailed, false},
+		{StatusTerminated, StatusActive, false},
+		{StatusFailed, StatusPending, false},
+	}
+	for _, tt := range tests {
+		err := ValidateTransition(tt.from, tt.to)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateTransition(%s, %s) = %v, want ok=%v", tt.from, tt.to, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected ErrInvalidTransition, got %v", err)
+		}
+	}
+	if !StatusTerminated.Terminal() || StatusActive.Terminal() {
+		t.Error("unexpected terminal statuses")
+	}
+}
+
+func TestApproveProvisionsServer(t *testing.T) {
+	svc, mock, funds, _ := newTestService(t)
+	bus := events.NewBus(events.Options{})
+	svc.SetEventPublisher(bus)
+	sub, err := bus.Subscribe("member", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	expectGet(mock, StatusPending, false, nil, 0)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusPending, StatusApproved, 2900)
+	expectTransition(mock, StatusApproved, StatusProvisioning, 0)
+	mock.ExpectCommit()
+	expectRecordServer(mock, 1)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusProvisioning, StatusActive, 0)
+	mock.ExpectCommit()
+
+	req, err := svc.Approve(context.Background(), 7, "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(funds.debits) != 1 || funds.debits[0] != 500+24*100 {
+		t.Errorf("expected reservation of 2900, got %v", funds.debits)
+	}
+	if req.Status != StatusActive || req.ServerID != "42" {
+		t.Errorf("unexpected request state: %+v", req)
+	}
+	if !req.TerminationScheduledAt.Equal(testNow.Add(24 * time.Hour)) {
+		t.Errorf("unexpected termination time %v", req.TerminationScheduledAt)
+	}
+	for _, want := range []string{events.StatusCreating, events.StatusReady} {
+		if e := <-sub.C(); e.Status != want {
+			t.Errorf("expected %s event, got %+v", want, e)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApproveRequiresAdmin(t *testing.T) {
+	svc, mock, _, _ := newTestService(t)
+	expectGet(mock, StatusPending, false, nil, 0)
+
+	if _, err := svc.Approve(context.Background(), 7, "member"); !errors.Is(err, treasury.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestApproveRefundsFailedProvisioning(t *testing.T) {
+	svc, mock, funds, servers := newTestService(t)
+	servers.err = errors.New("cluster full")
+
+	expectGet(mock, StatusPending, false, nil, 0)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusPending, StatusApproved, 2900)
+	expectTransition(mock, StatusApproved, StatusProvisioning, 0)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectTransition(mock, StatusProvisioning, StatusFailed, 2900)
+	mock.ExpectCommit()
+
+	req, err := svc.Approve(context.Background(), 7, "admin")
+	if err == nil {
+		t.Fatal("expected provisioning error")
+	}
+	if req == nil || req.Status != StatusFailed {
+		t.Fatalf("expected failed request, got %+v", req)
+	}
+	if len(funds.refunds) != 1 || funds.refunds[0] != 2900 {
+		t.Errorf("expected full refund, got %v", funds.refunds)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTerminateRefundsUnusedHours(t *testing.T) {
+	svc, mock, funds, servers := newTestService(t)
+
+	// 5.5 hours remain; only the 5 whole hours are refunded.
+	expectGet(mock, StatusActive, false, testNow.Add(5*time.Hour+30*time.Minute), 2900)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusActive, StatusTerminating, 500)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectTransition(mock, StatusTerminating, StatusTerminated, 0)
+	mock.ExpectCommit()
+
+	req, err := svc.Terminate(context.Background(), 7, "member", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(funds.refunds) != 1 || funds.refunds[0] != 500 {
+		t.Errorf("expected refund of 500, got %v", funds.refunds)
+	}
+	if req.Status != StatusTerminated || req.TotalCost != 2400 {
+		t.Errorf("expected terminated with total cost 2400, got %+v", req)
+	}
+	if len(servers.deprovisioned) != 1 {
+		t.Error("expected server to be deprovisioned")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessDueRenewsAndExpires(t *testing.T) {
+	svc, mock, funds, servers := newTestService(t)
+	funds.err = ledger.ErrInsufficientFunds
+
+	expectDue(mock, StatusApproved, nil)
+	expectDue(mock, StatusProvisioning, nil)
+	expectDue(mock, StatusTerminating, nil)
+	expectDue(mock, StatusActive, requestRows(StatusActive, testNow.Add(-time.Minute), 2900))
+	mock.ExpectBegin()
+	expectTransition(mock, StatusActive, StatusTerminating, 0)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectTransition(mock, StatusTerminating, StatusTerminated, 0)
+	mock.ExpectCommit()
+
+	if err := svc.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(servers.deprovisioned) != 1 {
+		t.Error("expected server without renewal funds to be deprovisioned")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTerminateKeepsTerminatingWhenRemovalFails(t *testing.T) {
+	svc, mock, funds, servers := newTestService(t)
+	servers.deprovisionErr = errors.New("cluster unreachable")
+
+	expectGet(mock, StatusActive, false, testNow.Add(5*time.Hour), 2900)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusActive, StatusTerminating, 500)
+	mock.ExpectCommit()
+
+	req, err := svc.Terminate(context.Background(), 7, "member", "")
+	if err == nil {
+		t.Fatal("expected deprovision error")
+	}
+	if req == nil || req.Status != StatusTerminating {
+		t.Fatalf("expected terminating request, got %+v", req)
+	}
+	if len(funds.refunds) != 1 || funds.refunds[0] != 500 {
+		t.Errorf("expected refund of 500, got %v", funds.refunds)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessDueSkipsClaimedRequest(t *testing.T) {
+	svc, mock, _, servers := newTestService(t)
+
+	// An approval claims the request between the lookup and the claim.
+	expectDue(mock, StatusApproved, requestRows(StatusApproved, nil, 2900))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE server_provision_requests`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	expectDue(mock, StatusProvisioning, nil)
+	expectDue(mock, StatusTerminating, nil)
+	expectDue(mock, StatusActive, nil)
+
+	if err := svc.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(servers.provisioned) != 0 {
+		t.Errorf("provisioned a request claimed elsewhere: %v", servers.provisioned)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessDueRecoversStaleRequests(t *testing.T) {
+	svc, mock, funds, servers := newTestService(t)
+
+	expectDue(mock, StatusApproved, nil)
+	// The interrupted provisioning is failed and refunded...
+	expectDue(mock, StatusProvisioning, requestRows(StatusProvisioning, nil, 2900))
+	mock.ExpectBegin()
+	expectTransition(mock, StatusProvisioning, StatusFailed, 2900)
+	mock.ExpectCommit()
+	// ...and the interrupted termination finished.
+	expectDue(mock, StatusTerminating, requestRows(StatusTerminating, testNow.Add(time.Hour), 2800))
+	mock.ExpectBegin()
+	expectTransition(mock, StatusTerminating, StatusTerminated, 0)
+	mock.ExpectCommit()
+	expectDue(mock, StatusActive, nil)
+
+	if err := svc.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(funds.refunds) != 1 || funds.refunds[0] != 2900 {
+		t.Errorf("expected refund of 2900, got %v", funds.refunds)
+	}
+	if len(servers.deprovisioned) != 2 || len(servers.provisioned) != 0 {
+		t.Errorf("deprovisioned %v, provisioned %v", servers.deprovisioned, servers.provisioned)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProvisionRecordsServerBeforeActivating(t *testing.T) {
+	svc, mock, _, servers := newTestService(t)
+
+	expectGet(mock, StatusPending, false, nil, 0)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusPending, StatusApproved, 2900)
+	expectTransition(mock, StatusApproved, StatusProvisioning, 0)
+	mock.ExpectCommit()
+	expectRecordServer(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE server_provision_requests`)).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	if _, err := svc.Approve(context.Background(), 7, "admin"); err == nil {
+		t.Fatal("expected activation error")
+	}
+	if len(servers.deprovisioned) != 0 {
+		t.Errorf("recorded server removed before recovery: %v", servers.removed)
+	}
+
+	// Recovery finds the stored server ID and removes that server.
+	rows := sqlmock.NewRows(requestColumns).AddRow(
+		7, "g1", "member", "minecraft-small", "survival", 24,
+		true, testNow.Add(-25*time.Hour), nil, "",
+		string(StatusProvisioning), "42", nil, 2900,
+		"", "minecraft", 100, 500)
+	expectDue(mock, StatusApproved, nil)
+	expectDue(mock, StatusProvisioning, rows)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusProvisioning, StatusFailed, 2900)
+	mock.ExpectCommit()
+	expectDue(mock, StatusTerminating, nil)
+	expectDue(mock, StatusActive, nil)
+
+	if err := svc.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(servers.removed) != 1 || servers.removed[0] != "42" {
+		t.Errorf("expected server 42 removed, got %v", servers.removed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProvisionRemovesUnrecordedServer(t *testing.T) {
+	svc, mock, _, servers := newTestService(t)
+
+	expectGet(mock, StatusPending, false, nil, 0)
+	mock.ExpectBegin()
+	expectTransition(mock, StatusPending, StatusApproved, 2900)
+	expectTransition(mock, StatusApproved, StatusProvisioning, 0)
+	mock.ExpectCommit()
+	// Recovery already failed the request.
+	expectRecordServer(mock, 0)
+
+	if _, err := svc.Approve(context.Background(), 7, "admin"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if len(servers.removed) != 1 || servers.removed[0] != "42" {
+		t.Errorf("expected server 42 removed, got %v", servers.removed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransitionConflict(t *testing.T) {
+	svc, mock, _, _ := newTestService(t)
+
+	expectGet(mock, StatusPending, false, nil, 0)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE server_provision_requests`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if _, err := svc.Reject(context.Background(), 7, "admin", "too expensive"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
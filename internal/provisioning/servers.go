@@ -0,0 +1,73 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/wethegamers/agis/internal/opensaas"
+	"github.com/wethegamers/agis/internal/templates"
+)
+
+// TemplateLookup loads a server template with its merged resources.
+type TemplateLookup interface {
+	Get(ctx context.Context, id string) (*templates.Template, error)
+}
+
+// ServerProvisioner provisions guild servers through the OpenSaaS server
+// service. Servers are owned by the member who requested them.
+type ServerProvisioner struct {
+	users     opensaas.UserService
+	servers   opensaas.ServerService
+	templates TemplateLookup
+}
+
+// NewServerProvisioner creates a Provisioner backed by the OpenSaaS services.
+func NewServerProvisioner(users opensaas.UserService, servers opensaas.ServerService, tmpls TemplateLookup) *ServerProvisioner {
+	return &ServerProvisioner{users: users, servers: servers, templates: tmpls}
+}
+
+// Provision creates the server with the resources of the request's template.
+func (p *ServerProvisioner) Provision(ctx context.Context, req *Request) (string, error) {
+	userID, err := p.owner(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := p.templates.Get(ctx, req.TemplateID)
+	if err != nil {
+		return "", fmt.Errorf("load template %s: %w", req.TemplateID, err)
+	}
+	srv, err := p.servers.CreateServer(ctx, userID, opensaas.SpecFromTemplate(req.ServerName, tmpl))
+	if err != nil {
+		return "", fmt.Errorf("create server: %w", err)
+	}
+	return strconv.Itoa(srv.ID), nil
+}
+
+// Deprovision deletes the request's server. Requests that never got a
+// server are a no-op.
+func (p *ServerProvisioner) Deprovision(ctx context.Context, req *Request) error {
+	if req.ServerID == "" {
+		return nil
+	}
+	serverID, err := strconv.Atoi(req.ServerID)
+	if err != nil {
+		return fmt.Errorf("invalid server ID %q: %w", req.ServerID, err)
+	}
+	userID, err := p.owner(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := p.servers.DeleteServer(ctx, userID, serverID); err != nil {
+		return fmt.Errorf("delete server: %w", err)
+	}
+	return nil
+}
+
+func (p *ServerProvisioner) owner(ctx context.Context, req *Request) (int, error) {
+	user, err := p.users.GetUserByDiscordID(ctx, req.RequestedBy)
+	if err != nil {
+		return 0, fmt.Errorf("resolve requester %s: %w", req.RequestedBy, err)
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,35 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ResolveEnv replaces every environment variable whose value is a
+// reference with the secret it points to, so code that reads the
+// environment directly sees plain values. It returns the references by
+// variable name; variables are updated again when their secret rotates.
+func (m *Manager) ResolveEnv(ctx context.Context) (map[string]string, error) {
+	refs := make(map[string]string)
+	var errs []error
+	for _, kv := range os.Environ() {
+		key, val, _ := strings.Cut(kv, "=")
+		ref, ok := ParseRef(val)
+		if !ok || (m.resolvers[ref.Scheme] == nil && !slices.Contains(Schemes, ref.Scheme)) {
+			continue
+		}
+		secret, err := m.Resolve(ctx, val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		os.Setenv(key, secret)
+		refs[key] = val
+		m.Subscribe(val, func(v string) { os.Setenv(key, v) })
+	}
+	return refs, errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileResolver reads file:///path references, such as Docker and
+// Kubernetes secret mounts. The whole file, without a trailing newline,
+// is the value. Mounted Kubernetes secrets are updated in place, so a
+// re-read picks up rotation.
+type FileResolver struct{}
+
+// Resolve implements Resolver.
+func (FileResolver) Resolve(_ context.Context, ref Ref) (*Secret, error) {
+	if ref.Key != "" {
+		return nil, fmt.Errorf("file references take no #key: %s", ref)
+	}
+	data, err := os.ReadFile(ref.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Secret{Data: map[string]string{"": strings.TrimRight(string(data), "\r\n")}}, nil
+}
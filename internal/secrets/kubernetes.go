@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubernetesResolver reads k8s://namespace/name#key references from
+// Kubernetes Secrets through the API, which needs get permission on the
+// secret but no volume mount.
+type KubernetesResolver struct {
+	client kubernetes.Interface
+}
+
+// NewKubernetesResolver creates a resolver using client.
+func NewKubernetesResolver(client kubernetes.Interface) *KubernetesResolver {
+	return &KubernetesResolver{client: client}
+}
+
+// Resolve implements Resolver.
+func (k *KubernetesResolver) Resolve(ctx context.Context, ref Ref) (*Secret, error) {
+	namespace, name, ok := strings.Cut(ref.Path, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("want k8s://namespace/name#key, got %s", ref)
+	}
+	secret, err := k.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: secret %s", ErrNotFound, ref.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Secret{Data: make(map[string]string, len(secret.Data)+len(secret.StringData))}
+	for key, val := range secret.Data {
+		s.Data[key] = string(val)
+	}
+	for key, val := range secret.StringData {
+		s.Data[key] = val
+	}
+	return s, nil
+}
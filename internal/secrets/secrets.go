@@ -0,0 +1,329 @@
+// Package secrets provides secret references for AGIS.
+//
+// A configuration value such as file:///run/secrets/db,
+// vault://secret/production/agis-bot#DB_PASSWORD or
+// k8s://agis/agis-bot-secrets#DISCORD_TOKEN is a reference, resolved
+// through the Resolver registered for its scheme. The Manager caches what
+// it resolved, renews Vault leases and re-reads other secrets
+// periodically, and notifies subscribers when a value changes.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wethegamers/agis/internal/metrics"
+)
+
+var (
+	// ErrNotFound is returned when a secret or key does not exist.
+	ErrNotFound = errors.New("secrets: not found")
+	// ErrNoResolver is returned for a reference whose scheme has no
+	// registered resolver.
+	ErrNoResolver = errors.New("secrets: no resolver for scheme")
+)
+
+// Schemes lists the reference schemes AGIS understands. A value using
+// one of them is never passed through as a literal.
+var Schemes = []string{"file", "vault", "k8s"}
+
+// Ref is a parsed secret reference, scheme://path#key.
+type Ref struct {
+	Scheme string
+	// Path locates the secret: a file path, a Vault path starting with
+	// its mount, or namespace/name for Kubernetes.
+	Path string
+	// Key selects one value of a secret holding several.
+	Key string
+}
+
+// ParseRef parses s as a reference. ok is false if s has no scheme.
+func ParseRef(s string) (ref Ref, ok bool) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, " /") {
+		return Ref{}, false
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	return Ref{Scheme: scheme, Path: path, Key: key}, true
+}
+
+func (r Ref) String() string {
+	s := r.Scheme + "://" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// source identifies the secret without its key; keys of one secret are
+// read and rotated together.
+func (r Ref) source() string {
+	return r.Scheme + "://" + r.Path
+}
+
+// Secret is what a Resolver read: every key of the secret and, for
+// leased secrets, the lease.
+type Secret struct {
+	Data      map[string]string
+	LeaseID   string
+	TTL       time.Duration
+	Renewable bool
+}
+
+// Resolver reads the secret a reference points to.
+type Resolver interface {
+	Resolve(ctx context.Context, ref Ref) (*Secret, error)
+}
+
+// Renewer is implemented by resolvers whose secrets carry renewable
+// leases. Renew extends the lease and returns its new TTL.
+type Renewer interface {
+	Renew(ctx context.Context, s *Secret) (time.Duration, error)
+}
+
+type entry struct {
+	ref      Ref // with Key cleared
+	resolver Resolver
+	secret   *Secret
+	initTTL  time.Duration
+	due      time.Time
+}
+
+type subscriber struct {
+	id  int
+	ref Ref
+	fn  func(value string)
+}
+
+// Manager resolves references and keeps them fresh. It is safe for
+// concurrent use.
+type Manager struct {
+	resolvers map[string]Resolver
+	refresh   time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	subs    []subscriber
+	nextID  int
+}
+
+// NewManager creates a manager with no resolvers. Secrets without a lease
+// are re-read every five minutes.
+func NewManager(logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Manager{
+		resolvers: make(map[string]Resolver),
+		refresh:   5 * time.Minute,
+		logger:    logger,
+		now:       time.Now,
+		entries:   make(map[string]*entry),
+	}
+}
+
+// Register sets the resolver for a scheme such as "vault".
+func (m *Manager) Register(scheme string, r Resolver) {
+	m.resolvers[scheme] = r
+}
+
+// SetRefreshInterval sets how often secrets without a lease are re-read.
+func (m *Manager) SetRefreshInterval(d time.Duration) {
+	m.refresh = d
+}
+
+// IsRef reports whether value is a reference to a registered scheme.
+func (m *Manager) IsRef(value string) bool {
+	ref, ok := ParseRef(value)
+	return ok && m.resolvers[ref.Scheme] != nil
+}
+
+// Resolve returns the secret value a reference points to; any other
+// value is returned unchanged. Secrets are read once and then served from
+// the cache, which Run keeps current.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok := ParseRef(value)
+	if !ok || m.resolvers[ref.Scheme] == nil {
+		// A vault:// reference with Vault unconfigured must not become
+		// the literal password.
+		if ok && slices.Contains(Schemes, ref.Scheme) {
+			return "", fmt.Errorf("%w %q: %s", ErrNoResolver, ref.Scheme, value)
+		}
+		return value, nil
+	}
+
+	m.mu.Lock()
+	e, cached := m.entries[ref.source()]
+	m.mu.Unlock()
+	if !cached {
+		var err error
+		if e, err = m.fetch(ctx, ref); err != nil {
+			return "", err
+		}
+		m.mu.Lock()
+		if existing, ok := m.entries[ref.source()]; ok {
+			e = existing
+		} else {
+			m.entries[ref.source()] = e
+		}
+		m.mu.Unlock()
+	}
+	return m.lookup(e, ref)
+}
+
+func (m *Manager) lookup(e *entry, ref Ref) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := e.secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("%w: key %q in %s", ErrNotFound, ref.Key, ref.source())
+	}
+	return v, nil
+}
+
+// fetch reads a secret and schedules its next renewal or refresh.
+func (m *Manager) fetch(ctx context.Context, ref Ref) (*entry, error) {
+	r := m.resolvers[ref.Scheme]
+	s, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", ref.source(), err)
+	}
+	e := &entry{ref: Ref{Scheme: ref.Scheme, Path: ref.Path}, resolver: r, secret: s, initTTL: s.TTL}
+	e.due = m.nextDue(s.TTL)
+	return e, nil
+}
+
+// nextDue renews or re-reads leased secrets two thirds into their TTL.
+func (m *Manager) nextDue(ttl time.Duration) time.Time {
+	if ttl > 0 {
+		return m.now().Add(ttl * 2 / 3)
+	}
+	return m.now().Add(m.refresh)
+}
+
+// Subscribe calls fn with the new value whenever the secret a reference
+// points to changes. The returned function removes the subscription.
+func (m *Manager) Subscribe(value string, fn func(value string)) func() {
+	ref, _ := ParseRef(value)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	m.subs = append(m.subs, subscriber{id: id, ref: ref, fn: fn})
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, s := range m.subs {
+			if s.id == id {
+				m.subs = append(m.subs[:i:i], m.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Run keeps cached secrets current until ctx is done: leases are renewed
+// and, once they cannot be, the secret is read again; other secrets are
+// re-read at the refresh interval.
+func (m *Manager) Run(ctx context.Context) error {
+	for {
+		next := m.rotate(ctx)
+		t := time.NewTimer(max(next.Sub(m.now()), time.Second))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// rotate renews or re-reads every secret that is due and returns when
+// the next one will be.
+func (m *Manager) rotate(ctx context.Context) time.Time {
+	m.mu.Lock()
+	var due []*entry
+	for _, e := range m.entries {
+		if !m.now().Before(e.due) {
+			due = append(due, e)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range due {
+		m.refreshEntry(ctx, e)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := m.now().Add(m.refresh)
+	for _, e := range m.entries {
+		if e.due.Before(next) {
+			next = e.due
+		}
+	}
+	return next
+}
+
+func (m *Manager) refreshEntry(ctx context.Context, e *entry) {
+	scheme := e.ref.Scheme
+	if renewer, ok := e.resolver.(Renewer); ok && e.secret.Renewable && e.secret.LeaseID != "" {
+		ttl, err := renewer.Renew(ctx, e.secret)
+		// Near its maximum TTL a lease is renewed for less than asked;
+		// read a new secret before it expires.
+		if err == nil && ttl > e.initTTL/3 {
+			m.mu.Lock()
+			e.secret.TTL = ttl
+			e.due = m.nextDue(ttl)
+			m.mu.Unlock()
+			metrics.SecretRefreshesTotal.WithLabelValues(scheme, "renewed").Inc()
+			return
+		}
+		if err != nil {
+			m.logger.Warn("secret lease renewal failed, reading a new secret", "secret", e.ref.source(), "error", err)
+		}
+	}
+
+	fresh, err := m.fetch(ctx, e.ref)
+	if err != nil {
+		// Keep serving the cached value and retry after a short delay.
+		metrics.SecretRefreshesTotal.WithLabelValues(scheme, "failed").Inc()
+		m.logger.Error("secret refresh failed", "secret", e.ref.source(), "error", err)
+		m.mu.Lock()
+		e.due = m.now().Add(min(m.refresh, 30*time.Second))
+		m.mu.Unlock()
+		return
+	}
+
+	m.mu.Lock()
+	old := e.secret
+	e.secret, e.initTTL, e.due = fresh.secret, fresh.initTTL, fresh.due
+	var notify []func()
+	for _, s := range m.subs {
+		if s.ref.source() != e.ref.source() {
+			continue
+		}
+		if v, ok := fresh.secret.Data[s.ref.Key]; ok && v != old.Data[s.ref.Key] {
+			notify = append(notify, func() { s.fn(v) })
+		}
+	}
+	m.mu.Unlock()
+
+	result := "unchanged"
+	if len(notify) > 0 {
+		result = "rotated"
+		m.logger.Info("secret rotated", "secret", e.ref.source(), "subscribers", len(notify))
+	}
+	metrics.SecretRefreshesTotal.WithLabelValues(scheme, result).Inc()
+	for _, fn := range notify {
+		fn()
+	}
+}
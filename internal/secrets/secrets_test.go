@@ -0,0 +1,202 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseRef(t *testing.T) {
+	for in, want := range map[string]Ref{
+		"file:///run/secrets/db":               {Scheme: "file", Path: "/run/secrets/db"},
+		"vault://kv/agis#discord_token":        {Scheme: "vault", Path: "kv/agis", Key: "discord_token"},
+		"k8s://agis/agis-bot-secrets#PASSWORD": {Scheme: "k8s", Path: "agis/agis-bot-secrets", Key: "PASSWORD"},
+	} {
+		got, ok := ParseRef(in)
+		if !ok || got != want || got.String() != in {
+			t.Errorf("ParseRef(%q) = %+v, %v", in, got, ok)
+		}
+	}
+	for _, in := range []string{"hunter2", "://x", "a b://c", ""} {
+		if _, ok := ParseRef(in); ok {
+			t.Errorf("ParseRef(%q) accepted a plain value", in)
+		}
+	}
+}
+
+// countingResolver serves values from a map and counts reads.
+type countingResolver struct {
+	data  map[string]string
+	err   error
+	reads int
+}
+
+func (c *countingResolver) Resolve(context.Context, Ref) (*Secret, error) {
+	c.reads++
+	if c.err != nil {
+		return nil, c.err
+	}
+	data := make(map[string]string, len(c.data))
+	for k, v := range c.data {
+		data[k] = v
+	}
+	return &Secret{Data: data}, nil
+}
+
+func TestManagerResolve(t *testing.T) {
+	r := &countingResolver{data: map[string]string{"user": "agis", "password": "one"}}
+	m := NewManager(nil)
+	m.Register("test", r)
+	ctx := context.Background()
+
+	if got, err := m.Resolve(ctx, "plain-value"); err != nil || got != "plain-value" {
+		t.Errorf("plain value = %q, %v", got, err)
+	}
+	if got, err := m.Resolve(ctx, "postgres://db:5432/agis"); err != nil || got != "postgres://db:5432/agis" {
+		t.Errorf("URL with an unknown scheme = %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "vault://secret/agis#token"); !errors.Is(err, ErrNoResolver) {
+		t.Errorf("unconfigured scheme = %v, want ErrNoResolver", err)
+	}
+
+	for ref, want := range map[string]string{"test://db#user": "agis", "test://db#password": "one"} {
+		if got, err := m.Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("Resolve(%s) = %q, %v", ref, got, err)
+		}
+	}
+	if r.reads != 1 {
+		t.Errorf("reads = %d, want keys of one secret to share a read", r.reads)
+	}
+	if _, err := m.Resolve(ctx, "test://db#missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key = %v", err)
+	}
+}
+
+func TestManagerRefresh(t *testing.T) {
+	r := &countingResolver{data: map[string]string{"password": "one"}}
+	m := NewManager(nil)
+	m.Register("test", r)
+	m.SetRefreshInterval(time.Minute)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := m.Resolve(ctx, "test://db#password"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	unsubscribe := m.Subscribe("test://db#password", func(v string) { got = append(got, v) })
+
+	now = now.Add(time.Minute)
+	m.rotate(ctx)
+	if r.reads != 2 || len(got) != 0 {
+		t.Fatalf("reads = %d, notified %v for an unchanged secret", r.reads, got)
+	}
+
+	r.data["password"] = "two"
+	now = now.Add(time.Minute)
+	m.rotate(ctx)
+	if len(got) != 1 || got[0] != "two" {
+		t.Fatalf("notified %v, want the rotated password", got)
+	}
+
+	// A failed read keeps the cached value and retries soon.
+	r.err = errors.New("vault sealed")
+	now = now.Add(time.Minute)
+	if next := m.rotate(ctx); next.Sub(now) > 30*time.Second {
+		t.Errorf("next attempt in %s after a failure", next.Sub(now))
+	}
+	if v, _ := m.Resolve(ctx, "test://db#password"); v != "two" {
+		t.Errorf("cached value = %q after a failed refresh", v)
+	}
+
+	r.err = nil
+	r.data["password"] = "three"
+	unsubscribe()
+	now = now.Add(time.Minute)
+	m.rotate(ctx)
+	if len(got) != 1 {
+		t.Errorf("notified %v after unsubscribing", got)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(nil)
+	m.Register("file", FileResolver{})
+	ctx := context.Background()
+
+	if got, err := m.Resolve(ctx, "file://"+path); err != nil || got != "hunter2" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "file://"+path+".missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing file = %v", err)
+	}
+	if _, err := m.Resolve(ctx, "file://"+path+"#key"); err == nil {
+		t.Error("file reference with a key accepted")
+	}
+}
+
+func TestKubernetesResolver(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "agis", Name: "agis-bot-secrets"},
+		Data:       map[string][]byte{"DB_PASSWORD": []byte("from-k8s")},
+	})
+	m := NewManager(nil)
+	m.Register("k8s", NewKubernetesResolver(client))
+	ctx := context.Background()
+
+	if got, err := m.Resolve(ctx, "k8s://agis/agis-bot-secrets#DB_PASSWORD"); err != nil || got != "from-k8s" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "k8s://agis/other#DB_PASSWORD"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing secret = %v", err)
+	}
+	if _, err := m.Resolve(ctx, "k8s://agis-bot-secrets#DB_PASSWORD"); err == nil {
+		t.Error("reference without a namespace accepted")
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	r := &countingResolver{data: map[string]string{"token": "bot-token"}}
+	m := NewManager(nil)
+	m.Register("test", r)
+	m.SetRefreshInterval(time.Minute)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	t.Setenv("AGIS_TEST_TOKEN", "test://discord#token")
+	t.Setenv("AGIS_TEST_PLAIN", "value")
+
+	refs, err := m.ResolveEnv(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs["AGIS_TEST_TOKEN"] != "test://discord#token" || len(refs) != 1 {
+		t.Errorf("refs = %v", refs)
+	}
+	if got := os.Getenv("AGIS_TEST_TOKEN"); got != "bot-token" {
+		t.Errorf("AGIS_TEST_TOKEN = %q", got)
+	}
+
+	r.data["token"] = "rotated"
+	now = now.Add(time.Minute)
+	m.rotate(context.Background())
+	if got := os.Getenv("AGIS_TEST_TOKEN"); got != "rotated" {
+		t.Errorf("AGIS_TEST_TOKEN = %q after rotation", got)
+	}
+
+	t.Setenv("AGIS_TEST_VAULT", "vault://secret/agis#token")
+	if _, err := m.ResolveEnv(context.Background()); !errors.Is(err, ErrNoResolver) {
+		t.Errorf("unconfigured scheme = %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultResolver reads vault://mount/path#key references over the Vault
+// HTTP API. Paths on KV version 2 mounts (secret and kv unless
+// SetKVMounts says otherwise) read the latest version of the secret;
+// other paths, such as database/creds/agis-bot, return leased secrets
+// that the Manager renews.
+type VaultResolver struct {
+	addr   string
+	client *http.Client
+	kv     map[string]bool
+
+	role    string
+	jwtPath string
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewVaultResolver creates a resolver for the Vault server at addr that
+// authenticates with token.
+func NewVaultResolver(addr, token string) *VaultResolver {
+	return &VaultResolver{
+		addr:   strings.TrimRight(addr, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+		kv:     map[string]bool{"secret": true, "kv": true},
+		token:  token,
+	}
+}
+
+// SetHTTPClient sets the client used to reach Vault.
+func (v *VaultResolver) SetHTTPClient(c *http.Client) {
+	v.client = c
+}
+
+// SetKVMounts sets which mounts are KV version 2 secret engines.
+func (v *VaultResolver) SetKVMounts(mounts ...string) {
+	v.kv = make(map[string]bool, len(mounts))
+	for _, m := range mounts {
+		v.kv[m] = true
+	}
+}
+
+// SetKubernetesAuth logs in with the pod's service account token, read
+// from jwtPath, as role instead of using a static token. The login is
+// repeated when Vault rejects the current token.
+func (v *VaultResolver) SetKubernetesAuth(role, jwtPath string) {
+	v.role, v.jwtPath = role, jwtPath
+}
+
+// vaultResponse is the envelope of Vault read and renew responses.
+type vaultResponse struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int             `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// Resolve implements Resolver.
+func (v *VaultResolver) Resolve(ctx context.Context, ref Ref) (*Secret, error) {
+	mount, rest, _ := strings.Cut(ref.Path, "/")
+	path := ref.Path
+	if v.kv[mount] {
+		path = mount + "/data/" + rest
+	}
+	resp, err := v.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]any
+	if v.kv[mount] {
+		var kv struct {
+			Data map[string]any `json:"data"`
+		}
+		err = json.Unmarshal(resp.Data, &kv)
+		data = kv.Data
+	} else {
+		err = json.Unmarshal(resp.Data, &data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vault: decode %s: %w", ref.Path, err)
+	}
+
+	s := &Secret{
+		Data:      make(map[string]string, len(data)),
+		LeaseID:   resp.LeaseID,
+		TTL:       time.Duration(resp.LeaseDuration) * time.Second,
+		Renewable: resp.Renewable,
+	}
+	for k, val := range data {
+		if str, ok := val.(string); ok {
+			s.Data[k] = str
+		} else {
+			s.Data[k] = fmt.Sprint(val)
+		}
+	}
+	return s, nil
+}
+
+// Renew implements Renewer, asking for the lease's original TTL again.
+func (v *VaultResolver) Renew(ctx context.Context, s *Secret) (time.Duration, error) {
+	body := map[string]any{"lease_id": s.LeaseID, "increment": int(s.TTL.Seconds())}
+	resp, err := v.do(ctx, http.MethodPut, "sys/leases/renew", body)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// do sends an authenticated request, logging in again once if Vault
+// rejects the token and Kubernetes auth is configured.
+func (v *VaultResolver) do(ctx context.Context, method, path string, body any) (*vaultResponse, error) {
+	token, err := v.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, status, err := v.send(ctx, method, path, token, body)
+	if status == http.StatusForbidden && v.role != "" {
+		if token, err = v.login(ctx); err != nil {
+			return nil, err
+		}
+		resp, status, err = v.send(ctx, method, path, token, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case status == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: vault %s", ErrNotFound, path)
+	case status >= 300:
+		return nil, fmt.Errorf("vault: %s %s: status %d: %s", method, path, status, strings.Join(resp.Errors, "; "))
+	}
+	return resp, nil
+}
+
+func (v *VaultResolver) send(ctx context.Context, method, path, token string, body any) (*vaultResponse, int, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+path, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("vault: %s %s: %w", method, path, err)
+	}
+	defer res.Body.Close()
+
+	var resp vaultResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil && !errors.Is(err, io.EOF) {
+		return nil, res.StatusCode, fmt.Errorf("vault: %s %s: decode response: %w", method, path, err)
+	}
+	return &resp, res.StatusCode, nil
+}
+
+func (v *VaultResolver) currentToken(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	token := v.token
+	v.mu.Unlock()
+	if token == "" && v.role != "" {
+		return v.login(ctx)
+	}
+	return token, nil
+}
+
+// login exchanges the service account token for a Vault token.
+func (v *VaultResolver) login(ctx context.Context) (string, error) {
+	jwt, err := os.ReadFile(v.jwtPath)
+	if err != nil {
+		return "", fmt.Errorf("vault: read service account token: %w", err)
+	}
+	body := map[string]string{"role": v.role, "jwt": strings.TrimSpace(string(jwt))}
+	resp, status, err := v.send(ctx, http.MethodPost, "auth/kubernetes/login", "", body)
+	if err != nil {
+		return "", err
+	}
+	if status >= 300 || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault: kubernetes login as %q: status %d: %s", v.role, status, strings.Join(resp.Errors, "; "))
+	}
+	v.mu.Lock()
+	v.token = resp.Auth.ClientToken
+	v.mu.Unlock()
+	return resp.Auth.ClientToken, nil
+}
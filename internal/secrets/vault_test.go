@@ -0,0 +1,207 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the parts of the Vault HTTP API the resolver uses: KV
+// version 2 reads, leased database credentials, lease renewal and
+// Kubernetes login.
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	kv       map[string]map[string]any // by path below the mount
+	creds    int                       // database credentials issued
+	ttl      int                       // seconds granted per lease or renewal
+	renewals int
+	logins   int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{token: "root", kv: make(map[string]map[string]any), ttl: 3600}
+	srv := httptest.NewServer(v)
+	t.Cleanup(srv.Close)
+	return v, srv
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	reply := func(status int, body any) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		var req struct{ Role, JWT string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Role != "agis-bot" || req.JWT != "sa-token" {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		v.logins++
+		v.token = fmt.Sprintf("k8s-%d", v.logins)
+		reply(http.StatusOK, map[string]any{"auth": map[string]any{"client_token": v.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.token {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v1/secret/data/"):
+		data, ok := v.kv[strings.TrimPrefix(path, "/v1/secret/data/")]
+		if !ok {
+			reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"data": data, "metadata": map[string]any{"version": 1}}})
+	case r.Method == http.MethodGet && path == "/v1/database/creds/agis-bot":
+		v.creds++
+		reply(http.StatusOK, map[string]any{
+			"lease_id":       fmt.Sprintf("database/creds/agis-bot/%d", v.creds),
+			"lease_duration": v.ttl,
+			"renewable":      true,
+			"data":           map[string]any{"username": fmt.Sprintf("v-agis-%d", v.creds), "password": fmt.Sprintf("pw-%d", v.creds)},
+		})
+	case r.Method == http.MethodPut && path == "/v1/sys/leases/renew":
+		var req struct {
+			LeaseID   string `json:"lease_id"`
+			Increment int    `json:"increment"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.LeaseID != fmt.Sprintf("database/creds/agis-bot/%d", v.creds) {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"lease not found"}})
+			return
+		}
+		v.renewals++
+		reply(http.StatusOK, map[string]any{"lease_id": req.LeaseID, "lease_duration": min(req.Increment, v.ttl), "renewable": true})
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func (v *fakeVault) set(fn func(v *fakeVault)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fn(v)
+}
+
+func TestVaultKV(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	fake.kv["production/agis-bot"] = map[string]any{"DISCORD_TOKEN": "bot-token", "DB_PORT": 5432}
+
+	m := NewManager(nil)
+	m.Register("vault", NewVaultResolver(srv.URL, "root"))
+	ctx := context.Background()
+
+	for ref, want := range map[string]string{
+		"vault://secret/production/agis-bot#DISCORD_TOKEN": "bot-token",
+		"vault://secret/production/agis-bot#DB_PORT":       "5432",
+	} {
+		got, err := m.Resolve(ctx, ref)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%s) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"vault://secret/production/agis-bot#MISSING", "vault://secret/staging/agis-bot#DISCORD_TOKEN"} {
+		if _, err := m.Resolve(ctx, ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve(%s) = %v, want ErrNotFound", ref, err)
+		}
+	}
+
+	bad := NewManager(nil)
+	bad.Register("vault", NewVaultResolver(srv.URL, "wrong"))
+	if _, err := bad.Resolve(ctx, "vault://secret/production/agis-bot#DISCORD_TOKEN"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("bad token: %v", err)
+	}
+}
+
+func TestVaultLeaseRenewalAndRotation(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	m := NewManager(nil)
+	m.Register("vault", NewVaultResolver(srv.URL, "root"))
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	ref := "vault://database/creds/agis-bot#password"
+	if got, err := m.Resolve(ctx, ref); err != nil || got != "pw-1" {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	// The username comes from the same lease, not a second credential.
+	if got, _ := m.Resolve(ctx, "vault://database/creds/agis-bot#username"); got != "v-agis-1" {
+		t.Errorf("username = %q, want v-agis-1", got)
+	}
+	var rotated []string
+	m.Subscribe(ref, func(v string) { rotated = append(rotated, v) })
+
+	// Nothing is due before two thirds of the TTL.
+	now = now.Add(30 * time.Minute)
+	m.rotate(ctx)
+	if fake.renewals != 0 {
+		t.Fatalf("renewed %d times before the lease was due", fake.renewals)
+	}
+
+	now = now.Add(11 * time.Minute)
+	m.rotate(ctx)
+	if fake.renewals != 1 || fake.creds != 1 || len(rotated) != 0 {
+		t.Fatalf("renewals = %d, creds = %d, rotated = %v after renewal", fake.renewals, fake.creds, rotated)
+	}
+
+	// Near the lease's maximum TTL Vault grants less than asked, so the
+	// manager reads new credentials and tells subscribers.
+	fake.set(func(v *fakeVault) { v.ttl = 600 })
+	now = now.Add(41 * time.Minute)
+	m.rotate(ctx)
+	if fake.creds != 2 || len(rotated) != 1 || rotated[0] != "pw-2" {
+		t.Fatalf("creds = %d, rotated = %v after the lease ran out", fake.creds, rotated)
+	}
+	if got, _ := m.Resolve(ctx, ref); got != "pw-2" {
+		t.Errorf("Resolve after rotation = %q", got)
+	}
+}
+
+func TestVaultKubernetesAuth(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	fake.kv["production/agis-bot"] = map[string]any{"STRIPE_SECRET_KEY": "sk_live"}
+	jwt := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwt, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewVaultResolver(srv.URL, "")
+	v.SetKubernetesAuth("agis-bot", jwt)
+	ref, _ := ParseRef("vault://secret/production/agis-bot#STRIPE_SECRET_KEY")
+	ctx := context.Background()
+	if s, err := v.Resolve(ctx, ref); err != nil || s.Data["STRIPE_SECRET_KEY"] != "sk_live" {
+		t.Fatalf("Resolve = %+v, %v", s, err)
+	}
+
+	// An expired token is replaced by logging in again.
+	fake.set(func(v *fakeVault) { v.token = "revoked" })
+	if _, err := v.Resolve(ctx, ref); err != nil {
+		t.Fatalf("Resolve after token expiry: %v", err)
+	}
+	if fake.logins != 2 {
+		t.Errorf("logins = %d, want 2", fake.logins)
+	}
+
+	v.SetKubernetesAuth("other", jwt)
+	fake.set(func(v *fakeVault) { v.token = "revoked" })
+	if _, err := v.Resolve(ctx, ref); err == nil || !strings.Contains(err.Error(), "kubernetes login") {
+		t.Errorf("login with unknown role: %v", err)
+	}
+}
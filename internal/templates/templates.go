@@ -0,0 +1,363 @@
+// Package templates provides server template management for AGIS.
+//
+// Templates live in server_templates and describe a sized variant (small,
+// medium, large) of a game. They are merged with the per-game definitions
+// in hot-config.yaml using this precedence:
+//
+//  1. Values set on the server_templates row always win (pricing, player
+//     count and resource requests are size specific).
+//  2. An empty docker_image, cpu_request or memory_request falls back to the
+//     game's image and resource requests in hot-config.
+//  3. Resource limits come from hot-config and are raised to the request
+//     when a larger size asks for more than the game default allows.
+//  4. A game with enabled: false in hot-config makes all of its templates
+//     unavailable, regardless of is_active.
+package templates
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wethegamers/agis/internal/hotconfig"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Size is a template size class.
+type Size string
+
+// Template sizes.
+const (
+	SizeSmall  Size = "small"
+	SizeMedium Size = "medium"
+	SizeLarge  Size = "large"
+)
+
+// Field provenance values reported in Template.Sources.
+const (
+	SourceTemplate  = "template"
+	SourceHotConfig = "hot-config"
+)
+
+// Errors returned by the template service.
+var (
+	ErrNotFound        = errors.New("templates: template not found")
+	ErrExists          = errors.New("templates: template already exists")
+	ErrUnavailable     = errors.New("templates: template is not available")
+	ErrInvalidTemplate = errors.New("templates: invalid template")
+)
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,49}$`)
+
+// Template is a server template merged with its hot-config game definition.
+type Template struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	GameType      string    `json:"game_type"`
+	Size          Size      `json:"size"`
+	CostPerHour   int64     `json:"cost_per_hour"`
+	SetupCost     int64     `json:"setup_cost"`
+	MaxPlayers    int       `json:"max_players"`
+	CPURequest    string    `json:"cpu_request"`
+	MemoryRequest string    `json:"memory_request"`
+	CPULimit      string    `json:"cpu_limit,omitempty"`
+	MemoryLimit   string    `json:"memory_limit,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	DockerImage   string    `json:"docker_image"`
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Available is false when the template is inactive or its game is
+	// disabled in hot-config.
+	Available bool `json:"available"`
+	// Sources records where each merged field came from.
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// Validate checks the template fields, parsing CPU and memory with
+// Kubernetes quantity rules. All problems are reported together.
+func (t *Template) Validate() error {
+	var errs []error
+	if !idPattern.MatchString(t.ID) {
+		errs = append(errs, fmt.Errorf("id %q must be 2-50 lowercase letters, digits or dashes", t.ID))
+	}
+	if t.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if t.GameType == "" {
+		errs = append(errs, errors.New("game_type is required"))
+	}
+	switch t.Size {
+	case SizeSmall, SizeMedium, SizeLarge:
+	default:
+		errs = append(errs, fmt.Errorf("size %q must be small, medium or large", t.Size))
+	}
+	if t.CostPerHour <= 0 {
+		errs = append(errs, errors.New("cost_per_hour must be positive"))
+	}
+	if t.SetupCost < 0 {
+		errs = append(errs, errors.New("setup_cost must not be negative"))
+	}
+	if t.MaxPlayers <= 0 {
+		errs = append(errs, errors.New("max_players must be positive"))
+	}
+	if err := validateCPU("cpu_request", t.CPURequest); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateMemory("memory_request", t.MemoryRequest); err != nil {
+		errs = append(errs, err)
+	}
+	if t.DockerImage == "" {
+		errs = append(errs, errors.New("docker_image is required when hot-config has no image for the game"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplate, errors.Join(errs...))
+	}
+	return nil
+}
+
+func parsePositive(field, value string) (resource.Quantity, error) {
+	if value == "" {
+		return resource.Quantity{}, fmt.Errorf("%s is required when hot-config has no default", field)
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return q, fmt.Errorf("%s %q: %w", field, value, err)
+	}
+	if q.Sign() <= 0 {
+		return q, fmt.Errorf("%s %q must be positive", field, value)
+	}
+	return q, nil
+}
+
+// validateCPU rejects binary suffixes (e.g. "2Gi"), which are valid
+// quantities but almost certainly a memory value in the wrong field.
+func validateCPU(field, value string) error {
+	q, err := parsePositive(field, value)
+	if err != nil {
+		return err
+	}
+	if q.Format == resource.BinarySI {
+		return fmt.Errorf("%s %q uses a memory unit; use cores or millicores such as 500m", field, value)
+	}
+	return nil
+}
+
+func validateMemory(field, value string) error {
+	q, err := parsePositive(field, value)
+	if err != nil {
+		return err
+	}
+	if q.Cmp(resource.MustParse("1Mi")) < 0 {
+		return fmt.Errorf("%s %q is below 1Mi; did you mean %sMi?", field, value, value)
+	}
+	return nil
+}
+
+// Service manages server templates.
+type Service struct {
+	db    *sql.DB
+	games *hotconfig.Source
+}
+
+// NewService creates a template service. games may be nil, in which case
+// templates are used exactly as stored.
+func NewService(db *sql.DB, games *hotconfig.Source) *Service {
+	return &Service{db: db, games: games}
+}
+
+// merge applies the hot-config game definition to t.
+func (s *Service) merge(t *Template) {
+	t.Sources = map[string]string{
+		"docker_image":   SourceTemplate,
+		"cpu_request":    SourceTemplate,
+		"memory_request": SourceTemplate,
+	}
+	t.Available = t.IsActive
+
+	if s.games == nil {
+		return
+	}
+	game, ok := s.games.Game(t.GameType)
+	if !ok {
+		return
+	}
+	if !game.Enabled {
+		t.Available = false
+	}
+	if t.DockerImage == "" && game.ImageRef() != "" {
+		t.DockerImage = game.ImageRef()
+		t.Sources["docker_image"] = SourceHotConfig
+	}
+	if t.CPURequest == "" && game.Resources.RequestsCPU != "" {
+		t.CPURequest = game.Resources.RequestsCPU
+		t.Sources["cpu_request"] = SourceHotConfig
+	}
+	if t.MemoryRequest == "" && game.Resources.RequestsMemory != "" {
+		t.MemoryRequest = game.Resources.RequestsMemory
+		t.Sources["memory_request"] = SourceHotConfig
+	}
+	t.CPULimit = atLeast(game.Resources.LimitsCPU, t.CPURequest)
+	t.MemoryLimit = atLeast(game.Resources.LimitsMemory, t.MemoryRequest)
+}
+
+// atLeast returns limit, or request when the request is larger or the
+// limit is unset or unparsable.
+func atLeast(limit, request string) string {
+	l, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return request
+	}
+	r, err := resource.ParseQuantity(request)
+	if err != nil {
+		return limit
+	}
+	if r.Cmp(l) > 0 {
+		return request
+	}
+	return limit
+}
+
+const selectTemplate = `
+	SELECT id, name, game_type, size, cost_per_hour, setup_cost, max_players,
+	       cpu_request, memory_request, COALESCE(description, ''), COALESCE(docker_image, ''),
+	       COALESCE(is_active, TRUE), created_at, updated_at
+	FROM server_templates
+`
+
+func scanTemplate(row interface{ Scan(...any) error }) (*Template, error) {
+	var t Template
+	err := row.Scan(&t.ID, &t.Name, &t.GameType, &t.Size, &t.CostPerHour, &t.SetupCost, &t.MaxPlayers,
+		&t.CPURequest, &t.MemoryRequest, &t.Description, &t.DockerImage,
+		&t.IsActive, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns merged templates ordered by game and price. Inactive
+// templates are only included when includeInactive is set.
+func (s *Service) List(ctx context.Context, includeInactive bool) ([]Template, error) {
+	rows, err := s.db.QueryContext(ctx, selectTemplate+`
+		WHERE $1 OR is_active = TRUE
+		ORDER BY game_type, cost_per_hour, id
+	`, includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("templates: list: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Template
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("templates: scan: %w", err)
+		}
+		s.merge(t)
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// Get returns a merged template by ID, including inactive templates.
+func (s *Service) Get(ctx context.Context, id string) (*Template, error) {
+	t, err := scanTemplate(s.db.QueryRowContext(ctx, selectTemplate+`WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("templates: get %s: %w", id, err)
+	}
+	s.merge(t)
+	return t, nil
+}
+
+// Resolve returns a template that can be used to create a server.
+func (s *Service) Resolve(ctx context.Context, id string) (*Template, error) {
+	t, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Available {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, id)
+	}
+	return t, nil
+}
+
+// Create validates and stores a new template. Empty image and resource
+// fields are stored empty so they keep following hot-config.
+func (s *Service) Create(ctx context.Context, t Template) (*Template, error) {
+	merged := t
+	s.merge(&merged)
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO server_templates (id, name, game_type, size, cost_per_hour, setup_cost, max_players,
+		                              cpu_request, memory_request, description, docker_image, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING created_at, updated_at
+	`, t.ID, t.Name, t.GameType, t.Size, t.CostPerHour, t.SetupCost, t.MaxPlayers,
+		t.CPURequest, t.MemoryRequest, t.Description, t.DockerImage, t.IsActive,
+	).Scan(&merged.CreatedAt, &merged.UpdatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s", ErrExists, t.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("templates: create %s: %w", t.ID, err)
+	}
+	return &merged, nil
+}
+
+// Update validates and replaces an existing template.
+func (s *Service) Update(ctx context.Context, t Template) (*Template, error) {
+	merged := t
+	s.merge(&merged)
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE server_templates
+		SET name = $2, game_type = $3, size = $4, cost_per_hour = $5, setup_cost = $6, max_players = $7,
+		    cpu_request = $8, memory_request = $9, description = $10, docker_image = $11, is_active = $12,
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`, t.ID, t.Name, t.GameType, t.Size, t.CostPerHour, t.SetupCost, t.MaxPlayers,
+		t.CPURequest, t.MemoryRequest, t.Description, t.DockerImage, t.IsActive,
+	).Scan(&merged.CreatedAt, &merged.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("templates: update %s: %w", t.ID, err)
+	}
+	return &merged, nil
+}
+
+// Delete deactivates a template. Rows are kept because provisioning
+// requests and running servers still reference them.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE server_templates SET is_active = FALSE, updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("templates: delete %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
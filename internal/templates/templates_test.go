@@ -0,0 +1,151 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/wethegamers/agis/internal/hotconfig"
+)
+
+var templateColumns = []string{
+	"id", "name", "game_type", "size", "cost_per_hour", "setup_cost", "max_players",
+	"cpu_request", "memory_request", "description", "docker_image",
+	"is_active", "created_at", "updated_at",
+}
+
+func testGames() *hotconfig.Source {
+	return hotconfig.StaticSource(&hotconfig.File{Games: map[string]hotconfig.Game{
+		"minecraft": {
+			Enabled:  true,
+			Image:    "itzg/minecraft-server",
+			ImageTag: "java21",
+			Resources: hotconfig.Resources{
+				RequestsCPU: "500m", RequestsMemory: "1Gi",
+				LimitsCPU: "2000m", LimitsMemory: "4Gi",
+			},
+		},
+		"ark": {Enabled: false, Image: "hermsi/ark-server"},
+	}})
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewService(db, testGames()), mock
+}
+
+func validTemplate() Template {
+	return Template{
+		ID: "minecraft-small", Name: "Minecraft (Small)", GameType: "minecraft", Size: SizeSmall,
+		CostPerHour: 100, SetupCost: 500, MaxPlayers: 10,
+		CPURequest: "1000m", MemoryRequest: "2Gi", DockerImage: "itzg/minecraft-server:latest",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Template)
+		ok     bool
+	}{
+		{"valid", func(*Template) {}, true},
+		{"whole cores", func(t *Template) { t.CPURequest = "2" }, true},
+		{"bad id", func(t *Template) { t.ID = "Minecraft Small" }, false},
+		{"bad size", func(t *Template) { t.Size = "huge" }, false},
+		{"zero cost", func(t *Template) { t.CostPerHour = 0 }, false},
+		{"unparsable cpu", func(t *Template) { t.CPURequest = "lots" }, false},
+		{"memory unit on cpu", func(t *Template) { t.CPURequest = "2Gi" }, false},
+		{"negative memory", func(t *Template) { t.MemoryRequest = "-1Gi" }, false},
+		{"memory in bytes", func(t *Template) { t.MemoryRequest = "512" }, false},
+		{"missing image", func(t *Template) { t.DockerImage = "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := validTemplate()
+			tt.mutate(&tmpl)
+			err := tmpl.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate() = %v, want ok=%v", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTemplate) {
+				t.Errorf("expected ErrInvalidTemplate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMergePrecedence(t *testing.T) {
+	svc := NewService(nil, testGames())
+
+	// Row values win; the limit is raised to the larger request.
+	large := validTemplate()
+	large.CPURequest, large.MemoryRequest, large.IsActive = "4000m", "8Gi", true
+	svc.merge(&large)
+	if large.CPULimit != "4000m" || large.MemoryLimit != "8Gi" {
+		t.Errorf("expected limits raised to request, got %s/%s", large.CPULimit, large.MemoryLimit)
+	}
+	if large.Sources["cpu_request"] != SourceTemplate || !large.Available {
+		t.Errorf("unexpected merge result: %+v", large)
+	}
+
+	// Empty fields fall back to hot-config.
+	bare := validTemplate()
+	bare.CPURequest, bare.MemoryRequest, bare.DockerImage, bare.IsActive = "", "", "", true
+	svc.merge(&bare)
+	if bare.CPURequest != "500m" || bare.MemoryRequest != "1Gi" || bare.DockerImage != "itzg/minecraft-server:java21" {
+		t.Errorf("expected hot-config defaults, got %+v", bare)
+	}
+	if bare.CPULimit != "2000m" || bare.Sources["docker_image"] != SourceHotConfig {
+		t.Errorf("unexpected merge result: %+v", bare)
+	}
+
+	// A disabled game hides active templates.
+	ark := Template{ID: "ark-large", GameType: "ark", IsActive: true}
+	svc.merge(&ark)
+	if ark.Available {
+		t.Error("expected template for disabled game to be unavailable")
+	}
+}
+
+func TestResolveUnavailable(t *testing.T) {
+	svc, mock := newTestService(t)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM server_templates`)).
+		WithArgs("minecraft-small").
+		WillReturnRows(sqlmock.NewRows(templateColumns).AddRow(
+			"minecraft-small", "Minecraft (Small)", "minecraft", "small", 100, 500, 10,
+			"1000m", "2Gi", "", "", false, now, now))
+
+	if _, err := svc.Resolve(context.Background(), "minecraft-small"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestCreateDuplicate(t *testing.T) {
+	svc, mock := newTestService(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO server_templates`)).
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	if _, err := svc.Create(context.Background(), validTemplate()); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+}
+
+func TestCreateRejectsInvalidQuantities(t *testing.T) {
+	svc, _ := newTestService(t)
+	tmpl := validTemplate()
+	tmpl.MemoryRequest = "two gigs"
+
+	if _, err := svc.Create(context.Background(), tmpl); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected ErrInvalidTemplate, got %v", err)
+	}
+}
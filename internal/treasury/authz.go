@@ -0,0 +1,122 @@
+package treasury
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Role is a member's standing in a guild, ordered from least to most privileged.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleMember
+	RoleAdmin
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleMember:
+		return "member"
+	case RoleAdmin:
+		return "admin"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+// Action is an operation on a guild treasury.
+type Action string
+
+const (
+	ActionView       Action = "view"
+	ActionContribute Action = "contribute"
+	ActionRequest    Action = "request"
+	ActionSpend      Action = "spend"
+	ActionApprove    Action = "approve"
+	ActionGrant      Action = "grant"
+)
+
+// minimumRole is the lowest guild role allowed to perform each action.
+// ActionGrant is not listed: it is reserved for platform admins.
+var minimumRole = map[Action]Role{
+	ActionView:       RoleMember,
+	ActionContribute: RoleMember,
+	ActionRequest:    RoleMember,
+	ActionSpend:      RoleAdmin,
+	ActionApprove:    RoleAdmin,
+}
+
+// Can reports whether the role permits the action.
+func (r Role) Can(a Action) bool {
+	required, ok := minimumRole[a]
+	return ok && r >= required
+}
+
+// Authorizer resolves who may act on a guild treasury.
+type Authorizer interface {
+	GuildRole(ctx context.Context, guildID, discordID string) (Role, error)
+	IsPlatformAdmin(ctx context.Context, discordID string) (bool, error)
+}
+
+// DiscordAuthorizer derives guild roles from Discord: the guild owner is
+// RoleOwner, members with Administrator or Manage Server are RoleAdmin and
+// everyone else in the guild is RoleMember.
+type DiscordAuthorizer struct {
+	session        *discordgo.Session
+	platformAdmins map[string]bool
+}
+
+// NewDiscordAuthorizer creates an authorizer backed by a Discord session.
+// platformAdmins lists the Discord IDs allowed to grant treasury funds.
+func NewDiscordAuthorizer(session *discordgo.Session, platformAdmins []string) *DiscordAuthorizer {
+	admins := make(map[string]bool, len(platformAdmins))
+	for _, id := range platformAdmins {
+		admins[id] = true
+	}
+	return &DiscordAuthorizer{session: session, platformAdmins: admins}
+}
+
+// GuildRole implements Authorizer.
+func (a *DiscordAuthorizer) GuildRole(ctx context.Context, guildID, discordID string) (Role, error) {
+	guild, err := a.session.State.Guild(guildID)
+	if err != nil {
+		guild, err = a.session.Guild(guildID, discordgo.WithContext(ctx))
+		if err != nil {
+			return RoleNone, err
+		}
+	}
+	if guild.OwnerID == discordID {
+		return RoleOwner, nil
+	}
+
+	member, err := a.session.GuildMember(guildID, discordID, discordgo.WithContext(ctx))
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+			return RoleNone, nil
+		}
+		return RoleNone, err
+	}
+
+	const adminPerms = discordgo.PermissionAdministrator | discordgo.PermissionManageServer
+	for _, roleID := range member.Roles {
+		for _, role := range guild.Roles {
+			if role.ID == roleID && role.Permissions&adminPerms != 0 {
+				return RoleAdmin, nil
+			}
+		}
+	}
+	return RoleMember, nil
+}
+
+// IsPlatformAdmin implements Authorizer.
+func (a *DiscordAuthorizer) IsPlatformAdmin(_ context.Context, discordID string) (bool, error) {
+	return a.platformAdmins[discordID], nil
+}
@@ -0,0 +1,305 @@
+// Package treasury provides guild treasury operations for AGIS.
+//
+// Treasury balances live in guild_treasury and are updated by the
+// treasury_transaction_trigger when rows are added to treasury_transactions.
+// Every movement is also posted to the credit ledger in the same transaction,
+// so the treasury and the ledger guild account never disagree.
+package treasury
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/ledger"
+)
+
+// Transaction sources recorded in treasury_transactions.source.
+const (
+	SourceMemberContribution = "member_contribution"
+	SourceServerProvisioning = "server_provisioning"
+	SourceAdminGrant         = "admin_grant"
+	SourceSpend              = "spend"
+	SourceRefund             = "refund"
+)
+
+// entryTypes maps each source to its ledger entry type. Entry types are
+// mirrored into credit_transactions.transaction_type, which holds 20
+// characters.
+var entryTypes = map[string]string{
+	SourceMemberContribution: "trs_contrib",
+	SourceServerProvisioning: "trs_provision",
+	SourceAdminGrant:         "trs_grant",
+	SourceSpend:              "trs_spend",
+	SourceRefund:             "trs_refund",
+}
+
+// Errors returned by the treasury service.
+var (
+	ErrForbidden     = errors.New("treasury: permission denied")
+	ErrNotFound      = errors.New("treasury: guild treasury not found")
+	ErrInvalidAmount = errors.New("treasury: amount must be positive")
+)
+
+// Summary is a guild's treasury overview from guild_treasury_summary.
+type Summary struct {
+	GuildID       string     `json:"guild_id"`
+	Balance       int64      `json:"balance"`
+	TotalEarned   int64      `json:"total_earned"`
+	TotalSpent    int64      `json:"total_spent"`
+	ActiveServers int        `json:"active_servers"`
+	HourlyCost    int64      `json:"hourly_cost"`
+	DailyBurn     int64      `json:"daily_burn"`
+	RunwayHours   *float64   `json:"runway_hours,omitempty"` // nil when nothing is burning
+	DepletesAt    *time.Time `json:"depletes_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Transaction is a row of treasury_transactions.
+type Transaction struct {
+	ID          int64     `json:"id"`
+	GuildID     string    `json:"guild_id"`
+	Amount      int64     `json:"amount"`
+	Type        string    `json:"transaction_type"` // credit or debit
+	Description string    `json:"description"`
+	Source      string    `json:"source"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Service implements guild treasury operations.
+type Service struct {
+	db     *sql.DB
+	ledger *ledger.Ledger
+	authz  Authorizer
+	audit  audit.Recorder
+	now    func() time.Time
+}
+
+// NewService creates a treasury service.
+func NewService(db *sql.DB, l *ledger.Ledger, authz Authorizer) *Service {
+	return &Service{
+		db:     db,
+		ledger: l,
+		authz:  authz,
+		now:    time.Now,
+	}
+}
+
+// authorize checks that actorID may perform action on the guild treasury.
+func (s *Service) authorize(ctx context.Context, guildID, actorID string, action Action) error {
+	if action == ActionGrant {
+		ok, err := s.authz.IsPlatformAdmin(ctx, actorID)
+		if err != nil {
+			return fmt.Errorf("treasury: resolve platform admin: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s requires platform admin", ErrForbidden, action)
+		}
+		return nil
+	}
+
+	role, err := s.authz.GuildRole(ctx, guildID, actorID)
+	if err != nil {
+		return fmt.Errorf("treasury: resolve guild role: %w", err)
+	}
+	if !role.Can(action) {
+		return fmt.Errorf("%w: %s requires a higher role than %s", ErrForbidden, action, role)
+	}
+	return nil
+}
+
+// SetAuditLog records every treasury movement in the audit log, in the
+// same transaction as the movement.
+func (s *Service) SetAuditLog(r audit.Recorder) {
+	s.audit = r
+}
+
+// Summary returns the treasury overview including the projected runway.
+func (s *Service) Summary(ctx context.Context, guildID, actorID string) (*Summary, error) {
+	if err := s.authorize(ctx, guildID, actorID, ActionView); err != nil {
+		return nil, err
+	}
+
+	sum := &Summary{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT guild_id, COALESCE(balance, 0), COALESCE(total_earned, 0), COALESCE(total_spent, 0),
+		       COALESCE(active_servers, 0), COALESCE(hourly_cost, 0), COALESCE(updated_at, NOW())
+		FROM guild_treasury_summary
+		WHERE guild_id = $1
+	`, guildID).Scan(&sum.GuildID, &sum.Balance, &sum.TotalEarned, &sum.TotalSpent,
+		&sum.ActiveServers, &sum.HourlyCost, &sum.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("treasury: summary: %w", err)
+	}
+
+	sum.project(s.now())
+	return sum, nil
+}
+
+// project fills in the burn rate and runway from the hourly cost.
+func (sum *Summary) project(now time.Time) {
+	sum.DailyBurn = sum.HourlyCost * 24
+	if sum.HourlyCost <= 0 {
+		return
+	}
+	hours := float64(sum.Balance) / float64(sum.HourlyCost)
+	sum.RunwayHours = &hours
+	depletes := now.Add(time.Duration(hours * float64(time.Hour)))
+	sum.DepletesAt = &depletes
+}
+
+// Contribute moves GameCredits from a member's wallet into the guild treasury.
+func (s *Service) Contribute(ctx context.Context, guildID, actorID string, amount int64) (*Transaction, error) {
+	if err := s.authorize(ctx, guildID, actorID, ActionContribute); err != nil {
+		return nil, err
+	}
+	return s.move(ctx, ledger.UserAccount(actorID), guildID, actorID, amount,
+		SourceMemberContribution, fmt.Sprintf("Contribution from %s", actorID), "", nil)
+}
+
+// Spend debits the treasury for a guild expense.
+func (s *Service) Spend(ctx context.Context, guildID, actorID string, amount int64, description string) (*Transaction, error) {
+	if err := s.authorize(ctx, guildID, actorID, ActionSpend); err != nil {
+		return nil, err
+	}
+	return s.debit(ctx, guildID, actorID, amount, SourceSpend, description, "", nil)
+}
+
+// Grant credits the treasury from SYSTEM. Only platform admins may grant.
+func (s *Service) Grant(ctx context.Context, guildID, actorID string, amount int64, reason string) (*Transaction, error) {
+	if err := s.authorize(ctx, guildID, actorID, ActionGrant); err != nil {
+		return nil, err
+	}
+	return s.move(ctx, ledger.System, guildID, actorID, amount, SourceAdminGrant, reason, "", nil)
+}
+
+// History lists treasury transactions, newest first. Each entry names who
+// moved the funds so admins can see who spent what.
+func (s *Service) History(ctx context.Context, guildID, actorID string, limit, offset int) ([]Transaction, error) {
+	if err := s.authorize(ctx, guildID, actorID, ActionView); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, guild_id, amount, transaction_type, COALESCE(description, ''),
+		       COALESCE(source, ''), COALESCE(created_by, ''), created_at
+		FROM treasury_transactions
+		WHERE guild_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, guildID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("treasury: history: %w", err)
+	}
+	defer rows.Close()
+
+	txs := make([]Transaction, 0, limit)
+	for rows.Next() {
+		var t Transaction
+		if err := rows.Scan(&t.ID, &t.GuildID, &t.Amount, &t.Type, &t.Description, &t.Source, &t.CreatedBy, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("treasury: scan history: %w", err)
+		}
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
+
+// Debit removes funds from the treasury without a permission check. It is
+// used by internal workflows (e.g. server provisioning) that have already
+// authorised the caller. The funds are burned. fn, if non-nil, runs in the
+// same transaction so the workflow's own state changes commit atomically.
+func (s *Service) Debit(ctx context.Context, guildID, actorID string, amount int64, source, description, idempotencyKey string, fn ledger.TxFunc) (*Transaction, error) {
+	return s.debit(ctx, guildID, actorID, amount, source, description, idempotencyKey, fn)
+}
+
+// Refund returns previously burned funds to the treasury without a
+// permission check, for use by internal workflows. fn behaves as in Debit.
+func (s *Service) Refund(ctx context.Context, guildID, actorID string, amount int64, description, idempotencyKey string, fn ledger.TxFunc) (*Transaction, error) {
+	return s.move(ctx, ledger.Burn, guildID, actorID, amount, SourceRefund, description, idempotencyKey, fn)
+}
+
+func (s *Service) debit(ctx context.Context, guildID, actorID string, amount int64, source, description, key string, fn ledger.TxFunc) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	entry := ledger.TransferEntry(ledger.GuildAccount(guildID), ledger.Burn, ledger.CurrencyGC, amount, entryTypes[source], description)
+	entry.CreatedBy = actorID
+	entry.IdempotencyKey = key
+	return s.record(ctx, entry, guildID, actorID, amount, "debit", source, description, fn)
+}
+
+func (s *Service) move(ctx context.Context, from ledger.Account, guildID, actorID string, amount int64, source, description, key string, fn ledger.TxFunc) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	entry := ledger.TransferEntry(from, ledger.GuildAccount(guildID), ledger.CurrencyGC, amount, entryTypes[source], description)
+	entry.CreatedBy = actorID
+	entry.IdempotencyKey = key
+	return s.record(ctx, entry, guildID, actorID, amount, "credit", source, description, fn)
+}
+
+// record posts the ledger entry and writes the matching treasury_transactions
+// row in the same transaction; the trigger then updates guild_treasury.
+func (s *Service) record(ctx context.Context, entry ledger.Entry, guildID, actorID string, amount int64, txType, source, description string, fn ledger.TxFunc) (*Transaction, error) {
+	t := &Transaction{
+		GuildID:     guildID,
+		Amount:      amount,
+		Type:        txType,
+		Description: description,
+		Source:      source,
+		CreatedBy:   actorID,
+	}
+
+	_, err := s.ledger.PostWith(ctx, entry, func(ctx context.Context, tx *sql.Tx, entryID int64) error {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO guild_treasury (guild_id) VALUES ($1) ON CONFLICT (guild_id) DO NOTHING`, guildID,
+		); err != nil {
+			return fmt.Errorf("treasury: ensure treasury: %w", err)
+		}
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO treasury_transactions (guild_id, amount, transaction_type, description, source, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, guildID, amount, txType, description, source, actorID).Scan(&t.ID, &t.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("treasury: insert transaction: %w", err)
+		}
+		if s.audit != nil {
+			if _, err := s.audit.RecordTx(ctx, tx, audit.Event{
+				Actor:  actorID,
+				Action: "treasury." + source,
+				Target: audit.Target{Type: "guild", ID: guildID},
+				After: map[string]any{
+					"transaction_id":  t.ID,
+					"ledger_entry_id": entryID,
+					"amount":          amount,
+					"type":            txType,
+					"description":     description,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			return fn(ctx, tx, entryID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,231 @@
+package treasury
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/wethegamers/agis/internal/audit"
+	"github.com/wethegamers/agis/internal/ledger"
+)
+
+type fakeAuthorizer struct {
+	roles  map[string]Role
+	admins map[string]bool
+}
+
+func (f *fakeAuthorizer) GuildRole(_ context.Context, _, discordID string) (Role, error) {
+	return f.roles[discordID], nil
+}
+
+func (f *fakeAuthorizer) IsPlatformAdmin(_ context.Context, discordID string) (bool, error) {
+	return f.admins[discordID], nil
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authz := &fakeAuthorizer{
+		roles: map[string]Role{
+			"member": RoleMember,
+			"admin":  RoleAdmin,
+			"owner":  RoleOwner,
+		},
+		admins: map[string]bool{"staff": true},
+	}
+	return NewService(db, ledger.New(db), authz), mock
+}
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role   Role
+		action Action
+		want   bool
+	}{
+		{RoleNone, ActionView, false},
+		{RoleMember, ActionView, true},
+		{RoleMember, ActionContribute, true},
+		{RoleMember, ActionSpend, false},
+		{RoleAdmin, ActionSpend, true},
+		{RoleOwner, ActionApprove, true},
+		{RoleOwner, ActionGrant, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Can(tt.action); got != tt.want {
+			t.Errorf("%s.Can(%s) = %v, want %v", tt.role, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryRunway(t *testing.T) {
+	svc, mock := newTestService(t)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM guild_treasury_summary`)).
+		WithArgs("g1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"guild_id", "balance", "total_earned", "total_spent", "active_servers", "hourly_cost", "updated_at",
+		}).AddRow("g1", 1000, 5000, 4000, 2, 100, now))
+
+	sum, err := svc.Summary(context.Background(), "g1", "member")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sum.DailyBurn != 2400 {
+		t.Errorf("expected daily burn 2400, got %d", sum.DailyBurn)
+	}
+	if sum.RunwayHours == nil || *sum.RunwayHours != 10 {
+		t.Fatalf("expected 10h runway, got %v", sum.RunwayHours)
+	}
+	if !sum.DepletesAt.Equal(now.Add(10 * time.Hour)) {
+		t.Errorf("unexpected depletion time %v", sum.DepletesAt)
+	}
+}
+
+func TestSummaryNoBurn(t *testing.T) {
+	sum := &Summary{Balance: 500}
+	sum.project(time.Now())
+	if sum.RunwayHours != nil || sum.DepletesAt != nil {
+		t.Error("expected no runway projection without hourly cost")
+	}
+}
+
+func TestSummaryForbiddenForOutsiders(t *testing.T) {
+	svc, _ := newTestService(t)
+	_, err := svc.Summary(context.Background(), "g1", "stranger")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestSpendRequiresAdmin(t *testing.T) {
+	svc, _ := newTestService(t)
+	_, err := svc.Spend(context.Background(), "g1", "member", 10, "snacks")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestGrantRequiresPlatformAdmin(t *testing.T) {
+	svc, _ := newTestService(t)
+	_, err := svc.Grant(context.Background(), "g1", "owner", 10, "event prize")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for guild owner, got %v", err)
+	}
+}
+
+func TestContribute(t *testing.T) {
+	svc, mock := newTestService(t)
+	created := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WithArgs("trs_contrib", "Contribution from member", sqlmock.AnyArg(), "member").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, created))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WithArgs(1, "user:member", "GC", -250).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(750))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (discord_id, credits)`)).
+		WithArgs("member", -250).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WithArgs(1, "guild:g1", "GC", 250).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(250))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO guild_treasury`)).
+		WithArgs("g1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO treasury_transactions`)).
+		WithArgs("g1", 250, "credit", "Contribution from member", SourceMemberContribution, "member").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(9, created))
+	mock.ExpectCommit()
+
+	tx, err := svc.Contribute(context.Background(), "g1", "member", 250)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.ID != 9 || tx.Type != "credit" || tx.CreatedBy != "member" {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+type fakeRecorder struct {
+	events []audit.Event
+	err    error
+}
+
+func (f *fakeRecorder) RecordTx(_ context.Context, _ *sql.Tx, e audit.Event) (*audit.Entry, error) {
+	f.events = append(f.events, e)
+	return &audit.Entry{}, f.err
+}
+
+func TestContributeAuditFailureRollsBack(t *testing.T) {
+	svc, mock := newTestService(t)
+	rec := &fakeRecorder{err: errors.New("audit unavailable")}
+	svc.SetAuditLog(rec)
+	created := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, created))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(750))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (discord_id, credits)`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings`)).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_balances`)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(250))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO guild_treasury`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO treasury_transactions`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(9, created))
+	mock.ExpectRollback()
+
+	if _, err := svc.Contribute(context.Background(), "g1", "member", 250); err == nil {
+		t.Fatal("expected the audit failure to abort the contribution")
+	}
+	if len(rec.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(rec.events))
+	}
+	e := rec.events[0]
+	if e.Actor != "member" || e.Action != "treasury."+SourceMemberContribution || e.Target.ID != "g1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEntryTypesFitLegacyColumn(t *testing.T) {
+	for _, source := range []string{SourceMemberContribution, SourceServerProvisioning, SourceAdminGrant, SourceSpend, SourceRefund} {
+		if typ := entryTypes[source]; typ == "" || len(typ) > 20 {
+			t.Errorf("source %s has entry type %q", source, typ)
+		}
+	}
+}
+
+func TestContributeInvalidAmount(t *testing.T) {
+	svc, _ := newTestService(t)
+	if _, err := svc.Contribute(context.Background(), "g1", "member", 0); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected ErrInvalidAmount, got %v", err)
+	}
+}
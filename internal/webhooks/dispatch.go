@@ -0,0 +1,250 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Dispatcher defaults.
+const (
+	// DefaultDisableAfter is how many consecutive failed attempts, across
+	// all of a subscription's deliveries, disable it.
+	DefaultDisableAfter = 20
+	// DefaultLowCreditThreshold is the balance below which credits.low
+	// fires.
+	DefaultLowCreditThreshold = 100
+
+	claimBatch     = 50
+	claimLease     = 2 * time.Minute
+	workers        = 8
+	requestTimeout = 10 * time.Second
+	pollInterval   = 5 * time.Second
+	maxErrorBody   = 256
+	disabledReason = "disabled after repeated delivery failures"
+)
+
+// ErrBlockedAddress is returned when an endpoint resolves to a private,
+// loopback or otherwise internal address.
+var ErrBlockedAddress = errors.New("webhooks: endpoint address is not public")
+
+// RetryPolicy is the exponential backoff schedule for failed deliveries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts before a delivery is
+	// dead-lettered.
+	MaxAttempts int
+	// BaseDelay is the wait after the first failure; it doubles after
+	// each further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy retries for about eight and a half hours over ten
+// attempts.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+}
+
+// Delay returns the wait after the given failed attempt (1-based),
+// before jitter.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// jitter spreads retries by up to a tenth of the delay so endpoints that
+// recover are not hit by every queued delivery at once.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + rand.N(d/10+1)
+}
+
+// ProcessDue sends the deliveries that are due and returns how many were
+// claimed.
+func (s *Service) ProcessDue(ctx context.Context) (int, error) {
+	jobs, err := s.store.Claim(ctx, s.now().UTC(), claimLease, claimBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j Job) {
+			defer func() { <-sem; wg.Done() }()
+			s.dispatch(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+// Run dispatches deliveries until ctx is cancelled. Full batches are
+// followed immediately by the next so a backlog drains quickly.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.ProcessDue(ctx)
+		if err != nil {
+			s.logger.Error("webhook dispatch failed", "error", err)
+		}
+		if n == claimBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch makes one attempt and records the outcome.
+func (s *Service) dispatch(ctx context.Context, j Job) {
+	d := j.Delivery
+	now := s.now().UTC()
+	a := Attempt{DeliveryID: d.ID, Attempt: d.Attempts + 1, AttemptedAt: now}
+	r := Result{SubscriptionID: d.SubscriptionID, DisableAfter: s.disableAfter}
+
+	if !j.Enabled {
+		// Dead-letter rather than drop, so the owner can redeliver after
+		// fixing and re-enabling the endpoint.
+		a.Error = "subscription disabled"
+		r.Status, r.NextAttemptAt, r.Skipped = StatusDead, now, true
+	} else {
+		start := time.Now()
+		code, err := s.send(ctx, j, now)
+		a.DurationMS = time.Since(start).Milliseconds()
+		a.StatusCode = code
+		switch {
+		case err == nil:
+			r.Status, r.NextAttemptAt, r.Success = StatusDelivered, now, true
+		case a.Attempt >= s.retry.MaxAttempts:
+			a.Error = err.Error()
+			r.Status, r.NextAttemptAt = StatusDead, now
+		default:
+			a.Error = err.Error()
+			r.Status, r.NextAttemptAt = StatusPending, now.Add(jitter(s.retry.Delay(a.Attempt)))
+		}
+	}
+	r.Attempt = a
+
+	enabled, err := s.store.Record(ctx, &d, r)
+	if err != nil {
+		s.logger.Error("webhook record attempt failed", "delivery_id", d.ID, "error", err)
+		return
+	}
+	if r.Status == StatusDead && !r.Skipped {
+		s.logger.Warn("webhook delivery dead-lettered",
+			"delivery_id", d.ID, "subscription_id", d.SubscriptionID, "attempts", a.Attempt, "error", a.Error)
+	}
+	if j.Enabled && !enabled {
+		s.logger.Warn("webhook subscription disabled after repeated failures", "subscription_id", d.SubscriptionID)
+	}
+}
+
+// send posts the payload, signed for this attempt's timestamp. Any
+// response other than 2xx is a failure; redirects are not followed.
+func (s *Service) send(ctx context.Context, j Job, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	d := j.Delivery
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AGIS-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderEventID, d.EventID)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(j.Secret, now, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	return resp.StatusCode, nil
+}
+
+// newClient builds the delivery HTTP client. The address check runs on
+// every connection, after DNS resolution, so a hostname cannot be
+// re-pointed at an internal address after it was registered.
+func (s *Service) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if s.allowPrivate {
+				return nil
+			}
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			if blockedAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// cgnat is the carrier-grade NAT range, which is not covered by
+// netip.Addr.IsPrivate.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+func blockedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		cgnat.Contains(ip)
+}
+
+// checkHost rejects endpoints that are obviously internal at registration.
+func checkHost(host string) error {
+	if host == "localhost" {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && blockedAddr(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrInvalidURL, host)
+	}
+	return nil
+}
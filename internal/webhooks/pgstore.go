@@ -0,0 +1,382 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PGStore keeps webhooks in webhook_subscriptions, webhook_deliveries and
+// webhook_delivery_attempts.
+type PGStore struct {
+	db *sql.DB
+}
+
+// NewPGStore creates a Postgres-backed store.
+func NewPGStore(db *sql.DB) *PGStore {
+	return &PGStore{db: db}
+}
+
+const subscriptionColumns = `id, owner_type, owner_id, url, secret, events, description,
+	enabled, consecutive_failures, disabled_reason, created_at, updated_at`
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, delivered_at, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row scanner) (*Subscription, error) {
+	var sub Subscription
+	var reason sql.NullString
+	err := row.Scan(&sub.ID, &sub.Owner.Type, &sub.Owner.ID, &sub.URL, &sub.Secret,
+		pq.Array(&sub.Events), &sub.Description, &sub.Enabled, &sub.ConsecutiveFailures,
+		&reason, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.DisabledReason = reason.String
+	return &sub, nil
+}
+
+func scanDelivery(row scanner) (*Delivery, error) {
+	var d Delivery
+	var code sql.NullInt64
+	var lastErr sql.NullString
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+		&d.Attempts, &d.NextAttemptAt, &code, &lastErr, &deliveredAt, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.LastStatusCode = int(code.Int64)
+	d.LastError = lastErr.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+// CreateSubscription stores a subscription and sets its ID.
+func (s *PGStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_subscriptions (owner_type, owner_id, url, secret, events, description, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		sub.Owner.Type, sub.Owner.ID, sub.URL, sub.Secret, pq.Array(sub.Events), sub.Description,
+		sub.Enabled, sub.CreatedAt, sub.UpdatedAt,
+	).Scan(&sub.ID)
+	if err != nil {
+		return fmt.Errorf("webhooks: create subscription: %w", err)
+	}
+	return nil
+}
+
+// Subscription returns a subscription by ID.
+func (s *PGStore) Subscription(ctx context.Context, id int64) (*Subscription, error) {
+	sub, err := scanSubscription(s.db.QueryRowContext(ctx,
+		`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: get subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns the owner's subscriptions, oldest first.
+func (s *PGStore) ListSubscriptions(ctx context.Context, owner Owner) ([]Subscription, error) {
+	return s.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+` FROM webhook_subscriptions
+		WHERE owner_type = $1 AND owner_id = $2
+		ORDER BY id`, owner.Type, owner.ID)
+}
+
+// MatchingSubscriptions returns enabled subscriptions wanting eventType.
+func (s *PGStore) MatchingSubscriptions(ctx context.Context, owner Owner, eventType string) ([]Subscription, error) {
+	return s.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+` FROM webhook_subscriptions
+		WHERE owner_type = $1 AND owner_id = $2 AND enabled AND $3 = ANY(events)
+		ORDER BY id`, owner.Type, owner.ID, eventType)
+}
+
+func (s *PGStore) querySubscriptions(ctx context.Context, query string, args ...any) ([]Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks: scan subscription: %w", err)
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscription replaces a subscription's mutable fields.
+func (s *PGStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_subscriptions
+		SET url = $2, events = $3, description = $4, enabled = $5,
+		    consecutive_failures = $6, disabled_reason = $7, updated_at = $8
+		WHERE id = $1`,
+		sub.ID, sub.URL, pq.Array(sub.Events), sub.Description, sub.Enabled,
+		sub.ConsecutiveFailures, nullString(sub.DisabledReason), sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("webhooks: update subscription: %w", err)
+	}
+	return requireRow(res)
+}
+
+// DeleteSubscription removes a subscription; deliveries cascade.
+func (s *PGStore) DeleteSubscription(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("webhooks: delete subscription: %w", err)
+	}
+	return requireRow(res)
+}
+
+// Enqueue stores pending deliveries in one transaction.
+func (s *PGStore) Enqueue(ctx context.Context, deliveries []Delivery) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for i := range deliveries {
+			d := &deliveries[i]
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`,
+				d.SubscriptionID, d.EventID, d.EventType, string(d.Payload), d.Status, d.NextAttemptAt, d.CreatedAt,
+			).Scan(&d.ID)
+			if err != nil {
+				return fmt.Errorf("webhooks: enqueue delivery: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Claim leases due deliveries. SKIP LOCKED lets several replicas dispatch
+// without handing out the same delivery twice.
+func (s *PGStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at,
+			s.url, s.secret, s.enabled`,
+		now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: claim deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		var code sql.NullInt64
+		var lastErr sql.NullString
+		var deliveredAt sql.NullTime
+		d := &j.Delivery
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &code, &lastErr, &deliveredAt, &d.CreatedAt,
+			&j.URL, &j.Secret, &j.Enabled); err != nil {
+			return nil, fmt.Errorf("webhooks: scan claimed delivery: %w", err)
+		}
+		d.LastStatusCode = int(code.Int64)
+		d.LastError = lastErr.String
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Record logs the attempt, updates the delivery and adjusts the
+// subscription's failure count in one transaction.
+func (s *PGStore) Record(ctx context.Context, delivery *Delivery, r Result) (bool, error) {
+	enabled := true
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		a := r.Attempt
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			delivery.ID, a.Attempt, nullInt(a.StatusCode), nullString(a.Error), a.DurationMS, a.AttemptedAt); err != nil {
+			return fmt.Errorf("webhooks: log attempt: %w", err)
+		}
+
+		var deliveredAt any
+		if r.Status == StatusDelivered {
+			deliveredAt = a.AttemptedAt
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5,
+			    last_error = $6, delivered_at = COALESCE($7, delivered_at)
+			WHERE id = $1`,
+			delivery.ID, r.Status, a.Attempt, r.NextAttemptAt, nullInt(a.StatusCode),
+			nullString(a.Error), deliveredAt); err != nil {
+			return fmt.Errorf("webhooks: update delivery: %w", err)
+		}
+
+		var err error
+		switch {
+		case r.Skipped:
+			err = tx.QueryRowContext(ctx,
+				`SELECT enabled FROM webhook_subscriptions WHERE id = $1`, r.SubscriptionID).Scan(&enabled)
+		case r.Success:
+			err = tx.QueryRowContext(ctx, `
+				UPDATE webhook_subscriptions SET consecutive_failures = 0
+				WHERE id = $1 RETURNING enabled`, r.SubscriptionID).Scan(&enabled)
+		default:
+			// SET expressions read the old row, so the failure that
+			// reaches the threshold is the one that disables.
+			err = tx.QueryRowContext(ctx, `
+				UPDATE webhook_subscriptions
+				SET consecutive_failures = consecutive_failures + 1,
+				    enabled = enabled AND consecutive_failures + 1 < $2,
+				    disabled_reason = CASE WHEN enabled AND consecutive_failures + 1 >= $2
+				                           THEN $3 ELSE disabled_reason END,
+				    updated_at = CASE WHEN enabled AND consecutive_failures + 1 >= $2
+				                      THEN $4 ELSE updated_at END
+				WHERE id = $1 RETURNING enabled`,
+				r.SubscriptionID, r.DisableAfter, disabledReason, a.AttemptedAt).Scan(&enabled)
+		}
+		if err != nil {
+			return fmt.Errorf("webhooks: update subscription health: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	applyResult(delivery, r)
+	return enabled, nil
+}
+
+// Deliveries returns a subscription's deliveries, newest first.
+func (s *PGStore) Deliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3`, subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks: scan delivery: %w", err)
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// Delivery returns a delivery by ID.
+func (s *PGStore) Delivery(ctx context.Context, id int64) (*Delivery, error) {
+	d, err := scanDelivery(s.db.QueryRowContext(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: get delivery: %w", err)
+	}
+	return d, nil
+}
+
+// Attempts returns a delivery's attempts in order.
+func (s *PGStore) Attempts(ctx context.Context, deliveryID int64) ([]Attempt, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: list attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Attempt
+	for rows.Next() {
+		a := Attempt{DeliveryID: deliveryID}
+		var code sql.NullInt64
+		var msg sql.NullString
+		if err := rows.Scan(&a.Attempt, &code, &msg, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("webhooks: scan attempt: %w", err)
+		}
+		a.StatusCode = int(code.Int64)
+		a.Error = msg.String
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Requeue moves a dead delivery back to pending.
+func (s *PGStore) Requeue(ctx context.Context, deliveryID int64, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $2
+		WHERE id = $1 AND status = 'dead'`, deliveryID, now)
+	if err != nil {
+		return fmt.Errorf("webhooks: requeue delivery: %w", err)
+	}
+	if err := requireRow(res); err != nil {
+		return ErrNotDead
+	}
+	return nil
+}
+
+func (s *PGStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("webhooks: begin: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("webhooks: commit: %w", err)
+	}
+	return nil
+}
+
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("webhooks: rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
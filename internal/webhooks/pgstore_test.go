@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockStore(t *testing.T) (*PGStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewPGStore(db), mock
+}
+
+func TestPGStore_ClaimLeasesDueDeliveries(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE webhook_deliveries d SET next_attempt_at = $2`)).
+		WithArgs(testNow, testNow.Add(claimLease), 50).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts",
+			"next_attempt_at", "last_status_code", "last_error", "delivered_at", "created_at",
+			"url", "secret", "enabled",
+		}).AddRow(7, 3, "evt_1", EventServerStarted, []byte(`{}`), StatusPending, 1,
+			testNow.Add(claimLease), 500, "endpoint returned 500", nil, testNow,
+			"https://hooks.example.com", "whsec_x", true))
+
+	jobs, err := store.Claim(context.Background(), testNow, claimLease, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Delivery.ID != 7 || jobs[0].Secret != "whsec_x" || jobs[0].Delivery.LastStatusCode != 500 {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPGStore_RecordFailureCountsTowardsDisable(t *testing.T) {
+	store, mock := newMockStore(t)
+	next := testNow.Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO webhook_delivery_attempts`)).
+		WithArgs(int64(7), 2, 503, "endpoint returned 503", int64(40), testNow).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE webhook_deliveries`)).
+		WithArgs(int64(7), StatusPending, 2, next, 503, "endpoint returned 503", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`enabled = enabled AND consecutive_failures + 1 < $2`)).
+		WithArgs(int64(3), 20, disabledReason, testNow).
+		WillReturnRows(sqlmock.NewRows([]string{"enabled"}).AddRow(false))
+	mock.ExpectCommit()
+
+	d := &Delivery{ID: 7, SubscriptionID: 3, Status: StatusPending, Attempts: 1}
+	enabled, err := store.Record(context.Background(), d, Result{
+		SubscriptionID: 3,
+		Attempt:        Attempt{DeliveryID: 7, Attempt: 2, StatusCode: 503, Error: "endpoint returned 503", DurationMS: 40, AttemptedAt: testNow},
+		Status:         StatusPending,
+		NextAttemptAt:  next,
+		DisableAfter:   20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled {
+		t.Error("expected subscription reported disabled")
+	}
+	if d.Attempts != 2 || d.LastStatusCode != 503 || !d.NextAttemptAt.Equal(next) {
+		t.Errorf("delivery not updated: %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPGStore_RequeueRequiresDead(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE id = $1 AND status = 'dead'`)).
+		WithArgs(int64(7), testNow).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.Requeue(context.Background(), 7, testNow); !errors.Is(err, ErrNotDead) {
+		t.Errorf("expected ErrNotDead, got %v", err)
+	}
+}
+
+func TestPGStore_SubscriptionNotFound(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM webhook_subscriptions WHERE id = $1`)).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, err := store.Subscription(context.Background(), 9); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// textArg matches a string argument. lib/pq sends []byte as bytea, which
+// the JSONB payload column rejects.
+type textArg string
+
+func (a textArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && s == string(a)
+}
+
+func TestPGStore_EnqueueSendsPayloadAsText(t *testing.T) {
+	store, mock := newMockStore(t)
+	payload := `{"server_id":42}`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO webhook_deliveries`)).
+		WithArgs(int64(3), "evt_1", EventServerStarted, textArg(payload), StatusPending, testNow, testNow).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	deliveries := []Delivery{{
+		SubscriptionID: 3, EventID: "evt_1", EventType: EventServerStarted, Payload: json.RawMessage(payload),
+		Status: StatusPending, NextAttemptAt: testNow, CreatedAt: testNow,
+	}}
+	if err := store.Enqueue(context.Background(), deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries[0].ID != 7 {
+		t.Errorf("delivery ID = %d", deliveries[0].ID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/wethegamers/agis/internal/events"
+)
+
+// ServerData is the payload of server.started and server.stopped.
+type ServerData struct {
+	ServerID string    `json:"server_id"`
+	Status   string    `json:"status"`
+	Reason   string    `json:"reason,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// serverEventTypes maps status events to webhook event types. Other
+// server events stay on the dashboard stream only.
+var serverEventTypes = map[string]string{
+	events.StatusReady:   EventServerStarted,
+	events.StatusStopped: EventServerStopped,
+}
+
+// EventPublisher passes server events to next and queues webhooks for the
+// ones subscribers care about. It is an events.Publisher, so it can be
+// handed to provisioning in place of the bus.
+type EventPublisher struct {
+	svc  *Service
+	next events.Publisher
+}
+
+// NewEventPublisher wraps next, which may be nil.
+func NewEventPublisher(svc *Service, next events.Publisher) *EventPublisher {
+	return &EventPublisher{svc: svc, next: next}
+}
+
+// Publish forwards the event and queues matching webhooks. Queueing
+// failures are logged; they must not fail the state change that
+// produced the event.
+func (p *EventPublisher) Publish(e events.Event) events.Event {
+	if p.next != nil {
+		e = p.next.Publish(e)
+	}
+	eventType, ok := serverEventTypes[e.Status]
+	if e.Type != events.TypeStatus || !ok || e.OwnerID == "" {
+		return e
+	}
+	at := e.Time
+	if at.IsZero() {
+		at = p.svc.now().UTC()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data := ServerData{ServerID: e.ServerID, Status: e.Status, Reason: e.Reason, Time: at}
+	if err := p.svc.Notify(ctx, User(e.OwnerID), eventType, data); err != nil {
+		p.svc.logger.Error("webhook enqueue failed", "event", eventType, "server_id", e.ServerID, "error", err)
+	}
+	return e
+}
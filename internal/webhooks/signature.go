@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderEvent      = "X-AGIS-Event"
+	HeaderEventID    = "X-AGIS-Event-ID"
+	HeaderDelivery   = "X-AGIS-Delivery"
+	HeaderTimestamp  = "X-AGIS-Timestamp"
+	HeaderSignature  = "X-AGIS-Signature"
+	signatureVersion = "v1"
+)
+
+// DefaultTolerance is how old a timestamp receivers should accept.
+const DefaultTolerance = 5 * time.Minute
+
+// Errors returned by Verify.
+var (
+	ErrInvalidSignature = errors.New("webhooks: signature does not match")
+	ErrStaleTimestamp   = errors.New("webhooks: timestamp outside tolerance")
+)
+
+// Sign returns the v1 signature of body sent at timestamp: hex
+// HMAC-SHA256 over "<unix seconds>.<body>". Covering the timestamp lets
+// receivers reject replays of old deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature header against the body. The
+// header may list several comma-separated signatures; any match is
+// accepted. Receivers written in Go can call it directly.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or malformed %s", ErrInvalidSignature, HeaderTimestamp)
+	}
+	sent := time.Unix(ts, 0)
+	if d := now.Sub(sent); d > tolerance || d < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	want := Sign(secret, sent, body)
+	for _, got := range strings.Split(header.Get(HeaderSignature), ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(got)), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,303 @@
+package webhooks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a claimed delivery together with where to send it.
+type Job struct {
+	Delivery Delivery
+	URL      string
+	Secret   string
+	Enabled  bool
+}
+
+// Result is the outcome of one dispatch of a job.
+type Result struct {
+	SubscriptionID int64
+	Attempt        Attempt
+	// Status is the delivery's new status; NextAttemptAt applies when it
+	// stays pending.
+	Status        string
+	NextAttemptAt time.Time
+	// Success resets the subscription's failure count; otherwise it grows
+	// and the subscription is disabled once it reaches DisableAfter.
+	Success      bool
+	DisableAfter int
+	// Skipped leaves the subscription untouched, for deliveries dropped
+	// without a request because the subscription is disabled.
+	Skipped bool
+}
+
+// Store persists subscriptions and the delivery queue.
+type Store interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	Subscription(ctx context.Context, id int64) (*Subscription, error)
+	ListSubscriptions(ctx context.Context, owner Owner) ([]Subscription, error)
+	// MatchingSubscriptions returns the owner's enabled subscriptions
+	// that want the event type.
+	MatchingSubscriptions(ctx context.Context, owner Owner, eventType string) ([]Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *Subscription) error
+	DeleteSubscription(ctx context.Context, id int64) error
+
+	// Enqueue stores pending deliveries and sets their IDs.
+	Enqueue(ctx context.Context, deliveries []Delivery) error
+	// Claim returns up to limit pending deliveries due at now and hides
+	// them from other dispatchers until now+lease, so a crashed
+	// dispatcher's work is picked up again after the lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Job, error)
+	// Record logs an attempt and updates the delivery and subscription
+	// atomically. It reports whether the subscription is still enabled.
+	Record(ctx context.Context, delivery *Delivery, r Result) (enabled bool, err error)
+	Deliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]Delivery, error)
+	Delivery(ctx context.Context, id int64) (*Delivery, error)
+	Attempts(ctx context.Context, deliveryID int64) ([]Attempt, error)
+	// Requeue moves a dead delivery back to pending with no attempts. It
+	// returns ErrNotDead if the delivery is not dead.
+	Requeue(ctx context.Context, deliveryID int64, now time.Time) error
+}
+
+// MemoryStore keeps webhooks in process memory. It suits tests and local
+// development; deliveries do not survive a restart.
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextID     int64
+	subs       map[int64]*Subscription
+	deliveries map[int64]*Delivery
+	attempts   map[int64][]Attempt
+}
+
+// NewMemoryStore creates an in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		subs:       make(map[int64]*Subscription),
+		deliveries: make(map[int64]*Delivery),
+		attempts:   make(map[int64][]Attempt),
+	}
+}
+
+func (m *MemoryStore) id() int64 {
+	m.nextID++
+	return m.nextID
+}
+
+// CreateSubscription stores a subscription and sets its ID.
+func (m *MemoryStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID = m.id()
+	cp := *sub
+	cp.Events = append([]string(nil), sub.Events...)
+	m.subs[sub.ID] = &cp
+	return nil
+}
+
+// Subscription returns a subscription by ID.
+func (m *MemoryStore) Subscription(ctx context.Context, id int64) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *sub
+	return &cp, nil
+}
+
+// ListSubscriptions returns the owner's subscriptions, oldest first.
+func (m *MemoryStore) ListSubscriptions(ctx context.Context, owner Owner) ([]Subscription, error) {
+	return m.filter(func(s *Subscription) bool { return s.Owner == owner }), nil
+}
+
+// MatchingSubscriptions returns enabled subscriptions wanting eventType.
+func (m *MemoryStore) MatchingSubscriptions(ctx context.Context, owner Owner, eventType string) ([]Subscription, error) {
+	return m.filter(func(s *Subscription) bool {
+		return s.Owner == owner && s.Enabled && s.Wants(eventType)
+	}), nil
+}
+
+func (m *MemoryStore) filter(keep func(*Subscription) bool) []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Subscription
+	for _, s := range m.subs {
+		if keep(s) {
+			out = append(out, *s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// UpdateSubscription replaces a subscription's mutable fields.
+func (m *MemoryStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.subs[sub.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	secret := cur.Secret
+	cp := *sub
+	cp.Secret = secret
+	m.subs[sub.ID] = &cp
+	return nil
+}
+
+// DeleteSubscription removes a subscription and its deliveries.
+func (m *MemoryStore) DeleteSubscription(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.subs, id)
+	for did, d := range m.deliveries {
+		if d.SubscriptionID == id {
+			delete(m.deliveries, did)
+			delete(m.attempts, did)
+		}
+	}
+	return nil
+}
+
+// Enqueue stores pending deliveries.
+func (m *MemoryStore) Enqueue(ctx context.Context, deliveries []Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range deliveries {
+		deliveries[i].ID = m.id()
+		cp := deliveries[i]
+		m.deliveries[cp.ID] = &cp
+	}
+	return nil
+}
+
+// Claim leases due pending deliveries, earliest first.
+func (m *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*Delivery
+	for _, d := range m.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	jobs := make([]Job, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		sub := m.subs[d.SubscriptionID]
+		jobs = append(jobs, Job{Delivery: *d, URL: sub.URL, Secret: sub.Secret, Enabled: sub.Enabled})
+	}
+	return jobs, nil
+}
+
+// Record applies a dispatch result.
+func (m *MemoryStore) Record(ctx context.Context, delivery *Delivery, r Result) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[delivery.ID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	applyResult(d, r)
+	*delivery = *d
+	m.attempts[d.ID] = append(m.attempts[d.ID], r.Attempt)
+
+	sub, ok := m.subs[r.SubscriptionID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	switch {
+	case r.Skipped:
+	case r.Success:
+		sub.ConsecutiveFailures = 0
+	default:
+		sub.ConsecutiveFailures++
+		if sub.Enabled && sub.ConsecutiveFailures >= r.DisableAfter {
+			sub.Enabled = false
+			sub.DisabledReason = disabledReason
+			sub.UpdatedAt = r.Attempt.AttemptedAt
+		}
+	}
+	return sub.Enabled, nil
+}
+
+// applyResult updates a delivery in place the way Record does.
+func applyResult(d *Delivery, r Result) {
+	d.Status = r.Status
+	d.Attempts = r.Attempt.Attempt
+	d.NextAttemptAt = r.NextAttemptAt
+	d.LastStatusCode = r.Attempt.StatusCode
+	d.LastError = r.Attempt.Error
+	if r.Status == StatusDelivered {
+		at := r.Attempt.AttemptedAt
+		d.DeliveredAt = &at
+	}
+}
+
+// Deliveries returns a subscription's deliveries, newest first.
+func (m *MemoryStore) Deliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Delivery
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID && (status == "" || d.Status == status) {
+			out = append(out, *d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Delivery returns a delivery by ID.
+func (m *MemoryStore) Delivery(ctx context.Context, id int64) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *d
+	return &cp, nil
+}
+
+// Attempts returns a delivery's attempts in order.
+func (m *MemoryStore) Attempts(ctx context.Context, deliveryID int64) ([]Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Attempt(nil), m.attempts[deliveryID]...), nil
+}
+
+// Requeue moves a dead delivery back to pending.
+func (m *MemoryStore) Requeue(ctx context.Context, deliveryID int64, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[deliveryID]
+	if !ok {
+		return ErrNotFound
+	}
+	if d.Status != StatusDead {
+		return ErrNotDead
+	}
+	d.Status = StatusPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	return nil
+}
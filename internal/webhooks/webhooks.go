@@ -0,0 +1,570 @@
+// Package webhooks provides outbound webhook subscriptions for AGIS.
+//
+// Users and guilds register HTTPS endpoints for events such as a server
+// starting or a payment landing. Each event becomes a delivery per
+// matching subscription, queued in PostgreSQL and sent by the dispatcher
+// with an HMAC-SHA256 signature over a timestamp and the body. Failed
+// deliveries are retried with exponential backoff and moved to the
+// dead-letter queue once attempts run out; a subscription that keeps
+// failing is disabled until its owner re-enables it.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+// OwnerType is who a subscription belongs to.
+type OwnerType string
+
+// Owner types.
+const (
+	OwnerUser  OwnerType = "user"
+	OwnerGuild OwnerType = "guild"
+)
+
+// Owner identifies a user (by Discord ID) or a guild.
+type Owner struct {
+	Type OwnerType `json:"type"`
+	ID   string    `json:"id"`
+}
+
+// User returns the owner for a Discord user.
+func User(discordID string) Owner {
+	return Owner{Type: OwnerUser, ID: discordID}
+}
+
+// Guild returns the owner for a guild.
+func Guild(guildID string) Owner {
+	return Owner{Type: OwnerGuild, ID: guildID}
+}
+
+// Event types a subscription can receive.
+const (
+	EventServerStarted    = "server.started"
+	EventServerStopped    = "server.stopped"
+	EventCreditsLow       = "credits.low"
+	EventPaymentSucceeded = "payment.succeeded"
+	// EventPing is sent by the test endpoint regardless of the
+	// subscription's event list.
+	EventPing = "ping"
+)
+
+// EventTypes lists the event types subscriptions may choose from.
+var EventTypes = []string{EventServerStarted, EventServerStopped, EventCreditsLow, EventPaymentSucceeded}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// MaxSubscriptionsPerOwner caps subscriptions for one user or guild.
+const MaxSubscriptionsPerOwner = 10
+
+// Errors returned by the webhooks service.
+var (
+	ErrNotFound     = errors.New("webhooks: not found")
+	ErrForbidden    = errors.New("webhooks: permission denied")
+	ErrInvalidURL   = errors.New("webhooks: invalid endpoint URL")
+	ErrInvalidEvent = errors.New("webhooks: unknown event type")
+	ErrLimitReached = errors.New("webhooks: subscription limit reached")
+	ErrNotDead      = errors.New("webhooks: only dead deliveries can be redelivered")
+)
+
+// Subscription is a registered endpoint.
+type Subscription struct {
+	ID                  int64     `json:"id"`
+	Owner               Owner     `json:"owner"`
+	URL                 string    `json:"url"`
+	Secret              string    `json:"secret,omitempty"` // only returned on create
+	Events              []string  `json:"events"`
+	Description         string    `json:"description"`
+	Enabled             bool      `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Wants reports whether the subscription receives the event type.
+func (s *Subscription) Wants(eventType string) bool {
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event queued for one subscription.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// Attempt is one HTTP request made for a delivery.
+type Attempt struct {
+	DeliveryID  int64     `json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// Envelope is the JSON body sent to endpoints.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Owner     Owner           `json:"owner"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Input is the caller-supplied part of a subscription.
+type Input struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+// Update changes a subscription. Nil fields are left as they are.
+// Re-enabling clears the failure count.
+type Update struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// Authorizer resolves guild roles. treasury.Authorizer implements it.
+type Authorizer interface {
+	GuildRole(ctx context.Context, guildID, discordID string) (treasury.Role, error)
+}
+
+// Service manages subscriptions and dispatches deliveries.
+type Service struct {
+	store        Store
+	authz        Authorizer
+	client       *http.Client
+	retry        RetryPolicy
+	disableAfter int
+	lowCredits   int64
+	allowPrivate bool
+	logger       *slog.Logger
+	now          func() time.Time
+}
+
+// NewService creates a webhooks service. authz may be nil, in which case
+// guild subscriptions cannot be managed.
+func NewService(store Store, authz Authorizer, logger *slog.Logger) *Service {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Service{
+		store:        store,
+		authz:        authz,
+		retry:        DefaultRetryPolicy(),
+		disableAfter: DefaultDisableAfter,
+		lowCredits:   DefaultLowCreditThreshold,
+		logger:       logger,
+		now:          time.Now,
+	}
+	s.client = s.newClient()
+	return s
+}
+
+// SetRetryPolicy overrides the retry schedule.
+func (s *Service) SetRetryPolicy(p RetryPolicy) {
+	s.retry = p
+}
+
+// SetDisableAfter sets how many consecutive failed attempts disable a
+// subscription.
+func (s *Service) SetDisableAfter(n int) {
+	s.disableAfter = n
+}
+
+// SetLowCreditThreshold sets the balance below which credits.low fires.
+func (s *Service) SetLowCreditThreshold(n int64) {
+	s.lowCredits = n
+}
+
+// SetAllowPrivateTargets permits plain HTTP and private, loopback and
+// link-local addresses. It exists for local development and tests; in
+// production endpoints must be public HTTPS URLs.
+func (s *Service) SetAllowPrivateTargets(allow bool) {
+	s.allowPrivate = allow
+}
+
+// authorize checks that actorID may manage the owner's subscriptions:
+// users manage their own, guild admins and owners manage the guild's.
+func (s *Service) authorize(ctx context.Context, actorID string, owner Owner) error {
+	switch owner.Type {
+	case OwnerUser:
+		if owner.ID != actorID {
+			return ErrForbidden
+		}
+		return nil
+	case OwnerGuild:
+		if s.authz == nil {
+			return ErrForbidden
+		}
+		role, err := s.authz.GuildRole(ctx, owner.ID, actorID)
+		if err != nil {
+			return fmt.Errorf("webhooks: resolve guild role: %w", err)
+		}
+		if role < treasury.RoleAdmin {
+			return fmt.Errorf("%w: guild webhooks require admin, have %s", ErrForbidden, role)
+		}
+		return nil
+	default:
+		return ErrForbidden
+	}
+}
+
+// subscription loads a subscription the actor may manage. Subscriptions
+// the actor cannot see are reported as not found.
+func (s *Service) subscription(ctx context.Context, actorID string, id int64) (*Subscription, error) {
+	sub, err := s.store.Subscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, actorID, sub.Owner); err != nil {
+		if errors.Is(err, ErrForbidden) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Create registers an endpoint. The returned subscription carries the
+// signing secret, which is not shown again.
+func (s *Service) Create(ctx context.Context, actorID string, owner Owner, in Input) (*Subscription, error) {
+	if err := s.authorize(ctx, actorID, owner); err != nil {
+		return nil, err
+	}
+	if err := s.validateURL(in.URL); err != nil {
+		return nil, err
+	}
+	if err := validateEvents(in.Events); err != nil {
+		return nil, err
+	}
+	existing, err := s.store.ListSubscriptions(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxSubscriptionsPerOwner {
+		return nil, ErrLimitReached
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	sub := &Subscription{
+		Owner:       owner,
+		URL:         in.URL,
+		Secret:      secret,
+		Events:      in.Events,
+		Description: in.Description,
+		Enabled:     true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.store.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// List returns the owner's subscriptions without secrets.
+func (s *Service) List(ctx context.Context, actorID string, owner Owner) ([]Subscription, error) {
+	if err := s.authorize(ctx, actorID, owner); err != nil {
+		return nil, err
+	}
+	subs, err := s.store.ListSubscriptions(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+// Get returns one subscription without its secret.
+func (s *Service) Get(ctx context.Context, actorID string, id int64) (*Subscription, error) {
+	sub, err := s.subscription(ctx, actorID, id)
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// Update applies changes to a subscription.
+func (s *Service) Update(ctx context.Context, actorID string, id int64, u Update) (*Subscription, error) {
+	sub, err := s.subscription(ctx, actorID, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.URL != nil {
+		if err := s.validateURL(*u.URL); err != nil {
+			return nil, err
+		}
+		sub.URL = *u.URL
+	}
+	if u.Events != nil {
+		if err := validateEvents(u.Events); err != nil {
+			return nil, err
+		}
+		sub.Events = u.Events
+	}
+	if u.Description != nil {
+		sub.Description = *u.Description
+	}
+	if u.Enabled != nil {
+		if *u.Enabled && !sub.Enabled {
+			sub.ConsecutiveFailures = 0
+			sub.DisabledReason = ""
+		}
+		if !*u.Enabled && sub.Enabled {
+			sub.DisabledReason = "disabled by owner"
+		}
+		sub.Enabled = *u.Enabled
+	}
+	sub.UpdatedAt = s.now().UTC()
+	if err := s.store.UpdateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// Delete removes a subscription and its delivery history.
+func (s *Service) Delete(ctx context.Context, actorID string, id int64) error {
+	if _, err := s.subscription(ctx, actorID, id); err != nil {
+		return err
+	}
+	return s.store.DeleteSubscription(ctx, id)
+}
+
+// Deliveries returns a subscription's most recent deliveries, optionally
+// filtered by status. Pass StatusDead to read the dead-letter queue.
+func (s *Service) Deliveries(ctx context.Context, actorID string, id int64, status string, limit int) ([]Delivery, error) {
+	if _, err := s.subscription(ctx, actorID, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.store.Deliveries(ctx, id, status, limit)
+}
+
+// Delivery returns one delivery of a subscription with its attempt log.
+func (s *Service) Delivery(ctx context.Context, actorID string, id, deliveryID int64) (*Delivery, []Attempt, error) {
+	if _, err := s.subscription(ctx, actorID, id); err != nil {
+		return nil, nil, err
+	}
+	d, err := s.store.Delivery(ctx, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.SubscriptionID != id {
+		return nil, nil, ErrNotFound
+	}
+	attempts, err := s.store.Attempts(ctx, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, attempts, nil
+}
+
+// Redeliver moves a dead delivery back onto the queue with a fresh
+// attempt budget.
+func (s *Service) Redeliver(ctx context.Context, actorID string, id, deliveryID int64) (*Delivery, error) {
+	d, _, err := s.Delivery(ctx, actorID, id, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != StatusDead {
+		return nil, ErrNotDead
+	}
+	if err := s.store.Requeue(ctx, deliveryID, s.now().UTC()); err != nil {
+		return nil, err
+	}
+	return s.store.Delivery(ctx, deliveryID)
+}
+
+// SendTest queues a ping event for one subscription.
+func (s *Service) SendTest(ctx context.Context, actorID string, id int64) (*Delivery, error) {
+	sub, err := s.subscription(ctx, actorID, id)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := s.enqueue(ctx, []Subscription{*sub}, sub.Owner, EventPing, map[string]string{"message": "webhook test"})
+	if err != nil {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+// Notify queues an event for every enabled subscription of the owner that
+// wants it. It is called by the services that produce events.
+func (s *Service) Notify(ctx context.Context, owner Owner, eventType string, data any) error {
+	subs, err := s.store.MatchingSubscriptions(ctx, owner, eventType)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	_, err = s.enqueue(ctx, subs, owner, eventType, data)
+	return err
+}
+
+// CreditsLowData is the payload of credits.low.
+type CreditsLowData struct {
+	Balance   int64 `json:"balance"`
+	Threshold int64 `json:"threshold"`
+}
+
+// NotifyBalance fires credits.low when a balance change crosses below the
+// low-credit threshold. Changes that stay below it do not fire again.
+func (s *Service) NotifyBalance(ctx context.Context, owner Owner, before, after int64) error {
+	if before < s.lowCredits || after >= s.lowCredits {
+		return nil
+	}
+	return s.Notify(ctx, owner, EventCreditsLow, CreditsLowData{Balance: after, Threshold: s.lowCredits})
+}
+
+// PaymentData is the payload of payment.succeeded.
+type PaymentData struct {
+	PaymentID   string `json:"payment_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Credits     int64  `json:"credits,omitempty"`
+	WTGCoins    int64  `json:"wtg_coins,omitempty"`
+}
+
+// NotifyPayment fires payment.succeeded for a completed payment.
+func (s *Service) NotifyPayment(ctx context.Context, owner Owner, p PaymentData) error {
+	return s.Notify(ctx, owner, EventPaymentSucceeded, p)
+}
+
+func (s *Service) enqueue(ctx context.Context, subs []Subscription, owner Owner, eventType string, data any) ([]Delivery, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: encode event data: %w", err)
+	}
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	payload, err := json.Marshal(Envelope{ID: eventID, Type: eventType, CreatedAt: now, Owner: owner, Data: raw})
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: encode envelope: %w", err)
+	}
+
+	deliveries := make([]Delivery, len(subs))
+	for i, sub := range subs {
+		deliveries[i] = Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+	}
+	if err := s.store.Enqueue(ctx, deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// validateURL checks the endpoint's form. Addresses are checked again
+// when connecting, since DNS can change after registration.
+func (s *Service) validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidURL, raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed in the URL", ErrInvalidURL)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && s.allowPrivate:
+	default:
+		return fmt.Errorf("%w: scheme must be https", ErrInvalidURL)
+	}
+	if !s.allowPrivate {
+		if err := checkHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateEvents(types []string) error {
+	if len(types) == 0 {
+		return fmt.Errorf("%w: at least one event type is required", ErrInvalidEvent)
+	}
+	for _, t := range types {
+		known := false
+		for _, e := range EventTypes {
+			if t == e {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %q", ErrInvalidEvent, t)
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("webhooks: generate secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("webhooks: generate event id: %w", err)
+	}
+	return "evt_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,370 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wethegamers/agis/internal/events"
+	"github.com/wethegamers/agis/internal/treasury"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// receiver is a local endpoint that verifies signatures and answers with
+// the queued status codes, then 200.
+type receiver struct {
+	t      *testing.T
+	now    func() time.Time
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	got      []Envelope
+	headers  []http.Header
+}
+
+func (rc *receiver) setSecret(s string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.secret = s
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	if err := Verify(rc.secret, r.Header, body, DefaultTolerance, rc.now()); err != nil {
+		rc.t.Errorf("receiver: %v", err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		rc.t.Errorf("receiver: decode: %v", err)
+	}
+	rc.got = append(rc.got, env)
+	rc.headers = append(rc.headers, r.Header.Clone())
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.got)
+}
+
+type fakeAuthz map[string]treasury.Role
+
+func (f fakeAuthz) GuildRole(ctx context.Context, guildID, discordID string) (treasury.Role, error) {
+	return f[discordID], nil
+}
+
+type fixture struct {
+	svc   *Service
+	store *MemoryStore
+	rc    *receiver
+	url   string
+	clock time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{store: NewMemoryStore(), clock: testNow}
+	f.rc = &receiver{t: t, now: func() time.Time { return f.clock }}
+	srv := httptest.NewServer(f.rc)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL + "/hook"
+
+	f.svc = NewService(f.store, fakeAuthz{"admin": treasury.RoleAdmin, "member": treasury.RoleMember}, slog.Default())
+	f.svc.SetAllowPrivateTargets(true)
+	f.svc.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	f.svc.now = func() time.Time { return f.clock }
+	return f
+}
+
+func (f *fixture) subscribe(t *testing.T, owner Owner, actor string, types ...string) *Subscription {
+	t.Helper()
+	sub, err := f.svc.Create(context.Background(), actor, owner, Input{URL: f.url, Events: types})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.rc.setSecret(sub.Secret)
+	return sub
+}
+
+// runUntilIdle advances the clock past every retry and dispatches until
+// nothing is due.
+func (f *fixture) runUntilIdle(t *testing.T) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		n, err := f.svc.ProcessDue(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return
+		}
+		f.clock = f.clock.Add(2 * time.Hour)
+	}
+	t.Fatal("queue did not drain")
+}
+
+func TestEndToEnd_SignedDeliveryWithRetry(t *testing.T) {
+	f := newFixture(t)
+	sub := f.subscribe(t, User("alice"), "alice", EventPaymentSucceeded)
+	f.rc.statuses = []int{http.StatusBadGateway}
+
+	err := f.svc.NotifyPayment(context.Background(), User("alice"), PaymentData{PaymentID: "pay_1", AmountCents: 999, Currency: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other owners and event types do not match.
+	if err := f.svc.Notify(context.Background(), User("bob"), EventPaymentSucceeded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.Notify(context.Background(), User("alice"), EventServerStarted, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f.runUntilIdle(t)
+
+	if f.rc.count() != 2 {
+		t.Fatalf("expected a failed attempt and a retry, got %d requests", f.rc.count())
+	}
+	if f.rc.got[0].ID != f.rc.got[1].ID || f.rc.got[1].Type != EventPaymentSucceeded {
+		t.Errorf("retry should resend the same event, got %+v", f.rc.got)
+	}
+	if f.rc.headers[1].Get(HeaderEvent) != EventPaymentSucceeded || f.rc.headers[1].Get(HeaderDelivery) == "" {
+		t.Errorf("missing delivery headers %v", f.rc.headers[1])
+	}
+
+	log, err := f.svc.Deliveries(context.Background(), "alice", sub.ID, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Status != StatusDelivered || log[0].Attempts != 2 {
+		t.Fatalf("unexpected delivery log %+v", log)
+	}
+	_, attempts, err := f.svc.Delivery(context.Background(), "alice", sub.ID, log[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].StatusCode != http.StatusBadGateway || attempts[1].StatusCode != http.StatusOK {
+		t.Errorf("unexpected attempts %+v", attempts)
+	}
+}
+
+func TestEndToEnd_DeadLetterAndRedeliver(t *testing.T) {
+	f := newFixture(t)
+	sub := f.subscribe(t, User("alice"), "alice", EventCreditsLow)
+	f.rc.statuses = []int{500, 500, 500}
+
+	if err := f.svc.NotifyBalance(context.Background(), User("alice"), 150, 50); err != nil {
+		t.Fatal(err)
+	}
+	f.runUntilIdle(t)
+
+	dead, err := f.svc.Deliveries(context.Background(), "alice", sub.ID, StatusDead, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastStatusCode != 500 {
+		t.Fatalf("expected one dead delivery after 3 attempts, got %+v", dead)
+	}
+
+	if _, err := f.svc.Redeliver(context.Background(), "alice", sub.ID, dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	f.runUntilIdle(t)
+
+	d, _, err := f.svc.Delivery(context.Background(), "alice", sub.ID, dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusDelivered {
+		t.Errorf("expected redelivered, got %s", d.Status)
+	}
+	if _, err := f.svc.Redeliver(context.Background(), "alice", sub.ID, d.ID); !errors.Is(err, ErrNotDead) {
+		t.Errorf("expected ErrNotDead, got %v", err)
+	}
+}
+
+func TestEndToEnd_DisablesAfterRepeatedFailures(t *testing.T) {
+	f := newFixture(t)
+	f.svc.SetDisableAfter(2)
+	sub := f.subscribe(t, User("alice"), "alice", EventServerStarted, EventServerStopped)
+	f.rc.statuses = []int{500, 500}
+
+	pub := NewEventPublisher(f.svc, events.NewBus(events.Options{}))
+	pub.Publish(events.StatusChanged("alice", "srv-1", events.StatusReady, ""))
+	pub.Publish(events.StatusChanged("alice", "srv-1", events.StatusStopped, ""))
+	f.runUntilIdle(t)
+
+	got, err := f.svc.Get(context.Background(), "alice", sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.DisabledReason == "" {
+		t.Fatalf("expected subscription disabled, got %+v", got)
+	}
+	if f.rc.count() != 2 {
+		t.Errorf("expected no requests after disabling, got %d", f.rc.count())
+	}
+	dead, _ := f.svc.Deliveries(context.Background(), "alice", sub.ID, StatusDead, 0)
+	if len(dead) != 2 {
+		t.Errorf("expected both deliveries dead-lettered, got %+v", dead)
+	}
+
+	// Disabled subscriptions receive no new events until re-enabled.
+	pub.Publish(events.StatusChanged("alice", "srv-1", events.StatusReady, ""))
+	if all, _ := f.svc.Deliveries(context.Background(), "alice", sub.ID, "", 0); len(all) != 2 {
+		t.Errorf("expected no new delivery while disabled, got %d", len(all))
+	}
+	enabled := true
+	got, err = f.svc.Update(context.Background(), "alice", sub.ID, Update{Enabled: &enabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Enabled || got.ConsecutiveFailures != 0 || got.DisabledReason != "" {
+		t.Errorf("expected re-enabled with cleared failures, got %+v", got)
+	}
+}
+
+func TestNotifyBalanceFiresOnCrossing(t *testing.T) {
+	f := newFixture(t)
+	sub := f.subscribe(t, User("alice"), "alice", EventCreditsLow)
+	ctx := context.Background()
+
+	_ = f.svc.NotifyBalance(ctx, User("alice"), 500, 200) // above
+	_ = f.svc.NotifyBalance(ctx, User("alice"), 200, 80)  // crosses
+	_ = f.svc.NotifyBalance(ctx, User("alice"), 80, 40)   // already low
+
+	log, _ := f.svc.Deliveries(ctx, "alice", sub.ID, "", 0)
+	if len(log) != 1 {
+		t.Errorf("expected one credits.low delivery, got %d", len(log))
+	}
+}
+
+func TestGuildSubscriptionsRequireAdmin(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	in := Input{URL: f.url, Events: []string{EventServerStarted}}
+
+	if _, err := f.svc.Create(ctx, "member", Guild("g1"), in); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected member forbidden, got %v", err)
+	}
+	sub, err := f.svc.Create(ctx, "admin", Guild("g1"), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.Get(ctx, "member", sub.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected member to see not found, got %v", err)
+	}
+	if err := f.svc.Delete(ctx, "admin", sub.ID); err != nil {
+		t.Errorf("expected admin delete, got %v", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	svc := NewService(NewMemoryStore(), nil, slog.Default())
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		in   Input
+		want error
+	}{
+		{"http", Input{URL: "http://hooks.example.com", Events: []string{EventPing}}, ErrInvalidURL},
+		{"loopback", Input{URL: "https://127.0.0.1/hook", Events: []string{EventServerStarted}}, ErrInvalidURL},
+		{"private", Input{URL: "https://10.0.0.5/hook", Events: []string{EventServerStarted}}, ErrInvalidURL},
+		{"credentials", Input{URL: "https://u:p@hooks.example.com", Events: []string{EventServerStarted}}, ErrInvalidURL},
+		{"no events", Input{URL: "https://hooks.example.com"}, ErrInvalidEvent},
+		{"unknown event", Input{URL: "https://hooks.example.com", Events: []string{"server.exploded"}}, ErrInvalidEvent},
+		{"other user", Input{URL: "https://hooks.example.com", Events: []string{EventServerStarted}}, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := User("alice")
+			if tt.name == "other user" {
+				owner = User("bob")
+			}
+			if _, err := svc.Create(ctx, "alice", owner, tt.in); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	sub, err := svc.Create(ctx, "alice", User("alice"), Input{URL: "https://hooks.example.com", Events: EventTypes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Secret) < 32 {
+		t.Errorf("expected a signing secret, got %q", sub.Secret)
+	}
+	list, _ := svc.List(ctx, "alice", User("alice"))
+	if len(list) != 1 || list[0].Secret != "" {
+		t.Errorf("list must not expose secrets: %+v", list)
+	}
+}
+
+func TestDispatcherBlocksPrivateAddresses(t *testing.T) {
+	f := newFixture(t)
+	sub := f.subscribe(t, User("alice"), "alice", EventServerStarted)
+	// The endpoint was registered while allowed; DNS or policy changes are
+	// caught when connecting.
+	f.svc.SetAllowPrivateTargets(false)
+
+	if err := f.svc.Notify(context.Background(), User("alice"), EventServerStarted, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if f.rc.count() != 0 {
+		t.Fatal("expected no request to a loopback address")
+	}
+	log, _ := f.svc.Deliveries(context.Background(), "alice", sub.ID, "", 0)
+	if len(log) != 1 || log[0].Status != StatusPending || log[0].LastError == "" {
+		t.Errorf("expected a failed attempt pending retry, got %+v", log)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	h := http.Header{}
+	h.Set(HeaderTimestamp, "1748779200") // testNow
+	h.Set(HeaderSignature, "v1=stale, "+Sign("secret", testNow, body))
+
+	if err := Verify("secret", h, body, DefaultTolerance, testNow); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := Verify("other", h, body, DefaultTolerance, testNow); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for wrong secret, got %v", err)
+	}
+	if err := Verify("secret", h, []byte(`{"id":"evt_2"}`), DefaultTolerance, testNow); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for tampered body, got %v", err)
+	}
+	if err := Verify("secret", h, body, DefaultTolerance, testNow.Add(time.Hour)); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("expected ErrStaleTimestamp, got %v", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+}
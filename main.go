@@ -2,34 +2,21 @@ package main
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	"github.com/wethegamers/agis-core/api"
-	"github.com/wethegamers/agis-core/bot"
 	"github.com/wethegamers/agis-core/bot/commands"
 	"github.com/wethegamers/agis-core/config"
-	"github.com/wethegamers/agis-core/hotconfig"
-	"github.com/wethegamers/agis-core/http"
-	"github.com/wethegamers/agis-core/payment"
-	"github.com/wethegamers/agis-core/services"
-	"github.com/wethegamers/agis-core/version"
 
 	// Internal packages for best-practice implementations
+	"github.com/wethegamers/agis/internal/app"
+	"github.com/wethegamers/agis/internal/health"
 	"github.com/wethegamers/agis/internal/metrics"
-	"github.com/wethegamers/agis/internal/tracing"
 	internalVersion "github.com/wethegamers/agis/internal/version"
 
 	"github.com/bwmarrin/discordgo"
 	_ "github.com/lib/pq"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Global variables for ready handler
@@ -42,496 +29,71 @@ var (
 // and are auto-registered via promauto. Do not duplicate here.
 // Import metrics package and use metrics.CommandsTotal, etc.
 
-//nolint:gocyclo // Main function orchestrates initialization; refactoring planned for v2.0
 func main() {
-	// Load configuration from .env file
-	cfg = config.Load()
-
-	// Initialize OpenTelemetry tracing (v1.9.0+)
-	// Enable by setting OTEL_EXPORTER_OTLP_ENDPOINT
-	tracingCfg := tracing.DefaultConfig()
-	tracingCfg.ServiceName = "agis"
-	tracingCfg.Environment = os.Getenv("SENTRY_ENVIRONMENT")
-	if tracingCfg.Environment == "" {
-		tracingCfg.Environment = "development"
-	}
-	tracingCfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	tracingCfg.Enabled = tracingCfg.Endpoint != ""
-
-	tracingProvider, err := tracing.Init(context.Background(), tracingCfg)
-	if err != nil {
-		log.Printf("⚠️ Failed to initialize tracing: %v", err)
-	} else if tracingProvider != nil {
-		defer func() {
-			if err := tracingProvider.Shutdown(context.Background()); err != nil {
-				log.Printf("Error shutting down tracing: %v", err)
-			}
-		}()
-		if tracingCfg.Enabled {
-			log.Printf("✅ OpenTelemetry tracing initialized (endpoint: %s)", tracingCfg.Endpoint)
-		}
+	if err := run(); err != nil {
+		log.Printf("❌ %v", err)
+		os.Exit(1)
 	}
+}
 
+// run builds every subsystem, registers each as an app.Service and blocks
+// until SIGINT or SIGTERM. If startup fails, whatever was already built is
+// torn down before returning.
+func run() error {
 	// Set build info metrics using internal/metrics and internal/version
 	versionInfo := internalVersion.Get()
 	metrics.SetBuildInfo(versionInfo.Version, versionInfo.GitCommit, versionInfo.BuildTime)
 	log.Printf("📦 Version: %s", versionInfo.String())
 
-	// Initialize hot-reloadable configuration (v1.8.0+)
-	// This watches ConfigMap-mounted YAML files for changes
-	var hotCfg *hotconfig.Manager
-	hotConfigPath := os.Getenv("HOT_CONFIG_PATH")
-	if hotConfigPath == "" {
-		// Default path when running locally
-		hotConfigPath = "configs/hot-config.yaml"
-	}
-	if _, err := os.Stat(hotConfigPath); err == nil {
-		hotCfg, err = hotconfig.NewManager(hotConfigPath)
-		if err != nil {
-			log.Printf("⚠️ Failed to initialize hot config: %v", err)
-		} else {
-			if err := hotCfg.Start(); err != nil {
-				log.Printf("⚠️ Failed to start hot config watcher: %v", err)
-			} else {
-				log.Printf("✅ Hot-reloadable config loaded from %s", hotConfigPath)
-				// Log available games
-				games := hotCfg.GetEnabledGames()
-				log.Printf("   📋 %d games configured: ", len(games))
-				for name := range games {
-					game := games[name]
-					log.Printf("      - %s (%s): %d GC/hour", name, game.Tier, game.BaseCostPerHour)
-				}
-			}
-			defer hotCfg.Stop()
-		}
-	} else {
-		log.Printf("⚠️ Hot config file not found at %s - using defaults", hotConfigPath)
-	}
-
-	// Initialize error monitoring (Sentry)
-	sentryDSN := os.Getenv("SENTRY_DSN")
-	sentryEnv := os.Getenv("SENTRY_ENVIRONMENT")
-	if sentryEnv == "" {
-		sentryEnv = "development"
-	}
-	errorMonitor, err := services.NewErrorMonitor(sentryDSN, sentryEnv, version.Version)
-	if err != nil {
-		log.Printf("⚠️ Failed to initialize error monitoring: %v", err)
-	}
-	defer func() {
-		if errorMonitor != nil {
-			errorMonitor.Close()
-		}
-	}()
-
-	// Prometheus metrics are auto-registered via promauto
-
-	// Start HTTP server with metrics, health checks, and info endpoints
-	httpServer := http.NewServer()
-	go func() {
-		if err := httpServer.Start(); err != nil {
-			log.Printf("Failed to start HTTP server: %v", err)
-		}
-	}()
-
-	// Initialize Kubernetes client (optional)
-	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
-		// Running inside cluster
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			log.Printf("⚠️ Failed to get in-cluster config: %v", err)
-		} else {
-			_, err = kubernetes.NewForConfig(config)
-			if err != nil {
-				log.Printf("⚠️ Failed to create Kubernetes client: %v", err)
-			} else {
-				log.Println("✅ Connected to Kubernetes cluster")
-			}
-		}
-	} else {
-		// Try to use local kubeconfig
-		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-		configOverrides := &clientcmd.ConfigOverrides{}
-		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-		config, err := kubeConfig.ClientConfig()
-		if err != nil {
-			log.Printf("⚠️ Failed to load Kubernetes config: %v (continuing without K8s)", err)
-		} else {
-			_, err = kubernetes.NewForConfig(config)
-			if err != nil {
-				log.Printf("⚠️ Failed to create Kubernetes client: %v", err)
-			} else {
-				log.Println("✅ Connected to Kubernetes cluster")
-			}
-		}
-	}
-
-	// Get Discord token
-	token := cfg.Discord.Token
-	if token == "" {
-		log.Println("❌ DISCORD_TOKEN is required")
-		os.Exit(1) //nolint:gocritic // Fatal startup error before main logic
-	}
-
-	// Create Discord session
-	session, err := discordgo.New("Bot " + token)
-	if err != nil {
-		log.Printf("Failed to create Discord session: %v", err)
-		os.Exit(1)
-	}
-
-	// Enable state tracking for member updates (required for BeforeUpdate)
-	session.StateEnabled = true
-	session.State.TrackMembers = true
-	session.State.TrackRoles = true
-
-	// Initialize database service
-	dbService, err := services.NewDatabaseService(cfg)
-	if err != nil {
-		log.Printf("Failed to initialize database service: %v", err)
-		os.Exit(1)
-	}
-	log.Println("✅ Database service initialized")
-
-	// Ensure database indexes for performance
-	if dbService.DB() != nil {
-		if err := services.EnsureIndexes(context.Background(), dbService.DB()); err != nil {
-			log.Printf("⚠️ Failed to ensure indexes: %v", err)
-		}
-	}
-
-	// Initialize logging service
-	loggingService := services.NewLoggingService(dbService, session, "") // Guild ID will be set later
-	log.Println("✅ Logging service initialized")
-
-	// Initialize GDPR consent service (BLOCKER 7)
-	consentService := services.NewConsentService(dbService.DB())
-	ctx := context.Background()
-	if err := consentService.InitSchema(ctx); err != nil {
-		log.Printf("⚠️ Failed to initialize consent schema: %v", err)
-	}
-	// Wire consent checker for HTTP endpoints
-	http.SetConsentChecker(consentService)
-	log.Println("✅ Consent service initialized")
-
-	// Initialize Ad Conversion service (ayeT-Studios S2S)
-	adConversionService := services.NewAdConversionService(dbService, consentService, cfg.Ads.AyetAPIKey, cfg.Ads.AyetCallbackToken)
-	if err := adConversionService.InitSchema(ctx); err != nil {
-		log.Printf("⚠️ Failed to initialize ad conversions schema: %v", err)
-	}
-	// Wire ayeT-Studios S2S callback handler
-	ayetHandler := http.NewAyetHandler(adConversionService)
-	http.SetAyetHandler(ayetHandler)
-
-	// Initialize ad metrics collector
-	adMetrics := services.NewAdMetrics(
-		metrics.AdConversionsTotal,
-		metrics.AdRewardsTotal,
-		metrics.AdFraudAttemptsTotal,
-		metrics.AdCallbackLatency,
-		metrics.AdConversionsByTier,
+	// On SIGTERM readiness drops at once; the pre-stop delay lets
+	// Kubernetes remove the pod from endpoints before work is drained.
+	checker := health.NewChecker()
+	a := app.New("agis", versionInfo.Version,
+		app.WithHealth(checker),
+		app.WithPreStopDelay(envDuration("SHUTDOWN_PRE_STOP_DELAY", 0)),
+		app.WithDrainTimeout(envDuration("SHUTDOWN_DRAIN_TIMEOUT", 20*time.Second)),
 	)
-	adConversionService.SetMetrics(adMetrics)
-	ayetHandler.SetMetrics(adMetrics)
-	log.Println("✅ Ad conversion service initialized (ayeT-Studios S2S with Prometheus metrics)")
+	b := &bootstrap{app: a, health: checker}
 
-	// Wire ad callback token and handler (credits reward from ayet - legacy fallback)
-	http.SetAdsCallbackToken(cfg.Ads.AyetCallbackToken)
-	http.SetAdsAPIKey(cfg.Ads.AyetAPIKey)
-	http.SetAdsLinks(cfg.Ads.OfferwallURL, cfg.Ads.SurveywallURL, cfg.Ads.VideoPlacementID)
-	http.OnRewardWithConversion = func(uid string, amount int, conversionID, source string) error {
-		err := dbService.ProcessAdConversion(uid, amount, conversionID, source)
-		if errors.Is(err, services.ErrDuplicate) {
-			return nil
-		}
+	// Secret references in the environment are resolved before the
+	// configuration is loaded from it and the .env file.
+	b.connectKubernetes()
+	if err := b.initSecrets(); err != nil {
 		return err
 	}
-	// Wire Stripe payment service (BLOCKER 2: Zero-touch payments)
-	if os.Getenv("STRIPE_SECRET_KEY") != "" {
-		stripeSecretKey := os.Getenv("STRIPE_SECRET_KEY")
-		stripeWebhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-		stripeSuccessURL := os.Getenv("STRIPE_SUCCESS_URL")
-		stripeCancelURL := os.Getenv("STRIPE_CANCEL_URL")
-		stripeTestMode := os.Getenv("STRIPE_TEST_MODE") == "true"
-
-		// Import payment package
-		stripeService := payment.NewStripeService(
-			stripeSecretKey,
-			stripeWebhookSecret,
-			stripeSuccessURL,
-			stripeCancelURL,
-			stripeTestMode,
-		)
-
-		// Wire webhook callback for automatic WTG fulfillment
-		http.SetStripeService(stripeService, func(discordID string, wtgCoins int, sessionID string, amountPaid int64) error {
-			log.Printf("💰 Processing payment: User %s purchased %d WTG for $%.2f (session: %s)",
-				discordID, wtgCoins, float64(amountPaid)/100, sessionID)
-
-			// Begin database transaction
-			tx, err := dbService.DB().Begin()
-			if err != nil {
-				return fmt.Errorf("failed to start transaction: %w", err)
-			}
-			defer tx.Rollback() //nolint:errcheck // Rollback on deferred path is best-effort
-
-			// Add WTG coins to user account
-			_, err = tx.Exec(`
-				INSERT INTO users (discord_id, wtg_coins, credits)
-				VALUES ($1, $2, 0)
-				ON CONFLICT (discord_id) 
-				DO UPDATE SET wtg_coins = users.wtg_coins + $2
-			`, discordID, wtgCoins)
-
-			if err != nil {
-				return fmt.Errorf("failed to add WTG coins: %w", err)
-			}
-
-			// Log transaction for audit trail
-			_, err = tx.Exec(`
-				INSERT INTO credit_transactions (
-					from_user, to_user, amount, transaction_type, description, currency_type
-				) VALUES (
-					'STRIPE', $1, $2, 'purchase', $3, 'WTG'
-				)
-			`, discordID, wtgCoins, fmt.Sprintf("Stripe payment $%.2f - Session %s", float64(amountPaid)/100, sessionID))
-
-			if err != nil {
-				return fmt.Errorf("failed to log transaction: %w", err)
-			}
-
-			// Commit transaction
-			if err := tx.Commit(); err != nil {
-				return fmt.Errorf("failed to commit transaction: %w", err)
-			}
-
-			log.Printf("✅ Successfully credited %d WTG to user %s", wtgCoins, discordID)
-
-			// Send Discord DM notification (best effort, don't fail payment on DM error)
-			if session != nil {
-				channel, err := session.UserChannelCreate(discordID)
-				if err == nil {
-					_, _ = session.ChannelMessageSend(channel.ID, fmt.Sprintf(
-						"💎 **Payment Successful!**\\n\\n"+
-							"You've received **%d WTG Coins**!\\n"+
-							"Amount paid: $%.2f\\n\\n"+
-							"Use `credits` to see your balance or `convert` to turn WTG into GameCredits!",
-						wtgCoins, float64(amountPaid)/100,
-					))
-				}
-			}
-
-			return nil
-		})
-
-		log.Printf("✅ Stripe payment service initialized (Test Mode: %v)", stripeTestMode)
-	} else {
-		log.Println("⚠️ Stripe not configured - payments disabled (set STRIPE_SECRET_KEY to enable)")
-	}
-
-	// Wire verification API config, Discord session, and logging
-	http.SetVerifyAPI(cfg.Roles.VerifyAPISecret, cfg.Discord.GuildID, cfg.Roles.VerifiedRoleID)
-	http.SetDiscordSessionForAPI(session)
-	http.SetLoggingServiceForAPI(loggingService)
-
-	// Load log channels from environment variables
-	loggingService.LoadChannelConfigFromEnv()
-
-	// Start log rotation (rotate every 24 hours, keep logs for 30 days)
-	loggingService.StartLogRotation(24*time.Hour, 30*24*time.Hour)
-
-	// Initialize cleanup service
-	cleanupService := services.NewCleanupService(dbService, loggingService)
-	go cleanupService.Start()
-	log.Println("✅ Cleanup service started")
-
-	// Initialize modular command handler
-	commandHandler = commands.NewCommandHandler(cfg, dbService, loggingService)
-	log.Println("✅ Modular command system initialized")
-
-	// Wire hot-reloadable config to command handler (v1.8.0+)
-	if hotCfg != nil {
-		commandHandler.SetHotConfig(hotCfg)
-	}
-
-	// Initialize scheduler service with metrics
-	var schedulerService *services.SchedulerService
-	if commandHandler.EnhancedService() != nil {
-		schedulerService = services.NewSchedulerService(dbService, commandHandler.EnhancedService(), metrics.SchedulerActiveSchedules, metrics.SchedulerExecutionsTotal)
-		if err := schedulerService.Start(); err != nil {
-			log.Printf("⚠️ Failed to start scheduler: %v", err)
-		} else {
-			log.Println("✅ Scheduler service started")
-			commandHandler.SetScheduler(schedulerService)
-		}
-	} else {
-		log.Println("⚠️ Enhanced server service not available - scheduler disabled")
-	}
-
-	// Initialize REST API server (separate from metrics HTTP server)
-	if commandHandler.EnhancedService() != nil && commandHandler.Agones() != nil {
-		apiPort := os.Getenv("API_PORT")
-		if apiPort == "" {
-			apiPort = "8080"
-		}
-		apiServer := api.NewAPIServer(":"+apiPort, dbService, commandHandler.Agones(), commandHandler.EnhancedService())
-		go func() {
-			log.Printf("🚀 Starting REST API server on :%s", apiPort)
-			if err := apiServer.Start(); err != nil {
-				log.Printf("⚠️ Failed to start API server: %v", err)
-			}
-		}()
-		log.Println("✅ REST API v1 initialized")
-	} else {
-		log.Println("⚠️ REST API disabled - missing required services")
+	if err := exportDatabaseURL(); err != nil {
+		return err
 	}
+	cfg = config.Load()
 
-	// Register ad analytics command (requires AdConversionService)
-	adAnalyticsCmd := commands.NewAdAnalyticsCommand(adConversionService)
-	commandHandler.Register(adAnalyticsCmd)
-	log.Println("✅ Ad analytics command registered")
-
-	// Wire user servers provider for WordPress dashboard API
-	http.SetUserServersProvider(func(ctx context.Context, discordID string) ([]http.DashboardServer, error) {
-		var (
-			servers []*services.GameServer
-			err     error
-		)
-		if commandHandler != nil && commandHandler.EnhancedService() != nil {
-			servers, err = commandHandler.EnhancedService().GetUserServersEnhanced(ctx, discordID)
-		} else {
-			servers, err = dbService.GetUserServers(discordID)
-		}
-		if err != nil {
-			return nil, err
-		}
-		out := make([]http.DashboardServer, 0, len(servers))
-		for _, s := range servers {
-			ds := http.DashboardServer{
-				ID:         s.ID,
-				Name:       s.Name,
-				Game:       s.GameType,
-				Address:    s.Address,
-				Port:       s.Port,
-				Status:     s.Status,
-				Region:     "",
-				Players:    http.PlayersInfo{Current: 0, Max: 0},
-				ConnectURL: "",
-				ManageURL:  "",
-			}
-			if !s.CreatedAt.IsZero() {
-				ds.CreatedAt = s.CreatedAt.Format(time.RFC3339)
-			}
-			out = append(out, ds)
-		}
-		return out, nil
-	})
-
-	// Wire admin dashboard provider (aggregated metrics)
-	http.SetAdminDashboardProvider(func(ctx context.Context) (*http.AdminDashboardData, error) {
-		// Fetch data from database service
-		dataRaw, err := dbService.GetAdminDashboardData()
-		if err != nil {
-			return nil, err
-		}
-		// Map to http struct to avoid import cycle
-		data := &http.AdminDashboardData{
-			TotalServers:         dataRaw.TotalServers,
-			ActiveServers:        dataRaw.ActiveServers,
-			ServerUtilization:    dataRaw.ServerUtilization,
-			Servers:              make([]http.AdminServer, 0, len(dataRaw.Servers)),
-			TotalUsers:           dataRaw.TotalUsers,
-			PremiumUsers:         dataRaw.PremiumUsers,
-			PremiumPercentage:    dataRaw.PremiumPercentage,
-			TotalGuilds:          dataRaw.TotalGuilds,
-			TotalTreasuryBalance: dataRaw.TotalTreasuryBalance,
-			TopGuilds:            make([]http.AdminGuild, 0, len(dataRaw.TopGuilds)),
-			CreditsEarnedToday:   dataRaw.CreditsEarnedToday,
-			CPUUsage:             dataRaw.CPUUsage,
-			MemoryUsage:          dataRaw.MemoryUsage,
-			NetworkIO:            dataRaw.NetworkIO,
-			NetworkUtilization:   dataRaw.NetworkUtilization,
-			Version:              version.Version,
-		}
-		for _, s := range dataRaw.Servers {
-			data.Servers = append(data.Servers, http.AdminServer{
-				Name:            s.Name,
-				GameType:        s.GameType,
-				OwnerUsername:   s.OwnerUsername,
-				Status:          s.Status,
-				UptimeFormatted: s.UptimeFormatted,
-				CostPerHour:     s.CostPerHour,
-			})
-		}
-		for _, g := range dataRaw.TopGuilds {
-			data.TopGuilds = append(data.TopGuilds, http.AdminGuild{
-				GuildName:   g.GuildName,
-				Balance:     g.Balance,
-				MemberCount: g.MemberCount,
-			})
-		}
-		return data, nil
-	})
-
-	// Initialize event handlers for verified role protection
-	eventHandlers := bot.NewEventHandlers(loggingService, cfg.Roles.VerifiedRoleID, cfg.Discord.GuildID)
-
-	// Register event handlers (message-based)
-	session.AddHandler(commandHandler.HandleMessage)
-	session.AddHandler(ready)
-	session.AddHandler(eventHandlers.HandleGuildMemberUpdate)
-
-	// Register interaction handler
-	session.AddHandler(commandHandler.HandleInteraction)
-
-	// Set bot intents - include message content, guild state, and guild members for role monitoring
-	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent | discordgo.IntentsGuilds | discordgo.IntentsGuildMembers
-
-	// Open connection
-	err = session.Open()
-	if err != nil {
-		log.Printf("⚠️ Failed to open Discord session: %v (continuing without Discord)", err)
-		// Continue without Discord for testing metrics
-	} else {
-		// Set Discord session for notification service
-		commandHandler.SetDiscordSession(session)
-
-		// Initialize role sync service after Discord connection (sync every 10 minutes)
-		if cfg.Roles.VerifiedRoleID != "" && cfg.Discord.GuildID != "" {
-			roleSyncService := services.NewRoleSyncService(dbService.DB(), session, cfg.Discord.GuildID, cfg.Roles.VerifiedRoleID, cfg.Roles.PremiumRoleID, 10*time.Minute)
-			go roleSyncService.Start()
+	if err := b.build(); err != nil {
+		if stopErr := a.Shutdown(); stopErr != nil {
+			log.Printf("Shutdown after failed startup: %v", stopErr)
 		}
-
-		defer func() {
-			if err := session.Close(); err != nil {
-				log.Printf("Error closing Discord session: %v", err)
-			}
-		}()
+		return err
 	}
 
 	log.Println("🤖 Agis bot is running! Press Ctrl+C to exit.")
-
-	// Wait for interrupt signal
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	<-stop
-
-	log.Println("🛑 Agis bot shutting down...")
-
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Stop scheduler
-	if schedulerService != nil {
-		schedulerService.Stop()
-		log.Println("✅ Scheduler service stopped")
+	if err := a.Run(context.Background()); err != nil {
+		return err
 	}
+	log.Println("🛑 Agis bot stopped")
+	return nil
+}
 
-	// Shutdown HTTP server
-	if err := httpServer.Stop(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+// envDuration reads a duration such as "5s", keeping def if unset or
+// invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s %q, using %s", key, v, def)
+		return def
 	}
+	return d
 }
 
 func ready(s *discordgo.Session, event *discordgo.Ready) {